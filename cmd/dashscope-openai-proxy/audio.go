@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+)
+
+// maxAudioSize caps transcription requests, the uploaded audio included.
+const maxAudioSize = 64 << 20
+
+// speechRequest is an OpenAI speech request.
+type speechRequest struct {
+	Model          string  `json:"model"`
+	Input          string  `json:"input"`
+	Voice          string  `json:"voice"`
+	ResponseFormat string  `json:"response_format"` // mp3 (default), wav or pcm
+	Speed          float64 `json:"speed"`
+}
+
+// speechContentTypes are the content types of the supported audio formats.
+var speechContentTypes = map[string]string{
+	dashscope.AudioFormatMP3: "audio/mpeg",
+	dashscope.AudioFormatWAV: "audio/wav",
+	dashscope.AudioFormatPCM: "audio/pcm",
+}
+
+// speech serves /v1/audio/speech with SpeechSynthesizer. A voice listed in
+// the configuration selects the model; otherwise the model is mapped.
+func (s *server) speech(w http.ResponseWriter, r *http.Request, c *call) error {
+	var req speechRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		return err
+	}
+	if req.Input == "" {
+		return badRequest("input is required")
+	}
+	format := req.ResponseFormat
+	if format == "" {
+		format = dashscope.AudioFormatMP3
+	}
+	contentType, ok := speechContentTypes[format]
+	if !ok {
+		return badRequest("unsupported response_format %q", format)
+	}
+
+	model, ok := s.cfg.Voices[req.Voice]
+	if !ok {
+		model = s.cfg.model(req.Model)
+	}
+	c.usage.Model = model
+
+	params := map[string]interface{}{"format": format}
+	if req.Speed > 0 {
+		params["rate"] = req.Speed
+	}
+	result, err := c.client.SpeechSynthesizer(model).Call(r.Context(), req.Input, nil, params)
+	if err != nil {
+		return err
+	}
+	if result.Usage != nil {
+		c.usage.Characters = result.Usage.Characters
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(result.AudioData)
+	return err
+}
+
+// transcriptionResult is an entry of the results of a transcription task.
+type transcriptionResult struct {
+	FileURL          string `json:"file_url"`
+	TranscriptionURL string `json:"transcription_url"`
+	SubtaskStatus    string `json:"subtask_status"`
+	Code             string `json:"code"`
+	Message          string `json:"message"`
+}
+
+// transcript is the document a transcription URL points to.
+type transcript struct {
+	Transcripts []struct {
+		Text string `json:"text"`
+	} `json:"transcripts"`
+}
+
+// transcriptions serves /v1/audio/transcriptions with Transcription.
+// DashScope fetches audio by URL, so the upload is served from /files under
+// a random token for the duration of the task.
+func (s *server) transcriptions(w http.ResponseWriter, r *http.Request, c *call) error {
+	if s.cfg.PublicURL == "" {
+		return &httpError{http.StatusNotImplemented, "transcription requires public_url in the proxy configuration"}
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxAudioSize)
+	if err := r.ParseMultipartForm(maxAudioSize); err != nil {
+		if tooLarge := errTooLarge(err); tooLarge != nil {
+			return tooLarge
+		}
+		return badRequest("invalid multipart form: %v", err)
+	}
+	format := r.FormValue("response_format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "text" {
+		return badRequest("unsupported response_format %q", format)
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		return badRequest("file is required")
+	}
+	defer file.Close()
+	audio, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	token := s.addFile(audio)
+	defer s.removeFile(token)
+
+	model := s.cfg.model(r.FormValue("model"))
+	c.usage.Model = model
+	resp, err := c.client.Transcription().Call(r.Context(), dashscope.TranscriptionRequest{
+		Model: model,
+		Input: dashscope.TranscriptionInput{
+			FileURLs: []string{strings.TrimRight(s.cfg.PublicURL, "/") + "/files/" + token},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	var consumed struct {
+		Duration int `json:"duration"`
+	}
+	json.Unmarshal(resp.Usage, &consumed)
+	c.usage.AudioSeconds = consumed.Duration
+
+	text, err := s.fetchTranscript(r.Context(), resp.Output.Results)
+	if err != nil {
+		return err
+	}
+	if format == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, err := io.WriteString(w, text)
+		return err
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"text": text})
+	return nil
+}
+
+// fetchTranscript downloads the transcript of the single file of a
+// transcription task and joins the text of its channels.
+func (s *server) fetchTranscript(ctx context.Context, results json.RawMessage) (string, error) {
+	var entries []transcriptionResult
+	if err := json.Unmarshal(results, &entries); err != nil || len(entries) == 0 {
+		return "", fmt.Errorf("unexpected transcription results: %s", results)
+	}
+	result := entries[0]
+	if result.SubtaskStatus != dashscope.TaskStatusSucceeded {
+		return "", &dashscope.APIError{Code: result.Code, Message: result.Message}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", result.TranscriptionURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := s.fetch.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch transcript: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch transcript: %s", resp.Status)
+	}
+
+	var doc transcript
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return "", fmt.Errorf("invalid transcript: %w", err)
+	}
+	texts := make([]string, len(doc.Transcripts))
+	for i, t := range doc.Transcripts {
+		texts[i] = t.Text
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// file serves uploaded audio to DashScope.
+func (s *server) file(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	audio, ok := s.files[r.PathValue("token")]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", http.DetectContentType(audio))
+	w.Write(audio)
+}
+
+func (s *server) addFile(audio []byte) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[token] = audio
+	return token
+}
+
+func (s *server) removeFile(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.files, token)
+}
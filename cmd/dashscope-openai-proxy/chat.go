@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+)
+
+// chatRequest is a chat completion request whose message contents may also
+// be arrays of content parts, as OpenAI clients send them.
+type chatRequest struct {
+	dashscope.ChatCompletionRequest
+	Messages []chatMessage `json:"messages"`
+}
+
+type chatMessage struct {
+	dashscope.Message
+	Content messageContent `json:"content"`
+}
+
+// messageContent is the text of a message, decoded from a string, null or
+// an array of text parts, whose texts are joined by newlines.
+type messageContent string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (c *messageContent) UnmarshalJSON(data []byte) error {
+	var text *string
+	if err := json.Unmarshal(data, &text); err == nil {
+		if text != nil {
+			*c = messageContent(*text)
+		}
+		return nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return fmt.Errorf("message content must be a string or an array of content parts")
+	}
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.Type != "text" {
+			return fmt.Errorf("unsupported content part type %q", part.Type)
+		}
+		texts = append(texts, part.Text)
+	}
+	*c = messageContent(strings.Join(texts, "\n"))
+	return nil
+}
+
+// completionRequest returns the request with flattened message contents.
+func (r *chatRequest) completionRequest() dashscope.ChatCompletionRequest {
+	req := r.ChatCompletionRequest
+	req.Messages = make([]dashscope.Message, len(r.Messages))
+	for i, msg := range r.Messages {
+		req.Messages[i] = msg.Message
+		req.Messages[i].Content = string(msg.Content)
+	}
+	return req
+}
+
+// chatCompletions serves /v1/chat/completions with Generation. Replies
+// carry the model name the client asked for.
+func (s *server) chatCompletions(w http.ResponseWriter, r *http.Request, c *call) error {
+	var body chatRequest
+	if err := decodeJSON(w, r, &body); err != nil {
+		return err
+	}
+	req := body.completionRequest()
+	native := req.ToGeneration()
+	native.Model = s.cfg.model(req.Model)
+	c.usage.Model = native.Model
+
+	gen := c.client.Generation()
+	if req.Stream {
+		return s.streamChatCompletion(w, r, c, gen, req, native)
+	}
+
+	resp, err := gen.Call(r.Context(), native)
+	if err != nil {
+		return err
+	}
+	c.usage.InputTokens, c.usage.OutputTokens = resp.Usage.InputTokens, resp.Usage.OutputTokens
+	writeJSON(w, http.StatusOK, dashscope.NewChatCompletion(resp, req.Model))
+	return nil
+}
+
+// streamChatCompletion relays an incremental generation stream as server-sent
+// chat completion chunks. Native chunks carry the usage so far, which is
+// sent once at the end when the client asks for it.
+func (s *server) streamChatCompletion(w http.ResponseWriter, r *http.Request, c *call, gen *dashscope.Generation, req dashscope.ChatCompletionRequest, native dashscope.GenerationRequest) error {
+	stream, err := gen.Stream(r.Context(), native)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	var last dashscope.GenerationUsage
+	for stream.Next() {
+		chunk := *stream.Current()
+		if chunk.Usage != (dashscope.GenerationUsage{}) {
+			last = chunk.Usage
+		}
+		chunk.Usage = dashscope.GenerationUsage{}
+		out := dashscope.NewChatCompletionChunk(&chunk, req.Model)
+		if len(out.Choices) == 0 {
+			continue
+		}
+		if err := writeEvent(w, out); err != nil {
+			return err
+		}
+	}
+	c.usage.InputTokens, c.usage.OutputTokens = last.InputTokens, last.OutputTokens
+
+	if err := stream.Err(); err != nil {
+		_, body := newOpenAIError(err)
+		writeEvent(w, body)
+		return err
+	}
+	if req.StreamOptions != nil && req.StreamOptions.IncludeUsage {
+		final := dashscope.GenerationResponse{Usage: last}
+		if err := writeEvent(w, dashscope.NewChatCompletionChunk(&final, req.Model)); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprint(w, "data: [DONE]\n\n")
+	flush(w)
+	return err
+}
+
+// writeEvent writes v as a server-sent event and flushes it to the client.
+func writeEvent(w http.ResponseWriter, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+		return err
+	}
+	flush(w)
+	return nil
+}
+
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Config is the proxy configuration, read from a JSON file.
+//
+//	{
+//		"keys": {
+//			"sk-team-a": {"name": "team-a", "api_key": "sk-..."},
+//			"sk-team-b": {"name": "team-b", "workspace": "llm-..."}
+//		},
+//		"models": {
+//			"gpt-4o": "qwen-max",
+//			"text-embedding-3-small": "text-embedding-v3",
+//			"whisper-1": "paraformer-v2"
+//		},
+//		"voices": {"alloy": "sambert-zhichu-v1"},
+//		"public_url": "https://proxy.example.com"
+//	}
+type Config struct {
+	// Keys maps the API keys clients present to DashScope credentials. With
+	// no keys, clients must present a DashScope API key, which is forwarded.
+	Keys map[string]Key `json:"keys"`
+	// Models maps OpenAI model names to DashScope models. Unknown names are
+	// passed through.
+	Models map[string]string `json:"models"`
+	// Voices maps OpenAI voices to DashScope speech synthesis models, which
+	// take precedence over the model of a speech request.
+	Voices map[string]string `json:"voices"`
+	// PublicURL is the address DashScope reaches the proxy at. Transcription
+	// reads uploaded audio from there, so it is disabled without one.
+	PublicURL string `json:"public_url"`
+}
+
+// Key is the DashScope credentials a client key maps to. An empty APIKey
+// uses the proxy's own key, from DASHSCOPE_API_KEY.
+type Key struct {
+	Name      string `json:"name"` // Reported in the usage log instead of the key
+	APIKey    string `json:"api_key"`
+	Workspace string `json:"workspace"`
+}
+
+func loadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// model returns the DashScope model for an OpenAI model name.
+func (c *Config) model(name string) string {
+	if m, ok := c.Models[name]; ok {
+		return m
+	}
+	return name
+}
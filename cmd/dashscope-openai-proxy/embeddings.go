@@ -0,0 +1,29 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+)
+
+// embeddings serves /v1/embeddings with TextEmbedding.
+func (s *server) embeddings(w http.ResponseWriter, r *http.Request, c *call) error {
+	var req dashscope.EmbeddingRequest
+	if err := decodeJSON(w, r, &req); err != nil {
+		return err
+	}
+	if req.EncodingFormat != "" && req.EncodingFormat != "float" {
+		return badRequest("unsupported encoding_format %q", req.EncodingFormat)
+	}
+	native := req.ToTextEmbedding()
+	native.Model = s.cfg.model(req.Model)
+	c.usage.Model = native.Model
+
+	resp, err := c.client.Embeddings().Call(r.Context(), native)
+	if err != nil {
+		return err
+	}
+	c.usage.InputTokens = resp.Usage.TotalTokens
+	writeJSON(w, http.StatusOK, dashscope.NewEmbeddingResponse(resp, req.Model))
+	return nil
+}
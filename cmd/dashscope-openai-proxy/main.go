@@ -0,0 +1,48 @@
+// Command dashscope-openai-proxy serves the OpenAI API on top of DashScope,
+// for tools that only speak OpenAI. It translates
+//
+//	POST /v1/chat/completions      to Generation, including streaming
+//	POST /v1/embeddings            to TextEmbedding
+//	POST /v1/audio/speech          to SpeechSynthesizer
+//	POST /v1/audio/transcriptions  to Transcription
+//
+// Usage:
+//
+//	dashscope-openai-proxy -addr :8080 -config proxy.json -usage-log usage.jsonl
+//
+// See Config for the configuration file. Every request is recorded as a
+// JSON line in the usage log.
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"os"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "listen address")
+	configPath := flag.String("config", "", "configuration file")
+	usagePath := flag.String("usage-log", "-", `usage log file, "-" for stdout`)
+	flag.Parse()
+
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var usage io.Writer = os.Stdout
+	if *usagePath != "-" {
+		f, err := os.OpenFile(*usagePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		usage = f
+	}
+
+	log.Printf("listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, newServer(cfg, usage)))
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+)
+
+// maxBodySize caps JSON request bodies.
+const maxBodySize = 8 << 20
+
+// transcriptTimeout bounds the download of a transcript.
+const transcriptTimeout = 30 * time.Second
+
+// server translates OpenAI API requests onto the DashScope SDK.
+type server struct {
+	cfg     *Config
+	mux     *http.ServeMux
+	opts    []dashscope.ClientOption     // Applied to every DashScope client
+	clients map[string]*dashscope.Client // By client key
+	usage   *usageLog
+	fetch   *http.Client // Downloads transcripts
+
+	mu    sync.Mutex
+	files map[string][]byte // Uploaded audio served to Transcription, by token
+}
+
+// newServer returns a proxy for cfg logging usage to usage. opts configure
+// the DashScope clients, after the proxy's own options.
+func newServer(cfg *Config, usage io.Writer, opts ...dashscope.ClientOption) *server {
+	s := &server{
+		cfg:     cfg,
+		mux:     http.NewServeMux(),
+		opts:    opts,
+		clients: make(map[string]*dashscope.Client),
+		usage:   newUsageLog(usage),
+		fetch:   &http.Client{Timeout: transcriptTimeout},
+		files:   make(map[string][]byte),
+	}
+	for clientKey, key := range cfg.Keys {
+		s.clients[clientKey] = s.newClient(key.APIKey, key.Workspace)
+	}
+
+	s.mux.HandleFunc("POST /v1/chat/completions", s.handle("chat.completions", s.chatCompletions))
+	s.mux.HandleFunc("POST /v1/embeddings", s.handle("embeddings", s.embeddings))
+	s.mux.HandleFunc("POST /v1/audio/speech", s.handle("audio.speech", s.speech))
+	s.mux.HandleFunc("POST /v1/audio/transcriptions", s.handle("audio.transcriptions", s.transcriptions))
+	s.mux.HandleFunc("GET /files/{token}", s.file)
+	return s
+}
+
+func (s *server) newClient(apiKey, workspace string) *dashscope.Client {
+	return dashscope.NewClient(append([]dashscope.ClientOption{
+		dashscope.WithAPIKey(apiKey),
+		dashscope.WithWorkspace(workspace),
+		dashscope.WithRetryPolicy(dashscope.DefaultRetryPolicy()),
+	}, s.opts...)...)
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// call is a request being served: the DashScope client of the caller and
+// the usage recorded for it.
+type call struct {
+	client *dashscope.Client
+	usage  usage
+}
+
+type handlerFunc func(w http.ResponseWriter, r *http.Request, c *call) error
+
+// handle authenticates requests to endpoint, reports failures in the OpenAI
+// error format and records the usage of every request.
+func (s *server) handle(endpoint string, h handlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+		c := &call{usage: usage{Endpoint: endpoint}}
+
+		client, name, err := s.authenticate(r)
+		c.usage.Key = name
+		if err == nil {
+			c.client = client
+			err = h(rec, r, c)
+		}
+		// Streams report failures in the stream once it has started.
+		if err != nil && !rec.written {
+			writeError(rec, err)
+		}
+		c.usage.Status = rec.status
+		s.usage.record(r.Context(), c.usage, time.Since(start), err)
+	}
+}
+
+// authenticate returns the DashScope client for the key a request presents,
+// and the name the key is logged under.
+func (s *server) authenticate(r *http.Request) (*dashscope.Client, string, error) {
+	clientKey, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || clientKey == "" {
+		return nil, "", &httpError{http.StatusUnauthorized, "missing API key"}
+	}
+	if len(s.cfg.Keys) == 0 {
+		return s.newClient(clientKey, ""), maskKey(clientKey), nil
+	}
+	client, ok := s.clients[clientKey]
+	if !ok {
+		return nil, maskKey(clientKey), &httpError{http.StatusUnauthorized, "invalid API key"}
+	}
+	return client, s.cfg.Keys[clientKey].Name, nil
+}
+
+// maskKey shortens a key to its last four characters for logging.
+func maskKey(key string) string {
+	if len(key) <= 4 {
+		return "..."
+	}
+	return "..." + key[len(key)-4:]
+}
+
+// httpError is a failure of the proxy itself, such as a malformed request.
+type httpError struct {
+	status  int
+	message string
+}
+
+func (e *httpError) Error() string {
+	return e.message
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &httpError{http.StatusBadRequest, fmt.Sprintf(format, args...)}
+}
+
+// openAIError is the OpenAI error envelope.
+type openAIError struct {
+	Error struct {
+		Message string  `json:"message"`
+		Type    string  `json:"type"`
+		Code    *string `json:"code"`
+	} `json:"error"`
+}
+
+// newOpenAIError describes err in the OpenAI format along with the HTTP
+// status to report it with. DashScope errors keep their status and code.
+func newOpenAIError(err error) (int, *openAIError) {
+	status := http.StatusInternalServerError
+	var body openAIError
+	body.Error.Message = err.Error()
+
+	var httpErr *httpError
+	var apiErr *dashscope.APIError
+	switch {
+	case errors.As(err, &httpErr):
+		status = httpErr.status
+	case errors.As(err, &apiErr):
+		status = apiErr.StatusCode
+		if status == 0 {
+			// Task and websocket failures carry no HTTP status.
+			status = http.StatusBadGateway
+			if apiErr.IsInvalidParameter() {
+				status = http.StatusBadRequest
+			}
+		}
+		body.Error.Message = apiErr.Message
+		if apiErr.Code != "" {
+			body.Error.Code = &apiErr.Code
+		}
+	}
+
+	switch {
+	case status == http.StatusUnauthorized:
+		body.Error.Type = "authentication_error"
+	case status == http.StatusTooManyRequests:
+		body.Error.Type = "rate_limit_error"
+	case status < 500:
+		body.Error.Type = "invalid_request_error"
+	default:
+		body.Error.Type = "api_error"
+	}
+	return status, &body
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status, body := newOpenAIError(err)
+	writeJSON(w, status, body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// decodeJSON decodes a JSON request body of up to maxBodySize bytes into v.
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	body := http.MaxBytesReader(w, r.Body, maxBodySize)
+	if err := json.NewDecoder(body).Decode(v); err != nil {
+		if tooLarge := errTooLarge(err); tooLarge != nil {
+			return tooLarge
+		}
+		return badRequest("invalid request body: %v", err)
+	}
+	return nil
+}
+
+// errTooLarge returns the 413 error to send when err reports a request body
+// over its http.MaxBytesReader limit, and nil otherwise.
+func errTooLarge(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return &httpError{http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit)}
+	}
+	return nil
+}
+
+// responseRecorder remembers the status of a response and whether it has
+// been started.
+type responseRecorder struct {
+	http.ResponseWriter
+	status  int
+	written bool
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.written {
+		r.status, r.written = status, true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if !r.written {
+		r.WriteHeader(http.StatusOK)
+	}
+	return r.ResponseWriter.Write(p)
+}
+
+func (r *responseRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
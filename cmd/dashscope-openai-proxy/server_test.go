@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+	"github.com/ceoifung/go-dashscope/dashscope/dashscopetest"
+)
+
+// newTestProxy returns a proxy forwarding to a fake DashScope, which is
+// reached with the key the fake expects.
+func newTestProxy(t *testing.T, cfg *Config) (*httptest.Server, *dashscopetest.Server) {
+	t.Helper()
+	fake := dashscopetest.NewServer()
+	t.Cleanup(fake.Close)
+	policy := dashscope.DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	policy.MaxBackoff = time.Millisecond
+	s := newServer(cfg, io.Discard,
+		dashscope.WithBaseURL(fake.URL),
+		dashscope.WithWebsocketURL(fake.WebsocketURL),
+		dashscope.WithRetryPolicy(policy))
+	proxy := httptest.NewServer(s)
+	t.Cleanup(proxy.Close)
+	return proxy, fake
+}
+
+func post(t *testing.T, url, key, body string) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest("POST", url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp, string(data)
+}
+
+func TestChatCompletions(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		noKey       bool
+		responses   []dashscopetest.Response
+		wantStatus  int
+		wantContent string // Content of the last message sent to DashScope
+		wantCode    string // OpenAI error code
+	}{
+		{
+			name:        "string content",
+			body:        `{"model":"gpt-4o","messages":[{"role":"user","content":"Hi"}]}`,
+			wantStatus:  http.StatusOK,
+			wantContent: "Hi",
+		},
+		{
+			name:        "content parts",
+			body:        `{"model":"gpt-4o","messages":[{"role":"user","content":[{"type":"text","text":"Hello"},{"type":"text","text":"world"}]}]}`,
+			wantStatus:  http.StatusOK,
+			wantContent: "Hello\nworld",
+		},
+		{
+			name:        "null content",
+			body:        `{"model":"gpt-4o","messages":[{"role":"user","content":"Hi"},{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"f","arguments":"{}"}}]},{"role":"tool","tool_call_id":"call_1","content":"done"}]}`,
+			wantStatus:  http.StatusOK,
+			wantContent: "done",
+		},
+		{
+			name:       "image part",
+			body:       `{"model":"gpt-4o","messages":[{"role":"user","content":[{"type":"image_url","image_url":{"url":"https://example.com/a.png"}}]}]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "malformed",
+			body:       `{"model":`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "too large",
+			body:       `{"model":"gpt-4o","messages":[{"role":"user","content":"` + strings.Repeat("x", maxBodySize) + `"}]}`,
+			wantStatus: http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:       "missing key",
+			body:       `{"model":"gpt-4o","messages":[{"role":"user","content":"Hi"}]}`,
+			noKey:      true,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "dashscope error",
+			body:       `{"model":"gpt-4o","messages":[{"role":"user","content":"Hi"}]}`,
+			responses:  []dashscopetest.Response{dashscopetest.Fail(http.StatusBadRequest, dashscope.ErrCodeInvalidParameter, "bad input")},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   dashscope.ErrCodeInvalidParameter,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy, fake := newTestProxy(t, &Config{Models: map[string]string{"gpt-4o": dashscope.QwenMax}})
+			fake.Enqueue(dashscope.ServiceGeneration, tt.responses...)
+			key := fake.APIKey
+			if tt.noKey {
+				key = ""
+			}
+
+			resp, body := post(t, proxy.URL+"/v1/chat/completions", key, tt.body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				var e openAIError
+				if err := json.Unmarshal([]byte(body), &e); err != nil || e.Error.Message == "" {
+					t.Errorf("body = %s, want an OpenAI error", body)
+				}
+				if tt.wantCode != "" && (e.Error.Code == nil || *e.Error.Code != tt.wantCode) {
+					t.Errorf("error code = %v, want %s", e.Error.Code, tt.wantCode)
+				}
+				return
+			}
+
+			var completion dashscope.ChatCompletion
+			if err := json.Unmarshal([]byte(body), &completion); err != nil {
+				t.Fatal(err)
+			}
+			if completion.Model != "gpt-4o" || completion.Choices[0].Message.Content != fake.Reply {
+				t.Errorf("completion = %+v, want the reply under the requested model", completion)
+			}
+
+			var sent dashscope.GenerationRequest
+			requests := fake.RequestsFor(dashscope.ServiceGeneration)
+			if err := requests[len(requests)-1].Decode(&sent); err != nil {
+				t.Fatal(err)
+			}
+			if sent.Model != dashscope.QwenMax {
+				t.Errorf("model = %q, want %q", sent.Model, dashscope.QwenMax)
+			}
+			messages := sent.Input.Messages
+			if got := messages[len(messages)-1].Content; got != tt.wantContent {
+				t.Errorf("content = %q, want %q", got, tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestChatCompletionsStream(t *testing.T) {
+	proxy, fake := newTestProxy(t, &Config{})
+	resp, body := post(t, proxy.URL+"/v1/chat/completions", fake.APIKey,
+		`{"model":"qwen-turbo","stream":true,"stream_options":{"include_usage":true},"messages":[{"role":"user","content":[{"type":"text","text":"Hi"}]}]}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d: %s", resp.StatusCode, body)
+	}
+
+	var text strings.Builder
+	var usage *dashscope.CompletionUsage
+	events := strings.Split(strings.TrimSpace(body), "\n\n")
+	for _, event := range events[:len(events)-1] {
+		var chunk dashscope.ChatCompletionChunk
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(event, "data: ")), &chunk); err != nil {
+			t.Fatalf("event %q: %v", event, err)
+		}
+		for _, choice := range chunk.Choices {
+			text.WriteString(choice.Delta.Content)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+	}
+	if last := events[len(events)-1]; last != "data: [DONE]" {
+		t.Errorf("last event = %q, want [DONE]", last)
+	}
+	if text.String() != fake.Reply {
+		t.Errorf("text = %q, want %q", text.String(), fake.Reply)
+	}
+	if usage == nil || usage.CompletionTokens == 0 {
+		t.Errorf("usage = %+v, want the final usage", usage)
+	}
+}
+
+func TestEmbeddings(t *testing.T) {
+	proxy, fake := newTestProxy(t, &Config{})
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantCount  int
+	}{
+		{"string input", `{"model":"text-embedding-v3","input":"hello"}`, http.StatusOK, 1},
+		{"array input", `{"model":"text-embedding-v3","input":["a","b"]}`, http.StatusOK, 2},
+		{"base64", `{"model":"text-embedding-v3","input":"hello","encoding_format":"base64"}`, http.StatusBadRequest, 0},
+		{"invalid input", `{"model":"text-embedding-v3","input":[1]}`, http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := post(t, proxy.URL+"/v1/embeddings", fake.APIKey, tt.body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var out dashscope.EmbeddingResponse
+			if err := json.Unmarshal([]byte(body), &out); err != nil {
+				t.Fatal(err)
+			}
+			if len(out.Data) != tt.wantCount || out.Model != "text-embedding-v3" {
+				t.Errorf("response = %+v, want %d embeddings", out, tt.wantCount)
+			}
+		})
+	}
+}
+
+// audioForm streams a transcription form uploading size bytes of audio.
+func audioForm(fields map[string]string, size int64) (io.Reader, string) {
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	go func() {
+		for name, value := range fields {
+			form.WriteField(name, value)
+		}
+		if size >= 0 {
+			part, err := form.CreateFormFile("file", "audio.wav")
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			if _, err := io.CopyN(part, zeros{}, size); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.CloseWithError(form.Close())
+	}()
+	return pr, form.FormDataContentType()
+}
+
+// zeros reads as an endless run of zero bytes.
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestTranscriptions(t *testing.T) {
+	tests := []struct {
+		name       string
+		noPublic   bool
+		fields     map[string]string
+		size       int64 // Of the audio; negative sends no file
+		wantStatus int
+	}{
+		{name: "json", size: 3200, wantStatus: http.StatusOK},
+		{name: "text", fields: map[string]string{"response_format": "text"}, size: 3200, wantStatus: http.StatusOK},
+		{name: "unsupported format", fields: map[string]string{"response_format": "srt"}, size: 3200, wantStatus: http.StatusBadRequest},
+		{name: "missing file", size: -1, wantStatus: http.StatusBadRequest},
+		{name: "too large", size: maxAudioSize + 1, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "no public URL", noPublic: true, size: 3200, wantStatus: http.StatusNotImplemented},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{}
+			proxy, fake := newTestProxy(t, cfg)
+			if !tt.noPublic {
+				cfg.PublicURL = proxy.URL
+			}
+
+			body, contentType := audioForm(tt.fields, tt.size)
+			req, err := http.NewRequest("POST", proxy.URL+"/v1/audio/transcriptions", body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+fake.APIKey)
+			req.Header.Set("Content-Type", contentType)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			data, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantStatus, data)
+			}
+			if tt.wantStatus == http.StatusOK && !strings.Contains(string(data), fake.Transcript) {
+				t.Errorf("body = %s, want the transcript %q", data, fake.Transcript)
+			}
+			if tt.wantStatus != http.StatusOK && len(fake.RequestsFor(dashscope.ServiceTranscription)) != 0 {
+				t.Error("a failed upload reached DashScope")
+			}
+		})
+	}
+}
+
+func TestFetchTranscript(t *testing.T) {
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok.json":
+			io.WriteString(w, `{"transcripts":[{"text":"left"},{"text":"right"}]}`)
+		case "/slow.json":
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer files.Close()
+
+	result := func(status, path string) json.RawMessage {
+		data, _ := json.Marshal([]transcriptionResult{{
+			SubtaskStatus:    status,
+			TranscriptionURL: files.URL + path,
+			Code:             "InvalidFile.DownloadFailed",
+			Message:          "download failed",
+		}})
+		return data
+	}
+	tests := []struct {
+		name    string
+		results json.RawMessage
+		want    string
+		wantErr bool
+	}{
+		{"channels", result(dashscope.TaskStatusSucceeded, "/ok.json"), "left\nright", false},
+		{"failed subtask", result(dashscope.TaskStatusFailed, "/ok.json"), "", true},
+		{"missing transcript", result(dashscope.TaskStatusSucceeded, "/missing.json"), "", true},
+		{"timeout", result(dashscope.TaskStatusSucceeded, "/slow.json"), "", true},
+		{"no results", json.RawMessage(`[]`), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(&Config{}, io.Discard)
+			s.fetch.Timeout = 50 * time.Millisecond
+			got, err := s.fetchTranscript(context.Background(), tt.results)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("fetchTranscript = %q, %v, want %q, error %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewOpenAIError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantType   string
+		wantCode   string
+	}{
+		{"proxy error", badRequest("input is required"), http.StatusBadRequest, "invalid_request_error", ""},
+		{"unauthorized", &httpError{http.StatusUnauthorized, "missing API key"}, http.StatusUnauthorized, "authentication_error", ""},
+		{"throttled", &dashscope.APIError{StatusCode: http.StatusTooManyRequests, Code: dashscope.ErrCodeThrottling}, http.StatusTooManyRequests, "rate_limit_error", dashscope.ErrCodeThrottling},
+		{"task failure", &dashscope.APIError{Code: "InternalError"}, http.StatusBadGateway, "api_error", "InternalError"},
+		{"invalid task", &dashscope.APIError{Code: dashscope.ErrCodeInvalidParameter}, http.StatusBadRequest, "invalid_request_error", dashscope.ErrCodeInvalidParameter},
+		{"other", errors.New("boom"), http.StatusInternalServerError, "api_error", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := newOpenAIError(tt.err)
+			if status != tt.wantStatus || body.Error.Type != tt.wantType {
+				t.Errorf("newOpenAIError = %d %s, want %d %s", status, body.Error.Type, tt.wantStatus, tt.wantType)
+			}
+			var code string
+			if body.Error.Code != nil {
+				code = *body.Error.Code
+			}
+			if code != tt.wantCode {
+				t.Errorf("code = %q, want %q", code, tt.wantCode)
+			}
+		})
+	}
+}
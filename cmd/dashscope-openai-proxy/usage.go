@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// usage is what a request consumed, as recorded in the usage log.
+type usage struct {
+	Key          string // Name of the client key
+	Endpoint     string
+	Model        string // DashScope model
+	Status       int
+	InputTokens  int
+	OutputTokens int
+	Characters   int // Synthesized characters
+	AudioSeconds int // Transcribed audio
+}
+
+// usageLog writes one JSON line per request.
+type usageLog struct {
+	logger *slog.Logger
+}
+
+func newUsageLog(w io.Writer) *usageLog {
+	return &usageLog{logger: slog.New(slog.NewJSONHandler(w, nil))}
+}
+
+func (l *usageLog) record(ctx context.Context, u usage, duration time.Duration, err error) {
+	attrs := []slog.Attr{
+		slog.String("key", u.Key),
+		slog.String("endpoint", u.Endpoint),
+		slog.Int("status", u.Status),
+		slog.Duration("duration", duration),
+	}
+	if u.Model != "" {
+		attrs = append(attrs, slog.String("model", u.Model))
+	}
+	if u.InputTokens+u.OutputTokens > 0 {
+		attrs = append(attrs, slog.Int("input_tokens", u.InputTokens), slog.Int("output_tokens", u.OutputTokens))
+	}
+	if u.Characters > 0 {
+		attrs = append(attrs, slog.Int("characters", u.Characters))
+	}
+	if u.AudioSeconds > 0 {
+		attrs = append(attrs, slog.Int("audio_seconds", u.AudioSeconds))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	l.logger.LogAttrs(ctx, slog.LevelInfo, "usage", attrs...)
+}
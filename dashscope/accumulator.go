@@ -0,0 +1,183 @@
+package dashscope
+
+// GenerationAccumulator assembles streamed generation chunks into a complete
+// response. With incremental output each chunk carries a delta, which is
+// appended; otherwise each chunk repeats the output so far, which replaces
+// what was accumulated.
+//
+//	acc := dashscope.NewGenerationAccumulator(req)
+//	for stream.Next() {
+//		acc.Add(stream.Current())
+//	}
+//	resp := acc.Response()
+type GenerationAccumulator struct {
+	incremental bool
+	resp        GenerationResponse
+}
+
+// NewGenerationAccumulator returns an accumulator for the stream of req.
+func NewGenerationAccumulator(req GenerationRequest) *GenerationAccumulator {
+	return &GenerationAccumulator{
+		incremental: req.Parameters != nil && req.Parameters.IncrementalOutput,
+	}
+}
+
+// Add merges a chunk into the response.
+func (a *GenerationAccumulator) Add(chunk *GenerationResponse) {
+	if chunk.RequestID != "" {
+		a.resp.RequestID = chunk.RequestID
+	}
+	if chunk.StatusCode != 0 {
+		a.resp.StatusCode = chunk.StatusCode
+	}
+	if chunk.Usage != (GenerationUsage{}) {
+		a.resp.Usage = chunk.Usage
+	}
+
+	out := &a.resp.Output
+	mergeText(&out.Text, chunk.Output.Text, a.incremental)
+	mergeFinishReason(&out.FinishReason, chunk.Output.FinishReason)
+
+	for i, c := range chunk.Output.Choices {
+		if i == len(out.Choices) {
+			out.Choices = append(out.Choices, Choice{})
+		}
+		choice := &out.Choices[i]
+		mergeFinishReason(&choice.FinishReason, c.FinishReason)
+		msg := &choice.Message
+		if c.Message.Role != "" {
+			msg.Role = c.Message.Role
+		}
+		mergeText(&msg.Content, c.Message.Content, a.incremental)
+		mergeText(&msg.ReasoningContent, c.Message.ReasoningContent, a.incremental)
+		msg.ToolCalls = mergeToolCalls(msg.ToolCalls, c.Message.ToolCalls, a.incremental)
+	}
+}
+
+// Response returns the response assembled so far.
+func (a *GenerationAccumulator) Response() *GenerationResponse {
+	resp := a.resp
+	resp.Output.Choices = append([]Choice(nil), a.resp.Output.Choices...)
+	for i := range resp.Output.Choices {
+		msg := &resp.Output.Choices[i].Message
+		msg.ToolCalls = append([]ToolCall(nil), msg.ToolCalls...)
+	}
+	return &resp
+}
+
+// MultiModalAccumulator assembles streamed multimodal conversation chunks
+// into a complete response, like GenerationAccumulator.
+type MultiModalAccumulator struct {
+	incremental bool
+	resp        MultiModalConversationResponse
+}
+
+// NewMultiModalAccumulator returns an accumulator for the stream of req.
+func NewMultiModalAccumulator(req MultiModalConversationRequest) *MultiModalAccumulator {
+	return &MultiModalAccumulator{
+		incremental: req.Parameters != nil && req.Parameters.IncrementalOutput,
+	}
+}
+
+// Add merges a chunk into the response.
+func (a *MultiModalAccumulator) Add(chunk *MultiModalConversationResponse) {
+	if chunk.RequestID != "" {
+		a.resp.RequestID = chunk.RequestID
+	}
+	if chunk.StatusCode != 0 {
+		a.resp.StatusCode = chunk.StatusCode
+	}
+	if chunk.Usage != (MultiModalUsage{}) {
+		a.resp.Usage = chunk.Usage
+	}
+
+	out := &a.resp.Output
+	for i, c := range chunk.Output.Choices {
+		if i == len(out.Choices) {
+			out.Choices = append(out.Choices, MultiModalChoice{})
+		}
+		choice := &out.Choices[i]
+		mergeFinishReason(&choice.FinishReason, c.FinishReason)
+		msg := &choice.Message
+		if c.Message.Role != "" {
+			msg.Role = c.Message.Role
+		}
+		mergeText(&msg.ReasoningContent, c.Message.ReasoningContent, a.incremental)
+
+		if !a.incremental {
+			if len(c.Message.Content) > 0 {
+				msg.Content = append([]MultiModalContentItem(nil), c.Message.Content...)
+			}
+			continue
+		}
+		for j, item := range c.Message.Content {
+			if j == len(msg.Content) {
+				msg.Content = append(msg.Content, MultiModalContentItem{})
+			}
+			msg.Content[j].Text += item.Text
+			if item.Image != "" {
+				msg.Content[j].Image = item.Image
+			}
+		}
+	}
+}
+
+// Response returns the response assembled so far.
+func (a *MultiModalAccumulator) Response() *MultiModalConversationResponse {
+	resp := a.resp
+	resp.Output.Choices = append([]MultiModalChoice(nil), a.resp.Output.Choices...)
+	for i := range resp.Output.Choices {
+		msg := &resp.Output.Choices[i].Message
+		msg.Content = append([]MultiModalContentItem(nil), msg.Content...)
+	}
+	return &resp
+}
+
+func mergeText(acc *string, chunk string, incremental bool) {
+	if incremental {
+		*acc += chunk
+	} else if chunk != "" {
+		*acc = chunk
+	}
+}
+
+// mergeFinishReason keeps the last finish reason. DashScope sends "null"
+// until the output is complete.
+func mergeFinishReason(acc *string, chunk string) {
+	if chunk != "" && chunk != "null" {
+		*acc = chunk
+	}
+}
+
+// mergeToolCalls merges streamed tool calls. Incremental fragments are
+// matched by index and their arguments concatenated.
+func mergeToolCalls(acc, chunk []ToolCall, incremental bool) []ToolCall {
+	if !incremental {
+		if len(chunk) == 0 {
+			return acc
+		}
+		return append([]ToolCall(nil), chunk...)
+	}
+
+	for _, fragment := range chunk {
+		i := 0
+		for i < len(acc) && acc[i].Index != fragment.Index {
+			i++
+		}
+		if i == len(acc) {
+			acc = append(acc, ToolCall{Index: fragment.Index})
+		}
+		call := &acc[i]
+		if fragment.ID != "" {
+			call.ID = fragment.ID
+		}
+		if fragment.Type != "" {
+			call.Type = fragment.Type
+		}
+		if fragment.Function.Name != "" {
+			call.Function.Name = fragment.Function.Name
+		}
+		call.Function.Arguments += fragment.Function.Arguments
+	}
+	return acc
+}
@@ -0,0 +1,227 @@
+package dashscope
+
+import (
+	"reflect"
+	"testing"
+)
+
+func messageChunk(msg Message, finish string, usage GenerationUsage) *GenerationResponse {
+	return &GenerationResponse{
+		RequestID:  "req-1",
+		StatusCode: 200,
+		Output:     GenerationOutput{Choices: []Choice{{FinishReason: finish, Message: msg}}},
+		Usage:      usage,
+	}
+}
+
+func TestGenerationAccumulator(t *testing.T) {
+	usage := func(out int) GenerationUsage {
+		return GenerationUsage{InputTokens: 5, OutputTokens: out, TotalTokens: 5 + out}
+	}
+
+	tests := []struct {
+		name        string
+		incremental bool
+		chunks      []*GenerationResponse
+		want        GenerationOutput
+		wantUsage   GenerationUsage
+	}{
+		{
+			name:        "incremental text",
+			incremental: true,
+			chunks: []*GenerationResponse{
+				{Output: GenerationOutput{Text: "Hel", FinishReason: "null"}, Usage: usage(1)},
+				{Output: GenerationOutput{Text: "lo", FinishReason: "stop"}, Usage: usage(2)},
+			},
+			want:      GenerationOutput{Text: "Hello", FinishReason: "stop"},
+			wantUsage: usage(2),
+		},
+		{
+			name: "cumulative text",
+			chunks: []*GenerationResponse{
+				{Output: GenerationOutput{Text: "Hel", FinishReason: "null"}, Usage: usage(1)},
+				{Output: GenerationOutput{Text: "Hello", FinishReason: "stop"}, Usage: usage(2)},
+			},
+			want:      GenerationOutput{Text: "Hello", FinishReason: "stop"},
+			wantUsage: usage(2),
+		},
+		{
+			name:        "usage only in some chunks",
+			incremental: true,
+			chunks: []*GenerationResponse{
+				{Output: GenerationOutput{Text: "a"}, Usage: usage(1)},
+				{Output: GenerationOutput{Text: "b", FinishReason: "stop"}},
+			},
+			want:      GenerationOutput{Text: "ab", FinishReason: "stop"},
+			wantUsage: usage(1),
+		},
+		{
+			name:        "incremental message with reasoning",
+			incremental: true,
+			chunks: []*GenerationResponse{
+				messageChunk(Message{Role: RoleAssistant, ReasoningContent: "Think"}, "null", usage(1)),
+				messageChunk(Message{ReasoningContent: "ing."}, "null", usage(2)),
+				messageChunk(Message{Content: "Hi"}, "null", usage(3)),
+				messageChunk(Message{Content: "!"}, "stop", usage(4)),
+			},
+			want: GenerationOutput{Choices: []Choice{{
+				FinishReason: "stop",
+				Message:      Message{Role: RoleAssistant, Content: "Hi!", ReasoningContent: "Thinking."},
+			}}},
+			wantUsage: usage(4),
+		},
+		{
+			name: "cumulative message",
+			chunks: []*GenerationResponse{
+				messageChunk(Message{Role: RoleAssistant, Content: "Hi"}, "null", usage(1)),
+				messageChunk(Message{Role: RoleAssistant, Content: "Hi there"}, "stop", usage(2)),
+			},
+			want: GenerationOutput{Choices: []Choice{{
+				FinishReason: "stop",
+				Message:      Message{Role: RoleAssistant, Content: "Hi there"},
+			}}},
+			wantUsage: usage(2),
+		},
+		{
+			name:        "incremental tool call fragments",
+			incremental: true,
+			chunks: []*GenerationResponse{
+				messageChunk(Message{Role: RoleAssistant, ToolCalls: []ToolCall{
+					{Index: 0, ID: "call_1", Type: "function", Function: FunctionCall{Name: "get_weather", Arguments: `{"ci`}},
+				}}, "null", usage(1)),
+				messageChunk(Message{ToolCalls: []ToolCall{
+					{Index: 0, Function: FunctionCall{Arguments: `ty":"Hangzhou"}`}},
+					{Index: 1, ID: "call_2", Type: "function", Function: FunctionCall{Name: "get_time", Arguments: `{}`}},
+				}}, "null", usage(2)),
+				messageChunk(Message{}, "tool_calls", usage(3)),
+			},
+			want: GenerationOutput{Choices: []Choice{{
+				FinishReason: "tool_calls",
+				Message: Message{Role: RoleAssistant, ToolCalls: []ToolCall{
+					{Index: 0, ID: "call_1", Type: "function", Function: FunctionCall{Name: "get_weather", Arguments: `{"city":"Hangzhou"}`}},
+					{Index: 1, ID: "call_2", Type: "function", Function: FunctionCall{Name: "get_time", Arguments: `{}`}},
+				}},
+			}}},
+			wantUsage: usage(3),
+		},
+		{
+			name: "cumulative tool calls",
+			chunks: []*GenerationResponse{
+				messageChunk(Message{Role: RoleAssistant, ToolCalls: []ToolCall{
+					{ID: "call_1", Function: FunctionCall{Name: "get_weather", Arguments: `{"ci`}},
+				}}, "null", usage(1)),
+				messageChunk(Message{Role: RoleAssistant, ToolCalls: []ToolCall{
+					{ID: "call_1", Function: FunctionCall{Name: "get_weather", Arguments: `{"city":"Hangzhou"}`}},
+				}}, "tool_calls", usage(2)),
+				messageChunk(Message{Role: RoleAssistant}, "null", GenerationUsage{}),
+			},
+			want: GenerationOutput{Choices: []Choice{{
+				FinishReason: "tool_calls",
+				Message: Message{Role: RoleAssistant, ToolCalls: []ToolCall{
+					{ID: "call_1", Function: FunctionCall{Name: "get_weather", Arguments: `{"city":"Hangzhou"}`}},
+				}},
+			}}},
+			wantUsage: usage(2),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acc := NewGenerationAccumulator(GenerationRequest{
+				Parameters: &GenerationParameters{IncrementalOutput: tt.incremental},
+			})
+			for _, chunk := range tt.chunks {
+				acc.Add(chunk)
+			}
+			resp := acc.Response()
+			if !reflect.DeepEqual(resp.Output, tt.want) {
+				t.Errorf("output = %+v, want %+v", resp.Output, tt.want)
+			}
+			if resp.Usage != tt.wantUsage {
+				t.Errorf("usage = %+v, want %+v", resp.Usage, tt.wantUsage)
+			}
+		})
+	}
+}
+
+func TestGenerationAccumulatorResponseIsCopy(t *testing.T) {
+	acc := NewGenerationAccumulator(GenerationRequest{Parameters: &GenerationParameters{IncrementalOutput: true}})
+	acc.Add(messageChunk(Message{Role: RoleAssistant, Content: "a", ToolCalls: []ToolCall{{ID: "call_1"}}}, "null", GenerationUsage{}))
+
+	resp := acc.Response()
+	resp.Output.Choices[0].Message.Content = "changed"
+	resp.Output.Choices[0].Message.ToolCalls[0].ID = "changed"
+
+	acc.Add(messageChunk(Message{Content: "b"}, "stop", GenerationUsage{}))
+	msg := acc.Response().Output.Choices[0].Message
+	if msg.Content != "ab" || msg.ToolCalls[0].ID != "call_1" {
+		t.Errorf("message = %+v, want it unaffected by changes to an earlier response", msg)
+	}
+}
+
+func TestMultiModalAccumulator(t *testing.T) {
+	chunk := func(finish string, items ...MultiModalContentItem) *MultiModalConversationResponse {
+		resp := &MultiModalConversationResponse{RequestID: "req-1"}
+		resp.Output.Choices = []MultiModalChoice{{
+			FinishReason: finish,
+			Message:      MultiModalMessage{Role: RoleAssistant, Content: items},
+		}}
+		return resp
+	}
+
+	tests := []struct {
+		name        string
+		incremental bool
+		chunks      []*MultiModalConversationResponse
+		want        []MultiModalContentItem
+		wantFinish  string
+	}{
+		{
+			name:        "incremental",
+			incremental: true,
+			chunks: []*MultiModalConversationResponse{
+				chunk("null", MultiModalContentItem{Text: "A "}),
+				chunk("null", MultiModalContentItem{Text: "cat"}),
+				chunk("stop"),
+			},
+			want:       []MultiModalContentItem{{Text: "A cat"}},
+			wantFinish: "stop",
+		},
+		{
+			name: "cumulative",
+			chunks: []*MultiModalConversationResponse{
+				chunk("null", MultiModalContentItem{Text: "A "}),
+				chunk("stop", MultiModalContentItem{Text: "A cat"}),
+				chunk("null"),
+			},
+			want:       []MultiModalContentItem{{Text: "A cat"}},
+			wantFinish: "stop",
+		},
+		{
+			name:        "incremental items",
+			incremental: true,
+			chunks: []*MultiModalConversationResponse{
+				chunk("null", MultiModalContentItem{Text: "One"}),
+				chunk("stop", MultiModalContentItem{Text: "."}, MultiModalContentItem{Image: "https://example.com/a.png"}),
+			},
+			want:       []MultiModalContentItem{{Text: "One."}, {Image: "https://example.com/a.png"}},
+			wantFinish: "stop",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acc := NewMultiModalAccumulator(MultiModalConversationRequest{
+				Parameters: &MultiModalConversationParameters{IncrementalOutput: tt.incremental},
+			})
+			for _, c := range tt.chunks {
+				acc.Add(c)
+			}
+			choice := acc.Response().Output.Choices[0]
+			if !reflect.DeepEqual(choice.Message.Content, tt.want) {
+				t.Errorf("content = %+v, want %+v", choice.Message.Content, tt.want)
+			}
+			if choice.FinishReason != tt.wantFinish {
+				t.Errorf("finish reason = %q, want %q", choice.FinishReason, tt.wantFinish)
+			}
+		})
+	}
+}
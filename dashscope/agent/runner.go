@@ -0,0 +1,254 @@
+// Package agent runs tool-calling loops against DashScope generation models,
+// executing registered Go functions for the tool calls the model makes.
+//
+//	type WeatherArgs struct {
+//		City string `json:"city" description:"City name"`
+//	}
+//
+//	weather := agent.NewTool("get_weather", "Get the current weather of a city",
+//		func(ctx context.Context, args WeatherArgs) (string, error) {
+//			return "sunny, 25°C", nil
+//		})
+//
+//	runner := &agent.Runner{
+//		Generation: client.Generation(),
+//		Tools:      agent.NewRegistry(weather),
+//	}
+//	result, err := runner.Run(ctx, req)
+//	fmt.Println(result.Answer)
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+)
+
+// DefaultMaxSteps is the number of model calls a run makes if
+// Runner.MaxSteps is zero.
+const DefaultMaxSteps = 10
+
+// ErrMaxSteps is returned when the model still requests tool calls after
+// the last allowed step.
+var ErrMaxSteps = errors.New("agent: step limit reached without a final answer")
+
+// Runner calls a model repeatedly, executing the tool calls it requests and
+// feeding the results back, until it answers without calling tools.
+type Runner struct {
+	Generation *dashscope.Generation
+	Tools      *Registry
+
+	// MaxSteps limits the number of model calls, DefaultMaxSteps if zero.
+	MaxSteps int
+	// ParallelToolCalls lets the model request several calls per step and
+	// executes them concurrently.
+	ParallelToolCalls bool
+	// ToolTimeout bounds each tool call unless the tool sets its own.
+	ToolTimeout time.Duration
+	// Approve, if set, is consulted before each tool call, concurrently with
+	// ParallelToolCalls. Denied calls are reported to the model as such; an
+	// error aborts the run.
+	Approve func(ctx context.Context, call dashscope.ToolCall) (bool, error)
+}
+
+// Result is the outcome of a run.
+type Result struct {
+	// Answer is the content of the model's final message.
+	Answer string
+	// Messages is the whole conversation, starting with the request's
+	// messages.
+	Messages []dashscope.Message
+	// Steps records each model call and the tool calls it led to.
+	Steps []Step
+	// Usage sums the token usage of all steps.
+	Usage dashscope.GenerationUsage
+}
+
+// Step is one model call of a run.
+type Step struct {
+	Response *dashscope.GenerationResponse
+	Calls    []CallRecord
+}
+
+// CallRecord is the execution of a tool call.
+type CallRecord struct {
+	Call     dashscope.ToolCall
+	Output   string // As sent to the model
+	Err      error  // Set if the tool failed, was unknown or was denied
+	Denied   bool
+	Duration time.Duration
+}
+
+// Run executes the loop for req, whose messages start the conversation. The
+// registered tools replace any in req.Parameters. On failure the result so
+// far is returned with the error.
+func (r *Runner) Run(ctx context.Context, req dashscope.GenerationRequest) (*Result, error) {
+	if r.Tools == nil {
+		return nil, errors.New("agent: Runner.Tools is nil")
+	}
+
+	var params dashscope.GenerationParameters
+	if req.Parameters != nil {
+		params = *req.Parameters
+	}
+	params.ResultFormat = "message"
+	params.Tools = r.Tools.Definitions()
+	params.ParallelToolCalls = r.ParallelToolCalls
+	req.Parameters = &params
+
+	result := &Result{
+		Messages: append([]dashscope.Message(nil), req.Input.Messages...),
+	}
+	if req.Input.Prompt != "" {
+		result.Messages = append(result.Messages, dashscope.Message{Role: dashscope.RoleUser, Content: req.Input.Prompt})
+		req.Input.Prompt = ""
+	}
+
+	maxSteps := r.MaxSteps
+	if maxSteps <= 0 {
+		maxSteps = DefaultMaxSteps
+	}
+	for i := 0; i < maxSteps; i++ {
+		req.Input.Messages = result.Messages
+		resp, err := r.Generation.Call(ctx, req)
+		if err != nil {
+			return result, err
+		}
+		result.Usage.InputTokens += resp.Usage.InputTokens
+		result.Usage.OutputTokens += resp.Usage.OutputTokens
+		result.Usage.TotalTokens += resp.Usage.TotalTokens
+		result.Usage.OutputTokensDetails.ReasoningTokens += resp.Usage.OutputTokensDetails.ReasoningTokens
+		if len(resp.Output.Choices) == 0 {
+			result.Steps = append(result.Steps, Step{Response: resp})
+			return result, fmt.Errorf("agent: response %s has no choices", resp.RequestID)
+		}
+
+		msg := resp.Output.Choices[0].Message
+		result.Messages = append(result.Messages, msg)
+		if len(msg.ToolCalls) == 0 {
+			result.Steps = append(result.Steps, Step{Response: resp})
+			result.Answer = msg.Content
+			return result, nil
+		}
+
+		calls, err := r.execute(ctx, msg.ToolCalls)
+		result.Steps = append(result.Steps, Step{Response: resp, Calls: calls})
+		if err != nil {
+			return result, err
+		}
+		for _, call := range calls {
+			result.Messages = append(result.Messages, dashscope.NewToolMessage(call.Call, call.Output))
+		}
+	}
+	return result, ErrMaxSteps
+}
+
+// execute runs the tool calls of a step, concurrently if allowed.
+func (r *Runner) execute(ctx context.Context, calls []dashscope.ToolCall) ([]CallRecord, error) {
+	records := make([]CallRecord, len(calls))
+	errs := make([]error, len(calls))
+	if !r.ParallelToolCalls || len(calls) == 1 {
+		for i, call := range calls {
+			records[i], errs[i] = r.invoke(ctx, call)
+			if errs[i] != nil {
+				return records[:i+1], errs[i]
+			}
+		}
+		return records, nil
+	}
+
+	var wg sync.WaitGroup
+	for i, call := range calls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			records[i], errs[i] = r.invoke(ctx, call)
+		}()
+	}
+	wg.Wait()
+	return records, errors.Join(errs...)
+}
+
+// invoke runs a single tool call. Tool failures are reported to the model;
+// only approval errors and cancellation are returned.
+func (r *Runner) invoke(ctx context.Context, call dashscope.ToolCall) (CallRecord, error) {
+	record := CallRecord{Call: call}
+
+	tool, ok := r.Tools.Get(call.Function.Name)
+	if !ok {
+		record.Err = fmt.Errorf("unknown tool %q", call.Function.Name)
+		record.Output = "Error: " + record.Err.Error()
+		return record, nil
+	}
+
+	if r.Approve != nil {
+		approved, err := r.Approve(ctx, call)
+		if err != nil {
+			record.Err = err
+			return record, err
+		}
+		if !approved {
+			record.Denied = true
+			record.Err = fmt.Errorf("tool call %q denied", call.Function.Name)
+			record.Output = "Error: the tool call was denied by the user."
+			return record, nil
+		}
+	}
+
+	timeout := tool.Timeout
+	if timeout == 0 {
+		timeout = r.ToolTimeout
+	}
+	callCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// The tool runs apart so the timeout holds even if it ignores callCtx. A
+	// panic is reported to the model like any other tool failure.
+	type outcome struct {
+		output string
+		err    error
+	}
+	done := make(chan outcome, 1)
+	start := time.Now()
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				done <- outcome{err: fmt.Errorf("tool panicked: %v", p)}
+			}
+		}()
+		output, err := tool.call(callCtx, call.Function.Arguments)
+		done <- outcome{output, err}
+	}()
+	var output string
+	var err error
+	select {
+	case o := <-done:
+		output, err = o.output, o.err
+	case <-callCtx.Done():
+		err = callCtx.Err()
+	}
+	record.Duration = time.Since(start)
+	if err != nil {
+		if ctx.Err() != nil {
+			record.Err = ctx.Err()
+			return record, ctx.Err()
+		}
+		record.Err = err
+		if errors.Is(err, context.DeadlineExceeded) {
+			record.Output = fmt.Sprintf("Error: the tool timed out after %s.", timeout)
+		} else {
+			record.Output = "Error: " + err.Error()
+		}
+		return record, nil
+	}
+	record.Output = output
+	return record, nil
+}
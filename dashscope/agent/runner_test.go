@@ -0,0 +1,221 @@
+package agent_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+	"github.com/ceoifung/go-dashscope/dashscope/agent"
+	"github.com/ceoifung/go-dashscope/dashscope/dashscopetest"
+)
+
+type cityArgs struct {
+	City string `json:"city"`
+}
+
+var (
+	weather = agent.NewTool("get_weather", "Get the weather of a city",
+		func(ctx context.Context, args cityArgs) (string, error) {
+			return "sunny in " + args.City, nil
+		})
+	failing = agent.NewTool("failing", "Always fails",
+		func(ctx context.Context, args cityArgs) (string, error) {
+			return "", errors.New("no data")
+		})
+	panicking = agent.NewTool("panicking", "Always panics",
+		func(ctx context.Context, args cityArgs) (string, error) {
+			panic("boom")
+		})
+	slow = agent.NewTool("slow", "Never returns in time",
+		func(ctx context.Context, args cityArgs) (string, error) {
+			<-ctx.Done()
+			return "", ctx.Err()
+		})
+)
+
+func toolCall(id, name string) dashscope.ToolCall {
+	return dashscope.ToolCall{
+		ID:       id,
+		Type:     "function",
+		Function: dashscope.FunctionCall{Name: name, Arguments: `{"city":"Hangzhou"}`},
+	}
+}
+
+// toolCalls scripts a model step requesting calls.
+func toolCalls(calls ...dashscope.ToolCall) dashscopetest.Response {
+	var resp dashscope.GenerationResponse
+	resp.Output.Choices = []dashscope.Choice{{
+		FinishReason: "tool_calls",
+		Message:      dashscope.Message{Role: dashscope.RoleAssistant, ToolCalls: calls},
+	}}
+	resp.Usage = dashscope.GenerationUsage{
+		InputTokens:         10,
+		OutputTokens:        5,
+		TotalTokens:         15,
+		OutputTokensDetails: dashscope.OutputTokensDetails{ReasoningTokens: 3},
+	}
+	return dashscopetest.Response{Body: resp}
+}
+
+func TestRunnerRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		runner   agent.Runner
+		steps    []dashscopetest.Response
+		wantErr  bool
+		wantTool []string // Tool messages sent back to the model, in order
+	}{
+		{
+			name: "direct answer",
+		},
+		{
+			name:     "tool call",
+			steps:    []dashscopetest.Response{toolCalls(toolCall("call_1", "get_weather"))},
+			wantTool: []string{"sunny in Hangzhou"},
+		},
+		{
+			name:     "unknown tool",
+			steps:    []dashscopetest.Response{toolCalls(toolCall("call_1", "get_time"))},
+			wantTool: []string{`Error: unknown tool "get_time"`},
+		},
+		{
+			name:     "tool error",
+			steps:    []dashscopetest.Response{toolCalls(toolCall("call_1", "failing"))},
+			wantTool: []string{"Error: no data"},
+		},
+		{
+			name:     "tool panic",
+			steps:    []dashscopetest.Response{toolCalls(toolCall("call_1", "panicking"))},
+			wantTool: []string{"Error: tool panicked: boom"},
+		},
+		{
+			name:   "parallel calls with a panic",
+			runner: agent.Runner{ParallelToolCalls: true},
+			steps: []dashscopetest.Response{toolCalls(
+				toolCall("call_1", "panicking"),
+				toolCall("call_2", "get_weather"),
+			)},
+			wantTool: []string{"Error: tool panicked: boom", "sunny in Hangzhou"},
+		},
+		{
+			name:     "tool timeout",
+			runner:   agent.Runner{ToolTimeout: 10 * time.Millisecond},
+			steps:    []dashscopetest.Response{toolCalls(toolCall("call_1", "slow"))},
+			wantTool: []string{"Error: the tool timed out after 10ms."},
+		},
+		{
+			name: "denied",
+			runner: agent.Runner{Approve: func(ctx context.Context, call dashscope.ToolCall) (bool, error) {
+				return false, nil
+			}},
+			steps:    []dashscopetest.Response{toolCalls(toolCall("call_1", "get_weather"))},
+			wantTool: []string{"Error: the tool call was denied by the user."},
+		},
+		{
+			name: "approval error",
+			runner: agent.Runner{Approve: func(ctx context.Context, call dashscope.ToolCall) (bool, error) {
+				return false, errors.New("no approver")
+			}},
+			steps:   []dashscopetest.Response{toolCalls(toolCall("call_1", "get_weather"))},
+			wantErr: true,
+		},
+		{
+			name:   "step limit",
+			runner: agent.Runner{MaxSteps: 2},
+			steps: []dashscopetest.Response{
+				toolCalls(toolCall("call_1", "get_weather")),
+				toolCalls(toolCall("call_2", "get_weather")),
+			},
+			wantErr:  true,
+			wantTool: []string{"sunny in Hangzhou", "sunny in Hangzhou"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := dashscopetest.NewServer()
+			defer srv.Close()
+			srv.Enqueue(dashscope.ServiceGeneration, tt.steps...)
+
+			runner := tt.runner
+			runner.Generation = srv.Client().Generation()
+			runner.Tools = agent.NewRegistry(weather, failing, panicking, slow)
+			result, err := runner.Run(context.Background(), dashscope.GenerationRequest{
+				Model: dashscope.QwenTurbo,
+				Input: dashscope.GenerationInput{Prompt: "What's the weather in Hangzhou?"},
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Run succeeded, want an error")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Run: %v", err)
+				}
+				if result.Answer != srv.Reply {
+					t.Errorf("answer = %q, want %q", result.Answer, srv.Reply)
+				}
+			}
+
+			var got []string
+			for _, msg := range result.Messages {
+				if msg.Role == dashscope.RoleTool {
+					got = append(got, msg.Content)
+				}
+			}
+			if strings.Join(got, "|") != strings.Join(tt.wantTool, "|") {
+				t.Errorf("tool messages = %q, want %q", got, tt.wantTool)
+			}
+		})
+	}
+}
+
+func TestRunnerUsage(t *testing.T) {
+	srv := dashscopetest.NewServer()
+	defer srv.Close()
+	srv.Enqueue(dashscope.ServiceGeneration,
+		toolCalls(toolCall("call_1", "get_weather")),
+		toolCalls(toolCall("call_2", "get_weather")))
+
+	runner := agent.Runner{Generation: srv.Client().Generation(), Tools: agent.NewRegistry(weather)}
+	result, err := runner.Run(context.Background(), dashscope.GenerationRequest{
+		Model: dashscope.QwenTurbo,
+		Input: dashscope.GenerationInput{Prompt: "Hi"},
+	})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(result.Steps) != 3 {
+		t.Fatalf("steps = %d, want 3", len(result.Steps))
+	}
+
+	var want dashscope.GenerationUsage
+	for _, step := range result.Steps {
+		u := step.Response.Usage
+		want.InputTokens += u.InputTokens
+		want.OutputTokens += u.OutputTokens
+		want.TotalTokens += u.TotalTokens
+		want.OutputTokensDetails.ReasoningTokens += u.OutputTokensDetails.ReasoningTokens
+	}
+	if want.OutputTokensDetails.ReasoningTokens != 6 {
+		t.Fatalf("reasoning tokens of the steps = %d, want 6", want.OutputTokensDetails.ReasoningTokens)
+	}
+	if result.Usage != want {
+		t.Errorf("usage = %+v, want %+v", result.Usage, want)
+	}
+}
+
+func TestRunnerNilTools(t *testing.T) {
+	srv := dashscopetest.NewServer()
+	defer srv.Close()
+
+	runner := agent.Runner{Generation: srv.Client().Generation()}
+	if _, err := runner.Run(context.Background(), dashscope.GenerationRequest{Model: dashscope.QwenTurbo}); err == nil {
+		t.Error("Run succeeded without tools, want an error")
+	}
+	if n := len(srv.Requests()); n != 0 {
+		t.Errorf("%d requests sent, want none", n)
+	}
+}
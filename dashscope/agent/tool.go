@@ -0,0 +1,110 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+)
+
+// Tool is a Go function the model can call.
+type Tool struct {
+	Name        string
+	Description string
+	// Timeout bounds each call, overriding Runner.ToolTimeout when set.
+	Timeout time.Duration
+
+	schema *dashscope.Schema
+	call   func(ctx context.Context, arguments string) (string, error)
+}
+
+// NewTool wraps fn as a tool. The schema of its arguments is derived from A,
+// usually a struct (see dashscope.SchemaOf). Results other than strings are
+// returned to the model JSON-encoded.
+func NewTool[A, R any](name, description string, fn func(ctx context.Context, args A) (R, error)) Tool {
+	return Tool{
+		Name:        name,
+		Description: description,
+		schema:      dashscope.SchemaFor[A](),
+		call: func(ctx context.Context, arguments string) (string, error) {
+			var args A
+			if strings.TrimSpace(arguments) != "" {
+				if err := json.Unmarshal([]byte(arguments), &args); err != nil {
+					return "", fmt.Errorf("invalid arguments: %w", err)
+				}
+			}
+			result, err := fn(ctx, args)
+			if err != nil {
+				return "", err
+			}
+			if s, ok := any(result).(string); ok {
+				return s, nil
+			}
+			data, err := json.Marshal(result)
+			if err != nil {
+				return "", fmt.Errorf("failed to encode result: %w", err)
+			}
+			return string(data), nil
+		},
+	}
+}
+
+// Schema returns the JSON schema of the tool's arguments.
+func (t Tool) Schema() *dashscope.Schema {
+	return t.schema
+}
+
+// Definition returns the tool as declared to the model.
+func (t Tool) Definition() dashscope.Tool {
+	return dashscope.NewFunctionTool(t.Name, t.Description, t.schema)
+}
+
+// Registry holds the tools available to a Runner.
+type Registry struct {
+	tools map[string]Tool
+	order []string
+}
+
+// NewRegistry returns a registry holding tools. It panics if two tools share
+// a name.
+func NewRegistry(tools ...Tool) *Registry {
+	r := &Registry{tools: map[string]Tool{}}
+	for _, t := range tools {
+		if err := r.Add(t); err != nil {
+			panic(err)
+		}
+	}
+	return r
+}
+
+// Add registers a tool.
+func (r *Registry) Add(t Tool) error {
+	if t.Name == "" || t.call == nil {
+		return fmt.Errorf("agent: tool %q was not created with NewTool", t.Name)
+	}
+	if _, ok := r.tools[t.Name]; ok {
+		return fmt.Errorf("agent: duplicate tool %q", t.Name)
+	}
+	r.tools[t.Name] = t
+	r.order = append(r.order, t.Name)
+	return nil
+}
+
+// Get returns the named tool.
+func (r *Registry) Get(name string) (Tool, bool) {
+	t, ok := r.tools[name]
+	return t, ok
+}
+
+// Definitions returns the registered tools as declared to the model, in
+// registration order.
+func (r *Registry) Definitions() []dashscope.Tool {
+	defs := make([]dashscope.Tool, 0, len(r.order))
+	for _, name := range r.order {
+		defs = append(defs, r.tools[name].Definition())
+	}
+	return defs
+}
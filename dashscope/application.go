@@ -0,0 +1,240 @@
+package dashscope
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Application handles the completion API of Bailian applications (agent,
+// RAG and workflow apps), which run the model, knowledge base and plugins
+// configured for the app.
+type Application struct {
+	APIKey    string
+	Workspace string
+	client    *http.Client
+	c         *Client
+}
+
+// NewApplication creates a new Application client.
+func NewApplication(apiKey string) *Application {
+	return NewClient(WithAPIKey(apiKey)).Application()
+}
+
+// SetHTTPClient sets a custom HTTP client.
+func (a *Application) SetHTTPClient(client *http.Client) {
+	a.client = client
+}
+
+// SetWorkspace sets the workspace ID.
+func (a *Application) SetWorkspace(workspace string) {
+	a.Workspace = workspace
+}
+
+// ApplicationRequest represents the request body of an application
+// completion.
+type ApplicationRequest struct {
+	Input      ApplicationInput       `json:"input"`
+	Parameters *ApplicationParameters `json:"parameters,omitempty"`
+}
+
+// ApplicationInput represents the input of an application completion.
+// For multi-turn conversations pass the SessionID of the previous reply, and
+// the app keeps the history; alternatively send the history as Messages.
+type ApplicationInput struct {
+	Prompt    string    `json:"prompt,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+	Messages  []Message `json:"messages,omitempty"`
+	MemoryID  string    `json:"memory_id,omitempty"`
+	ImageList []string  `json:"image_list,omitempty"`
+	// BizParams passes custom parameters to the prompt variables, plugins
+	// and workflow nodes of the app.
+	BizParams map[string]interface{} `json:"biz_params,omitempty"`
+}
+
+// ApplicationParameters represents the parameters of an application
+// completion.
+type ApplicationParameters struct {
+	IncrementalOutput bool        `json:"incremental_output,omitempty"`
+	HasThoughts       bool        `json:"has_thoughts,omitempty"` // Return the agent's thoughts and plugin calls
+	RAGOptions        *RAGOptions `json:"rag_options,omitempty"`
+}
+
+// RAGOptions narrows the knowledge retrieval of a RAG app.
+type RAGOptions struct {
+	PipelineIDs      []string               `json:"pipeline_ids,omitempty"` // Knowledge base IDs
+	FileIDs          []string               `json:"file_ids,omitempty"`     // Documents within the knowledge bases
+	Tags             []string               `json:"tags,omitempty"`
+	MetadataFilter   map[string]interface{} `json:"metadata_filter,omitempty"`
+	StructuredFilter map[string]interface{} `json:"structured_filter,omitempty"`
+	SessionFileIDs   []string               `json:"session_file_ids,omitempty"` // Files uploaded for this session
+}
+
+// ApplicationResponse represents the response of an application completion.
+type ApplicationResponse struct {
+	RequestID  string            `json:"request_id"`
+	Output     ApplicationOutput `json:"output"`
+	Usage      ApplicationUsage  `json:"usage"`
+	StatusCode int               `json:"status_code,omitempty"`
+	Code       string            `json:"code,omitempty"`
+	Message    string            `json:"message,omitempty"`
+}
+
+// ApplicationOutput represents the output of an application completion.
+type ApplicationOutput struct {
+	Text         string `json:"text"`
+	FinishReason string `json:"finish_reason,omitempty"`
+	SessionID    string `json:"session_id,omitempty"`
+	// Thoughts are only returned when HasThoughts is set.
+	Thoughts []ApplicationThought `json:"thoughts,omitempty"`
+	// DocReferences are the knowledge base passages the text cites, as
+	// <ref>[IndexID]</ref> markers.
+	DocReferences []DocReference `json:"doc_references,omitempty"`
+}
+
+// ApplicationThought is a reasoning step or plugin call of an agent app.
+type ApplicationThought struct {
+	Thought           string          `json:"thought,omitempty"`
+	ActionType        string          `json:"action_type,omitempty"` // e.g. "api" or "agentRag"
+	ActionName        string          `json:"action_name,omitempty"`
+	Action            string          `json:"action,omitempty"`
+	ActionInputStream string          `json:"action_input_stream,omitempty"`
+	ActionInput       json.RawMessage `json:"action_input,omitempty"`
+	Response          string          `json:"response,omitempty"`
+	Observation       string          `json:"observation,omitempty"`
+}
+
+// DocReference is a knowledge base passage cited by a RAG app.
+type DocReference struct {
+	IndexID    string   `json:"index_id"`
+	Title      string   `json:"title,omitempty"`
+	DocID      string   `json:"doc_id,omitempty"`
+	DocName    string   `json:"doc_name,omitempty"`
+	DocURL     string   `json:"doc_url,omitempty"`
+	Text       string   `json:"text,omitempty"`
+	BizID      string   `json:"biz_id,omitempty"`
+	Images     []string `json:"images,omitempty"`
+	PageNumber []int    `json:"page_number,omitempty"`
+}
+
+// ApplicationUsage lists the tokens consumed by each model the app called.
+type ApplicationUsage struct {
+	Models []ApplicationModelUsage `json:"models,omitempty"`
+}
+
+// ApplicationModelUsage is the token usage of one model.
+type ApplicationModelUsage struct {
+	ModelID      string `json:"model_id"`
+	InputTokens  int    `json:"input_tokens"`
+	OutputTokens int    `json:"output_tokens"`
+}
+
+// tokens sums the usage of all models.
+func (u ApplicationUsage) tokens() (input, output int) {
+	for _, m := range u.Models {
+		input += m.InputTokens
+		output += m.OutputTokens
+	}
+	return input, output
+}
+
+// Call performs a synchronous completion of the app appID.
+func (a *Application) Call(ctx context.Context, appID string, req ApplicationRequest) (_ *ApplicationResponse, err error) {
+	endpoint := a.c.url(AppsPath + "/" + url.PathEscape(appID) + "/completion")
+
+	if req.Parameters != nil {
+		params := *req.Parameters
+		params.IncrementalOutput = false
+		req.Parameters = &params
+	}
+
+	info := CallInfo{Service: ServiceApplication}
+	ctx, op := a.c.startOperation(ctx, "Application.Call", info)
+	defer func() { op.end(err) }()
+	op.setAttributes(AttrAppID.String(appID))
+
+	ctx, cancel := a.c.withTimeout(ctx)
+	defer cancel()
+
+	// The app decides which models run, so only the request quota applies.
+	if err := op.reserve(ctx, 0); err != nil {
+		return nil, err
+	}
+
+	httpReq, err := a.c.newRequest(ctx, "POST", endpoint, req, a.APIKey, a.Workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := a.c.do(a.client, httpReq, info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result ApplicationResponse
+	err = decodeResponse(resp, &result)
+	result.StatusCode = resp.StatusCode
+	op.setRequestID(result.RequestID)
+	op.setUsage(result.Usage.tokens())
+	if result.Output.SessionID != "" {
+		op.setAttributes(AttrSessionID.String(result.Output.SessionID))
+	}
+	if err != nil {
+		return &result, err
+	}
+
+	return &result, nil
+}
+
+// Stream performs a streaming completion of the app appID. Set
+// IncrementalOutput for text deltas; thoughts and doc references arrive with
+// the chunks that produce them. The caller must read the stream to the end
+// or Close it.
+func (a *Application) Stream(ctx context.Context, appID string, req ApplicationRequest) (_ *Stream[ApplicationResponse], err error) {
+	endpoint := a.c.url(AppsPath + "/" + url.PathEscape(appID) + "/completion")
+
+	info := CallInfo{Service: ServiceApplication, Stream: true}
+	ctx, op := a.c.startOperation(ctx, "Application.Stream", info)
+	defer func() {
+		if err != nil {
+			op.end(err)
+		}
+	}()
+	op.setAttributes(AttrAppID.String(appID))
+
+	if err := op.reserve(ctx, 0); err != nil {
+		return nil, err
+	}
+
+	httpReq, err := a.c.newRequest(ctx, "POST", endpoint, req, a.APIKey, a.Workspace)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "text/event-stream")
+	httpReq.Header.Set("X-DashScope-SSE", "enable")
+
+	resp, err := a.c.do(a.client, httpReq, info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	if err := checkStreamResponse(resp); err != nil {
+		return nil, err
+	}
+
+	var sessionID string
+	return newStream(ctx, op, resp, func(chunk *ApplicationResponse) {
+		chunk.StatusCode = resp.StatusCode
+		op.markFirstToken()
+		op.setRequestID(chunk.RequestID)
+		if len(chunk.Usage.Models) > 0 {
+			op.setUsage(chunk.Usage.tokens())
+		}
+		if id := chunk.Output.SessionID; id != "" && id != sessionID {
+			sessionID = id
+			op.setAttributes(AttrSessionID.String(id))
+		}
+	}), nil
+}
@@ -0,0 +1,177 @@
+package dashscope_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+	"github.com/ceoifung/go-dashscope/dashscope/dashscopetest"
+)
+
+// sentApplication decodes the application request the server received.
+func sentApplication(t *testing.T, req dashscopetest.Request) dashscope.ApplicationRequest {
+	t.Helper()
+	var sent dashscope.ApplicationRequest
+	if err := req.Decode(&sent); err != nil {
+		t.Fatalf("decoding the request: %v", err)
+	}
+	return sent
+}
+
+func TestApplicationCall(t *testing.T) {
+	srv := dashscopetest.NewServer()
+	defer srv.Close()
+	app := srv.Client().Application()
+	ctx := context.Background()
+
+	first, err := app.Call(ctx, "app-1", dashscope.ApplicationRequest{
+		Input: dashscope.ApplicationInput{Prompt: "Hello"},
+		Parameters: &dashscope.ApplicationParameters{
+			IncrementalOutput: true,
+			HasThoughts:       true,
+			RAGOptions:        &dashscope.RAGOptions{PipelineIDs: []string{"kb-1"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	out := first.Output
+	if !strings.HasPrefix(out.Text, srv.Reply) || out.FinishReason != "stop" || out.SessionID == "" {
+		t.Errorf("output = %+v, want the reply and a session ID", out)
+	}
+	if len(out.Thoughts) != 1 || len(out.DocReferences) != 1 || out.DocReferences[0].IndexID != "1" {
+		t.Errorf("thoughts = %+v, references = %+v, want one of each", out.Thoughts, out.DocReferences)
+	}
+	if len(first.Usage.Models) != 1 || first.Usage.Models[0].OutputTokens == 0 {
+		t.Errorf("usage = %+v, want the tokens of the model", first.Usage)
+	}
+	if first.StatusCode != http.StatusOK || first.RequestID == "" {
+		t.Errorf("status %d, request ID %q", first.StatusCode, first.RequestID)
+	}
+
+	// The session continues with the returned ID.
+	second, err := app.Call(ctx, "app-1", dashscope.ApplicationRequest{
+		Input: dashscope.ApplicationInput{Prompt: "And then?", SessionID: out.SessionID},
+	})
+	if err != nil {
+		t.Fatalf("second Call: %v", err)
+	}
+	if second.Output.SessionID != out.SessionID {
+		t.Errorf("session ID = %q, want %q", second.Output.SessionID, out.SessionID)
+	}
+
+	requests := srv.RequestsFor(dashscope.ServiceApplication)
+	if len(requests) != 2 {
+		t.Fatalf("%d requests sent, want 2", len(requests))
+	}
+	if requests[0].Path != "/apps/app-1/completion" || requests[0].Header.Get("X-DashScope-SSE") != "" {
+		t.Errorf("request %s %s, SSE %q, want a plain completion", requests[0].Method, requests[0].Path, requests[0].Header.Get("X-DashScope-SSE"))
+	}
+	if sent := sentApplication(t, requests[0]); sent.Parameters.IncrementalOutput || !sent.Parameters.HasThoughts {
+		t.Errorf("sent parameters = %+v, want incremental output cleared", sent.Parameters)
+	}
+	if sent := sentApplication(t, requests[1]); sent.Input.SessionID != out.SessionID {
+		t.Errorf("sent session ID = %q, want %q", sent.Input.SessionID, out.SessionID)
+	}
+}
+
+func TestApplicationCallError(t *testing.T) {
+	srv := dashscopetest.NewServer()
+	defer srv.Close()
+	srv.Enqueue(dashscope.ServiceApplication, dashscopetest.Fail(http.StatusNotFound, "InvalidApp", "app not found"))
+
+	resp, err := srv.Client().Application().Call(context.Background(), "missing", dashscope.ApplicationRequest{
+		Input: dashscope.ApplicationInput{Prompt: "Hello"},
+	})
+	var apiErr *dashscope.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || apiErr.Code != "InvalidApp" {
+		t.Fatalf("Call error = %v, want a 404 InvalidApp", err)
+	}
+	if resp == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("response = %+v, want one carrying the status", resp)
+	}
+}
+
+func TestApplicationStream(t *testing.T) {
+	for _, incremental := range []bool{true, false} {
+		name := "cumulative"
+		if incremental {
+			name = "incremental"
+		}
+		t.Run(name, func(t *testing.T) {
+			srv := dashscopetest.NewServer()
+			defer srv.Close()
+
+			stream, err := srv.Client().Application().Stream(context.Background(), "app-1", dashscope.ApplicationRequest{
+				Input:      dashscope.ApplicationInput{Prompt: "Hello", SessionID: "session-7"},
+				Parameters: &dashscope.ApplicationParameters{IncrementalOutput: incremental},
+			})
+			if err != nil {
+				t.Fatalf("Stream: %v", err)
+			}
+			defer stream.Close()
+
+			var text string
+			var last dashscope.ApplicationResponse
+			chunks := 0
+			for stream.Next() {
+				chunk := stream.Current()
+				if chunk.Output.SessionID != "session-7" {
+					t.Errorf("chunk session ID = %q, want session-7", chunk.Output.SessionID)
+				}
+				if incremental {
+					text += chunk.Output.Text
+				} else {
+					text = chunk.Output.Text
+				}
+				last = *chunk
+				chunks++
+			}
+			if err := stream.Err(); err != nil {
+				t.Fatalf("stream: %v", err)
+			}
+			if chunks < 2 {
+				t.Errorf("received %d chunks, want the reply in pieces", chunks)
+			}
+			if text != srv.Reply {
+				t.Errorf("text = %q, want %q", text, srv.Reply)
+			}
+			if last.Output.FinishReason != "stop" || len(last.Usage.Models) != 1 {
+				t.Errorf("last chunk = %+v, want the finish reason and usage", last)
+			}
+
+			req := srv.RequestsFor(dashscope.ServiceApplication)[0]
+			if req.Header.Get("X-DashScope-SSE") != "enable" || req.Header.Get("Accept") != "text/event-stream" {
+				t.Errorf("headers = %v, want a server-sent event request", req.Header)
+			}
+			if sent := sentApplication(t, req); sent.Parameters.IncrementalOutput != incremental {
+				t.Errorf("sent incremental_output = %t, want %t", sent.Parameters.IncrementalOutput, incremental)
+			}
+		})
+	}
+}
+
+func TestApplicationEscapedAppID(t *testing.T) {
+	srv, last := capture(t, `{"output":{"text":"hi","finish_reason":"stop"}}`)
+	app := dashscope.NewClient(dashscope.WithAPIKey("sk-test"), dashscope.WithBaseURL(srv.URL)).Application()
+	const want = "/apps/app%2F1%20x/completion"
+
+	if _, err := app.Call(context.Background(), "app/1 x", dashscope.ApplicationRequest{}); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if got := last().URL.EscapedPath(); got != want {
+		t.Errorf("Call path = %q, want %q", got, want)
+	}
+
+	stream, err := app.Stream(context.Background(), "app/1 x", dashscope.ApplicationRequest{})
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	stream.Close()
+	if got := last().URL.EscapedPath(); got != want {
+		t.Errorf("Stream path = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,477 @@
+package dashscope
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Batch endpoints, the requests a batch job runs.
+const (
+	BatchEndpointChatCompletions = "/v1/chat/completions"
+	BatchEndpointEmbeddings      = "/v1/embeddings"
+)
+
+// BatchStatus constants
+const (
+	BatchStatusValidating = "validating"
+	BatchStatusFailed     = "failed"
+	BatchStatusInProgress = "in_progress"
+	BatchStatusFinalizing = "finalizing"
+	BatchStatusCompleted  = "completed"
+	BatchStatusExpired    = "expired"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+)
+
+// batchPollInterval caps the delay between polls of a batch job, which runs
+// for minutes to hours.
+const batchPollInterval = 30 * time.Second
+
+// Batches handles batch inference: requests uploaded as a JSONL file are run
+// asynchronously, within a completion window, at a lower price than
+// individual calls. It uses the OpenAI-compatible endpoints.
+//
+//	input := dashscope.NewBatchInput()
+//	input.AddGeneration("q1", req1)
+//	input.AddGeneration("q2", req2)
+//	batch, err := batches.Submit(ctx, input, nil)
+//	batch, err = batches.Wait(ctx, batch.ID, nil)
+//	results, err := batches.Results(ctx, batch)
+//	fmt.Println(results["q1"].Generation.Output.Choices[0].Message.Content)
+type Batches struct {
+	APIKey    string
+	Workspace string
+	client    *http.Client
+	c         *Client
+}
+
+// NewBatches creates a new Batches client.
+func NewBatches(apiKey string) *Batches {
+	return NewClient(WithAPIKey(apiKey)).Batches()
+}
+
+// SetHTTPClient sets a custom HTTP client.
+func (b *Batches) SetHTTPClient(client *http.Client) {
+	b.client = client
+}
+
+// SetWorkspace sets the workspace ID.
+func (b *Batches) SetWorkspace(workspace string) {
+	b.Workspace = workspace
+}
+
+// Batch describes a batch job.
+type Batch struct {
+	ID               string             `json:"id"`
+	Object           string             `json:"object"` // "batch"
+	Endpoint         string             `json:"endpoint"`
+	InputFileID      string             `json:"input_file_id"`
+	CompletionWindow string             `json:"completion_window"`
+	Status           string             `json:"status"`
+	OutputFileID     string             `json:"output_file_id,omitempty"`
+	ErrorFileID      string             `json:"error_file_id,omitempty"`
+	Errors           *BatchErrors       `json:"errors,omitempty"` // Validation errors of the input
+	RequestCounts    BatchRequestCounts `json:"request_counts"`
+	Metadata         map[string]string  `json:"metadata,omitempty"`
+	CreatedAt        int64              `json:"created_at"`
+	InProgressAt     int64              `json:"in_progress_at,omitempty"`
+	ExpiresAt        int64              `json:"expires_at,omitempty"`
+	FinalizingAt     int64              `json:"finalizing_at,omitempty"`
+	CompletedAt      int64              `json:"completed_at,omitempty"`
+	FailedAt         int64              `json:"failed_at,omitempty"`
+	ExpiredAt        int64              `json:"expired_at,omitempty"`
+	CancellingAt     int64              `json:"cancelling_at,omitempty"`
+	CancelledAt      int64              `json:"cancelled_at,omitempty"`
+}
+
+// Done reports whether the job has stopped, successfully or not.
+func (b *Batch) Done() bool {
+	switch b.Status {
+	case BatchStatusCompleted, BatchStatusFailed, BatchStatusExpired, BatchStatusCancelled:
+		return true
+	}
+	return false
+}
+
+// BatchRequestCounts is the progress of a batch job.
+type BatchRequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+// BatchErrors lists the problems that failed a batch job.
+type BatchErrors struct {
+	Object string       `json:"object"` // "list"
+	Data   []BatchError `json:"data"`
+}
+
+// BatchError is a problem with a batch job or one of its requests.
+type BatchError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Param   string `json:"param,omitempty"`
+	Line    int    `json:"line,omitempty"`
+}
+
+// CreateBatchRequest creates a batch job from an uploaded input file.
+type CreateBatchRequest struct {
+	InputFileID      string            `json:"input_file_id"`
+	Endpoint         string            `json:"endpoint"`
+	CompletionWindow string            `json:"completion_window"` // e.g. "24h", the default
+	Metadata         map[string]string `json:"metadata,omitempty"`
+}
+
+// BatchList is a page of batch jobs.
+type BatchList struct {
+	Object  string  `json:"object"` // "list"
+	Data    []Batch `json:"data"`
+	HasMore bool    `json:"has_more"`
+	FirstID string  `json:"first_id,omitempty"`
+	LastID  string  `json:"last_id,omitempty"`
+}
+
+// ListBatchesParams selects a page of batch jobs. Pass the LastID of a page
+// as After to get the next one.
+type ListBatchesParams struct {
+	After string
+	Limit int
+}
+
+// BatchInput builds the JSONL input file of a batch job. All requests of a
+// batch go to the same endpoint.
+type BatchInput struct {
+	endpoint string
+	buf      bytes.Buffer
+	ids      map[string]bool
+}
+
+// batchLine is a line of a batch input file.
+type batchLine struct {
+	CustomID string      `json:"custom_id"`
+	Method   string      `json:"method"`
+	URL      string      `json:"url"`
+	Body     interface{} `json:"body"`
+}
+
+// NewBatchInput returns an empty batch input.
+func NewBatchInput() *BatchInput {
+	return &BatchInput{ids: make(map[string]bool)}
+}
+
+// NewGenerationBatchInput builds a batch input from generation requests,
+// identified by their index in reqs.
+func NewGenerationBatchInput(reqs []GenerationRequest) (*BatchInput, error) {
+	in := NewBatchInput()
+	for i, req := range reqs {
+		if err := in.AddGeneration(strconv.Itoa(i), req); err != nil {
+			return nil, err
+		}
+	}
+	return in, nil
+}
+
+// NewEmbeddingBatchInput builds a batch input from text embedding requests,
+// identified by their index in reqs.
+func NewEmbeddingBatchInput(reqs []TextEmbeddingRequest) (*BatchInput, error) {
+	in := NewBatchInput()
+	for i, req := range reqs {
+		if err := in.AddEmbedding(strconv.Itoa(i), req); err != nil {
+			return nil, err
+		}
+	}
+	return in, nil
+}
+
+// AddGeneration adds a generation request, whose result is reported under
+// customID. Batch jobs do not stream, so streaming parameters are ignored.
+func (in *BatchInput) AddGeneration(customID string, req GenerationRequest) error {
+	body := NewChatCompletionRequest(req)
+	body.Stream = false
+	body.StreamOptions = nil
+	return in.add(customID, BatchEndpointChatCompletions, body)
+}
+
+// AddEmbedding adds a text embedding request, whose result is reported
+// under customID.
+func (in *BatchInput) AddEmbedding(customID string, req TextEmbeddingRequest) error {
+	return in.add(customID, BatchEndpointEmbeddings, NewEmbeddingRequest(req))
+}
+
+func (in *BatchInput) add(customID, endpoint string, body interface{}) error {
+	if customID == "" {
+		return errors.New("dashscope: batch request needs a custom ID")
+	}
+	if in.ids[customID] {
+		return fmt.Errorf("dashscope: duplicate batch custom ID %q", customID)
+	}
+	if in.endpoint != "" && in.endpoint != endpoint {
+		return fmt.Errorf("dashscope: batch for %s cannot include %s requests", in.endpoint, endpoint)
+	}
+
+	line, err := json.Marshal(batchLine{CustomID: customID, Method: "POST", URL: endpoint, Body: body})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	in.buf.Write(line)
+	in.buf.WriteByte('\n')
+	in.endpoint = endpoint
+	in.ids[customID] = true
+	return nil
+}
+
+// Endpoint returns the endpoint of the requests, empty if there are none.
+func (in *BatchInput) Endpoint() string {
+	return in.endpoint
+}
+
+// Len returns the number of requests.
+func (in *BatchInput) Len() int {
+	return len(in.ids)
+}
+
+// Bytes returns the JSONL content.
+func (in *BatchInput) Bytes() []byte {
+	return in.buf.Bytes()
+}
+
+// Submit uploads input and creates a batch job running it. A nil req uses
+// the default completion window; its input file and endpoint are set from
+// input.
+func (b *Batches) Submit(ctx context.Context, input *BatchInput, req *CreateBatchRequest) (*Batch, error) {
+	if input.Len() == 0 {
+		return nil, errors.New("dashscope: batch input is empty")
+	}
+	files := &Files{APIKey: b.APIKey, Workspace: b.Workspace, client: b.client, c: b.c}
+	file, err := files.Upload(ctx, "batch.jsonl", FilePurposeBatch, bytes.NewReader(input.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+
+	create := CreateBatchRequest{}
+	if req != nil {
+		create = *req
+	}
+	create.InputFileID = file.ID
+	create.Endpoint = input.Endpoint()
+	return b.Create(ctx, create)
+}
+
+// Create creates a batch job from an uploaded input file.
+func (b *Batches) Create(ctx context.Context, req CreateBatchRequest) (*Batch, error) {
+	if req.CompletionWindow == "" {
+		req.CompletionWindow = "24h"
+	}
+	var batch Batch
+	if err := b.call(ctx, "Batches.Create", "POST", CompatibleBatchesPath, req, &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// Get retrieves a batch job.
+func (b *Batches) Get(ctx context.Context, batchID string) (*Batch, error) {
+	var batch Batch
+	if err := b.call(ctx, "Batches.Get", "GET", CompatibleBatchesPath+"/"+url.PathEscape(batchID), nil, &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// Cancel cancels a batch job. Requests already completed are kept in its
+// output.
+func (b *Batches) Cancel(ctx context.Context, batchID string) (*Batch, error) {
+	var batch Batch
+	if err := b.call(ctx, "Batches.Cancel", "POST", CompatibleBatchesPath+"/"+url.PathEscape(batchID)+"/cancel", nil, &batch); err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// List returns a page of batch jobs. A nil params returns the first page.
+func (b *Batches) List(ctx context.Context, params *ListBatchesParams) (*BatchList, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.After != "" {
+			query.Set("after", params.After)
+		}
+		if params.Limit > 0 {
+			query.Set("limit", strconv.Itoa(params.Limit))
+		}
+	}
+	path := CompatibleBatchesPath
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var list BatchList
+	if err := b.call(ctx, "Batches.List", "GET", path, nil, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// Wait polls a batch job until it stops, with the backoff of async tasks
+// capped at 30 seconds. progress, if set, is called with the job after every
+// poll. The job is returned whatever its final status; use Results to read
+// the outcome of its requests.
+func (b *Batches) Wait(ctx context.Context, batchID string, progress func(*Batch)) (_ *Batch, err error) {
+	ctx, op := b.c.startOperation(ctx, "Batches.Wait", CallInfo{Service: ServiceBatches, TaskID: batchID})
+	defer func() { op.end(err) }()
+
+	var batch *Batch
+	err = poll(ctx, op, batchPollInterval, func(ctx context.Context) (string, bool, error) {
+		got, err := b.Get(ctx, batchID)
+		if err != nil {
+			return "", false, err
+		}
+		batch = got
+		if progress != nil {
+			progress(got)
+		}
+		return got.Status, got.Done(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// BatchResult is the outcome of a request of a batch job. Generation or
+// Embedding is set, depending on the endpoint, when the request succeeded;
+// Err is set when it failed.
+type BatchResult struct {
+	CustomID   string
+	StatusCode int
+	RequestID  string
+	Generation *GenerationResponse
+	Embedding  *TextEmbeddingResponse
+	Err        error // *APIError
+	// Body is the raw response body.
+	Body json.RawMessage
+}
+
+// batchOutputLine is a line of a batch output or error file.
+type batchOutputLine struct {
+	ID       string `json:"id"`
+	CustomID string `json:"custom_id"`
+	Response *struct {
+		StatusCode int             `json:"status_code"`
+		RequestID  string          `json:"request_id"`
+		Body       json.RawMessage `json:"body"`
+	} `json:"response"`
+	Error *BatchError `json:"error"`
+}
+
+// Results downloads the output and error files of a finished batch job and
+// returns the result of each request by custom ID.
+func (b *Batches) Results(ctx context.Context, batch *Batch) (map[string]*BatchResult, error) {
+	files := &Files{APIKey: b.APIKey, Workspace: b.Workspace, client: b.client, c: b.c}
+	results := make(map[string]*BatchResult)
+	for _, fileID := range []string{batch.OutputFileID, batch.ErrorFileID} {
+		if fileID == "" {
+			continue
+		}
+		var buf bytes.Buffer
+		if err := files.Download(ctx, fileID, &buf); err != nil {
+			return nil, err
+		}
+		if err := parseBatchOutput(&buf, batch.Endpoint, results); err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// parseBatchOutput adds the results read from a batch output or error file.
+func parseBatchOutput(r io.Reader, endpoint string, results map[string]*BatchResult) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var line batchOutputLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return fmt.Errorf("failed to unmarshal batch result: %w", err)
+		}
+		results[line.CustomID] = newBatchResult(line, endpoint)
+	}
+	return scanner.Err()
+}
+
+func newBatchResult(line batchOutputLine, endpoint string) *BatchResult {
+	result := &BatchResult{CustomID: line.CustomID}
+	if resp := line.Response; resp != nil {
+		result.StatusCode = resp.StatusCode
+		result.RequestID = resp.RequestID
+		result.Body = resp.Body
+	}
+
+	if result.StatusCode != http.StatusOK || line.Error != nil {
+		apiErr := newAPIError(result.StatusCode, nil, result.Body)
+		if e := line.Error; e != nil {
+			apiErr.Code, apiErr.Message = e.Code, e.Message
+		}
+		if apiErr.RequestID == "" {
+			apiErr.RequestID = result.RequestID
+		}
+		result.Err = apiErr
+		return result
+	}
+
+	var err error
+	switch endpoint {
+	case BatchEndpointChatCompletions:
+		var completion ChatCompletion
+		if err = json.Unmarshal(result.Body, &completion); err == nil {
+			result.Generation = completion.ToGeneration()
+			result.Generation.StatusCode = result.StatusCode
+		}
+	case BatchEndpointEmbeddings:
+		var embeddings EmbeddingResponse
+		if err = json.Unmarshal(result.Body, &embeddings); err == nil {
+			result.Embedding = embeddings.ToTextEmbedding()
+			result.Embedding.StatusCode = result.StatusCode
+		}
+	}
+	if err != nil {
+		result.Err = fmt.Errorf("failed to unmarshal batch result: %w", err)
+	}
+	return result
+}
+
+// call sends a request to a compatible-mode batch path. A nil body sends no
+// request body.
+func (b *Batches) call(ctx context.Context, name, method, path string, body, out interface{}) (err error) {
+	url := b.c.compatibleURL(path)
+
+	info := CallInfo{Service: ServiceBatches}
+	ctx, op := b.c.startOperation(ctx, name, info)
+	defer func() { op.end(err) }()
+
+	ctx, cancel := b.c.withTimeout(ctx)
+	defer cancel()
+
+	httpReq, err := b.c.newRequest(ctx, method, url, body, b.APIKey, b.Workspace)
+	if err != nil {
+		return err
+	}
+
+	resp, err := b.c.do(b.client, httpReq, info)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return decodeResponse(resp, out)
+}
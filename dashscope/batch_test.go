@@ -0,0 +1,109 @@
+package dashscope
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseBatchOutput(t *testing.T) {
+	// batchSummary is the part of a BatchResult the tests compare.
+	type batchSummary struct {
+		StatusCode int
+		RequestID  string
+		Content    string    // Of the first generation choice
+		Embedding  []float64 // First embedding
+		Err        *APIError
+		BadBody    bool // Err is an unmarshal error
+	}
+	tests := []struct {
+		name     string
+		endpoint string
+		output   string
+		want     map[string]batchSummary
+		wantErr  bool
+	}{
+		{
+			name:     "chat completion",
+			endpoint: BatchEndpointChatCompletions,
+			output: `{"id":"1","custom_id":"a","response":{"status_code":200,"request_id":"req-a","body":{"id":"chatcmpl-a","choices":[{"index":0,"message":{"role":"assistant","content":"hi"},"finish_reason":"stop"}]}}}` + "\n" +
+				"\n" +
+				`{"id":"2","custom_id":"b","response":{"status_code":200,"request_id":"req-b","body":{"choices":[{"message":{"role":"assistant","content":"yo"}}]}}}`,
+			want: map[string]batchSummary{
+				"a": {StatusCode: 200, RequestID: "req-a", Content: "hi"},
+				"b": {StatusCode: 200, RequestID: "req-b", Content: "yo"},
+			},
+		},
+		{
+			name:     "embeddings",
+			endpoint: BatchEndpointEmbeddings,
+			output:   `{"custom_id":"e","response":{"status_code":200,"request_id":"req-e","body":{"object":"list","data":[{"index":0,"embedding":[0.5,-1]}],"usage":{"total_tokens":3}}}}`,
+			want: map[string]batchSummary{
+				"e": {StatusCode: 200, RequestID: "req-e", Embedding: []float64{0.5, -1}},
+			},
+		},
+		{
+			name:     "failed request",
+			endpoint: BatchEndpointChatCompletions,
+			output:   `{"custom_id":"f","response":{"status_code":400,"request_id":"req-f","body":{"error":{"code":"InvalidParameter","message":"bad input"}}}}`,
+			want: map[string]batchSummary{
+				"f": {StatusCode: 400, RequestID: "req-f", Err: &APIError{StatusCode: 400, Code: "InvalidParameter", Message: "bad input", RequestID: "req-f"}},
+			},
+		},
+		{
+			name:     "error file line",
+			endpoint: BatchEndpointChatCompletions,
+			output:   `{"custom_id":"g","response":null,"error":{"code":"batch_expired","message":"expired"}}`,
+			want: map[string]batchSummary{
+				"g": {Err: &APIError{Code: "batch_expired", Message: "expired"}},
+			},
+		},
+		{
+			name:     "invalid body",
+			endpoint: BatchEndpointEmbeddings,
+			output:   `{"custom_id":"h","response":{"status_code":200,"body":{"data":"nope"}}}`,
+			want: map[string]batchSummary{
+				"h": {StatusCode: 200, BadBody: true},
+			},
+		},
+		{
+			name:     "invalid line",
+			endpoint: BatchEndpointChatCompletions,
+			output:   `{"custom_id":`,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := make(map[string]*BatchResult)
+			err := parseBatchOutput(strings.NewReader(tt.output), tt.endpoint, results)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseBatchOutput error = %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := make(map[string]batchSummary)
+			for id, r := range results {
+				if r.CustomID != id {
+					t.Errorf("result %q has custom ID %q", id, r.CustomID)
+				}
+				s := batchSummary{StatusCode: r.StatusCode, RequestID: r.RequestID}
+				if r.Generation != nil && len(r.Generation.Output.Choices) > 0 {
+					s.Content = r.Generation.Output.Choices[0].Message.Content
+				}
+				if r.Embedding != nil && len(r.Embedding.Output.Embeddings) > 0 {
+					s.Embedding = r.Embedding.Output.Embeddings[0].Embedding
+				}
+				if r.Err != nil && !errors.As(r.Err, &s.Err) {
+					s.BadBody = true
+				}
+				got[id] = s
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("results = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
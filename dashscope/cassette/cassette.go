@@ -0,0 +1,216 @@
+// Package cassette records DashScope traffic to a file once and replays it
+// afterwards, so integration tests run deterministically and offline.
+//
+//	rec, err := cassette.New("testdata/chat.json", cassette.ModeAuto)
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer rec.Stop()
+//
+//	client := dashscope.NewClient(rec.ClientOptions()...)
+//
+// The recorder plugs into the client's HTTP transport and websocket dialer.
+// It captures HTTP bodies, server-sent event sequences and websocket frames,
+// both JSON events and binary audio. Credentials are stripped before a
+// cassette is written. During replay, HTTP requests are matched by method,
+// URL and body, and websocket sessions by URL, in recording order. JSON
+// bodies are compared in normalized form and multipart bodies regardless of
+// their random boundary.
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ceoifung/go-dashscope/dashscope/internal/redact"
+)
+
+// Cassette is the recorded traffic stored in a cassette file.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+	Sessions     []*Session     `json:"sessions,omitempty"`
+}
+
+// Interaction is a recorded HTTP request and its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is a recorded HTTP request. Bodies that are not valid UTF-8, such
+// as uploaded files, are stored in Binary instead of Body.
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+	Binary []byte      `json:"binary,omitempty"`
+}
+
+// Response is a recorded HTTP response. Server-sent event streams are stored
+// as Events, one entry per event, and bodies that are not valid UTF-8 as
+// Binary, instead of Body.
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+	Binary []byte      `json:"binary,omitempty"`
+	Events []string    `json:"events,omitempty"`
+}
+
+// Session is a recorded websocket connection.
+type Session struct {
+	URL    string   `json:"url"`
+	Frames []*Frame `json:"frames"`
+}
+
+// Frame directions.
+const (
+	Sent     = "sent"     // Client to DashScope
+	Received = "received" // DashScope to client
+)
+
+// Frame is a recorded websocket message. Text frames are stored in Text,
+// binary frames in Binary.
+type Frame struct {
+	Direction string `json:"direction"`
+	Text      string `json:"text,omitempty"`
+	Binary    []byte `json:"binary,omitempty"`
+}
+
+// Load reads a cassette file.
+func Load(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Save writes the cassette to path, creating its directory if needed.
+func (c *Cassette) Save(path string) error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// omittedHeaders are never written to a cassette: credentials, and the
+// length, which redaction may change.
+var omittedHeaders = []string{
+	"Authorization",
+	"X-DashScope-ApiKey",
+	"Cookie",
+	"Set-Cookie",
+	"Content-Length",
+}
+
+// sanitizer strips credentials from recorded traffic.
+type sanitizer struct {
+	secrets []string
+}
+
+func (s *sanitizer) header(h http.Header) http.Header {
+	out := h.Clone()
+	for _, name := range omittedHeaders {
+		out.Del(name)
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+func (s *sanitizer) string(v string) string {
+	return redact.String(v, s.secrets...)
+}
+
+// body sanitizes a request or response body. Binary bodies are kept as they
+// are, since replacing text in them would corrupt them.
+func (s *sanitizer) body(data []byte) (text string, binary []byte) {
+	if !utf8.Valid(data) {
+		return "", append([]byte(nil), data...)
+	}
+	return s.string(string(data)), nil
+}
+
+// addSecret makes the API key of an outgoing request a secret.
+func (s *sanitizer) addSecret(h http.Header) {
+	key := strings.TrimPrefix(h.Get("Authorization"), "Bearer ")
+	if key == "" {
+		return
+	}
+	for _, secret := range s.secrets {
+		if secret == key {
+			return
+		}
+	}
+	s.secrets = append(s.secrets, key)
+}
+
+// matchBody returns the form of the request body compared during replay.
+// Multipart boundaries are random, so they are replaced with a fixed one.
+func (r Request) matchBody() string {
+	if r.Binary != nil {
+		return normalizeMultipart(r.Header, string(r.Binary))
+	}
+	return normalizeBody(normalizeMultipart(r.Header, r.Body))
+}
+
+// normalizeMultipart replaces the boundary of a multipart body.
+func normalizeMultipart(header http.Header, body string) string {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		return body
+	}
+	return strings.ReplaceAll(body, params["boundary"], "boundary")
+}
+
+// normalizeBody returns a canonical form of a JSON body so requests differing
+// only in formatting or key order match. Other bodies are returned as-is.
+func normalizeBody(body string) string {
+	var v interface{}
+	if err := json.Unmarshal([]byte(body), &v); err != nil {
+		return strings.TrimSpace(body)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+	return strings.TrimSpace(buf.String())
+}
+
+// splitEvents splits a server-sent event stream into events.
+func splitEvents(body string) []string {
+	var events []string
+	for _, event := range strings.Split(strings.ReplaceAll(body, "\r\n", "\n"), "\n\n") {
+		if strings.TrimSpace(event) != "" {
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+// joinEvents reassembles a server-sent event stream.
+func joinEvents(events []string) string {
+	var b strings.Builder
+	for _, event := range events {
+		b.WriteString(event)
+		b.WriteString("\n\n")
+	}
+	return b.String()
+}
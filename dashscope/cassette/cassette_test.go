@@ -0,0 +1,224 @@
+package cassette_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+	"github.com/ceoifung/go-dashscope/dashscope/cassette"
+	"github.com/ceoifung/go-dashscope/dashscope/dashscopetest"
+)
+
+// binaryFile is an upload that is not valid UTF-8.
+var binaryFile = []byte{0x00, 0xff, 0xfe, 'P', 'K', 0x80, 0x81, '\n'}
+
+// outcome is what a session of calls returned.
+type outcome struct {
+	Text      string
+	Streamed  string
+	ImageURL  string
+	Audio     []byte
+	FileID    string
+	Download  []byte
+	Generated int // Stream chunks
+}
+
+// session performs an HTTP call, a stream, an async task, a websocket session
+// and a file upload and download.
+func session(t *testing.T, c *dashscope.Client) outcome {
+	t.Helper()
+	ctx := context.Background()
+	var out outcome
+
+	resp, err := c.Generation().Call(ctx, dashscope.GenerationRequest{
+		Model: dashscope.QwenTurbo,
+		Input: dashscope.GenerationInput{Prompt: "Hi"},
+	})
+	if err != nil {
+		t.Fatalf("Generation.Call: %v", err)
+	}
+	out.Text = resp.Output.Text
+
+	stream, err := c.Generation().Stream(ctx, dashscope.GenerationRequest{
+		Model:      dashscope.QwenTurbo,
+		Input:      dashscope.GenerationInput{Prompt: "Tell me more"},
+		Parameters: &dashscope.GenerationParameters{IncrementalOutput: true},
+	})
+	if err != nil {
+		t.Fatalf("Generation.Stream: %v", err)
+	}
+	for stream.Next() {
+		out.Streamed += stream.Current().Output.Text
+		out.Generated++
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+
+	image, err := c.ImageSynthesis().Call(ctx, dashscope.ImageSynthesisRequest{
+		Model: "wanx-v1",
+		Input: dashscope.ImageSynthesisInput{Prompt: "A cat"},
+	})
+	if err != nil {
+		t.Fatalf("ImageSynthesis.Call: %v", err)
+	}
+	if len(image.Output.Results) == 0 {
+		t.Fatal("ImageSynthesis.Call returned no results")
+	}
+	out.ImageURL = image.Output.Results[0].URL
+
+	speech, err := c.SpeechSynthesizer("cosyvoice-v1").Call(ctx, "Hello", nil, nil)
+	if err != nil {
+		t.Fatalf("SpeechSynthesizer.Call: %v", err)
+	}
+	out.Audio = speech.AudioData
+
+	file, err := c.Files().Upload(ctx, "data.bin", dashscope.FilePurposeFileExtract, bytes.NewReader(binaryFile))
+	if err != nil {
+		t.Fatalf("Files.Upload: %v", err)
+	}
+	out.FileID = file.ID
+
+	var buf bytes.Buffer
+	if err := c.Files().Download(ctx, file.ID, &buf); err != nil {
+		t.Fatalf("Files.Download: %v", err)
+	}
+	out.Download = buf.Bytes()
+	return out
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassettes", "session.json")
+
+	srv := dashscopetest.NewServer()
+	rec, err := cassette.New(path, cassette.ModeAuto)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if rec.Mode() != cassette.ModeRecord {
+		t.Fatalf("mode = %v without a cassette, want ModeRecord", rec.Mode())
+	}
+	recorded := session(t, srv.Client(rec.ClientOptions()...))
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if !bytes.Equal(recorded.Download, binaryFile) {
+		t.Fatalf("recorded download = %v, want %v", recorded.Download, binaryFile)
+	}
+
+	// Replay against a server that is gone.
+	srv.Close()
+	rec, err = cassette.New(path, cassette.ModeAuto)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer rec.Stop()
+	if rec.Mode() != cassette.ModeReplay {
+		t.Fatalf("mode = %v with a cassette, want ModeReplay", rec.Mode())
+	}
+	replayed := session(t, srv.Client(rec.ClientOptions()...))
+	if !reflect.DeepEqual(replayed, recorded) {
+		t.Errorf("replayed %+v, want the recorded %+v", replayed, recorded)
+	}
+}
+
+func TestCassetteContents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+
+	srv := dashscopetest.NewServer()
+	defer srv.Close()
+	rec, err := cassette.New(path, cassette.ModeRecord)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	rec.Redact("Hangzhou")
+	if _, err := srv.Client(rec.ClientOptions()...).Generation().Call(context.Background(), dashscope.GenerationRequest{
+		Model: dashscope.QwenTurbo,
+		Input: dashscope.GenerationInput{Prompt: "Weather in Hangzhou? My key is sk-0123456789abcdef0123"},
+	}); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	session(t, srv.Client(rec.ClientOptions()...))
+	if err := rec.Stop(); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{srv.APIKey, "sk-0123456789abcdef0123", "Hangzhou"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("cassette contains %q", secret)
+		}
+	}
+
+	c, err := cassette.Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	var upload, download *cassette.Interaction
+	for _, in := range c.Interactions {
+		switch {
+		case in.Request.Method == "POST" && strings.HasSuffix(in.Request.URL, "/files"):
+			upload = in
+		case strings.HasSuffix(in.Request.URL, "/content"):
+			download = in
+		}
+	}
+	if upload == nil || upload.Request.Binary == nil || upload.Request.Body != "" {
+		t.Errorf("upload = %+v, want its body stored as binary", upload)
+	}
+	if download == nil || !bytes.Equal(download.Response.Binary, binaryFile) {
+		t.Errorf("download = %+v, want its body stored as binary", download)
+	}
+	if len(c.Sessions) != 1 {
+		t.Fatalf("%d sessions recorded, want 1", len(c.Sessions))
+	}
+	var audio bool
+	for _, f := range c.Sessions[0].Frames {
+		audio = audio || (f.Direction == cassette.Received && f.Binary != nil)
+	}
+	if !audio {
+		t.Error("session has no received audio frame")
+	}
+}
+
+func TestReplayMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session.json")
+	empty := &cassette.Cassette{}
+	if err := empty.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	rec, err := cassette.New(path, cassette.ModeReplay)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	defer rec.Stop()
+
+	c := dashscope.NewClient(append(rec.ClientOptions(),
+		dashscope.WithAPIKey("sk-test"),
+		dashscope.WithRetryPolicy(&dashscope.RetryPolicy{}))...)
+	_, err = c.Generation().Call(context.Background(), dashscope.GenerationRequest{
+		Model: dashscope.QwenTurbo,
+		Input: dashscope.GenerationInput{Prompt: "Hi"},
+	})
+	if !errors.Is(err, cassette.ErrNoMatch) {
+		t.Errorf("Call error = %v, want %v", err, cassette.ErrNoMatch)
+	}
+
+	if _, err := c.SpeechSynthesizer("cosyvoice-v1").Call(context.Background(), "Hello", nil, nil); err == nil {
+		t.Error("SpeechSynthesizer.Call succeeded without a recorded session")
+	}
+
+	if _, err := cassette.New(filepath.Join(t.TempDir(), "missing.json"), cassette.ModeReplay); err == nil {
+		t.Error("New succeeded in replay mode without a cassette")
+	}
+}
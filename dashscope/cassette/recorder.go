@@ -0,0 +1,257 @@
+package cassette
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+	"github.com/gorilla/websocket"
+)
+
+// Mode selects whether a Recorder records or replays.
+type Mode int
+
+const (
+	// ModeReplay serves traffic from an existing cassette and never touches
+	// the network.
+	ModeReplay Mode = iota
+	// ModeRecord sends traffic to DashScope and overwrites the cassette.
+	ModeRecord
+	// ModeAuto replays if the cassette exists and records otherwise.
+	ModeAuto
+)
+
+// ErrNoMatch is returned during replay for requests missing from the cassette.
+var ErrNoMatch = errors.New("cassette: no recorded interaction matches the request")
+
+// Recorder records or replays DashScope traffic.
+type Recorder struct {
+	path string
+	mode Mode
+
+	// Transport sends requests while recording. Nil uses
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+	// Dialer dials DashScope websockets while recording. Nil uses a dialer
+	// like the client's default.
+	Dialer *websocket.Dialer
+
+	mu        sync.Mutex
+	cassette  *Cassette
+	used      []bool // Replayed interactions
+	sessions  []bool // Replayed sessions
+	sanitizer sanitizer
+	proxy     *proxy
+}
+
+// New creates a recorder for the cassette at path. In replay mode the
+// cassette must exist.
+func New(path string, mode Mode) (*Recorder, error) {
+	if mode == ModeAuto {
+		mode = ModeRecord
+		if _, err := os.Stat(path); err == nil {
+			mode = ModeReplay
+		}
+	}
+
+	r := &Recorder{path: path, mode: mode}
+	if mode == ModeReplay {
+		c, err := Load(path)
+		if err != nil {
+			return nil, err
+		}
+		r.cassette = c
+		r.used = make([]bool, len(c.Interactions))
+		r.sessions = make([]bool, len(c.Sessions))
+	} else {
+		r.cassette = &Cassette{}
+	}
+	return r, nil
+}
+
+// Mode returns ModeRecord or ModeReplay.
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Redact adds strings, besides API keys, that must not appear in the
+// cassette.
+func (r *Recorder) Redact(secrets ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sanitizer.secrets = append(r.sanitizer.secrets, secrets...)
+}
+
+// ClientOptions returns the options routing a client through the recorder.
+func (r *Recorder) ClientOptions() []dashscope.ClientOption {
+	return []dashscope.ClientOption{
+		dashscope.WithHTTPClient(r.HTTPClient()),
+		dashscope.WithWebsocketDialer(r.WebsocketDialer()),
+	}
+}
+
+// HTTPClient returns an HTTP client using the recorder as its transport.
+func (r *Recorder) HTTPClient() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// Stop shuts down the websocket proxy and, when recording, writes the
+// cassette.
+func (r *Recorder) Stop() error {
+	r.mu.Lock()
+	p := r.proxy
+	r.proxy = nil
+	r.mu.Unlock()
+	if p != nil {
+		p.close()
+	}
+
+	if r.mode != ModeRecord {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cassette.Save(r.path)
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if r.mode == ModeReplay {
+		return r.replay(req, body)
+	}
+	return r.record(req, body)
+}
+
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	r.mu.Lock()
+	live := Request{
+		Method: req.Method,
+		URL:    r.sanitizer.string(req.URL.String()),
+		Header: req.Header,
+	}
+	live.Body, live.Binary = r.sanitizer.body(body)
+	match := live.matchBody()
+
+	var found *Interaction
+	for i, in := range r.cassette.Interactions {
+		if r.used[i] || in.Request.Method != live.Method || in.Request.URL != live.URL {
+			continue
+		}
+		if in.Request.matchBody() != match {
+			continue
+		}
+		r.used[i] = true
+		found = in
+		break
+	}
+	r.mu.Unlock()
+
+	if found == nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoMatch, req.Method, req.URL)
+	}
+
+	content := found.Response.Body
+	switch {
+	case found.Response.Events != nil:
+		content = joinEvents(found.Response.Events)
+	case found.Response.Binary != nil:
+		content = string(found.Response.Binary)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", found.Response.Status, http.StatusText(found.Response.Status)),
+		StatusCode:    found.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        found.Response.Header.Clone(),
+		Body:          io.NopCloser(strings.NewReader(content)),
+		ContentLength: int64(len(content)),
+		Request:       req,
+	}, nil
+}
+
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	r.mu.Lock()
+	r.sanitizer.addSecret(req.Header)
+	in := &Interaction{Request: Request{
+		Method: req.Method,
+		URL:    r.sanitizer.string(req.URL.String()),
+		Header: r.sanitizer.header(req.Header),
+	}}
+	in.Request.Body, in.Request.Binary = r.sanitizer.body(body)
+	r.mu.Unlock()
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// The body is passed through as it arrives so streams stay live, and
+	// the interaction is stored once the caller is done with it.
+	resp.Body = &teeBody{
+		ReadCloser: resp.Body,
+		done: func(data []byte) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			in.Response = Response{
+				Status: resp.StatusCode,
+				Header: r.sanitizer.header(resp.Header),
+			}
+			if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+				in.Response.Events = splitEvents(r.sanitizer.string(string(data)))
+			} else {
+				in.Response.Body, in.Response.Binary = r.sanitizer.body(data)
+			}
+			r.cassette.Interactions = append(r.cassette.Interactions, in)
+		},
+	}
+	return resp, nil
+}
+
+func (r *Recorder) sanitizeString(v string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sanitizer.string(v)
+}
+
+// teeBody copies a response body as it is read and reports it when closed.
+type teeBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	once sync.Once
+	done func([]byte)
+}
+
+func (t *teeBody) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	t.buf.Write(p[:n])
+	return n, err
+}
+
+func (t *teeBody) Close() error {
+	err := t.ReadCloser.Close()
+	t.once.Do(func() { t.done(t.buf.Bytes()) })
+	return err
+}
@@ -0,0 +1,245 @@
+package cassette
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebsocketDialer returns a dialer routing websocket connections through the
+// recorder. Connections are served by a local proxy that forwards them to
+// DashScope while recording, and plays the cassette back while replaying.
+func (r *Recorder) WebsocketDialer() *websocket.Dialer {
+	p := r.startProxy()
+	return &websocket.Dialer{
+		HandshakeTimeout: 10 * time.Second,
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return p.dial(ctx, p.plain)
+		},
+		// The proxy speaks plain websocket; dialing it here tells the dialer
+		// the TLS handshake is done.
+		NetDialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return p.dial(ctx, p.secure)
+		},
+	}
+}
+
+func (r *Recorder) startProxy() *proxy {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.proxy == nil {
+		p := &proxy{r: r}
+		p.plain = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			p.serve(w, req, "ws")
+		}))
+		p.secure = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			p.serve(w, req, "wss")
+		}))
+		r.proxy = p
+	}
+	return r.proxy
+}
+
+// proxy is the local websocket endpoint. It listens twice so it knows whether
+// the client dialed ws:// or wss://.
+type proxy struct {
+	r        *Recorder
+	plain    *httptest.Server
+	secure   *httptest.Server
+	upgrader websocket.Upgrader
+}
+
+func (p *proxy) dial(ctx context.Context, srv *httptest.Server) (net.Conn, error) {
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", srv.Listener.Addr().String())
+}
+
+func (p *proxy) close() {
+	p.plain.CloseClientConnections()
+	p.plain.Close()
+	p.secure.CloseClientConnections()
+	p.secure.Close()
+}
+
+func (p *proxy) serve(w http.ResponseWriter, req *http.Request, scheme string) {
+	url := scheme + "://" + req.Host + req.URL.RequestURI()
+	if p.r.mode == ModeReplay {
+		p.replay(w, req, url)
+	} else {
+		p.record(w, req, url)
+	}
+}
+
+// handshakeHeaders are set by the dialer and must not be forwarded.
+var handshakeHeaders = map[string]bool{
+	"Upgrade":                  true,
+	"Connection":               true,
+	"Sec-Websocket-Key":        true,
+	"Sec-Websocket-Version":    true,
+	"Sec-Websocket-Extensions": true,
+	"Sec-Websocket-Protocol":   true,
+}
+
+func (p *proxy) record(w http.ResponseWriter, req *http.Request, url string) {
+	header := http.Header{}
+	for k, v := range req.Header {
+		if !handshakeHeaders[k] {
+			header[k] = v
+		}
+	}
+
+	dialer := p.r.Dialer
+	if dialer == nil {
+		dialer = &websocket.Dialer{
+			Proxy:            http.ProxyFromEnvironment,
+			HandshakeTimeout: 10 * time.Second,
+		}
+	}
+	upstream, resp, err := dialer.DialContext(req.Context(), url, header)
+	if err != nil {
+		// Pass handshake failures such as 401 on to the client.
+		status := http.StatusBadGateway
+		if resp != nil {
+			status = resp.StatusCode
+			defer resp.Body.Close()
+		}
+		w.WriteHeader(status)
+		if resp != nil {
+			io.Copy(w, resp.Body)
+		}
+		return
+	}
+	defer upstream.Close()
+
+	client, err := p.upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		return
+	}
+	defer client.Close()
+
+	p.r.mu.Lock()
+	p.r.sanitizer.addSecret(req.Header)
+	session := &Session{URL: p.r.sanitizer.string(url)}
+	p.r.cassette.Sessions = append(p.r.cassette.Sessions, session)
+	p.r.mu.Unlock()
+
+	add := func(direction string, messageType int, data []byte) {
+		p.r.mu.Lock()
+		defer p.r.mu.Unlock()
+		frame := &Frame{Direction: direction}
+		if messageType == websocket.BinaryMessage {
+			frame.Binary = append([]byte(nil), data...)
+		} else {
+			frame.Text = p.r.sanitizer.string(string(data))
+		}
+		session.Frames = append(session.Frames, frame)
+	}
+
+	done := make(chan struct{}, 2)
+	go pipe(client, upstream, Sent, add, done)
+	go pipe(upstream, client, Received, add, done)
+	<-done
+	client.Close()
+	upstream.Close()
+	<-done
+}
+
+// pipe copies messages from src to dst until either fails, forwarding a
+// close from src.
+func pipe(src, dst *websocket.Conn, direction string, add func(string, int, []byte), done chan<- struct{}) {
+	defer func() { done <- struct{}{} }()
+	for {
+		messageType, data, err := src.ReadMessage()
+		if err != nil {
+			msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+			if e, ok := err.(*websocket.CloseError); ok && e.Code != websocket.CloseNoStatusReceived {
+				msg = websocket.FormatCloseMessage(e.Code, e.Text)
+			}
+			dst.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+			return
+		}
+		add(direction, messageType, data)
+		if err := dst.WriteMessage(messageType, data); err != nil {
+			return
+		}
+	}
+}
+
+func (p *proxy) replay(w http.ResponseWriter, req *http.Request, url string) {
+	url = p.r.sanitizeString(url)
+
+	p.r.mu.Lock()
+	var session *Session
+	for i, s := range p.r.cassette.Sessions {
+		if !p.r.sessions[i] && s.URL == url {
+			p.r.sessions[i] = true
+			session = s
+			break
+		}
+	}
+	p.r.mu.Unlock()
+
+	if session == nil {
+		http.Error(w, ErrNoMatch.Error()+": websocket "+url, http.StatusBadGateway)
+		return
+	}
+
+	conn, err := p.upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// Task IDs are generated by the client, so the recorded ones are
+	// rewritten to the live ones.
+	var ids []string
+	for _, frame := range session.Frames {
+		if frame.Direction == Sent {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			recorded, live := taskID([]byte(frame.Text)), taskID(data)
+			if recorded != "" && live != "" && recorded != live {
+				ids = append(ids, recorded, live)
+			}
+			continue
+		}
+
+		if frame.Binary != nil {
+			err = conn.WriteMessage(websocket.BinaryMessage, frame.Binary)
+		} else {
+			err = conn.WriteMessage(websocket.TextMessage, []byte(strings.NewReplacer(ids...).Replace(frame.Text)))
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	// Wait for the client to hang up.
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// taskID extracts the task ID of a websocket JSON message.
+func taskID(data []byte) string {
+	var msg struct {
+		Header struct {
+			TaskID string `json:"task_id"`
+		} `json:"header"`
+	}
+	if json.Unmarshal(data, &msg) != nil {
+		return ""
+	}
+	return msg.Header.TaskID
+}
@@ -0,0 +1,427 @@
+package dashscope
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultUserAgent is sent with every request unless overridden with WithUserAgent.
+const DefaultUserAgent = "dashscope-go-sdk/0.1.0"
+
+// Client holds the configuration shared by every DashScope service: credentials,
+// HTTP transport, websocket dialer and defaults. Service handles such as
+// Generation or SpeechSynthesizer obtained from a Client inherit all of it.
+type Client struct {
+	apiKey       string
+	workspace    string
+	baseURL      string
+	websocketURL string
+	compatURL    string
+	httpClient   *http.Client
+	dialer       *websocket.Dialer
+	userAgent    string
+	timeout      time.Duration
+	retry        *RetryPolicy
+	limiter      *RateLimiter
+	middleware   []Middleware
+	tracer       trace.Tracer
+	metrics      MetricsRecorder
+	logger       *slog.Logger
+	logBodies    bool
+
+	tokenCounters []TokenCounter
+	tokenCache    *tokenCache
+}
+
+// ClientOption configures a Client.
+type ClientOption func(*Client)
+
+// WithAPIKey sets the API key. If unset, DASHSCOPE_API_KEY is used.
+func WithAPIKey(apiKey string) ClientOption {
+	return func(c *Client) {
+		c.apiKey = apiKey
+	}
+}
+
+// WithWorkspace sets the workspace ID sent as X-DashScope-WorkSpace.
+func WithWorkspace(workspace string) ClientOption {
+	return func(c *Client) {
+		c.workspace = workspace
+	}
+}
+
+// WithBaseURL sets the HTTP base URL, e.g. "https://dashscope-intl.aliyuncs.com/api/v1"
+// or the address of a private gateway. If unset, DASHSCOPE_HTTP_BASE_URL is used,
+// falling back to DefaultHTTPBaseURL.
+func WithBaseURL(baseURL string) ClientOption {
+	return func(c *Client) {
+		c.baseURL = baseURL
+	}
+}
+
+// WithCompatibleBaseURL sets the base URL of the OpenAI-compatible
+// endpoints. If unset, DASHSCOPE_COMPATIBLE_BASE_URL is used, falling back
+// to the HTTP base URL with /compatible-mode/v1 in place of /api/v1.
+func WithCompatibleBaseURL(baseURL string) ClientOption {
+	return func(c *Client) {
+		c.compatURL = baseURL
+	}
+}
+
+// WithWebsocketURL sets the websocket inference URL. If unset,
+// DASHSCOPE_WEBSOCKET_BASE_URL is used, falling back to DefaultWebsocketBaseURL.
+func WithWebsocketURL(websocketURL string) ClientOption {
+	return func(c *Client) {
+		c.websocketURL = websocketURL
+	}
+}
+
+// WithRegion sets the base URLs to the public endpoints of region.
+// Unknown regions leave the base URLs unchanged.
+func WithRegion(region Region) ClientOption {
+	return func(c *Client) {
+		switch region {
+		case RegionBeijing:
+			c.baseURL = DefaultHTTPBaseURL
+			c.websocketURL = DefaultWebsocketBaseURL
+			c.compatURL = DefaultCompatibleBaseURL
+		case RegionSingapore:
+			c.baseURL = IntlHTTPBaseURL
+			c.websocketURL = IntlWebsocketBaseURL
+			c.compatURL = IntlCompatibleBaseURL
+		}
+	}
+}
+
+// WithHTTPClient sets the HTTP client used by all HTTP services.
+func WithHTTPClient(client *http.Client) ClientOption {
+	return func(c *Client) {
+		c.httpClient = client
+	}
+}
+
+// WithWebsocketDialer sets the dialer used by the websocket services
+// (SpeechSynthesizer, Recognition and MultiModalDialog).
+func WithWebsocketDialer(dialer *websocket.Dialer) ClientOption {
+	return func(c *Client) {
+		c.dialer = dialer
+	}
+}
+
+// WithUserAgent sets the User-Agent header.
+func WithUserAgent(userAgent string) ClientOption {
+	return func(c *Client) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithTimeout sets a default timeout for non-streaming calls whose context
+// has no deadline of its own. Zero means no timeout.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// NewClient creates a new Client.
+func NewClient(opts ...ClientOption) *Client {
+	c := &Client{
+		httpClient: &http.Client{},
+		dialer: &websocket.Dialer{
+			HandshakeTimeout: 10 * time.Second,
+		},
+		userAgent: DefaultUserAgent,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.apiKey == "" {
+		c.apiKey = os.Getenv("DASHSCOPE_API_KEY")
+	}
+	if c.baseURL == "" {
+		c.baseURL = os.Getenv("DASHSCOPE_HTTP_BASE_URL")
+	}
+	if c.baseURL == "" {
+		c.baseURL = DefaultHTTPBaseURL
+	}
+	if c.compatURL == "" {
+		c.compatURL = os.Getenv("DASHSCOPE_COMPATIBLE_BASE_URL")
+	}
+	if c.compatURL == "" {
+		c.compatURL = strings.TrimSuffix(strings.TrimRight(c.baseURL, "/"), "/api/v1") + "/compatible-mode/v1"
+	}
+	if c.websocketURL == "" {
+		c.websocketURL = os.Getenv("DASHSCOPE_WEBSOCKET_BASE_URL")
+	}
+	if c.websocketURL == "" {
+		c.websocketURL = DefaultWebsocketBaseURL
+	}
+	if c.httpClient == nil {
+		c.httpClient = &http.Client{}
+	}
+	if c.dialer == nil {
+		c.dialer = websocket.DefaultDialer
+	}
+	return c
+}
+
+// defaultClient is used by the websocket services when they are built as
+// struct literals, as they could be before Client existed, rather than
+// obtained from a Client.
+var defaultClient = sync.OnceValue(func() *Client { return NewClient() })
+
+// APIKey returns the configured API key.
+func (c *Client) APIKey() string {
+	return c.apiKey
+}
+
+// Workspace returns the configured workspace ID.
+func (c *Client) Workspace() string {
+	return c.workspace
+}
+
+// BaseURL returns the HTTP base URL.
+func (c *Client) BaseURL() string {
+	return c.baseURL
+}
+
+// WebsocketURL returns the websocket inference URL.
+func (c *Client) WebsocketURL() string {
+	return c.websocketURL
+}
+
+// CompatibleBaseURL returns the base URL of the OpenAI-compatible endpoints.
+func (c *Client) CompatibleBaseURL() string {
+	return c.compatURL
+}
+
+// Generation returns a text generation handle.
+func (c *Client) Generation() *Generation {
+	return &Generation{
+		APIKey:    c.apiKey,
+		Workspace: c.workspace,
+		client:    c.httpClient,
+		c:         c,
+	}
+}
+
+// Embeddings returns a text embedding handle.
+func (c *Client) Embeddings() *TextEmbedding {
+	return &TextEmbedding{
+		APIKey: c.apiKey,
+		client: c.httpClient,
+		c:      c,
+	}
+}
+
+// MultimodalEmbedding returns a multimodal embedding handle.
+func (c *Client) MultimodalEmbedding() *MultimodalEmbedding {
+	return &MultimodalEmbedding{
+		APIKey: c.apiKey,
+		client: c.httpClient,
+		c:      c,
+	}
+}
+
+// ImageSynthesis returns an image synthesis handle.
+func (c *Client) ImageSynthesis() *ImageSynthesis {
+	return &ImageSynthesis{
+		APIKey: c.apiKey,
+		client: c.httpClient,
+		c:      c,
+	}
+}
+
+// Transcription returns an audio transcription handle.
+func (c *Client) Transcription() *Transcription {
+	return &Transcription{
+		APIKey: c.apiKey,
+		client: c.httpClient,
+		c:      c,
+	}
+}
+
+// Understanding returns an NLU handle.
+func (c *Client) Understanding() *Understanding {
+	return &Understanding{
+		APIKey: c.apiKey,
+		client: c.httpClient,
+		c:      c,
+	}
+}
+
+// TextReRank returns a text rerank handle.
+func (c *Client) TextReRank() *TextReRank {
+	return &TextReRank{
+		APIKey: c.apiKey,
+		client: c.httpClient,
+		c:      c,
+	}
+}
+
+// Tokenization returns a tokenizer API handle.
+func (c *Client) Tokenization() *Tokenization {
+	return &Tokenization{
+		APIKey:    c.apiKey,
+		Workspace: c.workspace,
+		client:    c.httpClient,
+		c:         c,
+	}
+}
+
+// Compatible returns a handle to the OpenAI-compatible endpoints.
+func (c *Client) Compatible() *Compatible {
+	return &Compatible{
+		APIKey:    c.apiKey,
+		Workspace: c.workspace,
+		client:    c.httpClient,
+		c:         c,
+	}
+}
+
+// Application returns a Bailian application handle.
+func (c *Client) Application() *Application {
+	return &Application{
+		APIKey:    c.apiKey,
+		Workspace: c.workspace,
+		client:    c.httpClient,
+		c:         c,
+	}
+}
+
+// Files returns a file storage handle.
+func (c *Client) Files() *Files {
+	return &Files{
+		APIKey:    c.apiKey,
+		Workspace: c.workspace,
+		client:    c.httpClient,
+		c:         c,
+	}
+}
+
+// Batches returns a batch inference handle.
+func (c *Client) Batches() *Batches {
+	return &Batches{
+		APIKey:    c.apiKey,
+		Workspace: c.workspace,
+		client:    c.httpClient,
+		c:         c,
+	}
+}
+
+// MultiModalConversation returns a multimodal conversation handle.
+func (c *Client) MultiModalConversation() *MultiModalConversation {
+	return &MultiModalConversation{
+		APIKey:    c.apiKey,
+		Workspace: c.workspace,
+		client:    c.httpClient,
+		c:         c,
+	}
+}
+
+// SpeechSynthesizer returns a text-to-speech handle for the given model.
+func (c *Client) SpeechSynthesizer(model string) *SpeechSynthesizer {
+	return &SpeechSynthesizer{
+		Model:     model,
+		APIKey:    c.apiKey,
+		Workspace: c.workspace,
+		c:         c,
+	}
+}
+
+// Recognition returns a real-time speech recognition handle.
+func (c *Client) Recognition(model, format string, sampleRate int) *Recognition {
+	return &Recognition{
+		Model:      model,
+		APIKey:     c.apiKey,
+		Format:     format,
+		SampleRate: sampleRate,
+		Workspace:  c.workspace,
+		c:          c,
+	}
+}
+
+// GetTask retrieves the status of an asynchronous task.
+func (c *Client) GetTask(ctx context.Context, taskID string) (*TaskResponse, error) {
+	return c.getTask(ctx, c.httpClient, c.apiKey, taskID)
+}
+
+// WaitForTask waits for an asynchronous task to complete. A task that
+// failed, was canceled or is unknown is returned along with an *APIError.
+func (c *Client) WaitForTask(ctx context.Context, taskID string) (*TaskResponse, error) {
+	return c.waitForTask(ctx, c.httpClient, c.apiKey, taskID)
+}
+
+// url joins path onto the HTTP base URL.
+func (c *Client) url(path string) string {
+	return strings.TrimRight(c.baseURL, "/") + path
+}
+
+// compatibleURL returns the URL of a compatible-mode path.
+func (c *Client) compatibleURL(path string) string {
+	return strings.TrimRight(c.compatURL, "/") + path
+}
+
+// setHeaders sets the headers shared by every DashScope HTTP and websocket request.
+func (c *Client) setHeaders(header http.Header, apiKey, workspace string) {
+	header.Set("Authorization", "Bearer "+apiKey)
+	if c.userAgent != "" {
+		header.Set("User-Agent", c.userAgent)
+	}
+	if workspace == "" {
+		workspace = c.workspace
+	}
+	if workspace != "" {
+		header.Set("X-DashScope-WorkSpace", workspace)
+	}
+}
+
+// newRequest builds a JSON request carrying the shared DashScope headers.
+// A nil body sends no request body.
+func (c *Client) newRequest(ctx context.Context, method, url string, body interface{}, apiKey, workspace string) (*http.Request, error) {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, &buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	c.setHeaders(req.Header, apiKey, workspace)
+	return req, nil
+}
+
+// withTimeout applies the default timeout to ctx if it has no deadline.
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout <= 0 {
+		return ctx, func() {}
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+// dial opens a websocket connection carrying the shared DashScope headers.
+func (c *Client) dial(ctx context.Context, apiKey, workspace string) (*websocket.Conn, error) {
+	header := http.Header{}
+	c.setHeaders(header, apiKey, workspace)
+	conn, _, err := c.dialer.DialContext(ctx, c.websocketURL, header)
+	return conn, err
+}
@@ -0,0 +1,392 @@
+package dashscope_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+	"github.com/ceoifung/go-dashscope/dashscope/dashscopetest"
+)
+
+// capture is a server recording the last request it received, replying
+// with body.
+func capture(t *testing.T, body string) (*httptest.Server, func() *http.Request) {
+	t.Helper()
+	var mu sync.Mutex
+	var last *http.Request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		mu.Lock()
+		last = r
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() *http.Request {
+		mu.Lock()
+		defer mu.Unlock()
+		return last
+	}
+}
+
+func TestNewClientAPIKey(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		opts []dashscope.ClientOption
+		want string
+	}{
+		{"unset", "", nil, ""},
+		{"environment", "sk-env", nil, "sk-env"},
+		{"option", "sk-env", []dashscope.ClientOption{dashscope.WithAPIKey("sk-opt")}, "sk-opt"},
+		{"empty option", "sk-env", []dashscope.ClientOption{dashscope.WithAPIKey("")}, "sk-env"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DASHSCOPE_API_KEY", tt.env)
+			c := dashscope.NewClient(tt.opts...)
+			if got := c.APIKey(); got != tt.want {
+				t.Errorf("APIKey = %q, want %q", got, tt.want)
+			}
+			if got := c.Generation().APIKey; got != tt.want {
+				t.Errorf("Generation().APIKey = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientHeaders(t *testing.T) {
+	const generation = `{"request_id":"req-1","output":{"text":"hi","finish_reason":"stop"}}`
+	const embedding = `{"request_id":"req-1","output":{"embeddings":[]}}`
+	ctx := context.Background()
+	genReq := dashscope.GenerationRequest{Model: dashscope.QwenTurbo, Input: dashscope.GenerationInput{Prompt: "Hi"}}
+	embedReq := dashscope.TextEmbeddingRequest{Model: dashscope.TextEmbeddingV3, Input: dashscope.TextEmbeddingInput{Texts: []string{"a"}}}
+
+	tests := []struct {
+		name          string
+		body          string
+		opts          []dashscope.ClientOption
+		call          func(c *dashscope.Client) error
+		wantKey       string
+		wantWorkspace string
+		wantUserAgent string
+	}{
+		{
+			name: "defaults",
+			body: generation,
+			opts: []dashscope.ClientOption{dashscope.WithAPIKey("sk-a")},
+			call: func(c *dashscope.Client) error {
+				_, err := c.Generation().Call(ctx, genReq)
+				return err
+			},
+			wantKey:       "sk-a",
+			wantUserAgent: dashscope.DefaultUserAgent,
+		},
+		{
+			name: "client options",
+			body: generation,
+			opts: []dashscope.ClientOption{dashscope.WithAPIKey("sk-a"), dashscope.WithWorkspace("ws-client"), dashscope.WithUserAgent("app/1.0")},
+			call: func(c *dashscope.Client) error {
+				_, err := c.Generation().Call(ctx, genReq)
+				return err
+			},
+			wantKey:       "sk-a",
+			wantWorkspace: "ws-client",
+			wantUserAgent: "app/1.0",
+		},
+		{
+			name: "handle overrides",
+			body: generation,
+			opts: []dashscope.ClientOption{dashscope.WithAPIKey("sk-a"), dashscope.WithWorkspace("ws-client")},
+			call: func(c *dashscope.Client) error {
+				g := c.Generation()
+				g.APIKey = "sk-b"
+				g.SetWorkspace("ws-handle")
+				_, err := g.Call(ctx, genReq)
+				return err
+			},
+			wantKey:       "sk-b",
+			wantWorkspace: "ws-handle",
+			wantUserAgent: dashscope.DefaultUserAgent,
+		},
+		{
+			name: "workspace fallback",
+			body: embedding,
+			opts: []dashscope.ClientOption{dashscope.WithAPIKey("sk-a"), dashscope.WithWorkspace("ws-client")},
+			call: func(c *dashscope.Client) error {
+				_, err := c.Embeddings().Call(ctx, embedReq)
+				return err
+			},
+			wantKey:       "sk-a",
+			wantWorkspace: "ws-client",
+			wantUserAgent: dashscope.DefaultUserAgent,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, last := capture(t, tt.body)
+			c := dashscope.NewClient(append(tt.opts, dashscope.WithBaseURL(srv.URL))...)
+			if err := tt.call(c); err != nil {
+				t.Fatal(err)
+			}
+			header := last().Header
+			if got := header.Get("Authorization"); got != "Bearer "+tt.wantKey {
+				t.Errorf("Authorization = %q, want %q", got, "Bearer "+tt.wantKey)
+			}
+			if got := header.Get("X-DashScope-WorkSpace"); got != tt.wantWorkspace {
+				t.Errorf("X-DashScope-WorkSpace = %q, want %q", got, tt.wantWorkspace)
+			}
+			if got := header.Get("User-Agent"); got != tt.wantUserAgent {
+				t.Errorf("User-Agent = %q, want %q", got, tt.wantUserAgent)
+			}
+			if got := header.Get("Content-Type"); got != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", got)
+			}
+		})
+	}
+}
+
+func TestClientBaseURLs(t *testing.T) {
+	type urls struct{ http, websocket, compatible string }
+	defaults := urls{dashscope.DefaultHTTPBaseURL, dashscope.DefaultWebsocketBaseURL, dashscope.DefaultCompatibleBaseURL}
+	intl := urls{dashscope.IntlHTTPBaseURL, dashscope.IntlWebsocketBaseURL, dashscope.IntlCompatibleBaseURL}
+
+	tests := []struct {
+		name string
+		env  urls
+		opts []dashscope.ClientOption
+		want urls
+	}{
+		{name: "defaults", want: defaults},
+		{name: "beijing", opts: []dashscope.ClientOption{dashscope.WithRegion(dashscope.RegionBeijing)}, want: defaults},
+		{name: "singapore", opts: []dashscope.ClientOption{dashscope.WithRegion(dashscope.RegionSingapore)}, want: intl},
+		{name: "unknown region", opts: []dashscope.ClientOption{dashscope.WithRegion("eu-central-1")}, want: defaults},
+		{
+			name: "environment",
+			env:  urls{"https://env.example.com/api/v1", "wss://env.example.com/ws", "https://env.example.com/compat"},
+			want: urls{"https://env.example.com/api/v1", "wss://env.example.com/ws", "https://env.example.com/compat"},
+		},
+		{
+			name: "options over environment",
+			env:  urls{"https://env.example.com/api/v1", "wss://env.example.com/ws", "https://env.example.com/compat"},
+			opts: []dashscope.ClientOption{
+				dashscope.WithBaseURL("https://gw.example.com/api/v1"),
+				dashscope.WithWebsocketURL("wss://gw.example.com/ws"),
+				dashscope.WithCompatibleBaseURL("https://gw.example.com/compat"),
+			},
+			want: urls{"https://gw.example.com/api/v1", "wss://gw.example.com/ws", "https://gw.example.com/compat"},
+		},
+		{
+			name: "region over environment",
+			env:  urls{"https://env.example.com/api/v1", "wss://env.example.com/ws", "https://env.example.com/compat"},
+			opts: []dashscope.ClientOption{dashscope.WithRegion(dashscope.RegionSingapore)},
+			want: intl,
+		},
+		{
+			name: "later option wins",
+			opts: []dashscope.ClientOption{dashscope.WithRegion(dashscope.RegionSingapore), dashscope.WithBaseURL("https://gw.example.com/api/v1")},
+			want: urls{"https://gw.example.com/api/v1", dashscope.IntlWebsocketBaseURL, dashscope.IntlCompatibleBaseURL},
+		},
+		{
+			name: "compatible derived from base",
+			opts: []dashscope.ClientOption{dashscope.WithBaseURL("https://gw.example.com/api/v1/")},
+			want: urls{"https://gw.example.com/api/v1/", dashscope.DefaultWebsocketBaseURL, "https://gw.example.com/compatible-mode/v1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DASHSCOPE_HTTP_BASE_URL", tt.env.http)
+			t.Setenv("DASHSCOPE_WEBSOCKET_BASE_URL", tt.env.websocket)
+			t.Setenv("DASHSCOPE_COMPATIBLE_BASE_URL", tt.env.compatible)
+			c := dashscope.NewClient(tt.opts...)
+			got := urls{c.BaseURL(), c.WebsocketURL(), c.CompatibleBaseURL()}
+			if got != tt.want {
+				t.Errorf("URLs = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientURLs(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		base     string // Appended to the server URL
+		body     string
+		call     func(c *dashscope.Client) error
+		wantPath string
+	}{
+		{
+			name: "service path",
+			base: "/api/v1",
+			body: `{"request_id":"req-1","output":{"text":"hi"}}`,
+			call: func(c *dashscope.Client) error {
+				_, err := c.Generation().Call(ctx, dashscope.GenerationRequest{Model: dashscope.QwenTurbo})
+				return err
+			},
+			wantPath: "/api/v1" + dashscope.QwenGenerationPath,
+		},
+		{
+			name: "trailing slash",
+			base: "/api/v1/",
+			body: `{"request_id":"req-1","output":{"text":"hi"}}`,
+			call: func(c *dashscope.Client) error {
+				_, err := c.Generation().Call(ctx, dashscope.GenerationRequest{Model: dashscope.QwenTurbo})
+				return err
+			},
+			wantPath: "/api/v1" + dashscope.QwenGenerationPath,
+		},
+		{
+			name: "task",
+			base: "/gateway/api/v1",
+			body: `{"request_id":"req-1","output":{"task_id":"task-1","task_status":"SUCCEEDED"}}`,
+			call: func(c *dashscope.Client) error {
+				_, err := c.GetTask(ctx, "task-1")
+				return err
+			},
+			wantPath: "/gateway/api/v1" + dashscope.TaskPath + "/task-1",
+		},
+		{
+			name: "escaped task ID",
+			base: "/api/v1",
+			body: `{"request_id":"req-1","output":{"task_id":"a/b c","task_status":"SUCCEEDED"}}`,
+			call: func(c *dashscope.Client) error {
+				_, err := c.GetTask(ctx, "a/b c")
+				return err
+			},
+			wantPath: "/api/v1" + dashscope.TaskPath + "/a%2Fb%20c",
+		},
+		{
+			name: "compatible mode",
+			base: "/api/v1/",
+			body: `{"id":"chatcmpl-1","object":"chat.completion","choices":[]}`,
+			call: func(c *dashscope.Client) error {
+				_, err := c.Compatible().ChatCompletion(ctx, dashscope.ChatCompletionRequest{Model: dashscope.QwenTurbo})
+				return err
+			},
+			wantPath: "/compatible-mode/v1" + dashscope.CompatibleChatCompletionsPath,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DASHSCOPE_COMPATIBLE_BASE_URL", "")
+			srv, last := capture(t, tt.body)
+			c := dashscope.NewClient(dashscope.WithAPIKey("sk-a"), dashscope.WithBaseURL(srv.URL+tt.base))
+			if err := tt.call(c); err != nil {
+				t.Fatal(err)
+			}
+			if got := last().URL.EscapedPath(); got != tt.wantPath {
+				t.Errorf("path = %s, want %s", got, tt.wantPath)
+			}
+		})
+	}
+}
+
+// roundTripFunc is an http.RoundTripper calling itself.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestClientHTTPOptions(t *testing.T) {
+	t.Run("http client", func(t *testing.T) {
+		t.Setenv("DASHSCOPE_HTTP_BASE_URL", "")
+		var sent *http.Request
+		client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			sent = r
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Header:     http.Header{"Content-Type": {"application/json"}},
+				Body:       io.NopCloser(strings.NewReader(`{"request_id":"req-1","output":{"text":"hi"}}`)),
+			}, nil
+		})}
+		c := dashscope.NewClient(dashscope.WithAPIKey("sk-a"), dashscope.WithHTTPClient(client))
+		if _, err := c.Generation().Call(context.Background(), dashscope.GenerationRequest{Model: dashscope.QwenTurbo}); err != nil {
+			t.Fatal(err)
+		}
+		if sent == nil {
+			t.Fatal("request not sent through the configured HTTP client")
+		}
+		if want := dashscope.DefaultHTTPBaseURL + dashscope.QwenGenerationPath; sent.URL.String() != want {
+			t.Errorf("URL = %s, want %s", sent.URL, want)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		release := make(chan struct{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-release
+		}))
+		defer srv.Close()
+		defer close(release)
+		c := dashscope.NewClient(dashscope.WithAPIKey("sk-a"), dashscope.WithBaseURL(srv.URL), dashscope.WithTimeout(10*time.Millisecond))
+		start := time.Now()
+		if _, err := c.Generation().Call(context.Background(), dashscope.GenerationRequest{Model: dashscope.QwenTurbo}); err == nil {
+			t.Fatal("Call succeeded, want a timeout")
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("Call returned after %v, want the 10ms timeout", elapsed)
+		}
+	})
+}
+
+// completionCallback records how a recognition session ended.
+type completionCallback struct {
+	mu        sync.Mutex
+	err       error
+	completed bool
+}
+
+func (c *completionCallback) OnOpen()                                     {}
+func (c *completionCallback) OnClose()                                    {}
+func (c *completionCallback) OnEvent(result *dashscope.RecognitionResult) {}
+
+func (c *completionCallback) OnComplete() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.completed = true
+}
+
+func (c *completionCallback) OnError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+func TestWebsocketServiceLiterals(t *testing.T) {
+	srv := dashscopetest.NewServer()
+	defer srv.Close()
+	// Struct literals have no Client, so they use a default one configured
+	// from the environment.
+	t.Setenv("DASHSCOPE_WEBSOCKET_BASE_URL", srv.WebsocketURL)
+
+	synth := &dashscope.SpeechSynthesizer{Model: "cosyvoice-v1", APIKey: srv.APIKey}
+	result, err := synth.Call(context.Background(), "Hello", nil, nil)
+	if err != nil {
+		t.Fatalf("SpeechSynthesizer.Call: %v", err)
+	}
+	if len(result.AudioData) == 0 {
+		t.Error("SpeechSynthesizer.Call returned no audio")
+	}
+
+	cb := &completionCallback{}
+	rec := &dashscope.Recognition{Model: "paraformer-realtime-v2", APIKey: srv.APIKey, Format: "pcm", SampleRate: 16000}
+	if err := rec.Start(context.Background(), cb, nil); err != nil {
+		t.Fatalf("Recognition.Start: %v", err)
+	}
+	if err := rec.SendAudioFrame(make([]byte, 3200)); err != nil {
+		t.Fatalf("SendAudioFrame: %v", err)
+	}
+	rec.Stop()
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	if cb.err != nil || !cb.completed {
+		t.Errorf("recognition ended with error %v, completed %v", cb.err, cb.completed)
+	}
+}
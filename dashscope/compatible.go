@@ -0,0 +1,600 @@
+package dashscope
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Compatible handles the OpenAI-compatible endpoints of DashScope, which
+// speak the OpenAI wire format. Their types convert to and from the native
+// ones, so a request can be sent with either protocol.
+type Compatible struct {
+	APIKey    string
+	Workspace string
+	client    *http.Client
+	c         *Client
+}
+
+// NewCompatible creates a new Compatible client.
+func NewCompatible(apiKey string) *Compatible {
+	return NewClient(WithAPIKey(apiKey)).Compatible()
+}
+
+// SetHTTPClient sets a custom HTTP client.
+func (c *Compatible) SetHTTPClient(client *http.Client) {
+	c.client = client
+}
+
+// ChatCompletionRequest is an OpenAI chat completion request. DashScope
+// specific parameters are sent alongside the OpenAI ones.
+type ChatCompletionRequest struct {
+	Model             string          `json:"model"`
+	Messages          []Message       `json:"messages"`
+	Stream            bool            `json:"stream,omitempty"`
+	StreamOptions     *StreamOptions  `json:"stream_options,omitempty"`
+	MaxTokens         int             `json:"max_tokens,omitempty"`
+	Temperature       float64         `json:"temperature,omitempty"`
+	TopP              float64         `json:"top_p,omitempty"`
+	PresencePenalty   float64         `json:"presence_penalty,omitempty"`
+	Seed              uint64          `json:"seed,omitempty"`
+	Stop              interface{}     `json:"stop,omitempty"` // string or []string
+	N                 int             `json:"n,omitempty"`
+	Tools             []Tool          `json:"tools,omitempty"`
+	ToolChoice        interface{}     `json:"tool_choice,omitempty"`
+	ParallelToolCalls bool            `json:"parallel_tool_calls,omitempty"`
+	ResponseFormat    *ResponseFormat `json:"response_format,omitempty"`
+	User              string          `json:"user,omitempty"`
+
+	// DashScope extensions
+	TopK              int     `json:"top_k,omitempty"`
+	RepetitionPenalty float64 `json:"repetition_penalty,omitempty"`
+	EnableSearch      bool    `json:"enable_search,omitempty"`
+	EnableThinking    *bool   `json:"enable_thinking,omitempty"`
+	ThinkingBudget    int     `json:"thinking_budget,omitempty"`
+}
+
+// StreamOptions configures a streamed chat completion.
+type StreamOptions struct {
+	// IncludeUsage adds a final chunk without choices carrying the usage.
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// ChatCompletion is an OpenAI chat completion.
+type ChatCompletion struct {
+	ID                string                 `json:"id"`
+	Object            string                 `json:"object"` // "chat.completion"
+	Created           int64                  `json:"created"`
+	Model             string                 `json:"model"`
+	Choices           []ChatCompletionChoice `json:"choices"`
+	Usage             *CompletionUsage       `json:"usage,omitempty"`
+	SystemFingerprint string                 `json:"system_fingerprint,omitempty"`
+}
+
+// ChatCompletionChoice is a reply of a chat completion.
+type ChatCompletionChoice struct {
+	Index        int     `json:"index"`
+	Message      Message `json:"message"`
+	FinishReason string  `json:"finish_reason"`
+}
+
+// ChatCompletionChunk is a chunk of a streamed chat completion.
+type ChatCompletionChunk struct {
+	ID      string                      `json:"id"`
+	Object  string                      `json:"object"` // "chat.completion.chunk"
+	Created int64                       `json:"created"`
+	Model   string                      `json:"model"`
+	Choices []ChatCompletionChunkChoice `json:"choices"`
+	Usage   *CompletionUsage            `json:"usage,omitempty"`
+}
+
+// ChatCompletionChunkChoice is the delta of a reply in a chunk. The finish
+// reason is empty until the last chunk of the reply.
+type ChatCompletionChunkChoice struct {
+	Index        int     `json:"index"`
+	Delta        Message `json:"delta"`
+	FinishReason *string `json:"finish_reason"`
+}
+
+// CompletionUsage is the token usage of a chat completion.
+type CompletionUsage struct {
+	PromptTokens            int                      `json:"prompt_tokens"`
+	CompletionTokens        int                      `json:"completion_tokens"`
+	TotalTokens             int                      `json:"total_tokens"`
+	CompletionTokensDetails *CompletionTokensDetails `json:"completion_tokens_details,omitempty"`
+}
+
+// CompletionTokensDetails breaks down the completion tokens.
+type CompletionTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+// EmbeddingRequest is an OpenAI embeddings request.
+type EmbeddingRequest struct {
+	Model          string         `json:"model"`
+	Input          EmbeddingInput `json:"input"`
+	Dimensions     int            `json:"dimensions,omitempty"`
+	EncodingFormat string         `json:"encoding_format,omitempty"` // Only "float" is supported
+}
+
+// EmbeddingInput is the text, or texts, to embed. It decodes from a string
+// or an array of strings.
+type EmbeddingInput []string
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (in *EmbeddingInput) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*in = EmbeddingInput{text}
+		return nil
+	}
+	var texts []string
+	if err := json.Unmarshal(data, &texts); err != nil {
+		return fmt.Errorf("dashscope: embedding input must be a string or an array of strings")
+	}
+	*in = texts
+	return nil
+}
+
+// EmbeddingResponse is an OpenAI embeddings response.
+type EmbeddingResponse struct {
+	ID     string      `json:"id,omitempty"`
+	Object string      `json:"object"` // "list"
+	Data   []Embedding `json:"data"`
+	Model  string      `json:"model"`
+	Usage  struct {
+		PromptTokens int `json:"prompt_tokens"`
+		TotalTokens  int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+// Embedding is the embedding of the input text at Index.
+type Embedding struct {
+	Object    string    `json:"object"` // "embedding"
+	Index     int       `json:"index"`
+	Embedding []float64 `json:"embedding"`
+}
+
+// ModelList lists the models available in compatible mode.
+type ModelList struct {
+	Object string  `json:"object"` // "list"
+	Data   []Model `json:"data"`
+}
+
+// Model describes a model.
+type Model struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"` // "model"
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// ChatCompletion performs a chat completion. Thinking requests, which are
+// only served as a stream, are streamed and assembled.
+func (c *Compatible) ChatCompletion(ctx context.Context, req ChatCompletionRequest) (_ *ChatCompletion, err error) {
+	req.Stream = false
+	req.StreamOptions = nil
+	req.Messages = withoutReasoning(req.Messages)
+	if thinking(req.Model, req.EnableThinking) {
+		return c.collect(ctx, req)
+	}
+
+	url := c.c.compatibleURL(CompatibleChatCompletionsPath)
+
+	info := CallInfo{Service: ServiceChatCompletions, Model: req.Model}
+	ctx, op := c.c.startOperation(ctx, "Compatible.ChatCompletion", info)
+	defer func() { op.end(err) }()
+
+	ctx, cancel := c.c.withTimeout(ctx)
+	defer cancel()
+
+	if err := op.reserve(ctx, estimateGenerationTokens(req.ToGeneration(), op.counter(ctx))); err != nil {
+		return nil, err
+	}
+
+	httpReq, err := c.c.newRequest(ctx, "POST", url, req, c.APIKey, c.Workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.do(c.client, httpReq, info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var completion ChatCompletion
+	err = decodeResponse(resp, &completion)
+	op.setRequestID(completion.ID)
+	if u := completion.Usage; u != nil {
+		op.setUsage(u.PromptTokens, u.CompletionTokens)
+	}
+	if err != nil {
+		return &completion, err
+	}
+
+	return &completion, nil
+}
+
+// ChatCompletionStream performs a streamed chat completion. Usage is
+// requested in a final chunk unless StreamOptions is set. The caller must
+// read the stream to the end or Close it.
+func (c *Compatible) ChatCompletionStream(ctx context.Context, req ChatCompletionRequest) (*Stream[ChatCompletionChunk], error) {
+	return c.stream(ctx, req, "Compatible.ChatCompletionStream")
+}
+
+func (c *Compatible) stream(ctx context.Context, req ChatCompletionRequest, name string) (_ *Stream[ChatCompletionChunk], err error) {
+	url := c.c.compatibleURL(CompatibleChatCompletionsPath)
+
+	req.Stream = true
+	if req.StreamOptions == nil {
+		req.StreamOptions = &StreamOptions{IncludeUsage: true}
+	}
+	req.Messages = withoutReasoning(req.Messages)
+
+	info := CallInfo{Service: ServiceChatCompletions, Model: req.Model, Stream: true}
+	ctx, op := c.c.startOperation(ctx, name, info)
+	defer func() {
+		if err != nil {
+			op.end(err)
+		}
+	}()
+
+	if err := op.reserve(ctx, estimateGenerationTokens(req.ToGeneration(), op.counter(ctx))); err != nil {
+		return nil, err
+	}
+
+	httpReq, err := c.c.newRequest(ctx, "POST", url, req, c.APIKey, c.Workspace)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.c.do(c.client, httpReq, info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	if err := checkStreamResponse(resp); err != nil {
+		return nil, err
+	}
+
+	return newStream(ctx, op, resp, func(chunk *ChatCompletionChunk) {
+		if len(chunk.Choices) > 0 {
+			op.markFirstToken()
+		}
+		op.setRequestID(chunk.ID)
+		if u := chunk.Usage; u != nil {
+			op.setUsage(u.PromptTokens, u.CompletionTokens)
+		}
+	}), nil
+}
+
+// collect streams a chat completion and assembles the reply.
+func (c *Compatible) collect(ctx context.Context, req ChatCompletionRequest) (*ChatCompletion, error) {
+	ctx, cancel := c.c.withTimeout(ctx)
+	defer cancel()
+
+	stream, err := c.stream(ctx, req, "Compatible.ChatCompletion")
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	req.Stream = true
+	acc := NewGenerationAccumulator(req.ToGeneration())
+	for stream.Next() {
+		acc.Add(stream.Current().ToGeneration())
+	}
+	return NewChatCompletion(acc.Response(), req.Model), stream.Err()
+}
+
+// Generate sends a native generation request through the compatible
+// endpoint and returns the native response.
+func (c *Compatible) Generate(ctx context.Context, req GenerationRequest) (*GenerationResponse, error) {
+	completion, err := c.ChatCompletion(ctx, NewChatCompletionRequest(req))
+	if completion == nil {
+		return nil, err
+	}
+	return completion.ToGeneration(), err
+}
+
+// Embeddings embeds texts.
+func (c *Compatible) Embeddings(ctx context.Context, req EmbeddingRequest) (_ *EmbeddingResponse, err error) {
+	url := c.c.compatibleURL(CompatibleEmbeddingsPath)
+
+	info := CallInfo{Service: ServiceEmbeddings, Model: req.Model}
+	ctx, op := c.c.startOperation(ctx, "Compatible.Embeddings", info)
+	defer func() { op.end(err) }()
+
+	ctx, cancel := c.c.withTimeout(ctx)
+	defer cancel()
+
+	if err := op.reserve(ctx, estimateTextsTokens(req.Input, op.counter(ctx))); err != nil {
+		return nil, err
+	}
+
+	httpReq, err := c.c.newRequest(ctx, "POST", url, req, c.APIKey, c.Workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.do(c.client, httpReq, info)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var embResp EmbeddingResponse
+	err = decodeResponse(resp, &embResp)
+	op.setRequestID(embResp.ID)
+	op.setUsage(embResp.Usage.TotalTokens, 0)
+	if err != nil {
+		return &embResp, err
+	}
+
+	return &embResp, nil
+}
+
+// Models lists the models available in compatible mode.
+func (c *Compatible) Models(ctx context.Context) (_ *ModelList, err error) {
+	url := c.c.compatibleURL(CompatibleModelsPath)
+
+	info := CallInfo{Service: ServiceModels}
+	ctx, op := c.c.startOperation(ctx, "Compatible.Models", info)
+	defer func() { op.end(err) }()
+
+	ctx, cancel := c.c.withTimeout(ctx)
+	defer cancel()
+
+	httpReq, err := c.c.newRequest(ctx, "GET", url, nil, c.APIKey, c.Workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.do(c.client, httpReq, info)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var list ModelList
+	op.setRequestID(resp.Header.Get("X-Request-Id"))
+	if err := decodeResponse(resp, &list); err != nil {
+		return &list, err
+	}
+	return &list, nil
+}
+
+// NewChatCompletionRequest converts a native generation request. A prompt
+// becomes a trailing user message and incremental output becomes streaming.
+func NewChatCompletionRequest(req GenerationRequest) ChatCompletionRequest {
+	out := ChatCompletionRequest{
+		Model:    req.Model,
+		Messages: append([]Message(nil), req.Input.Messages...),
+	}
+	if req.Input.Prompt != "" {
+		out.Messages = append(out.Messages, Message{Role: RoleUser, Content: req.Input.Prompt})
+	}
+	if p := req.Parameters; p != nil {
+		out.Stream = p.Stream || p.IncrementalOutput
+		out.MaxTokens = p.MaxTokens
+		out.Temperature = p.Temperature
+		out.TopP = p.TopP
+		out.TopK = p.TopK
+		out.Seed = p.Seed
+		out.Stop = p.Stop
+		out.RepetitionPenalty = p.RepetitionPenalty
+		out.EnableSearch = p.EnableSearch
+		out.Tools = p.Tools
+		out.ToolChoice = p.ToolChoice
+		out.ParallelToolCalls = p.ParallelToolCalls
+		out.ResponseFormat = p.ResponseFormat
+		out.EnableThinking = p.EnableThinking
+		out.ThinkingBudget = p.ThinkingBudget
+	}
+	return out
+}
+
+// ToGeneration converts the request to a native generation request in the
+// message format. Streaming becomes incremental output.
+func (r ChatCompletionRequest) ToGeneration() GenerationRequest {
+	return GenerationRequest{
+		Model: r.Model,
+		Input: GenerationInput{Messages: append([]Message(nil), r.Messages...)},
+		Parameters: &GenerationParameters{
+			ResultFormat:      "message",
+			IncrementalOutput: r.Stream,
+			MaxTokens:         r.MaxTokens,
+			Temperature:       r.Temperature,
+			TopP:              r.TopP,
+			TopK:              r.TopK,
+			Seed:              r.Seed,
+			Stop:              r.Stop,
+			RepetitionPenalty: r.RepetitionPenalty,
+			EnableSearch:      r.EnableSearch,
+			Tools:             r.Tools,
+			ToolChoice:        r.ToolChoice,
+			ParallelToolCalls: r.ParallelToolCalls,
+			ResponseFormat:    r.ResponseFormat,
+			EnableThinking:    r.EnableThinking,
+			ThinkingBudget:    r.ThinkingBudget,
+		},
+	}
+}
+
+// NewChatCompletion converts a native generation response, in either result
+// format, to a chat completion of model.
+func NewChatCompletion(resp *GenerationResponse, model string) *ChatCompletion {
+	out := &ChatCompletion{
+		ID:      resp.RequestID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []ChatCompletionChoice{},
+		Usage:   newCompletionUsage(resp.Usage),
+	}
+	for i, choice := range nativeChoices(resp) {
+		out.Choices = append(out.Choices, ChatCompletionChoice{
+			Index:        i,
+			Message:      choice.Message,
+			FinishReason: choice.FinishReason,
+		})
+	}
+	return out
+}
+
+// ToGeneration converts the completion to a native response in the message
+// format.
+func (c *ChatCompletion) ToGeneration() *GenerationResponse {
+	out := &GenerationResponse{RequestID: c.ID}
+	for _, choice := range c.Choices {
+		out.Output.Choices = append(out.Output.Choices, Choice{
+			FinishReason: choice.FinishReason,
+			Message:      choice.Message,
+		})
+	}
+	if c.Usage != nil {
+		out.Usage = c.Usage.toGeneration()
+	}
+	return out
+}
+
+// NewChatCompletionChunk converts a chunk of an incremental native stream to
+// a chat completion chunk of model. A chunk with usage but no output, as
+// sent last when usage is requested, has no choices.
+func NewChatCompletionChunk(resp *GenerationResponse, model string) *ChatCompletionChunk {
+	out := &ChatCompletionChunk{
+		ID:      resp.RequestID,
+		Object:  "chat.completion.chunk",
+		Created: time.Now().Unix(),
+		Model:   model,
+		Choices: []ChatCompletionChunkChoice{},
+	}
+	for i, choice := range nativeChoices(resp) {
+		c := ChatCompletionChunkChoice{Index: i, Delta: choice.Message}
+		if choice.FinishReason != "" && choice.FinishReason != "null" {
+			c.FinishReason = &choice.FinishReason
+		}
+		out.Choices = append(out.Choices, c)
+	}
+	if len(out.Choices) == 0 {
+		out.Usage = newCompletionUsage(resp.Usage)
+	}
+	return out
+}
+
+// ToGeneration converts the chunk to a chunk of an incremental native
+// stream in the message format.
+func (c *ChatCompletionChunk) ToGeneration() *GenerationResponse {
+	out := &GenerationResponse{RequestID: c.ID}
+	for _, choice := range c.Choices {
+		finish := "null"
+		if choice.FinishReason != nil {
+			finish = *choice.FinishReason
+		}
+		out.Output.Choices = append(out.Output.Choices, Choice{
+			FinishReason: finish,
+			Message:      choice.Delta,
+		})
+	}
+	if c.Usage != nil {
+		out.Usage = c.Usage.toGeneration()
+	}
+	return out
+}
+
+// NewEmbeddingResponse converts a native text embedding response to an
+// embeddings response of model.
+func NewEmbeddingResponse(resp *TextEmbeddingResponse, model string) *EmbeddingResponse {
+	out := &EmbeddingResponse{
+		ID:     resp.RequestID,
+		Object: "list",
+		Data:   make([]Embedding, len(resp.Output.Embeddings)),
+		Model:  model,
+	}
+	for i, e := range resp.Output.Embeddings {
+		out.Data[i] = Embedding{Object: "embedding", Index: e.TextIndex, Embedding: e.Embedding}
+	}
+	out.Usage.PromptTokens = resp.Usage.TotalTokens
+	out.Usage.TotalTokens = resp.Usage.TotalTokens
+	return out
+}
+
+// ToTextEmbedding converts the response to a native text embedding response.
+func (r *EmbeddingResponse) ToTextEmbedding() *TextEmbeddingResponse {
+	out := &TextEmbeddingResponse{RequestID: r.ID}
+	out.Output.Embeddings = make([]EmbeddingResult, len(r.Data))
+	for i, e := range r.Data {
+		out.Output.Embeddings[i] = EmbeddingResult{TextIndex: e.Index, Embedding: e.Embedding}
+	}
+	out.Usage.TotalTokens = r.Usage.TotalTokens
+	return out
+}
+
+// NewEmbeddingRequest converts a native text embedding request.
+func NewEmbeddingRequest(req TextEmbeddingRequest) EmbeddingRequest {
+	out := EmbeddingRequest{
+		Model: req.Model,
+		Input: append(EmbeddingInput(nil), req.Input.Texts...),
+	}
+	if req.Parameters != nil {
+		out.Dimensions = req.Parameters.Dimension
+	}
+	return out
+}
+
+// ToTextEmbedding converts the request to a native text embedding request.
+func (r EmbeddingRequest) ToTextEmbedding() TextEmbeddingRequest {
+	out := TextEmbeddingRequest{
+		Model: r.Model,
+		Input: TextEmbeddingInput{Texts: r.Input},
+	}
+	if r.Dimensions > 0 {
+		out.Parameters = &TextEmbeddingParameters{Dimension: r.Dimensions}
+	}
+	return out
+}
+
+// nativeChoices returns the choices of a response, turning the text result
+// format into a single assistant message.
+func nativeChoices(resp *GenerationResponse) []Choice {
+	if len(resp.Output.Choices) > 0 || (resp.Output.Text == "" && resp.Output.FinishReason == "") {
+		return resp.Output.Choices
+	}
+	return []Choice{{
+		FinishReason: resp.Output.FinishReason,
+		Message:      Message{Role: RoleAssistant, Content: resp.Output.Text},
+	}}
+}
+
+func newCompletionUsage(usage GenerationUsage) *CompletionUsage {
+	if usage == (GenerationUsage{}) {
+		return nil
+	}
+	out := &CompletionUsage{
+		PromptTokens:     usage.InputTokens,
+		CompletionTokens: usage.OutputTokens,
+		TotalTokens:      usage.TotalTokens,
+	}
+	if out.TotalTokens == 0 {
+		out.TotalTokens = usage.InputTokens + usage.OutputTokens
+	}
+	if n := usage.OutputTokensDetails.ReasoningTokens; n > 0 {
+		out.CompletionTokensDetails = &CompletionTokensDetails{ReasoningTokens: n}
+	}
+	return out
+}
+
+func (u *CompletionUsage) toGeneration() GenerationUsage {
+	out := GenerationUsage{
+		InputTokens:  u.PromptTokens,
+		OutputTokens: u.CompletionTokens,
+		TotalTokens:  u.TotalTokens,
+	}
+	if d := u.CompletionTokensDetails; d != nil {
+		out.OutputTokensDetails.ReasoningTokens = d.ReasoningTokens
+	}
+	return out
+}
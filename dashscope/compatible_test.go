@@ -0,0 +1,306 @@
+package dashscope
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChatCompletionRequestConversion(t *testing.T) {
+	enabled := true
+	tests := []struct {
+		name string
+		req  GenerationRequest
+		want ChatCompletionRequest
+	}{
+		{
+			name: "prompt",
+			req:  GenerationRequest{Model: QwenTurbo, Input: GenerationInput{Prompt: "Hi"}},
+			want: ChatCompletionRequest{Model: QwenTurbo, Messages: []Message{{Role: RoleUser, Content: "Hi"}}},
+		},
+		{
+			name: "messages and prompt",
+			req: GenerationRequest{Model: QwenTurbo, Input: GenerationInput{
+				Messages: []Message{{Role: RoleSystem, Content: "Be brief."}},
+				Prompt:   "Hi",
+			}},
+			want: ChatCompletionRequest{Model: QwenTurbo, Messages: []Message{
+				{Role: RoleSystem, Content: "Be brief."},
+				{Role: RoleUser, Content: "Hi"},
+			}},
+		},
+		{
+			name: "parameters",
+			req: GenerationRequest{
+				Model: QwenPlus,
+				Input: GenerationInput{Messages: []Message{{Role: RoleUser, Content: "Hi"}}},
+				Parameters: &GenerationParameters{
+					IncrementalOutput: true,
+					MaxTokens:         100,
+					Temperature:       0.5,
+					TopK:              20,
+					Stop:              []string{"\n"},
+					EnableSearch:      true,
+					EnableThinking:    &enabled,
+					ThinkingBudget:    500,
+				},
+			},
+			want: ChatCompletionRequest{
+				Model:          QwenPlus,
+				Messages:       []Message{{Role: RoleUser, Content: "Hi"}},
+				Stream:         true,
+				MaxTokens:      100,
+				Temperature:    0.5,
+				TopK:           20,
+				Stop:           []string{"\n"},
+				EnableSearch:   true,
+				EnableThinking: &enabled,
+				ThinkingBudget: 500,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewChatCompletionRequest(tt.req)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("NewChatCompletionRequest = %+v, want %+v", got, tt.want)
+			}
+
+			back := got.ToGeneration()
+			if back.Model != tt.req.Model || !reflect.DeepEqual(back.Input.Messages, got.Messages) {
+				t.Errorf("ToGeneration = %+v, want the model and messages back", back)
+			}
+			if back.Parameters.ResultFormat != "message" || back.Parameters.IncrementalOutput != got.Stream {
+				t.Errorf("ToGeneration parameters = %+v, want message format and incremental output %v", back.Parameters, got.Stream)
+			}
+			if p := tt.req.Parameters; p != nil && (back.Parameters.MaxTokens != p.MaxTokens || back.Parameters.ThinkingBudget != p.ThinkingBudget) {
+				t.Errorf("ToGeneration parameters = %+v, want those of %+v", back.Parameters, p)
+			}
+		})
+	}
+}
+
+func TestChatCompletionConversion(t *testing.T) {
+	usage := GenerationUsage{InputTokens: 5, OutputTokens: 7, TotalTokens: 12, OutputTokensDetails: OutputTokensDetails{ReasoningTokens: 3}}
+	wantUsage := &CompletionUsage{PromptTokens: 5, CompletionTokens: 7, TotalTokens: 12, CompletionTokensDetails: &CompletionTokensDetails{ReasoningTokens: 3}}
+	reply := Message{Role: RoleAssistant, Content: "Hello", ReasoningContent: "Greet back."}
+
+	tests := []struct {
+		name      string
+		resp      GenerationResponse
+		want      []ChatCompletionChoice
+		wantUsage *CompletionUsage
+	}{
+		{
+			name: "message format",
+			resp: GenerationResponse{
+				RequestID: "req-1",
+				Output:    GenerationOutput{Choices: []Choice{{FinishReason: "stop", Message: reply}}},
+				Usage:     usage,
+			},
+			want:      []ChatCompletionChoice{{Message: reply, FinishReason: "stop"}},
+			wantUsage: wantUsage,
+		},
+		{
+			name: "text format",
+			resp: GenerationResponse{
+				RequestID: "req-1",
+				Output:    GenerationOutput{Text: "Hello", FinishReason: "stop"},
+				Usage:     GenerationUsage{InputTokens: 5, OutputTokens: 7},
+			},
+			want:      []ChatCompletionChoice{{Message: Message{Role: RoleAssistant, Content: "Hello"}, FinishReason: "stop"}},
+			wantUsage: &CompletionUsage{PromptTokens: 5, CompletionTokens: 7, TotalTokens: 12},
+		},
+		{
+			name: "no output",
+			resp: GenerationResponse{RequestID: "req-1"},
+			want: []ChatCompletionChoice{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewChatCompletion(&tt.resp, QwenTurbo)
+			if got.ID != "req-1" || got.Object != "chat.completion" || got.Model != QwenTurbo {
+				t.Errorf("completion = %+v, want the request ID and model", got)
+			}
+			if !reflect.DeepEqual(got.Choices, tt.want) {
+				t.Errorf("choices = %+v, want %+v", got.Choices, tt.want)
+			}
+			if !reflect.DeepEqual(got.Usage, tt.wantUsage) {
+				t.Errorf("usage = %+v, want %+v", got.Usage, tt.wantUsage)
+			}
+
+			back := got.ToGeneration()
+			if back.RequestID != "req-1" || !reflect.DeepEqual(back.Output.Choices, nativeChoices(&tt.resp)) {
+				t.Errorf("ToGeneration = %+v, want the choices back", back)
+			}
+			if tt.wantUsage != nil && back.Usage != got.Usage.toGeneration() {
+				t.Errorf("ToGeneration usage = %+v", back.Usage)
+			}
+		})
+	}
+}
+
+func TestChatCompletionChunkConversion(t *testing.T) {
+	stop := "stop"
+	tests := []struct {
+		name       string
+		resp       GenerationResponse
+		want       []ChatCompletionChunkChoice
+		wantUsage  *CompletionUsage
+		wantFinish string // Finish reason after converting back
+	}{
+		{
+			name: "delta",
+			resp: GenerationResponse{Output: GenerationOutput{Choices: []Choice{{
+				FinishReason: "null",
+				Message:      Message{Role: RoleAssistant, Content: "Hel"},
+			}}}},
+			want:       []ChatCompletionChunkChoice{{Delta: Message{Role: RoleAssistant, Content: "Hel"}}},
+			wantFinish: "null",
+		},
+		{
+			name: "last delta",
+			resp: GenerationResponse{Output: GenerationOutput{Choices: []Choice{{
+				FinishReason: "stop",
+				Message:      Message{Content: "lo"},
+			}}}, Usage: GenerationUsage{InputTokens: 1, OutputTokens: 2, TotalTokens: 3}},
+			want:       []ChatCompletionChunkChoice{{Delta: Message{Content: "lo"}, FinishReason: &stop}},
+			wantFinish: "stop",
+		},
+		{
+			name:      "usage only",
+			resp:      GenerationResponse{Usage: GenerationUsage{InputTokens: 1, OutputTokens: 2, TotalTokens: 3}},
+			want:      []ChatCompletionChunkChoice{},
+			wantUsage: &CompletionUsage{PromptTokens: 1, CompletionTokens: 2, TotalTokens: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewChatCompletionChunk(&tt.resp, QwenTurbo)
+			if !reflect.DeepEqual(got.Choices, tt.want) {
+				t.Errorf("choices = %+v, want %+v", got.Choices, tt.want)
+			}
+			if !reflect.DeepEqual(got.Usage, tt.wantUsage) {
+				t.Errorf("usage = %+v, want %+v", got.Usage, tt.wantUsage)
+			}
+
+			back := got.ToGeneration()
+			if len(back.Output.Choices) != len(tt.want) {
+				t.Fatalf("ToGeneration choices = %+v", back.Output.Choices)
+			}
+			if len(tt.want) > 0 && back.Output.Choices[0].FinishReason != tt.wantFinish {
+				t.Errorf("finish reason = %q, want %q", back.Output.Choices[0].FinishReason, tt.wantFinish)
+			}
+		})
+	}
+}
+
+func TestEmbeddingConversion(t *testing.T) {
+	req := TextEmbeddingRequest{
+		Model:      TextEmbeddingV3,
+		Input:      TextEmbeddingInput{Texts: []string{"a", "b"}},
+		Parameters: &TextEmbeddingParameters{Dimension: 512},
+	}
+	compat := NewEmbeddingRequest(req)
+	if want := (EmbeddingRequest{Model: TextEmbeddingV3, Input: EmbeddingInput{"a", "b"}, Dimensions: 512}); !reflect.DeepEqual(compat, want) {
+		t.Errorf("NewEmbeddingRequest = %+v, want %+v", compat, want)
+	}
+	if back := compat.ToTextEmbedding(); !reflect.DeepEqual(back, req) {
+		t.Errorf("ToTextEmbedding = %+v, want %+v", back, req)
+	}
+
+	var resp TextEmbeddingResponse
+	resp.RequestID = "req-1"
+	resp.Output.Embeddings = []EmbeddingResult{{TextIndex: 1, Embedding: []float64{0.5}}, {TextIndex: 0, Embedding: []float64{1}}}
+	resp.Usage.TotalTokens = 2
+	out := NewEmbeddingResponse(&resp, TextEmbeddingV3)
+	want := []Embedding{{Object: "embedding", Index: 1, Embedding: []float64{0.5}}, {Object: "embedding", Index: 0, Embedding: []float64{1}}}
+	if !reflect.DeepEqual(out.Data, want) || out.Usage.PromptTokens != 2 || out.Usage.TotalTokens != 2 {
+		t.Errorf("NewEmbeddingResponse = %+v", out)
+	}
+	if back := out.ToTextEmbedding(); !reflect.DeepEqual(back, &resp) {
+		t.Errorf("ToTextEmbedding = %+v, want %+v", back, &resp)
+	}
+}
+
+func TestEmbeddingInputUnmarshal(t *testing.T) {
+	tests := []struct {
+		data    string
+		want    EmbeddingInput
+		wantErr bool
+	}{
+		{`"a"`, EmbeddingInput{"a"}, false},
+		{`["a","b"]`, EmbeddingInput{"a", "b"}, false},
+		{`[1]`, nil, true},
+		{`{}`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			var in EmbeddingInput
+			err := json.Unmarshal([]byte(tt.data), &in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(in, tt.want) {
+				t.Errorf("input = %q, want %q", in, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompatibleChatCompletionWithoutReasoning(t *testing.T) {
+	var sent ChatCompletionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&sent)
+		io.WriteString(w, `{"id":"chatcmpl-1","object":"chat.completion","choices":[{"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}]}`)
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithAPIKey("sk-test"), WithCompatibleBaseURL(srv.URL))
+	messages := []Message{
+		{Role: RoleUser, Content: "Hi"},
+		{Role: RoleAssistant, Content: "Hello", ReasoningContent: "Greet back."},
+		{Role: RoleUser, Content: "How are you?"},
+	}
+	if _, err := c.Compatible().ChatCompletion(context.Background(), ChatCompletionRequest{Model: QwenTurbo, Messages: messages}); err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range sent.Messages {
+		if msg.ReasoningContent != "" {
+			t.Errorf("sent reasoning content %q", msg.ReasoningContent)
+		}
+	}
+	if messages[1].ReasoningContent == "" {
+		t.Error("the caller's messages were modified")
+	}
+}
+
+func TestCompatibleModelsRequestID(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-Id", "req-models")
+		io.WriteString(w, `{"object":"list","data":[{"id":"qwen-turbo","object":"model"}]}`)
+	}))
+	defer srv.Close()
+
+	var logs bytes.Buffer
+	c := NewClient(WithAPIKey("sk-test"), WithCompatibleBaseURL(srv.URL),
+		WithLogger(slog.New(slog.NewTextHandler(&logs, nil))))
+	list, err := c.Compatible().Models(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Data) != 1 || list.Data[0].ID != "qwen-turbo" {
+		t.Errorf("models = %+v", list.Data)
+	}
+	if !strings.Contains(logs.String(), "request_id=req-models") {
+		t.Errorf("log %q lacks the request ID", logs.String())
+	}
+}
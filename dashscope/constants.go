@@ -2,33 +2,69 @@ package dashscope
 
 const (
 	// Base URLs
-	BaseWebsocketURL = "wss://dashscope.aliyuncs.com/api-ws/v1/inference"
-	
-	// Service URLs
-	
+	DefaultHTTPBaseURL      = "https://dashscope.aliyuncs.com/api/v1"
+	DefaultWebsocketBaseURL = "wss://dashscope.aliyuncs.com/api-ws/v1/inference"
+
+	// International (Singapore) endpoints
+	IntlHTTPBaseURL      = "https://dashscope-intl.aliyuncs.com/api/v1"
+	IntlWebsocketBaseURL = "wss://dashscope-intl.aliyuncs.com/api-ws/v1/inference"
+
+	// OpenAI-compatible mode base URLs
+	DefaultCompatibleBaseURL = "https://dashscope.aliyuncs.com/compatible-mode/v1"
+	IntlCompatibleBaseURL    = "https://dashscope-intl.aliyuncs.com/compatible-mode/v1"
+
+	BaseWebsocketURL = DefaultWebsocketBaseURL
+
+	// Service paths, relative to the HTTP base URL
+
 	// Text Generation
-	QwenGenerationURL = "https://dashscope.aliyuncs.com/api/v1/services/aigc/text-generation/generation"
-	
+	QwenGenerationPath = "/services/aigc/text-generation/generation"
+
 	// Multimodal Generation (Qwen-VL)
-	QwenVLGenerationURL = "https://dashscope.aliyuncs.com/api/v1/services/aigc/multimodal-generation/generation"
-	
+	QwenVLGenerationPath = "/services/aigc/multimodal-generation/generation"
+
 	// Image Synthesis (Wanx)
-	ImageSynthesisURL = "https://dashscope.aliyuncs.com/api/v1/services/aigc/text2image/image-synthesis"
-	
+	ImageSynthesisPath = "/services/aigc/text2image/image-synthesis"
+
 	// Embeddings
-	TextEmbeddingURL = "https://dashscope.aliyuncs.com/api/v1/services/embeddings/text-embedding/text-embedding"
-	
+	TextEmbeddingPath       = "/services/embeddings/text-embedding/text-embedding"
+	MultimodalEmbeddingPath = "/services/embeddings/multimodal-embedding/multimodal-embedding"
+
 	// Natural Language Understanding (NLU)
-	NLUUnderstandingURL = "https://dashscope.aliyuncs.com/api/v1/services/nlp/nlu/understanding"
-	
+	NLUUnderstandingPath = "/services/nlp/nlu/understanding"
+
 	// ReRank
-	TextReRankURL = "https://dashscope.aliyuncs.com/api/v1/services/rerank/text-rerank/text-rerank"
-	
+	TextReRankPath = "/services/rerank/text-rerank/text-rerank"
+
 	// Audio - ASR (Transcription)
-	ASRTranscriptionURL = "https://dashscope.aliyuncs.com/api/v1/services/audio/asr/transcription"
-	
+	ASRTranscriptionPath = "/services/audio/asr/transcription"
+
 	// Tasks (Async)
-	TaskBaseURL = "https://dashscope.aliyuncs.com/api/v1/tasks"
+	TaskPath = "/tasks"
+
+	// Tokenizer
+	TokenizerPath = "/tokenizer"
+
+	// Applications (Bailian apps): AppsPath/{app_id}/completion
+	AppsPath = "/apps"
+
+	// OpenAI-compatible mode, relative to the compatible-mode base URL
+	CompatibleChatCompletionsPath = "/chat/completions"
+	CompatibleEmbeddingsPath      = "/embeddings"
+	CompatibleModelsPath          = "/models"
+	CompatibleFilesPath           = "/files"
+	CompatibleBatchesPath         = "/batches"
+
+	// Service URLs on the default endpoint, kept for compatibility.
+	// Clients build their URLs from the configured base URL instead.
+	QwenGenerationURL   = DefaultHTTPBaseURL + QwenGenerationPath
+	QwenVLGenerationURL = DefaultHTTPBaseURL + QwenVLGenerationPath
+	ImageSynthesisURL   = DefaultHTTPBaseURL + ImageSynthesisPath
+	TextEmbeddingURL    = DefaultHTTPBaseURL + TextEmbeddingPath
+	NLUUnderstandingURL = DefaultHTTPBaseURL + NLUUnderstandingPath
+	TextReRankURL       = DefaultHTTPBaseURL + TextReRankPath
+	ASRTranscriptionURL = DefaultHTTPBaseURL + ASRTranscriptionPath
+	TaskBaseURL         = DefaultHTTPBaseURL + TaskPath
 
 	// TTS Models (Sambert)
 	TTSModelSambertZhichu   = "sambert-zhichu-v1"   // 知厨 - 亲切女声
@@ -38,3 +74,11 @@ const (
 	TTSModelSambertZhixiang = "sambert-zhixiang-v1" // 知祥 - 磁性男声
 	TTSModelSambertZhihao   = "sambert-zhihao-v1"   // 知豪 - 情感男声
 )
+
+// Region identifies a DashScope deployment region.
+type Region string
+
+const (
+	RegionBeijing   Region = "cn-beijing"     // dashscope.aliyuncs.com
+	RegionSingapore Region = "ap-southeast-1" // dashscope-intl.aliyuncs.com
+)
@@ -0,0 +1,280 @@
+package dashscope
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Conversation is a multi-turn chat with a model. It records the user and
+// assistant turns, keeps the prompt within TokenBudget by trimming, or
+// summarizing, the oldest turns and always keeps the system prompt.
+//
+// A Conversation encodes to JSON, so it can be saved and resumed with
+// LoadConversation. It is not safe for concurrent use.
+type Conversation struct {
+	Model      string                `json:"model"`
+	System     string                `json:"system,omitempty"`
+	Parameters *GenerationParameters `json:"parameters,omitempty"`
+	Turns      []ConversationTurn    `json:"turns"`
+
+	// TokenBudget caps the tokens of the prompt sent to the model. Zero
+	// means no limit.
+	TokenBudget int `json:"token_budget,omitempty"`
+	// Summarize replaces trimmed turns with a summary written by the model
+	// instead of dropping them.
+	Summarize bool `json:"summarize,omitempty"`
+	// Summary covers the turns trimmed so far when Summarize is set.
+	Summary string `json:"summary,omitempty"`
+
+	// Usage sums the token usage of every call.
+	Usage GenerationUsage `json:"usage"`
+
+	gen *Generation
+}
+
+// ConversationTurn is a message of a conversation with its size in tokens,
+// measured from the usage DashScope reports. Zero means not yet counted.
+type ConversationTurn struct {
+	Message
+	Tokens int `json:"tokens,omitempty"`
+}
+
+// NewConversation starts a conversation with model. system may be empty.
+func NewConversation(gen *Generation, model, system string) *Conversation {
+	return &Conversation{
+		Model:  model,
+		System: system,
+		gen:    gen,
+	}
+}
+
+// LoadConversation resumes a conversation saved with json.Marshal.
+func LoadConversation(gen *Generation, data []byte) (*Conversation, error) {
+	var c Conversation
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	c.gen = gen
+	return &c, nil
+}
+
+// Send adds a user message and returns the model's reply, which is added to
+// the conversation. On failure the user message is removed again.
+func (c *Conversation) Send(ctx context.Context, content string) (*GenerationResponse, error) {
+	n := len(c.Turns)
+	c.Append(Message{Role: RoleUser, Content: content})
+	resp, err := c.Continue(ctx)
+	if err != nil {
+		c.Turns = c.Turns[:n]
+	}
+	return resp, err
+}
+
+// Append adds messages, such as tool results, without calling the model.
+func (c *Conversation) Append(messages ...Message) {
+	for _, msg := range messages {
+		c.Turns = append(c.Turns, ConversationTurn{Message: msg})
+	}
+}
+
+// Continue calls the model with the conversation so far and adds its reply.
+func (c *Conversation) Continue(ctx context.Context) (*GenerationResponse, error) {
+	if c.gen == nil {
+		return nil, fmt.Errorf("dashscope: conversation has no Generation; use LoadConversation")
+	}
+	c.countTurns(ctx)
+	// The trimmed turns and summary replace the current ones only once the
+	// model has replied.
+	turns, summary, err := c.trim(ctx)
+	if err != nil {
+		return nil, err
+	}
+	turns = append([]ConversationTurn(nil), turns...)
+
+	var params GenerationParameters
+	if c.Parameters != nil {
+		params = *c.Parameters
+	}
+	params.ResultFormat = "message"
+	req := GenerationRequest{
+		Model:      c.Model,
+		Input:      GenerationInput{Messages: c.messages(turns, summary)},
+		Parameters: &params,
+	}
+
+	resp, err := c.gen.Call(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	if len(resp.Output.Choices) == 0 {
+		return resp, fmt.Errorf("dashscope: response %s has no choices", resp.RequestID)
+	}
+	c.addUsage(resp.Usage)
+
+	// The prompt size is exact; attribute what the earlier turns do not
+	// account for to the newest ones.
+	if last := len(turns) - 1; last >= 0 && resp.Usage.InputTokens > 0 {
+		if rest := resp.Usage.InputTokens - (c.tokens(turns, summary) - turns[last].Tokens); rest > 0 {
+			turns[last].Tokens = rest
+		}
+	}
+	// The reasoning is kept but not sent back, so it takes no prompt tokens.
+	c.Turns = append(turns, ConversationTurn{
+		Message: resp.Output.Choices[0].Message,
+		Tokens:  resp.Usage.OutputTokens - resp.Usage.OutputTokensDetails.ReasoningTokens,
+	})
+	c.Summary = summary
+	return resp, nil
+}
+
+// Messages returns the prompt for the next call: the system prompt, the
+// summary of trimmed turns and the remaining turns.
+func (c *Conversation) Messages() []Message {
+	return c.messages(c.Turns, c.Summary)
+}
+
+func (c *Conversation) messages(turns []ConversationTurn, summary string) []Message {
+	var messages []Message
+	if system := c.systemPrompt(summary); system != "" {
+		messages = append(messages, Message{Role: RoleSystem, Content: system})
+	}
+	for _, turn := range turns {
+		messages = append(messages, turn.Message)
+	}
+	return messages
+}
+
+// Tokens returns the size of the next prompt in tokens.
+func (c *Conversation) Tokens() int {
+	return c.tokens(c.Turns, c.Summary)
+}
+
+func (c *Conversation) tokens(turns []ConversationTurn, summary string) int {
+	n := estimateTokens(c.systemPrompt(summary))
+	for _, turn := range turns {
+		if turn.Tokens == 0 {
+			n += countMessage(turn.Message, estimateTokens)
+		}
+		n += turn.Tokens
+	}
+	return n
+}
+
+// Reset clears the turns and summary, keeping the system prompt.
+func (c *Conversation) Reset() {
+	c.Turns = nil
+	c.Summary = ""
+}
+
+func (c *Conversation) systemPrompt(summary string) string {
+	if summary == "" {
+		return c.System
+	}
+	summary = "Summary of the earlier conversation:\n" + summary
+	if c.System == "" {
+		return summary
+	}
+	return c.System + "\n\n" + summary
+}
+
+// trim returns the turns and summary of a prompt that fits the budget,
+// leaving the conversation unchanged. The oldest turns are dropped up to the
+// next user message, so tool results never lose their call, and the latest
+// user message is always kept. A summary of the dropped turns counts towards
+// the budget, so more turns are folded into it while it does not fit.
+func (c *Conversation) trim(ctx context.Context) ([]ConversationTurn, string, error) {
+	turns, summary := c.Turns, c.Summary
+	for c.TokenBudget > 0 {
+		tokens := c.tokens(turns, summary)
+		cut := 0
+		for tokens > c.TokenBudget {
+			next := cut + 1
+			for next < len(turns) && turns[next].Role != RoleUser {
+				next++
+			}
+			if next >= len(turns) {
+				break
+			}
+			for _, turn := range turns[cut:next] {
+				tokens -= turn.Tokens
+			}
+			cut = next
+		}
+		if cut == 0 {
+			break
+		}
+
+		if c.Summarize {
+			var err error
+			summary, err = c.summarize(ctx, summary, turns[:cut])
+			if err != nil {
+				return nil, "", err
+			}
+		}
+		turns = turns[cut:]
+	}
+	return turns, summary, nil
+}
+
+// summarize asks the model to fold turns into the running summary.
+func (c *Conversation) summarize(ctx context.Context, summary string, turns []ConversationTurn) (string, error) {
+	var b strings.Builder
+	if summary != "" {
+		b.WriteString("Summary so far:\n")
+		b.WriteString(summary)
+		b.WriteString("\n\n")
+	}
+	b.WriteString("Conversation:\n")
+	for _, turn := range turns {
+		if turn.Content == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "%s: %s\n", turn.Role, turn.Content)
+	}
+
+	resp, err := c.gen.Call(ctx, GenerationRequest{
+		Model: c.Model,
+		Input: GenerationInput{Messages: []Message{
+			{Role: RoleSystem, Content: "Summarize the conversation below in a few sentences, keeping the facts, names and decisions needed to continue it."},
+			{Role: RoleUser, Content: b.String()},
+		}},
+		Parameters: &GenerationParameters{ResultFormat: "message"},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to summarize conversation: %w", err)
+	}
+	c.addUsage(resp.Usage)
+	if len(resp.Output.Choices) == 0 {
+		return "", fmt.Errorf("dashscope: response %s has no choices", resp.RequestID)
+	}
+	return resp.Output.Choices[0].Message.Content, nil
+}
+
+func (c *Conversation) addUsage(usage GenerationUsage) {
+	c.Usage.InputTokens += usage.InputTokens
+	c.Usage.OutputTokens += usage.OutputTokens
+	c.Usage.TotalTokens += usage.TotalTokens
+	c.Usage.OutputTokensDetails.ReasoningTokens += usage.OutputTokensDetails.ReasoningTokens
+}
+
+// countTurns sizes the turns added since the last call with the client's
+// token counter, until DashScope reports their usage. The client caches the
+// counts, so turns already sized for rate limiting are not counted again.
+func (c *Conversation) countTurns(ctx context.Context) {
+	count := c.gen.c.tokenCounter(ctx, c.Model)
+	for i := range c.Turns {
+		if c.Turns[i].Tokens == 0 {
+			c.Turns[i].Tokens = countMessage(c.Turns[i].Message, count)
+		}
+	}
+}
+
+func countMessage(msg Message, count func(string) int) int {
+	n := count(msg.Content)
+	for _, call := range msg.ToolCalls {
+		n += count(call.Function.Name) + count(call.Function.Arguments)
+	}
+	return n
+}
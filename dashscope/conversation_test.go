@@ -0,0 +1,177 @@
+package dashscope_test
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+	"github.com/ceoifung/go-dashscope/dashscope/dashscopetest"
+)
+
+// reply scripts a generation reply with the given content.
+func reply(content string) dashscopetest.Response {
+	var resp dashscope.GenerationResponse
+	resp.Output.Choices = []dashscope.Choice{{
+		FinishReason: "stop",
+		Message:      dashscope.Message{Role: dashscope.RoleAssistant, Content: content},
+	}}
+	return dashscopetest.Response{Body: resp}
+}
+
+func turn(role, content string, tokens int) dashscope.ConversationTurn {
+	return dashscope.ConversationTurn{Message: dashscope.Message{Role: role, Content: content}, Tokens: tokens}
+}
+
+// sentMessages returns the contents of the messages of the last generation
+// request, prefixed with their roles.
+func sentMessages(t *testing.T, srv *dashscopetest.Server) []string {
+	t.Helper()
+	requests := srv.RequestsFor(dashscope.ServiceGeneration)
+	var req dashscope.GenerationRequest
+	if err := requests[len(requests)-1].Decode(&req); err != nil {
+		t.Fatal(err)
+	}
+	var messages []string
+	for _, msg := range req.Input.Messages {
+		messages = append(messages, msg.Role+": "+msg.Content)
+	}
+	return messages
+}
+
+func TestConversationTrim(t *testing.T) {
+	// Four earlier turns of 50 tokens each, then "Hi" is sent.
+	history := []dashscope.ConversationTurn{
+		turn(dashscope.RoleUser, "u1", 50),
+		turn(dashscope.RoleAssistant, "a1", 50),
+		turn(dashscope.RoleUser, "u2", 50),
+		turn(dashscope.RoleAssistant, "a2", 50),
+	}
+	long := strings.Repeat("word ", 80) // About 100 tokens
+
+	tests := []struct {
+		name        string
+		budget      int
+		summarize   bool
+		summaries   []string // Replies to the summary requests, in order
+		want        []string
+		wantSummary string
+	}{
+		{
+			name: "no budget",
+			want: []string{"user: u1", "assistant: a1", "user: u2", "assistant: a2", "user: Hi"},
+		},
+		{
+			name:   "within budget",
+			budget: 500,
+			want:   []string{"user: u1", "assistant: a1", "user: u2", "assistant: a2", "user: Hi"},
+		},
+		{
+			name:   "oldest exchange dropped",
+			budget: 150,
+			want:   []string{"user: u2", "assistant: a2", "user: Hi"},
+		},
+		{
+			name:   "latest user message kept",
+			budget: 1,
+			want:   []string{"user: Hi"},
+		},
+		{
+			name:        "summarized",
+			budget:      160,
+			summarize:   true,
+			summaries:   []string{"short"},
+			want:        []string{"system: Be brief.\n\nSummary of the earlier conversation:\nshort", "user: u2", "assistant: a2", "user: Hi"},
+			wantSummary: "short",
+		},
+		{
+			name:        "summary counted",
+			budget:      160,
+			summarize:   true,
+			summaries:   []string{long, "short"},
+			want:        []string{"system: Be brief.\n\nSummary of the earlier conversation:\nshort", "user: Hi"},
+			wantSummary: "short",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := dashscopetest.NewServer()
+			defer srv.Close()
+			for _, s := range tt.summaries {
+				srv.Enqueue(dashscope.ServiceGeneration, reply(s))
+			}
+
+			conv := dashscope.NewConversation(srv.Client().Generation(), dashscope.QwenTurbo, "Be brief.")
+			conv.Turns = append(conv.Turns, history...)
+			conv.TokenBudget = tt.budget
+			conv.Summarize = tt.summarize
+			if _, err := conv.Send(context.Background(), "Hi"); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+
+			want := tt.want
+			if tt.wantSummary == "" {
+				want = append([]string{"system: Be brief."}, want...)
+			}
+			if got := sentMessages(t, srv); !reflect.DeepEqual(got, want) {
+				t.Errorf("messages = %q, want %q", got, want)
+			}
+			if n := len(srv.RequestsFor(dashscope.ServiceGeneration)); n != len(tt.summaries)+1 {
+				t.Errorf("%d requests, want %d", n, len(tt.summaries)+1)
+			}
+			if conv.Summary != tt.wantSummary {
+				t.Errorf("summary = %q, want %q", conv.Summary, tt.wantSummary)
+			}
+			if last := conv.Turns[len(conv.Turns)-1]; last.Content != srv.Reply {
+				t.Errorf("last turn = %q, want the reply", last.Content)
+			}
+			if len(conv.Turns) != len(want) { // The sent turns, less the system prompt, plus the reply
+				t.Errorf("%d turns kept, want %d", len(conv.Turns), len(want))
+			}
+		})
+	}
+}
+
+func TestConversationSendFailure(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []dashscopetest.Response
+	}{
+		{"call failed", []dashscopetest.Response{
+			reply("short"),
+			dashscopetest.Fail(http.StatusBadRequest, dashscope.ErrCodeInvalidParameter, "bad input"),
+		}},
+		{"summary failed", []dashscopetest.Response{
+			dashscopetest.Fail(http.StatusBadRequest, dashscope.ErrCodeInvalidParameter, "bad input"),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := dashscopetest.NewServer()
+			defer srv.Close()
+			srv.Enqueue(dashscope.ServiceGeneration, tt.responses...)
+
+			conv := dashscope.NewConversation(srv.Client().Generation(), dashscope.QwenTurbo, "")
+			conv.Turns = []dashscope.ConversationTurn{
+				turn(dashscope.RoleUser, "u1", 50),
+				turn(dashscope.RoleAssistant, "a1", 50),
+			}
+			conv.Summary = "earlier"
+			conv.TokenBudget = 10
+			conv.Summarize = true
+			before := append([]dashscope.ConversationTurn(nil), conv.Turns...)
+
+			if _, err := conv.Send(context.Background(), "Hi"); err == nil {
+				t.Fatal("Send succeeded, want an error")
+			}
+			if !reflect.DeepEqual(conv.Turns, before) {
+				t.Errorf("turns = %+v, want them unchanged", conv.Turns)
+			}
+			if conv.Summary != "earlier" {
+				t.Errorf("summary = %q, want it unchanged", conv.Summary)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package dashscopetest
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+)
+
+// applicationRequest covers the fields of application requests the server
+// looks at.
+type applicationRequest struct {
+	Input struct {
+		Prompt    string            `json:"prompt"`
+		SessionID string            `json:"session_id"`
+		Messages  []json.RawMessage `json:"messages"`
+	} `json:"input"`
+	Parameters struct {
+		IncrementalOutput bool                  `json:"incremental_output"`
+		HasThoughts       bool                  `json:"has_thoughts"`
+		RAGOptions        *dashscope.RAGOptions `json:"rag_options"`
+	} `json:"parameters"`
+}
+
+// applicationOutput builds the parts of an application reply shared by the
+// plain and streamed responses. RAG requests cite one passage of the first
+// knowledge base.
+func (s *Server) applicationOutput(req applicationRequest) (reply string, extra map[string]interface{}, usage map[string]interface{}) {
+	sessionID := req.Input.SessionID
+	if sessionID == "" {
+		sessionID = s.newID("session")
+	}
+	extra = map[string]interface{}{"session_id": sessionID}
+	reply = s.Reply
+
+	if req.Parameters.HasThoughts {
+		extra["thoughts"] = []map[string]interface{}{{
+			"thought":     "I should answer the user directly.",
+			"action_type": "response",
+			"response":    s.Reply,
+		}}
+	}
+	if rag := req.Parameters.RAGOptions; rag != nil && len(rag.PipelineIDs) > 0 {
+		reply += "<ref>[1]</ref>"
+		extra["doc_references"] = []map[string]interface{}{{
+			"index_id": "1",
+			"title":    "Reference",
+			"doc_id":   s.newID("doc"),
+			"doc_name": "reference.pdf",
+			"text":     s.Reply,
+		}}
+	}
+
+	input := countTokens(req.Input.Prompt)
+	for _, msg := range req.Input.Messages {
+		input += countTokens(string(msg))
+	}
+	usage = map[string]interface{}{
+		"models": []map[string]interface{}{{
+			"model_id":      dashscope.QwenPlus,
+			"input_tokens":  input,
+			"output_tokens": countTokens(reply),
+		}},
+	}
+	return reply, extra, usage
+}
+
+func (s *Server) application(body []byte) interface{} {
+	var req applicationRequest
+	json.Unmarshal(body, &req)
+
+	reply, output, usage := s.applicationOutput(req)
+	output["text"] = reply
+	output["finish_reason"] = "stop"
+	return map[string]interface{}{"output": output, "usage": usage}
+}
+
+// applicationEvents streams the reply word by word. The session ID is sent
+// with every chunk; thoughts, doc references and usage with the last.
+func (s *Server) applicationEvents(body []byte) []interface{} {
+	var req applicationRequest
+	json.Unmarshal(body, &req)
+
+	reply, extra, usage := s.applicationOutput(req)
+	pieces := strings.SplitAfter(reply, " ")
+	events := make([]interface{}, len(pieces))
+	for i := range pieces {
+		text := pieces[i]
+		if !req.Parameters.IncrementalOutput {
+			text = strings.Join(pieces[:i+1], "")
+		}
+		output := map[string]interface{}{
+			"text":          text,
+			"finish_reason": "null",
+			"session_id":    extra["session_id"],
+		}
+		event := map[string]interface{}{"output": output}
+		if i == len(pieces)-1 {
+			for k, v := range extra {
+				output[k] = v
+			}
+			output["finish_reason"] = "stop"
+			event["usage"] = usage
+		}
+		events[i] = event
+	}
+	return events
+}
@@ -0,0 +1,187 @@
+package dashscopetest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+)
+
+// batch is a batch job submitted to the server. It runs when it is created
+// and reports its output once TaskPolls polls have seen it in progress.
+type batch struct {
+	batch        dashscope.Batch
+	polls        int // In progress polls left
+	outputFileID string
+	errorFileID  string
+	counts       dashscope.BatchRequestCounts
+}
+
+// serveBatches implements the batch endpoints: create, list, get and
+// cancel.
+func (s *Server) serveBatches(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	id := strings.TrimPrefix(strings.TrimPrefix(path, dashscope.CompatibleBatchesPath), "/")
+	id, cancel := strings.CutSuffix(id, "/cancel")
+
+	switch {
+	case id == "" && r.Method == "POST":
+		s.createBatch(w, body)
+	case id == "" && r.Method == "GET":
+		writeJSON(w, http.StatusOK, s.listBatches())
+	case r.Method == "GET" || (cancel && r.Method == "POST"):
+		s.mu.Lock()
+		b, ok := s.batches[id]
+		if ok {
+			s.advanceBatch(b, cancel)
+		}
+		var out dashscope.Batch
+		if ok {
+			out = b.batch
+		}
+		s.mu.Unlock()
+		if !ok {
+			s.writeError(w, http.StatusNotFound, "NotFound", "batch not found: "+id)
+			return
+		}
+		writeJSON(w, http.StatusOK, out)
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, "InvalidURL", "method not allowed: "+r.Method)
+	}
+}
+
+func (s *Server) createBatch(w http.ResponseWriter, body []byte) {
+	var req dashscope.CreateBatchRequest
+	json.Unmarshal(body, &req)
+	input, ok := s.lookupFile(req.InputFileID)
+	if !ok {
+		s.writeError(w, http.StatusBadRequest, dashscope.ErrCodeInvalidParameter, "input file not found: "+req.InputFileID)
+		return
+	}
+
+	b := &batch{
+		batch: dashscope.Batch{
+			ID:               s.newID("batch"),
+			Object:           "batch",
+			Endpoint:         req.Endpoint,
+			InputFileID:      req.InputFileID,
+			CompletionWindow: req.CompletionWindow,
+			Status:           dashscope.BatchStatusInProgress,
+			Metadata:         req.Metadata,
+			CreatedAt:        time.Now().Unix(),
+			InProgressAt:     time.Now().Unix(),
+		},
+		polls: s.TaskPolls,
+	}
+	s.runBatch(b, input.content)
+	b.batch.RequestCounts.Total = b.counts.Total
+
+	s.mu.Lock()
+	s.batches[b.batch.ID] = b
+	s.batchIDs = append(s.batchIDs, b.batch.ID)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, b.batch)
+}
+
+// runBatch answers every line of the input with the default reply of its
+// endpoint, and stores the output and error files. Lines for another
+// endpoint fail.
+func (s *Server) runBatch(b *batch, input []byte) {
+	var output, errors bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(input))
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var line struct {
+			CustomID string          `json:"custom_id"`
+			URL      string          `json:"url"`
+			Body     json.RawMessage `json:"body"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &line) != nil {
+			continue
+		}
+		b.counts.Total++
+		requestID := s.newID("req")
+
+		var reply interface{}
+		switch {
+		case line.URL != b.batch.Endpoint:
+		case line.URL == dashscope.BatchEndpointChatCompletions:
+			completion := s.chatCompletion(line.Body).(*dashscope.ChatCompletion)
+			completion.ID = requestID
+			reply = completion
+		case line.URL == dashscope.BatchEndpointEmbeddings:
+			embeddings := s.embeddings(line.Body).(*dashscope.EmbeddingResponse)
+			embeddings.ID = requestID
+			reply = embeddings
+		}
+
+		result := map[string]interface{}{"id": s.newID("batch_req"), "custom_id": line.CustomID}
+		if reply == nil {
+			b.counts.Failed++
+			message := "url " + line.URL + " does not match the batch endpoint " + b.batch.Endpoint
+			result["response"] = map[string]interface{}{
+				"status_code": http.StatusBadRequest,
+				"request_id":  requestID,
+				"body":        Error{RequestID: requestID, Code: dashscope.ErrCodeInvalidParameter, Message: message},
+			}
+			result["error"] = dashscope.BatchError{Code: dashscope.ErrCodeInvalidParameter, Message: message}
+			json.NewEncoder(&errors).Encode(result)
+			continue
+		}
+		b.counts.Completed++
+		result["response"] = map[string]interface{}{
+			"status_code": http.StatusOK,
+			"request_id":  requestID,
+			"body":        reply,
+		}
+		result["error"] = nil
+		json.NewEncoder(&output).Encode(result)
+	}
+
+	if output.Len() > 0 {
+		b.outputFileID = s.storeFile(b.batch.ID+"_success.jsonl", "batch_output", output.Bytes()).ID
+	}
+	if errors.Len() > 0 {
+		b.errorFileID = s.storeFile(b.batch.ID+"_error.jsonl", "batch_output", errors.Bytes()).ID
+	}
+}
+
+// advanceBatch counts a poll of b, completing it once its polls run out, or
+// cancels it. The caller holds s.mu.
+func (s *Server) advanceBatch(b *batch, cancel bool) {
+	if b.batch.Done() {
+		return
+	}
+	now := time.Now().Unix()
+	if cancel {
+		b.batch.Status = dashscope.BatchStatusCancelled
+		b.batch.CancellingAt, b.batch.CancelledAt = now, now
+		return
+	}
+	if b.polls > 0 {
+		b.polls--
+		return
+	}
+	b.batch.Status = dashscope.BatchStatusCompleted
+	b.batch.FinalizingAt, b.batch.CompletedAt = now, now
+	b.batch.OutputFileID = b.outputFileID
+	b.batch.ErrorFileID = b.errorFileID
+	b.batch.RequestCounts = b.counts
+}
+
+func (s *Server) listBatches() *dashscope.BatchList {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := &dashscope.BatchList{Object: "list", Data: []dashscope.Batch{}}
+	for _, id := range s.batchIDs {
+		list.Data = append(list.Data, s.batches[id].batch)
+	}
+	if n := len(list.Data); n > 0 {
+		list.FirstID, list.LastID = list.Data[0].ID, list.Data[n-1].ID
+	}
+	return list
+}
@@ -0,0 +1,91 @@
+package dashscopetest
+
+import (
+	"encoding/json"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+)
+
+// compatPrefix is the path of the OpenAI-compatible base URL.
+const compatPrefix = "/compatible-mode/v1"
+
+// compatServices maps compatible-mode paths to services.
+var compatServices = map[string]string{
+	dashscope.CompatibleChatCompletionsPath: dashscope.ServiceChatCompletions,
+	dashscope.CompatibleEmbeddingsPath:      dashscope.ServiceEmbeddings,
+	dashscope.CompatibleModelsPath:          dashscope.ServiceModels,
+	dashscope.CompatibleFilesPath:           dashscope.ServiceFiles,
+	dashscope.CompatibleBatchesPath:         dashscope.ServiceBatches,
+}
+
+// compatModels are the models listed by the models endpoint.
+var compatModels = []string{
+	dashscope.QwenTurbo,
+	dashscope.QwenPlus,
+	dashscope.QwenMax,
+	dashscope.QwenFlash,
+	dashscope.QwQPlus,
+	dashscope.TextEmbeddingV3,
+	dashscope.TextEmbeddingV4,
+}
+
+// nativeBody converts a chat completion request to the native generation
+// request the default replies are built from.
+func nativeBody(body []byte) (dashscope.ChatCompletionRequest, []byte) {
+	var req dashscope.ChatCompletionRequest
+	json.Unmarshal(body, &req)
+	native, _ := json.Marshal(req.ToGeneration())
+	return req, native
+}
+
+func (s *Server) chatCompletion(body []byte) interface{} {
+	req, native := nativeBody(body)
+	var resp dashscope.GenerationResponse
+	json.Unmarshal(encode(s.generation(native)), &resp)
+	return dashscope.NewChatCompletion(&resp, req.Model)
+}
+
+// chatCompletionEvents converts the default native chunks, ending with a
+// usage chunk when requested.
+func (s *Server) chatCompletionEvents(body []byte) []interface{} {
+	req, native := nativeBody(body)
+	var events []interface{}
+	var last dashscope.GenerationResponse
+	for _, event := range s.defaultEvents(dashscope.ServiceGeneration, native) {
+		var chunk dashscope.GenerationResponse
+		json.Unmarshal(encode(event), &chunk)
+		last = chunk
+		chunk.Usage = dashscope.GenerationUsage{}
+		events = append(events, dashscope.NewChatCompletionChunk(&chunk, req.Model))
+	}
+	if req.StreamOptions != nil && req.StreamOptions.IncludeUsage {
+		usage := dashscope.GenerationResponse{Usage: last.Usage}
+		events = append(events, dashscope.NewChatCompletionChunk(&usage, req.Model))
+	}
+	return events
+}
+
+func (s *Server) embeddings(body []byte) interface{} {
+	var req dashscope.EmbeddingRequest
+	json.Unmarshal(body, &req)
+
+	resp := dashscope.EmbeddingResponse{Object: "list", Model: req.Model}
+	for i, text := range req.Input {
+		resp.Data = append(resp.Data, dashscope.Embedding{
+			Object:    "embedding",
+			Index:     i,
+			Embedding: s.vector(text),
+		})
+		resp.Usage.PromptTokens += countTokens(text)
+	}
+	resp.Usage.TotalTokens = resp.Usage.PromptTokens
+	return &resp
+}
+
+func (s *Server) models() interface{} {
+	list := dashscope.ModelList{Object: "list"}
+	for _, id := range compatModels {
+		list.Data = append(list.Data, dashscope.Model{ID: id, Object: "model", OwnedBy: "system"})
+	}
+	return &list
+}
@@ -0,0 +1,363 @@
+package dashscopetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+	"github.com/ceoifung/go-dashscope/dashscope/internal/models"
+)
+
+// generationRequest covers the fields of the generation requests the server
+// looks at.
+type generationRequest struct {
+	Model string `json:"model"`
+	Input struct {
+		Prompt   string            `json:"prompt"`
+		Messages []json.RawMessage `json:"messages"`
+	} `json:"input"`
+	Parameters struct {
+		ResultFormat      string `json:"result_format"`
+		IncrementalOutput bool   `json:"incremental_output"`
+		EnableThinking    *bool  `json:"enable_thinking"`
+	} `json:"parameters"`
+}
+
+// thinking reports whether req asks for a reasoning trace, which the server
+// only streams in the message format.
+func (req generationRequest) thinking(service string) bool {
+	if service != dashscope.ServiceMultiModalGeneration && req.Parameters.ResultFormat != "message" {
+		return false
+	}
+	if req.Parameters.EnableThinking != nil {
+		return *req.Parameters.EnableThinking
+	}
+	return models.ThinksByDefault(req.Model)
+}
+
+// defaultBody builds the default reply of a non-streaming request.
+func (s *Server) defaultBody(service, path string, body []byte) interface{} {
+	switch service {
+	case dashscope.ServiceGeneration:
+		return s.generation(body)
+	case dashscope.ServiceMultiModalGeneration:
+		return s.multiModalGeneration(body)
+	case dashscope.ServiceTextEmbedding:
+		return s.textEmbedding(body)
+	case dashscope.ServiceMultimodalEmbedding:
+		return s.multimodalEmbedding(body)
+	case dashscope.ServiceTextReRank:
+		return s.rerank(body)
+	case dashscope.ServiceUnderstanding:
+		return s.understanding(body)
+	case dashscope.ServiceTokenization:
+		return s.tokenization(body)
+	case dashscope.ServiceChatCompletions:
+		return s.chatCompletion(body)
+	case dashscope.ServiceEmbeddings:
+		return s.embeddings(body)
+	case dashscope.ServiceModels:
+		return s.models()
+	case dashscope.ServiceApplication:
+		return s.application(body)
+	case dashscope.ServiceImageSynthesis, dashscope.ServiceTranscription:
+		return s.submitTask(service, body)
+	case dashscope.ServiceTask:
+		return s.pollTask(strings.TrimPrefix(path, dashscope.TaskPath+"/"))
+	}
+	return nil
+}
+
+// defaultEvents builds the default chunks of a streaming request.
+func (s *Server) defaultEvents(service string, body []byte) []interface{} {
+	var req generationRequest
+	json.Unmarshal(body, &req)
+	input := promptTokens(req)
+
+	var thoughts []string
+	if req.thinking(service) && s.Reasoning != "" {
+		thoughts = strings.SplitAfter(s.Reasoning, " ")
+	}
+	pieces := strings.SplitAfter(s.Reply, " ")
+	events := make([]interface{}, 0, len(thoughts)+len(pieces))
+	for i := range thoughts {
+		reasoning := thoughts[i]
+		if !req.Parameters.IncrementalOutput {
+			reasoning = strings.Join(thoughts[:i+1], "")
+		}
+		var content interface{} = ""
+		if service == dashscope.ServiceMultiModalGeneration {
+			content = []map[string]string{}
+		}
+		output := map[string]interface{}{
+			"choices": []map[string]interface{}{{
+				"finish_reason": "null",
+				"message": map[string]interface{}{
+					"role":              dashscope.RoleAssistant,
+					"content":           content,
+					"reasoning_content": reasoning,
+				},
+			}},
+		}
+		events = append(events, map[string]interface{}{"output": output, "usage": outputUsage(input, i+1, i+1)})
+	}
+	for i := range pieces {
+		text := pieces[i]
+		if !req.Parameters.IncrementalOutput {
+			text = strings.Join(pieces[:i+1], "")
+		}
+		finish := "null"
+		if i == len(pieces)-1 {
+			finish = "stop"
+		}
+		usage := outputUsage(input, len(thoughts)+i+1, len(thoughts))
+
+		var output map[string]interface{}
+		switch {
+		case service == dashscope.ServiceMultiModalGeneration:
+			output = choicesOutput(finish, []map[string]string{{"text": text}})
+		case req.Parameters.ResultFormat == "message":
+			output = choicesOutput(finish, text)
+		default:
+			output = map[string]interface{}{"text": text, "finish_reason": finish}
+		}
+		events = append(events, map[string]interface{}{"output": output, "usage": usage})
+	}
+	return events
+}
+
+// outputUsage reports the usage of a stream chunk, output including the
+// reasoning tokens.
+func outputUsage(input, output, reasoning int) map[string]interface{} {
+	usage := map[string]interface{}{
+		"input_tokens":  input,
+		"output_tokens": output,
+		"total_tokens":  input + output,
+	}
+	if reasoning > 0 {
+		usage["output_tokens_details"] = map[string]interface{}{"reasoning_tokens": reasoning}
+	}
+	return usage
+}
+
+func (s *Server) generation(body []byte) interface{} {
+	var req generationRequest
+	json.Unmarshal(body, &req)
+	input, output := promptTokens(req), countTokens(s.Reply)
+
+	var out map[string]interface{}
+	if req.Parameters.ResultFormat == "message" {
+		out = choicesOutput("stop", s.Reply)
+	} else {
+		out = map[string]interface{}{"text": s.Reply, "finish_reason": "stop"}
+	}
+	return map[string]interface{}{
+		"output": out,
+		"usage": map[string]interface{}{
+			"input_tokens":  input,
+			"output_tokens": output,
+			"total_tokens":  input + output,
+		},
+	}
+}
+
+func (s *Server) multiModalGeneration(body []byte) interface{} {
+	var req generationRequest
+	json.Unmarshal(body, &req)
+	input, output := promptTokens(req), countTokens(s.Reply)
+
+	return map[string]interface{}{
+		"output": choicesOutput("stop", []map[string]string{{"text": s.Reply}}),
+		"usage": map[string]interface{}{
+			"input_tokens":  input,
+			"output_tokens": output,
+			"image_count":   strings.Count(string(body), `"image":`),
+		},
+	}
+}
+
+func choicesOutput(finish string, content interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"choices": []map[string]interface{}{{
+			"finish_reason": finish,
+			"message": map[string]interface{}{
+				"role":    dashscope.RoleAssistant,
+				"content": content,
+			},
+		}},
+	}
+}
+
+func (s *Server) textEmbedding(body []byte) interface{} {
+	var req dashscope.TextEmbeddingRequest
+	json.Unmarshal(body, &req)
+
+	embeddings := make([]map[string]interface{}, len(req.Input.Texts))
+	tokens := 0
+	for i, text := range req.Input.Texts {
+		embeddings[i] = map[string]interface{}{
+			"text_index": i,
+			"embedding":  s.vector(text),
+		}
+		tokens += countTokens(text)
+	}
+	return map[string]interface{}{
+		"output": map[string]interface{}{"embeddings": embeddings},
+		"usage":  map[string]interface{}{"total_tokens": tokens},
+	}
+}
+
+func (s *Server) multimodalEmbedding(body []byte) interface{} {
+	var req dashscope.MultimodalEmbeddingRequest
+	json.Unmarshal(body, &req)
+
+	var key strings.Builder
+	tokens := 0
+	for _, c := range req.Input.Contents {
+		key.WriteString(c.Text + c.Image + c.Audio)
+		tokens += countTokens(c.Text)
+	}
+	return map[string]interface{}{
+		"output": map[string]interface{}{"embedding": s.vector(key.String())},
+		"usage":  map[string]interface{}{"total_tokens": tokens},
+	}
+}
+
+// vector returns a deterministic unit vector for text, so equal inputs embed
+// equally.
+func (s *Server) vector(text string) []float64 {
+	h := fnv.New64a()
+	h.Write([]byte(text))
+	rng := rand.New(rand.NewPCG(h.Sum64(), 0))
+
+	v := make([]float64, s.EmbeddingDimension)
+	norm := 0.0
+	for i := range v {
+		v[i] = rng.NormFloat64()
+		norm += v[i] * v[i]
+	}
+	norm = math.Sqrt(norm)
+	for i := range v {
+		v[i] /= norm
+	}
+	return v
+}
+
+// rerank scores documents by the fraction of query words they contain.
+func (s *Server) rerank(body []byte) interface{} {
+	var req dashscope.TextReRankRequest
+	json.Unmarshal(body, &req)
+
+	query := strings.Fields(strings.ToLower(req.Input.Query))
+	results := make([]map[string]interface{}, len(req.Input.Documents))
+	tokens := countTokens(req.Input.Query)
+	for i, doc := range req.Input.Documents {
+		lower := strings.ToLower(doc)
+		hits := 0
+		for _, word := range query {
+			if strings.Contains(lower, word) {
+				hits++
+			}
+		}
+		score := 0.0
+		if len(query) > 0 {
+			score = float64(hits) / float64(len(query))
+		}
+		results[i] = map[string]interface{}{"index": i, "relevance_score": score}
+		if req.Parameters != nil && req.Parameters.ReturnDocuments {
+			results[i]["document"] = map[string]string{"text": doc}
+		}
+		tokens += countTokens(doc)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i]["relevance_score"].(float64) > results[j]["relevance_score"].(float64)
+	})
+	if req.Parameters != nil && req.Parameters.TopN > 0 && req.Parameters.TopN < len(results) {
+		results = results[:req.Parameters.TopN]
+	}
+
+	return map[string]interface{}{
+		"output": map[string]interface{}{"results": results},
+		"usage":  map[string]interface{}{"total_tokens": tokens},
+	}
+}
+
+// understanding answers with the first label.
+func (s *Server) understanding(body []byte) interface{} {
+	var req dashscope.UnderstandingRequest
+	json.Unmarshal(body, &req)
+
+	label := strings.TrimSpace(strings.Split(req.Input.Labels, ",")[0])
+	text := label
+	if req.Input.Task == "extraction" {
+		text = fmt.Sprintf("%s: %s", label, req.Input.Sentence)
+	}
+	return map[string]interface{}{
+		"output": map[string]interface{}{"text": text},
+		"usage": map[string]interface{}{
+			"total_tokens": countTokens(req.Input.Sentence) + countTokens(req.Input.Labels),
+		},
+	}
+}
+
+// tokenization splits the input the way countTokens counts it, with token
+// IDs derived from a hash of each token.
+func (s *Server) tokenization(body []byte) interface{} {
+	var req dashscope.TokenizationRequest
+	json.Unmarshal(body, &req)
+
+	texts := []string{req.Input.Prompt}
+	for _, msg := range req.Input.Messages {
+		texts = append(texts, msg.Content)
+	}
+	tokens := []string{}
+	for _, text := range texts {
+		for _, word := range strings.Fields(text) {
+			if utf8.RuneCountInString(word) == len(word) {
+				tokens = append(tokens, word)
+				continue
+			}
+			for _, r := range word {
+				tokens = append(tokens, string(r))
+			}
+		}
+	}
+	ids := make([]int, len(tokens))
+	for i, token := range tokens {
+		h := fnv.New32a()
+		h.Write([]byte(token))
+		ids[i] = int(h.Sum32() % 151643)
+	}
+	return map[string]interface{}{
+		"output": map[string]interface{}{"token_ids": ids, "tokens": tokens},
+		"usage":  map[string]interface{}{"input_tokens": len(tokens)},
+	}
+}
+
+// countTokens approximates a token count: one per CJK character and one per
+// other word.
+func countTokens(text string) int {
+	n := 0
+	for _, word := range strings.Fields(text) {
+		if utf8.RuneCountInString(word) == len(word) {
+			n++
+			continue
+		}
+		n += utf8.RuneCountInString(word)
+	}
+	return n
+}
+
+func promptTokens(req generationRequest) int {
+	n := countTokens(req.Input.Prompt)
+	for _, msg := range req.Input.Messages {
+		n += countTokens(string(msg))
+	}
+	return n
+}
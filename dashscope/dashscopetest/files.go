@@ -0,0 +1,133 @@
+package dashscopetest
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+)
+
+// storedFile is a file uploaded to, or generated by, the server.
+type storedFile struct {
+	file    dashscope.File
+	content []byte
+}
+
+// storeFile adds a file and returns its description.
+func (s *Server) storeFile(filename, purpose string, content []byte) dashscope.File {
+	f := &storedFile{
+		file: dashscope.File{
+			ID:        s.newID("file"),
+			Object:    "file",
+			Bytes:     int64(len(content)),
+			CreatedAt: time.Now().Unix(),
+			Filename:  filename,
+			Purpose:   purpose,
+			Status:    "processed",
+		},
+		content: content,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[f.file.ID] = f
+	s.fileIDs = append(s.fileIDs, f.file.ID)
+	return f.file
+}
+
+// lookupFile returns the file with the given ID, if any.
+func (s *Server) lookupFile(id string) (*storedFile, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[id]
+	return f, ok
+}
+
+// serveStoredFiles implements the files endpoints: upload, list, get,
+// delete and content download.
+func (s *Server) serveStoredFiles(w http.ResponseWriter, r *http.Request, path string, body []byte) {
+	id := strings.TrimPrefix(strings.TrimPrefix(path, dashscope.CompatibleFilesPath), "/")
+	id, content := strings.CutSuffix(id, "/content")
+
+	switch {
+	case id == "" && r.Method == "POST":
+		s.uploadFile(w, r, body)
+	case id == "" && r.Method == "GET":
+		writeJSON(w, http.StatusOK, s.listFiles(r))
+	case r.Method == "GET" || r.Method == "DELETE":
+		f, ok := s.lookupFile(id)
+		if !ok {
+			s.writeError(w, http.StatusNotFound, "NotFound", "file not found: "+id)
+			return
+		}
+		switch {
+		case content:
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(f.content)
+		case r.Method == "DELETE":
+			s.mu.Lock()
+			delete(s.files, id)
+			s.mu.Unlock()
+			writeJSON(w, http.StatusOK, dashscope.FileDeleted{ID: id, Object: "file", Deleted: true})
+		default:
+			writeJSON(w, http.StatusOK, f.file)
+		}
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, "InvalidURL", "method not allowed: "+r.Method)
+	}
+}
+
+// uploadFile stores the file of a multipart upload. The body has already
+// been read, so it is parsed from the recorded copy.
+func (s *Server) uploadFile(w http.ResponseWriter, r *http.Request, body []byte) {
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, dashscope.ErrCodeInvalidParameter, "file is required")
+		return
+	}
+	defer file.Close()
+	content, _ := io.ReadAll(file)
+	writeJSON(w, http.StatusOK, s.storeFile(header.Filename, r.FormValue("purpose"), content))
+}
+
+// listFiles returns the files in upload order, paginated by after and limit.
+func (s *Server) listFiles(r *http.Request) *dashscope.FileList {
+	query := r.URL.Query()
+	after := query.Get("after")
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 {
+		limit = 20
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := &dashscope.FileList{Object: "list", Data: []dashscope.File{}}
+	started := after == ""
+	for _, id := range s.fileIDs {
+		f, ok := s.files[id]
+		if !ok {
+			continue
+		}
+		if !started {
+			started = id == after
+			continue
+		}
+		if purpose := query.Get("purpose"); purpose != "" && f.file.Purpose != purpose {
+			continue
+		}
+		if len(list.Data) == limit {
+			list.HasMore = true
+			break
+		}
+		list.Data = append(list.Data, f.file)
+	}
+	if n := len(list.Data); n > 0 {
+		list.FirstID, list.LastID = list.Data[0].ID, list.Data[n-1].ID
+	}
+	return list
+}
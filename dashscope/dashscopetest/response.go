@@ -0,0 +1,156 @@
+package dashscopetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+)
+
+// Response scripts one reply of an HTTP service. Fields left zero fall back
+// to the service's default behaviour, so Response{Delay: time.Second} delays
+// an otherwise normal reply.
+type Response struct {
+	// Status is the HTTP status. Zero means 200.
+	Status int
+	// Header is added to the response.
+	Header http.Header
+	// Body is encoded as JSON; []byte and string are sent verbatim.
+	Body interface{}
+	// Events are sent as server-sent events, each encoded like Body.
+	Events []interface{}
+	// StreamError, if set, is sent as an error event after Events.
+	StreamError *Error
+	// Delay is waited before responding.
+	Delay time.Duration
+	// EventDelay is waited before each event.
+	EventDelay time.Duration
+	// Disconnect resets the connection without responding, which clients
+	// observe as a retryable transport error.
+	Disconnect bool
+}
+
+// scripted reports whether r replaces the default reply.
+func (r Response) scripted() bool {
+	return r.Body != nil || r.Events != nil || r.StreamError != nil ||
+		(r.Status != 0 && r.Status != http.StatusOK)
+}
+
+// Error is a DashScope error body. A missing RequestID is filled in.
+type Error struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Fail returns a response carrying a DashScope error.
+func Fail(status int, code, message string) Response {
+	return Response{
+		Status: status,
+		Body:   Error{Code: code, Message: message},
+	}
+}
+
+// Chunks returns a response streaming the given events.
+func Chunks(events ...interface{}) Response {
+	return Response{Events: events}
+}
+
+// taskFailure is the Body of a TaskFailed response.
+type taskFailure struct {
+	code, message string
+}
+
+// TaskFailed scripts a task poll, queued for dashscope.ServiceTask, that
+// reports the polled task as FAILED.
+func TaskFailed(code, message string) Response {
+	return Response{Body: taskFailure{code: code, message: message}}
+}
+
+// writeStream sends resp.Events in DashScope's server-sent event format, or
+// in the OpenAI format, ending with [DONE], for compatible-mode services.
+func (s *Server) writeStream(w http.ResponseWriter, r *http.Request, resp Response, service string) {
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	requestID := w.Header().Get("X-Request-Id")
+	if requestID == "" {
+		requestID = s.newID("req")
+		w.Header().Set("X-Request-Id", requestID)
+	}
+	w.Header().Set("Content-Type", "text/event-stream;charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	flusher, _ := w.(http.Flusher)
+
+	compat := service == dashscope.ServiceChatCompletions
+	id := 0
+	send := func(event string, status int, data []byte) {
+		id++
+		if compat {
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		} else {
+			fmt.Fprintf(w, "id:%d\nevent:%s\n:HTTP_STATUS/%d\ndata:%s\n\n", id, event, status, data)
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	for _, event := range resp.Events {
+		sleep(r, resp.EventDelay)
+		if r.Context().Err() != nil {
+			return
+		}
+		send("result", status, encode(withStreamRequestID(event, requestID)))
+	}
+	if resp.StreamError != nil {
+		sleep(r, resp.EventDelay)
+		e := *resp.StreamError
+		if e.RequestID == "" {
+			e.RequestID = requestID
+		}
+		if compat {
+			send("error", http.StatusBadRequest, encode(map[string]interface{}{"error": e}))
+			return
+		}
+		send("error", http.StatusBadRequest, encode(e))
+		return
+	}
+	if compat {
+		send("", status, []byte("[DONE]"))
+	}
+}
+
+// withStreamRequestID fills in the request_id of generated events.
+func withStreamRequestID(event interface{}, requestID string) interface{} {
+	if c, ok := event.(*dashscope.ChatCompletionChunk); ok && c.ID == "" {
+		c.ID = requestID
+	}
+	if m, ok := event.(map[string]interface{}); ok {
+		if _, ok := m["request_id"]; !ok {
+			m["request_id"] = requestID
+		}
+	}
+	return event
+}
+
+func encode(v interface{}) []byte {
+	switch body := v.(type) {
+	case []byte:
+		return body
+	case string:
+		return []byte(body)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("dashscopetest: cannot encode %T: %v", v, err))
+	}
+	return data
+}
@@ -0,0 +1,444 @@
+// Package dashscopetest provides an in-process fake DashScope server for
+// testing code built on the dashscope package without network access.
+//
+//	srv := dashscopetest.NewServer()
+//	defer srv.Close()
+//
+//	srv.Enqueue(dashscope.ServiceGeneration,
+//		dashscopetest.Fail(http.StatusTooManyRequests, dashscope.ErrCodeThrottling, "Requests rate limit exceeded"))
+//
+//	client := srv.Client(dashscope.WithRetryPolicy(dashscope.DefaultRetryPolicy()))
+//	resp, err := client.Generation().Call(ctx, req)
+//
+// Every endpoint answers with a plausible default response: generation
+// (plain and SSE), multimodal generation, text and multimodal embedding,
+// rerank, understanding, tokenization, async image synthesis and
+// transcription with task polling, application completions (plain and
+// SSE), the OpenAI-compatible chat completions (plain and SSE), embeddings,
+// models, file storage and batch jobs, and the websocket inference endpoint
+// for speech synthesis, recognition and the multimodal dialog. Enqueue and
+// EnqueueSession script the replies of a service, including errors, dropped
+// connections and latency. Requests records everything the server received.
+package dashscopetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+	"github.com/gorilla/websocket"
+)
+
+// APIKey is the key NewServer accepts by default.
+const APIKey = "sk-dashscopetest"
+
+const (
+	httpPrefix    = "/api/v1"
+	websocketPath = "/api-ws/v1/inference"
+	filesPath     = "/files/"
+)
+
+// Server is a fake DashScope endpoint. Set its exported fields before sending
+// requests.
+type Server struct {
+	URL          string // HTTP base URL, for dashscope.WithBaseURL
+	WebsocketURL string // Websocket URL, for dashscope.WithWebsocketURL
+
+	// APIKey is the only key accepted. Empty accepts any key.
+	APIKey string
+	// Reply is the text generated by the generation endpoints and the dialog.
+	Reply string
+	// Reasoning is the thinking trace streamed before Reply when a request
+	// enables thinking.
+	Reasoning string
+	// Transcript is the text recognized from audio.
+	Transcript string
+	// Latency delays every HTTP response and websocket reply.
+	Latency time.Duration
+	// TaskPolls is the number of polls an async task reports RUNNING, or a
+	// batch job in_progress, before it succeeds.
+	TaskPolls int
+	// EmbeddingDimension is the length of generated embedding vectors.
+	EmbeddingDimension int
+
+	srv      *httptest.Server
+	upgrader websocket.Upgrader
+
+	mu        sync.Mutex
+	responses map[string][]Response
+	sessions  map[string][]Session
+	tasks     map[string]*task
+	files     map[string]*storedFile
+	fileIDs   []string // In upload order
+	batches   map[string]*batch
+	batchIDs  []string // In creation order
+	requests  []Request
+	nextID    int
+}
+
+// Request is a request, or websocket message, received by the server.
+type Request struct {
+	Service string // One of the dashscope.Service* constants
+	Method  string // HTTP method, or "WS" for websocket messages
+	Path    string // Path relative to the base URL
+	Header  http.Header
+	Body    []byte
+	Action  string // Action of a websocket text message
+	Binary  bool   // Whether the websocket message is an audio frame
+}
+
+// Decode unmarshals the JSON body of the request into v.
+func (r Request) Decode(v interface{}) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// NewServer starts a fake server. Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		APIKey:             APIKey,
+		Reply:              "Hello! How can I help you today?",
+		Reasoning:          "The user greets me, so I greet them back.",
+		Transcript:         "What is the weather like today?",
+		EmbeddingDimension: 8,
+		responses:          make(map[string][]Response),
+		sessions:           make(map[string][]Session),
+		tasks:              make(map[string]*task),
+		files:              make(map[string]*storedFile),
+		batches:            make(map[string]*batch),
+	}
+	s.srv = httptest.NewServer(s)
+	s.URL = s.srv.URL + httpPrefix
+	s.WebsocketURL = "ws" + strings.TrimPrefix(s.srv.URL, "http") + websocketPath
+	return s
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.srv.CloseClientConnections()
+	s.srv.Close()
+}
+
+// Client returns a dashscope.Client talking to the server. Options are
+// applied after the server's endpoints and key, so they may override them.
+func (s *Server) Client(opts ...dashscope.ClientOption) *dashscope.Client {
+	return dashscope.NewClient(append([]dashscope.ClientOption{
+		dashscope.WithAPIKey(s.APIKey),
+		dashscope.WithBaseURL(s.URL),
+		dashscope.WithWebsocketURL(s.WebsocketURL),
+	}, opts...)...)
+}
+
+// Enqueue scripts the next replies of an HTTP service, given as one of the
+// dashscope.Service* constants. Each request consumes one response; once the
+// queue is empty the default response is used again. Responses queued for
+// dashscope.ServiceTask answer task polls.
+func (s *Server) Enqueue(service string, responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses[service] = append(s.responses[service], responses...)
+}
+
+// EnqueueSession scripts the next websocket sessions of dashscope.ServiceSpeechSynthesis,
+// dashscope.ServiceRecognition or dashscope.ServiceMultiModalDialog.
+func (s *Server) EnqueueSession(service string, sessions ...Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[service] = append(s.sessions[service], sessions...)
+}
+
+// Requests returns everything the server has received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// RequestsFor returns the requests received by a service.
+func (s *Server) RequestsFor(service string) []Request {
+	var out []Request
+	for _, r := range s.Requests() {
+		if r.Service == service {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func (s *Server) record(r Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r)
+}
+
+func (s *Server) nextResponse(service string) (Response, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queue := s.responses[service]
+	if len(queue) == 0 {
+		return Response{}, false
+	}
+	s.responses[service] = queue[1:]
+	return queue[0], true
+}
+
+func (s *Server) nextSession(service string) (Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	queue := s.sessions[service]
+	if len(queue) == 0 {
+		return Session{}, false
+	}
+	s.sessions[service] = queue[1:]
+	return queue[0], true
+}
+
+// newID returns a unique identifier with the given prefix.
+func (s *Server) newID(prefix string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	return fmt.Sprintf("%s-%d", prefix, s.nextID)
+}
+
+// authorized reports whether r carries the server's API key.
+func (s *Server) authorized(r *http.Request) bool {
+	return s.APIKey == "" || r.Header.Get("Authorization") == "Bearer "+s.APIKey
+}
+
+// services maps HTTP paths to service names.
+var services = map[string]string{
+	dashscope.QwenGenerationPath:      dashscope.ServiceGeneration,
+	dashscope.QwenVLGenerationPath:    dashscope.ServiceMultiModalGeneration,
+	dashscope.TextEmbeddingPath:       dashscope.ServiceTextEmbedding,
+	dashscope.MultimodalEmbeddingPath: dashscope.ServiceMultimodalEmbedding,
+	dashscope.TextReRankPath:          dashscope.ServiceTextReRank,
+	dashscope.NLUUnderstandingPath:    dashscope.ServiceUnderstanding,
+	dashscope.ImageSynthesisPath:      dashscope.ServiceImageSynthesis,
+	dashscope.ASRTranscriptionPath:    dashscope.ServiceTranscription,
+	dashscope.TokenizerPath:           dashscope.ServiceTokenization,
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == websocketPath {
+		s.serveWebsocket(w, r)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, filesPath) {
+		s.serveFile(w, r)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, httpPrefix)
+	service, ok := services[path]
+	if strings.HasPrefix(path, dashscope.TaskPath+"/") {
+		service, ok = dashscope.ServiceTask, true
+	}
+	if strings.HasPrefix(path, dashscope.AppsPath+"/") && strings.HasSuffix(path, "/completion") {
+		service, ok = dashscope.ServiceApplication, true
+	}
+	if strings.HasPrefix(r.URL.Path, compatPrefix) {
+		path = strings.TrimPrefix(r.URL.Path, compatPrefix)
+		service, ok = compatServices[path]
+		if strings.HasPrefix(path, dashscope.CompatibleFilesPath+"/") {
+			service, ok = dashscope.ServiceFiles, true
+		}
+		if strings.HasPrefix(path, dashscope.CompatibleBatchesPath+"/") {
+			service, ok = dashscope.ServiceBatches, true
+		}
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	s.record(Request{
+		Service: service,
+		Method:  r.Method,
+		Path:    path,
+		Header:  r.Header.Clone(),
+		Body:    body,
+	})
+
+	if !ok {
+		s.writeError(w, http.StatusNotFound, "InvalidURL", "url not found: "+r.URL.Path)
+		return
+	}
+	if !s.authorized(r) {
+		s.writeError(w, http.StatusUnauthorized, dashscope.ErrCodeInvalidAPIKey, "Invalid API-key provided.")
+		return
+	}
+
+	resp, _ := s.nextResponse(service)
+	sleep(r, s.Latency+resp.Delay)
+	if resp.Disconnect {
+		disconnect(w)
+		return
+	}
+	if resp.scripted() {
+		s.writeResponse(w, r, resp, service, path)
+		return
+	}
+	if service == dashscope.ServiceFiles {
+		s.serveStoredFiles(w, r, path, body)
+		return
+	}
+	if service == dashscope.ServiceBatches {
+		s.serveBatches(w, r, path, body)
+		return
+	}
+
+	stream := r.Header.Get("X-DashScope-SSE") == "enable" ||
+		strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	if stream && service == dashscope.ServiceChatCompletions {
+		if resp.Events == nil {
+			resp.Events = s.chatCompletionEvents(body)
+		}
+		s.writeStream(w, r, resp, service)
+		return
+	}
+	if stream && service == dashscope.ServiceApplication {
+		if resp.Events == nil {
+			resp.Events = s.applicationEvents(body)
+		}
+		s.writeStream(w, r, resp, service)
+		return
+	}
+	if stream && (service == dashscope.ServiceGeneration || service == dashscope.ServiceMultiModalGeneration) {
+		if resp.Events == nil {
+			resp.Events = s.defaultEvents(service, body)
+		}
+		s.writeStream(w, r, resp, service)
+		return
+	}
+	resp.Body = s.defaultBody(service, path, body)
+	s.writeResponse(w, r, resp, service, path)
+}
+
+func (s *Server) writeResponse(w http.ResponseWriter, r *http.Request, resp Response, service, path string) {
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	if resp.Events != nil {
+		s.writeStream(w, r, resp, service)
+		return
+	}
+
+	body := resp.Body
+	if failure, ok := body.(taskFailure); ok {
+		body = s.failedTask(strings.TrimPrefix(path, dashscope.TaskPath+"/"), failure)
+	}
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	writeJSON(w, status, s.withRequestID(w, body))
+}
+
+// withRequestID sets the request ID header and fills in the request_id of
+// generated and error bodies.
+func (s *Server) withRequestID(w http.ResponseWriter, body interface{}) interface{} {
+	requestID := w.Header().Get("X-Request-Id")
+	if requestID == "" {
+		requestID = s.newID("req")
+		w.Header().Set("X-Request-Id", requestID)
+	}
+	if m, ok := body.(map[string]interface{}); ok {
+		if _, ok := m["request_id"]; !ok {
+			m["request_id"] = requestID
+		}
+		return m
+	}
+	switch b := body.(type) {
+	case *dashscope.ChatCompletion:
+		if b.ID == "" {
+			b.ID = requestID
+		}
+	case *dashscope.EmbeddingResponse:
+		if b.ID == "" {
+			b.ID = requestID
+		}
+	}
+	if e, ok := body.(Error); ok && e.RequestID == "" {
+		e.RequestID = requestID
+		return e
+	}
+	if e, ok := body.(*Error); ok && e.RequestID == "" {
+		copied := *e
+		copied.RequestID = requestID
+		return copied
+	}
+	return body
+}
+
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, ".json") {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"file_url": r.URL.String(),
+			"transcripts": []map[string]interface{}{
+				{"channel_id": 0, "text": s.Transcript},
+			},
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(pixelPNG)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	switch body := v.(type) {
+	case nil:
+	case []byte:
+		w.Write(body)
+	case string:
+		io.WriteString(w, body)
+	default:
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+func (s *Server) writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, s.withRequestID(w, Error{Code: code, Message: message}))
+}
+
+// disconnect resets the connection without responding.
+func disconnect(w http.ResponseWriter) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		panic("dashscopetest: response writer does not support hijacking")
+	}
+	conn, _, err := hj.Hijack()
+	if err != nil {
+		return
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+	conn.Close()
+}
+
+func sleep(r *http.Request, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	select {
+	case <-r.Context().Done():
+	case <-time.After(d):
+	}
+}
+
+// pixelPNG is a transparent 1x1 PNG served for generated images.
+var pixelPNG = []byte{
+	0x89, 0x50, 0x4e, 0x47, 0x0d, 0x0a, 0x1a, 0x0a, 0x00, 0x00, 0x00, 0x0d,
+	0x49, 0x48, 0x44, 0x52, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x01,
+	0x08, 0x06, 0x00, 0x00, 0x00, 0x1f, 0x15, 0xc4, 0x89, 0x00, 0x00, 0x00,
+	0x0d, 0x49, 0x44, 0x41, 0x54, 0x78, 0x9c, 0x63, 0x00, 0x01, 0x00, 0x00,
+	0x05, 0x00, 0x01, 0x0d, 0x0a, 0x2d, 0xb4, 0x00, 0x00, 0x00, 0x00, 0x49,
+	0x45, 0x4e, 0x44, 0xae, 0x42, 0x60, 0x82,
+}
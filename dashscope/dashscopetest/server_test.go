@@ -0,0 +1,400 @@
+package dashscopetest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+	"github.com/ceoifung/go-dashscope/dashscope/dashscopetest"
+)
+
+// fastRetry is the default retry policy with negligible backoff.
+func fastRetry() *dashscope.RetryPolicy {
+	policy := dashscope.DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	policy.MaxBackoff = 5 * time.Millisecond
+	policy.RespectRetryAfter = false
+	return policy
+}
+
+func generationRequest(incremental bool) dashscope.GenerationRequest {
+	return dashscope.GenerationRequest{
+		Model: dashscope.QwenTurbo,
+		Input: dashscope.GenerationInput{
+			Messages: []dashscope.Message{{Role: dashscope.RoleUser, Content: "Hi"}},
+		},
+		Parameters: &dashscope.GenerationParameters{
+			ResultFormat:      "message",
+			IncrementalOutput: incremental,
+		},
+	}
+}
+
+func TestRetry(t *testing.T) {
+	throttled := dashscopetest.Fail(http.StatusTooManyRequests, dashscope.ErrCodeThrottling, "Requests rate limit exceeded")
+	unavailable := dashscopetest.Fail(http.StatusServiceUnavailable, "ServiceUnavailable", "busy")
+	internal := dashscopetest.Fail(http.StatusInternalServerError, dashscope.ErrCodeInternalError, "oops")
+	invalid := dashscopetest.Fail(http.StatusBadRequest, dashscope.ErrCodeInvalidParameter, "bad input")
+
+	tests := []struct {
+		name         string
+		responses    []dashscopetest.Response
+		wantStatus   int // Status of the returned *APIError, zero for success
+		wantRequests int
+	}{
+		{"success", nil, 0, 1},
+		{"throttled once", []dashscopetest.Response{throttled}, 0, 2},
+		{"server errors", []dashscopetest.Response{internal, unavailable}, 0, 3},
+		{"dropped connection", []dashscopetest.Response{{Disconnect: true}}, 0, 2},
+		{"gives up", []dashscopetest.Response{throttled, unavailable, internal, throttled}, http.StatusTooManyRequests, 4},
+		{"not retryable", []dashscopetest.Response{invalid}, http.StatusBadRequest, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := dashscopetest.NewServer()
+			defer srv.Close()
+			srv.Enqueue(dashscope.ServiceGeneration, tt.responses...)
+
+			var retries int
+			policy := fastRetry()
+			policy.OnRetry = func(dashscope.RetryAttempt) { retries++ }
+			client := srv.Client(dashscope.WithRetryPolicy(policy))
+
+			resp, err := client.Generation().Call(context.Background(), generationRequest(false))
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Fatalf("Call: %v", err)
+				}
+				if got := resp.Output.Choices[0].Message.Content; got != srv.Reply {
+					t.Errorf("content = %q, want %q", got, srv.Reply)
+				}
+			} else {
+				var apiErr *dashscope.APIError
+				if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.wantStatus {
+					t.Fatalf("Call error = %v, want an *APIError with status %d", err, tt.wantStatus)
+				}
+			}
+			if got := len(srv.RequestsFor(dashscope.ServiceGeneration)); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+			if retries != tt.wantRequests-1 {
+				t.Errorf("OnRetry called %d times, want %d", retries, tt.wantRequests-1)
+			}
+		})
+	}
+}
+
+func TestStream(t *testing.T) {
+	chunk := func(text, finish string) map[string]interface{} {
+		return map[string]interface{}{
+			"output": map[string]interface{}{
+				"choices": []map[string]interface{}{{
+					"finish_reason": finish,
+					"message":       map[string]interface{}{"role": dashscope.RoleAssistant, "content": text},
+				}},
+			},
+			"usage": map[string]interface{}{"input_tokens": 3, "output_tokens": 2},
+		}
+	}
+
+	tests := []struct {
+		name        string
+		responses   []dashscopetest.Response
+		incremental bool
+		want        []string
+		wantCode    string // Code of the *APIError ending the stream
+	}{
+		{
+			name:        "default incremental",
+			incremental: true,
+			want:        strings.SplitAfter("Hello! How can I help you today?", " "),
+		},
+		{
+			name: "default cumulative",
+			want: []string{"Hello! ", "Hello! How ", "Hello! How can ", "Hello! How can I ", "Hello! How can I help ",
+				"Hello! How can I help you ", "Hello! How can I help you today?"},
+		},
+		{
+			name:        "scripted chunks",
+			responses:   []dashscopetest.Response{dashscopetest.Chunks(chunk("Hel", "null"), chunk("lo", "stop"))},
+			incremental: true,
+			want:        []string{"Hel", "lo"},
+		},
+		{
+			name: "error event",
+			responses: []dashscopetest.Response{{
+				Events:      []interface{}{chunk("Hel", "null")},
+				StreamError: &dashscopetest.Error{Code: dashscope.ErrCodeDataInspectionFailed, Message: "inappropriate content"},
+			}},
+			incremental: true,
+			want:        []string{"Hel"},
+			wantCode:    dashscope.ErrCodeDataInspectionFailed,
+		},
+		{
+			name: "retried before the first chunk",
+			responses: []dashscopetest.Response{
+				dashscopetest.Fail(http.StatusTooManyRequests, dashscope.ErrCodeThrottling, "slow down"),
+				dashscopetest.Chunks(chunk("ok", "stop")),
+			},
+			incremental: true,
+			want:        []string{"ok"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := dashscopetest.NewServer()
+			defer srv.Close()
+			srv.Enqueue(dashscope.ServiceGeneration, tt.responses...)
+			client := srv.Client(dashscope.WithRetryPolicy(fastRetry()))
+
+			stream, err := client.Generation().Stream(context.Background(), generationRequest(tt.incremental))
+			if err != nil {
+				t.Fatalf("Stream: %v", err)
+			}
+			defer stream.Close()
+
+			var got []string
+			for stream.Next() {
+				chunk := stream.Current()
+				if chunk.RequestID == "" {
+					t.Error("chunk without request ID")
+				}
+				got = append(got, chunk.Output.Choices[0].Message.Content)
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("chunks = %q, want %q", got, tt.want)
+			}
+
+			err = stream.Err()
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Errorf("Err = %v", err)
+				}
+				return
+			}
+			var apiErr *dashscope.APIError
+			if !errors.As(err, &apiErr) || apiErr.Code != tt.wantCode {
+				t.Errorf("Err = %v, want an *APIError with code %s", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestTaskPolling(t *testing.T) {
+	tests := []struct {
+		name      string
+		polls     int
+		responses []dashscopetest.Response
+		wantCode  string // Code of the returned *APIError
+		wantPolls int
+	}{
+		{name: "immediate", polls: 0, wantPolls: 1},
+		{name: "running", polls: 1, wantPolls: 2},
+		{
+			name:      "failed",
+			responses: []dashscopetest.Response{dashscopetest.TaskFailed(dashscope.ErrCodeDataInspectionFailed, "unsafe prompt")},
+			wantCode:  dashscope.ErrCodeDataInspectionFailed,
+			wantPolls: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := dashscopetest.NewServer()
+			defer srv.Close()
+			srv.TaskPolls = tt.polls
+			srv.Enqueue(dashscope.ServiceTask, tt.responses...)
+			client := srv.Client()
+
+			resp, err := client.ImageSynthesis().Call(context.Background(), dashscope.ImageSynthesisRequest{
+				Model: dashscope.WanxV1,
+				Input: dashscope.ImageSynthesisInput{Prompt: "a cat"},
+			})
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("Call: %v", err)
+				}
+				if resp.Output.TaskStatus != dashscope.TaskStatusSucceeded || len(resp.Output.Results) == 0 {
+					t.Errorf("output = %+v, want succeeded with results", resp.Output)
+				}
+			} else {
+				var apiErr *dashscope.APIError
+				if !errors.As(err, &apiErr) || apiErr.Code != tt.wantCode || apiErr.TaskID == "" {
+					t.Fatalf("Call error = %v, want an *APIError with code %s and a task ID", err, tt.wantCode)
+				}
+				if resp == nil || resp.Output.TaskStatus != dashscope.TaskStatusFailed {
+					t.Errorf("response = %+v, want the failed task", resp)
+				}
+			}
+			if got := len(srv.RequestsFor(dashscope.ServiceTask)); got != tt.wantPolls {
+				t.Errorf("polls = %d, want %d", got, tt.wantPolls)
+			}
+		})
+	}
+}
+
+func TestWaitForUnknownTask(t *testing.T) {
+	srv := dashscopetest.NewServer()
+	defer srv.Close()
+
+	resp, err := srv.Client().WaitForTask(context.Background(), "task-missing")
+	var apiErr *dashscope.APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("WaitForTask error = %v, want an *APIError", err)
+	}
+	if resp == nil || resp.Output.TaskStatus != dashscope.TaskStatusUnknown {
+		t.Errorf("response = %+v, want the unknown task", resp)
+	}
+}
+
+func TestSpeechSynthesisSession(t *testing.T) {
+	tests := []struct {
+		name      string
+		session   *dashscopetest.Session
+		wantAudio int
+		wantCode  string
+	}{
+		{name: "default", wantAudio: 3200},
+		{
+			name: "scripted audio",
+			session: &dashscopetest.Session{Started: []dashscopetest.Frame{
+				{Event: string(dashscope.EventTaskStarted)},
+				dashscopetest.AudioFrame(make([]byte, 10)),
+				dashscopetest.AudioFrame(make([]byte, 20)),
+				{Event: string(dashscope.EventTaskFinished), Payload: map[string]interface{}{"usage": map[string]interface{}{"characters": 5}}},
+			}},
+			wantAudio: 30,
+		},
+		{
+			name:     "failed",
+			session:  &dashscopetest.Session{Fail: &dashscopetest.Error{Code: dashscope.ErrCodeInvalidParameter, Message: "voice not found"}},
+			wantCode: dashscope.ErrCodeInvalidParameter,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := dashscopetest.NewServer()
+			defer srv.Close()
+			if tt.session != nil {
+				srv.EnqueueSession(dashscope.ServiceSpeechSynthesis, *tt.session)
+			}
+
+			result, err := srv.Client().SpeechSynthesizer("cosyvoice-v1").Call(context.Background(), "Hello", nil, nil)
+			if tt.wantCode != "" {
+				var apiErr *dashscope.APIError
+				if !errors.As(err, &apiErr) || apiErr.Code != tt.wantCode {
+					t.Fatalf("Call error = %v, want an *APIError with code %s", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Call: %v", err)
+			}
+			if len(result.AudioData) != tt.wantAudio {
+				t.Errorf("audio = %d bytes, want %d", len(result.AudioData), tt.wantAudio)
+			}
+			if result.Usage == nil || result.Usage.Characters != 5 {
+				t.Errorf("usage = %+v, want 5 characters", result.Usage)
+			}
+
+			var actions []string
+			for _, r := range srv.RequestsFor(dashscope.ServiceSpeechSynthesis) {
+				actions = append(actions, r.Action)
+			}
+			if len(actions) != 1 || actions[0] != string(dashscope.ActionRunTask) {
+				t.Errorf("actions = %q, want [run-task]", actions)
+			}
+		})
+	}
+}
+
+// recognitionCallback collects the sentences of a recognition session.
+type recognitionCallback struct {
+	mu        sync.Mutex
+	texts     []string
+	err       error
+	completed bool
+}
+
+func (c *recognitionCallback) OnOpen()  {}
+func (c *recognitionCallback) OnClose() {}
+
+func (c *recognitionCallback) OnComplete() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.completed = true
+}
+
+func (c *recognitionCallback) OnError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.err = err
+}
+
+func (c *recognitionCallback) OnEvent(result *dashscope.RecognitionResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range result.Sentences {
+		text, _ := s.(map[string]interface{})["text"].(string)
+		c.texts = append(c.texts, text)
+	}
+}
+
+func TestRecognitionSession(t *testing.T) {
+	tests := []struct {
+		name      string
+		frames    int
+		want      []string
+		wantFinal string
+	}{
+		{"no audio", 0, []string{""}, ""},
+		{"partial results", 3, []string{"What", "What is", "What is the", "What is the weather like today?"}, "What is the weather like today?"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := dashscopetest.NewServer()
+			defer srv.Close()
+			if tt.frames == 0 {
+				srv.Transcript = ""
+			}
+
+			cb := &recognitionCallback{}
+			rec := srv.Client().Recognition("paraformer-realtime-v2", "pcm", 16000)
+			if err := rec.Start(context.Background(), cb, nil); err != nil {
+				t.Fatalf("Start: %v", err)
+			}
+			for i := 0; i < tt.frames; i++ {
+				if err := rec.SendAudioFrame(make([]byte, 3200)); err != nil {
+					t.Fatalf("SendAudioFrame: %v", err)
+				}
+			}
+			rec.Stop()
+
+			cb.mu.Lock()
+			defer cb.mu.Unlock()
+			if cb.err != nil || !cb.completed {
+				t.Fatalf("session ended with error %v, completed %v", cb.err, cb.completed)
+			}
+			if strings.Join(cb.texts, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("sentences = %q, want %q", cb.texts, tt.want)
+			}
+			if final := cb.texts[len(cb.texts)-1]; final != tt.wantFinal {
+				t.Errorf("final sentence = %q, want %q", final, tt.wantFinal)
+			}
+
+			var audio int
+			for _, r := range srv.RequestsFor(dashscope.ServiceRecognition) {
+				if r.Binary {
+					audio++
+				}
+			}
+			if audio != tt.frames {
+				t.Errorf("audio frames received = %d, want %d", audio, tt.frames)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package dashscopetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+)
+
+// task is an async task submitted to the server.
+type task struct {
+	service string
+	body    []byte
+	polls   int // RUNNING polls left
+}
+
+func (s *Server) submitTask(service string, body []byte) interface{} {
+	id := s.newID("task")
+
+	s.mu.Lock()
+	s.tasks[id] = &task{service: service, body: body, polls: s.TaskPolls}
+	s.mu.Unlock()
+
+	return map[string]interface{}{
+		"output": map[string]interface{}{
+			"task_id":     id,
+			"task_status": dashscope.TaskStatusPending,
+		},
+	}
+}
+
+func (s *Server) pollTask(id string) interface{} {
+	s.mu.Lock()
+	t, ok := s.tasks[id]
+	running := ok && t.polls > 0
+	if running {
+		t.polls--
+	}
+	s.mu.Unlock()
+
+	output := map[string]interface{}{"task_id": id}
+	switch {
+	case !ok:
+		output["task_status"] = dashscope.TaskStatusUnknown
+	case running:
+		output["task_status"] = dashscope.TaskStatusRunning
+	default:
+		output["task_status"] = dashscope.TaskStatusSucceeded
+		results, usage := s.taskResults(id, t)
+		output["results"] = results
+		return map[string]interface{}{"output": output, "usage": usage}
+	}
+	return map[string]interface{}{"output": output}
+}
+
+// taskResults builds the results of a finished task, pointing at files
+// served by the server.
+func (s *Server) taskResults(id string, t *task) (interface{}, interface{}) {
+	files := strings.TrimSuffix(s.URL, httpPrefix) + strings.TrimSuffix(filesPath, "/")
+
+	if t.service == dashscope.ServiceTranscription {
+		var req dashscope.TranscriptionRequest
+		json.Unmarshal(t.body, &req)
+		results := make([]map[string]interface{}, len(req.Input.FileURLs))
+		for i, url := range req.Input.FileURLs {
+			results[i] = map[string]interface{}{
+				"file_url":          url,
+				"transcription_url": fmt.Sprintf("%s/%s-%d.json", files, id, i),
+				"subtask_status":    dashscope.TaskStatusSucceeded,
+			}
+		}
+		return results, map[string]interface{}{"duration": 10 * len(results)}
+	}
+
+	var req dashscope.ImageSynthesisRequest
+	json.Unmarshal(t.body, &req)
+	n := 1
+	if req.Parameters != nil && req.Parameters.N > 0 {
+		n = req.Parameters.N
+	}
+	results := make([]map[string]interface{}, n)
+	for i := range results {
+		results[i] = map[string]interface{}{"url": fmt.Sprintf("%s/%s-%d.png", files, id, i)}
+	}
+	return results, map[string]interface{}{"image_count": n}
+}
+
+// failedTask builds the poll reply of a task that failed.
+func (s *Server) failedTask(id string, failure taskFailure) interface{} {
+	return map[string]interface{}{
+		"output": map[string]interface{}{
+			"task_id":     id,
+			"task_status": dashscope.TaskStatusFailed,
+			"code":        failure.code,
+			"message":     failure.message,
+		},
+	}
+}
@@ -0,0 +1,320 @@
+package dashscopetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+	"github.com/gorilla/websocket"
+)
+
+// Session scripts the server side of one websocket task. Nil phases use the
+// service's default frames.
+type Session struct {
+	// Started is sent after run-task, or the dialog's Start action. Speech
+	// synthesis sends its whole reply here.
+	Started []Frame
+	// Audio[i] is sent in reply to the client's i-th audio frame.
+	Audio []Frame
+	// Finished is sent after finish-task, or the dialog's StopSpeech action.
+	Finished []Frame
+	// Fail, if set, fails the task right after it starts: task-failed for
+	// speech synthesis and recognition, an Error directive for the dialog.
+	Fail *Error
+}
+
+// Frame is a websocket message sent by the server.
+type Frame struct {
+	// Event is a task event such as "result-generated", or a dialog
+	// directive such as "SpeechContent".
+	Event string
+	// Payload is the task event payload, or the dialog directive's output
+	// fields.
+	Payload map[string]interface{}
+	// Audio, if set, is sent as a binary frame instead of an event.
+	Audio []byte
+	// Delay is waited before sending the frame.
+	Delay time.Duration
+}
+
+// AudioFrame returns a frame carrying audio data.
+func AudioFrame(data []byte) Frame {
+	return Frame{Audio: data}
+}
+
+// silence is the default synthesized audio: 100ms of 16kHz 16-bit PCM.
+var silence = make([]byte, 3200)
+
+// wsMessage covers the fields of client messages the server looks at.
+type wsMessage struct {
+	Header struct {
+		Action string `json:"action"`
+		TaskID string `json:"task_id"`
+	} `json:"header"`
+	Payload struct {
+		Task  string `json:"task"`
+		Model string `json:"model"`
+		Input struct {
+			Text string `json:"text"`
+		} `json:"input"`
+	} `json:"payload"`
+}
+
+// wsSession is the state of one websocket connection.
+type wsSession struct {
+	s       *Server
+	conn    *websocket.Conn
+	r       *http.Request
+	service string
+	taskID  string
+	script  Session
+	frames  int // Audio frames received
+	text    string
+}
+
+func (s *Server) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		s.writeError(w, http.StatusUnauthorized, dashscope.ErrCodeInvalidAPIKey, "Invalid API-key provided.")
+		return
+	}
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	ws := &wsSession{s: s, conn: conn, r: r}
+	for {
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		if messageType == websocket.BinaryMessage {
+			s.record(Request{
+				Service: ws.service,
+				Method:  "WS",
+				Path:    websocketPath,
+				Header:  r.Header.Clone(),
+				Body:    data,
+				Binary:  true,
+			})
+			ws.frames++
+			if err := ws.onAudio(); err != nil {
+				return
+			}
+			continue
+		}
+
+		var msg wsMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+		if ws.service == "" {
+			ws.start(msg)
+		}
+		s.record(Request{
+			Service: ws.service,
+			Method:  "WS",
+			Path:    websocketPath,
+			Header:  r.Header.Clone(),
+			Body:    data,
+			Action:  msg.Header.Action,
+		})
+		if err := ws.onAction(msg.Header.Action); err != nil {
+			return
+		}
+	}
+}
+
+// start identifies the service of the first message and picks its script.
+func (ws *wsSession) start(msg wsMessage) {
+	switch msg.Payload.Task {
+	case "tts":
+		ws.service = dashscope.ServiceSpeechSynthesis
+	case "asr":
+		ws.service = dashscope.ServiceRecognition
+	default:
+		ws.service = dashscope.ServiceMultiModalDialog
+	}
+	ws.taskID = msg.Header.TaskID
+	ws.text = msg.Payload.Input.Text
+	ws.script, _ = ws.s.nextSession(ws.service)
+}
+
+func (ws *wsSession) onAction(action string) error {
+	switch action {
+	case string(dashscope.ActionRunTask), dashscope.ActionStart:
+		if ws.script.Fail != nil {
+			return ws.fail()
+		}
+		frames := ws.script.Started
+		if frames == nil {
+			frames = ws.defaultStarted()
+		}
+		return ws.send(frames)
+	case string(dashscope.ActionFinishTask), dashscope.ActionStopSpeech:
+		frames := ws.script.Finished
+		if frames == nil {
+			frames = ws.defaultFinished()
+		}
+		return ws.send(frames)
+	case dashscope.ActionStop:
+		return ws.send([]Frame{{Event: dashscope.ResponseStopped}})
+	}
+	return nil
+}
+
+func (ws *wsSession) onAudio() error {
+	i := ws.frames - 1
+	if ws.script.Audio != nil {
+		if i < len(ws.script.Audio) {
+			return ws.send(ws.script.Audio[i : i+1])
+		}
+		return nil
+	}
+
+	switch ws.service {
+	case dashscope.ServiceRecognition:
+		return ws.send([]Frame{ws.sentence(false)})
+	case dashscope.ServiceMultiModalDialog:
+		if i == 0 {
+			return ws.send([]Frame{{Event: dashscope.ResponseSpeechStarted}})
+		}
+	}
+	return nil
+}
+
+func (ws *wsSession) defaultStarted() []Frame {
+	switch ws.service {
+	case dashscope.ServiceSpeechSynthesis:
+		usage := map[string]interface{}{"characters": utf8.RuneCountInString(ws.text)}
+		return []Frame{
+			{Event: string(dashscope.EventTaskStarted)},
+			AudioFrame(silence),
+			{Event: string(dashscope.EventResultGenerated), Payload: map[string]interface{}{
+				"output": map[string]interface{}{
+					"sentence": map[string]interface{}{"begin_time": 0, "end_time": 100, "words": []interface{}{}},
+				},
+				"usage": usage,
+			}},
+			{Event: string(dashscope.EventTaskFinished), Payload: map[string]interface{}{
+				"output": map[string]interface{}{},
+				"usage":  usage,
+			}},
+		}
+	case dashscope.ServiceRecognition:
+		return []Frame{{Event: string(dashscope.EventTaskStarted)}}
+	default:
+		return []Frame{{Event: dashscope.ResponseStarted, Payload: map[string]interface{}{
+			"dialog_id": ws.s.newID("dialog"),
+		}}}
+	}
+}
+
+func (ws *wsSession) defaultFinished() []Frame {
+	switch ws.service {
+	case dashscope.ServiceRecognition:
+		return []Frame{
+			ws.sentence(true),
+			{Event: string(dashscope.EventTaskFinished), Payload: map[string]interface{}{
+				"output": map[string]interface{}{},
+				"usage":  map[string]interface{}{"duration": ws.frames / 10},
+			}},
+		}
+	case dashscope.ServiceMultiModalDialog:
+		return []Frame{
+			{Event: dashscope.ResponseSpeechEnded},
+			{Event: dashscope.ResponseSpeechContent, Payload: map[string]interface{}{"text": ws.s.Transcript}},
+			{Event: dashscope.ResponseRespondingStarted},
+			{Event: dashscope.ResponseRespondingContent, Payload: map[string]interface{}{"text": ws.s.Reply}},
+			AudioFrame(silence),
+			{Event: dashscope.ResponseRespondingEnded},
+		}
+	}
+	return []Frame{}
+}
+
+// sentence returns a recognition result revealing one more word of the
+// transcript per audio frame.
+func (ws *wsSession) sentence(final bool) Frame {
+	words := strings.SplitAfter(ws.s.Transcript, " ")
+	n := ws.frames
+	if final || n > len(words) {
+		n = len(words)
+	}
+	sentence := map[string]interface{}{
+		"begin_time":   0,
+		"end_time":     nil,
+		"text":         strings.TrimSpace(strings.Join(words[:n], "")),
+		"sentence_end": final,
+	}
+	if final {
+		sentence["end_time"] = ws.frames * 100
+	}
+	return Frame{Event: string(dashscope.EventResultGenerated), Payload: map[string]interface{}{
+		"output": map[string]interface{}{"sentence": sentence},
+	}}
+}
+
+func (ws *wsSession) fail() error {
+	e := ws.script.Fail
+	if ws.service == dashscope.ServiceMultiModalDialog {
+		return ws.send([]Frame{{Event: dashscope.ResponseError, Payload: map[string]interface{}{
+			"text": e.Message,
+		}}})
+	}
+	return ws.conn.WriteJSON(map[string]interface{}{
+		"header": map[string]interface{}{
+			"task_id":       ws.taskID,
+			"event":         string(dashscope.EventTaskFailed),
+			"error_code":    e.Code,
+			"error_message": e.Message,
+		},
+		"payload": map[string]interface{}{},
+	})
+}
+
+func (ws *wsSession) send(frames []Frame) error {
+	sleep(ws.r, ws.s.Latency)
+	for _, f := range frames {
+		sleep(ws.r, f.Delay)
+		if err := ws.write(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ws *wsSession) write(f Frame) error {
+	if f.Audio != nil {
+		return ws.conn.WriteMessage(websocket.BinaryMessage, f.Audio)
+	}
+
+	if ws.service == dashscope.ServiceMultiModalDialog {
+		output := map[string]interface{}{"directive": f.Event}
+		for k, v := range f.Payload {
+			output[k] = v
+		}
+		return ws.conn.WriteJSON(map[string]interface{}{
+			"header":  map[string]interface{}{"task_id": ws.taskID},
+			"payload": map[string]interface{}{"output": output},
+		})
+	}
+
+	payload := f.Payload
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+	return ws.conn.WriteJSON(map[string]interface{}{
+		"header": map[string]interface{}{
+			"task_id":    ws.taskID,
+			"event":      f.Event,
+			"attributes": map[string]interface{}{},
+		},
+		"payload": payload,
+	})
+}
@@ -18,7 +18,8 @@
 //
 // Basic usage:
 //
-//	gen := dashscope.NewGeneration("your-api-key")
+//	client := dashscope.NewClient(dashscope.WithAPIKey("your-api-key"))
+//	gen := client.Generation()
 //	resp, err := gen.Call(context.Background(), req)
 //
 // See individual client types for more details.
@@ -1,12 +1,8 @@
 package dashscope
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
 	"net/http"
-	"os"
 )
 
 // Text Embedding Models
@@ -26,17 +22,12 @@ const (
 type TextEmbedding struct {
 	APIKey string
 	client *http.Client
+	c      *Client
 }
 
 // NewTextEmbedding creates a new TextEmbedding client.
 func NewTextEmbedding(apiKey string) *TextEmbedding {
-	if apiKey == "" {
-		apiKey = os.Getenv("DASHSCOPE_API_KEY")
-	}
-	return &TextEmbedding{
-		APIKey: apiKey,
-		client: &http.Client{},
-	}
+	return NewClient(WithAPIKey(apiKey)).Embeddings()
 }
 
 // SetHTTPClient sets a custom HTTP client.
@@ -55,7 +46,8 @@ type TextEmbeddingInput struct {
 }
 
 type TextEmbeddingParameters struct {
-	TextType string `json:"text_type,omitempty"` // "query" or "document"
+	TextType  string `json:"text_type,omitempty"` // "query" or "document"
+	Dimension int    `json:"dimension,omitempty"` // text-embedding-v3 and later
 }
 
 type TextEmbeddingResponse struct {
@@ -78,48 +70,122 @@ type EmbeddingUsage struct {
 }
 
 // Call performs the text embedding request.
-func (e *TextEmbedding) Call(ctx context.Context, req TextEmbeddingRequest) (*TextEmbeddingResponse, error) {
-	url := TextEmbeddingURL
+func (e *TextEmbedding) Call(ctx context.Context, req TextEmbeddingRequest) (_ *TextEmbeddingResponse, err error) {
+	url := e.c.url(TextEmbeddingPath)
 
-	jsonData, err := json.Marshal(req)
-	if err != nil {
+	info := CallInfo{Service: ServiceTextEmbedding, Model: req.Model}
+	ctx, op := e.c.startOperation(ctx, "TextEmbedding.Call", info)
+	defer func() { op.end(err) }()
+
+	ctx, cancel := e.c.withTimeout(ctx)
+	defer cancel()
+
+	if err := op.reserve(ctx, estimateTextsTokens(req.Input.Texts, op.counter(ctx))); err != nil {
 		return nil, err
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	httpReq, err := e.c.newRequest(ctx, "POST", url, req, e.APIKey, "")
 	if err != nil {
 		return nil, err
 	}
 
-	httpReq.Header.Set("Authorization", "Bearer "+e.APIKey)
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	resp, err := e.client.Do(httpReq)
+	resp, err := e.c.do(e.client, httpReq, info)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	var embeddingResp TextEmbeddingResponse
-	if err := json.NewDecoder(resp.Body).Decode(&embeddingResp); err != nil {
-		return nil, err
+	err = decodeResponse(resp, &embeddingResp)
+	op.setRequestID(embeddingResp.RequestID)
+	op.setUsage(embeddingResp.Usage.TotalTokens, 0)
+	if err != nil {
+		return &embeddingResp, err
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		return &embeddingResp, fmt.Errorf("text embedding failed: %s (%s)", embeddingResp.Message, embeddingResp.RequestID)
+	return &embeddingResp, nil
+}
+
+// maxEmbeddingTexts returns the number of texts model accepts per request.
+func maxEmbeddingTexts(model string) int {
+	switch model {
+	case TextEmbeddingV1, TextEmbeddingV2:
+		return 25
+	default:
+		return 10
 	}
+}
 
-	return &embeddingResp, nil
+// CallAll embeds any number of texts, split into requests of at most
+// maxTexts texts and maxTokens tokens, counted with the client's
+// TokenCounters. Zero maxTexts means the model's limit and zero maxTokens
+// no token limit. The embeddings are indexed into req.Input.Texts and the
+// usage is summed. On failure the embeddings of the earlier requests are
+// returned with the error.
+func (e *TextEmbedding) CallAll(ctx context.Context, req TextEmbeddingRequest, maxTexts, maxTokens int) (*TextEmbeddingResponse, error) {
+	if maxTexts <= 0 {
+		maxTexts = maxEmbeddingTexts(req.Model)
+	}
+	batches := embeddingBatches(req.Input.Texts, maxTexts, maxTokens, e.c.tokenCounter(ctx, req.Model))
+
+	all := &TextEmbeddingResponse{}
+	offset := 0
+	for _, texts := range batches {
+		batch := req
+		batch.Input.Texts = texts
+		resp, err := e.Call(ctx, batch)
+		if err != nil {
+			return all, err
+		}
+		for _, emb := range resp.Output.Embeddings {
+			emb.TextIndex += offset
+			all.Output.Embeddings = append(all.Output.Embeddings, emb)
+		}
+		all.RequestID = resp.RequestID
+		all.Usage.TotalTokens += resp.Usage.TotalTokens
+		offset += len(texts)
+	}
+	return all, nil
+}
+
+// embeddingBatches splits texts into consecutive batches of at most
+// maxTexts texts and, if maxTokens is positive, maxTokens tokens. A text
+// larger than maxTokens is sent alone.
+func embeddingBatches(texts []string, maxTexts, maxTokens int, count func(string) int) [][]string {
+	var batches [][]string
+	start, tokens := 0, 0
+	for i, text := range texts {
+		n := 0
+		if maxTokens > 0 {
+			n = count(text)
+		}
+		if i > start && (i-start == maxTexts || (maxTokens > 0 && tokens+n > maxTokens)) {
+			batches = append(batches, texts[start:i])
+			start, tokens = i, 0
+		}
+		tokens += n
+	}
+	if start < len(texts) {
+		batches = append(batches, texts[start:])
+	}
+	return batches
 }
 
 // MultimodalEmbedding handles the multimodal embedding API.
 type MultimodalEmbedding struct {
 	APIKey string
+	client *http.Client
+	c      *Client
 }
 
 // NewMultimodalEmbedding creates a new MultimodalEmbedding client.
 func NewMultimodalEmbedding(apiKey string) *MultimodalEmbedding {
-	return &MultimodalEmbedding{APIKey: apiKey}
+	return NewClient(WithAPIKey(apiKey)).MultimodalEmbedding()
+}
+
+// SetHTTPClient sets a custom HTTP client.
+func (e *MultimodalEmbedding) SetHTTPClient(client *http.Client) {
+	e.client = client
 }
 
 type MultimodalEmbeddingRequest struct {
@@ -154,39 +220,50 @@ type MultimodalEmbeddingResponse struct {
 }
 
 // Call performs the multimodal embedding request.
-func (e *MultimodalEmbedding) Call(req MultimodalEmbeddingRequest) (*MultimodalEmbeddingResponse, error) {
-	url := "https://dashscope.aliyuncs.com/api/v1/services/embeddings/multimodal-embedding/multimodal-embedding"
+func (e *MultimodalEmbedding) Call(req MultimodalEmbeddingRequest) (_ *MultimodalEmbeddingResponse, err error) {
+	url := e.c.url(MultimodalEmbeddingPath)
 
-	jsonData, err := json.Marshal(req)
-	if err != nil {
+	info := CallInfo{Service: ServiceMultimodalEmbedding, Model: req.Model}
+	ctx, op := e.c.startOperation(context.Background(), "MultimodalEmbedding.Call", info)
+	defer func() { op.end(err) }()
+
+	ctx, cancel := e.c.withTimeout(ctx)
+	defer cancel()
+
+	if err := op.reserve(ctx, 0); err != nil {
 		return nil, err
 	}
 
-	httpReq, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	httpReq, err := e.c.newRequest(ctx, "POST", url, req, e.APIKey, "")
 	if err != nil {
 		return nil, err
 	}
 
-	httpReq.Header.Set("Authorization", "Bearer "+e.APIKey)
-	httpReq.Header.Set("Content-Type", "application/json")
 	// Header required for OSS resource resolution if URLs are passed (assumed true for simplicity)
 	httpReq.Header.Set("X-DashScope-OssResourceResolve", "enable")
 
-	client := &http.Client{}
-	resp, err := client.Do(httpReq)
+	resp, err := e.c.do(e.client, httpReq, info)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	var embeddingResp MultimodalEmbeddingResponse
-	if err := json.NewDecoder(resp.Body).Decode(&embeddingResp); err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return &embeddingResp, fmt.Errorf("multimodal embedding failed: %s (%s)", embeddingResp.Message, embeddingResp.RequestID)
+	err = decodeResponse(resp, &embeddingResp)
+	op.setRequestID(embeddingResp.RequestID)
+	op.setUsage(embeddingResp.Usage.TotalTokens, 0)
+	if err != nil {
+		return &embeddingResp, err
 	}
 
 	return &embeddingResp, nil
 }
+
+// estimateTextsTokens estimates the total tokens of texts.
+func estimateTextsTokens(texts []string, count func(string) int) int {
+	n := 0
+	for _, text := range texts {
+		n += count(text)
+	}
+	return n
+}
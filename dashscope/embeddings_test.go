@@ -0,0 +1,31 @@
+package dashscope
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEmbeddingBatches(t *testing.T) {
+	count := func(text string) int { return len(text) }
+	tests := []struct {
+		name      string
+		texts     []string
+		maxTexts  int
+		maxTokens int
+		want      [][]string
+	}{
+		{"empty", nil, 10, 0, nil},
+		{"single batch", []string{"a", "b"}, 10, 0, [][]string{{"a", "b"}}},
+		{"by count", []string{"a", "b", "c", "d", "e"}, 2, 0, [][]string{{"a", "b"}, {"c", "d"}, {"e"}}},
+		{"by tokens", []string{"aaa", "bb", "cc", "d"}, 10, 5, [][]string{{"aaa", "bb"}, {"cc", "d"}}},
+		{"oversized text alone", []string{"a", "bbbbbbbb", "c"}, 10, 5, [][]string{{"a"}, {"bbbbbbbb"}, {"c"}}},
+		{"count and tokens", []string{"a", "b", "c", "ddddd"}, 2, 5, [][]string{{"a", "b"}, {"c"}, {"ddddd"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := embeddingBatches(tt.texts, tt.maxTexts, tt.maxTokens, count); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("batches = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package dashscope
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Error codes returned by DashScope.
+const (
+	ErrCodeThrottling           = "Throttling"
+	ErrCodeInvalidParameter     = "InvalidParameter"
+	ErrCodeInvalidAPIKey        = "InvalidApiKey"
+	ErrCodeAccessDenied         = "AccessDenied"
+	ErrCodeDataInspectionFailed = "DataInspectionFailed"
+	ErrCodeInternalError        = "InternalError"
+)
+
+// APIError is returned by every service when DashScope reports a failure,
+// whether through an HTTP status, a failed async task or a websocket
+// task-failed event. Use errors.As to inspect it.
+type APIError struct {
+	StatusCode int    // HTTP status, zero for websocket and task failures
+	Code       string // DashScope error code, e.g. "Throttling.RateQuota"
+	Message    string
+	RequestID  string
+	TaskID     string // Set for async task and websocket failures
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" && e.StatusCode != 0 {
+		msg = http.StatusText(e.StatusCode)
+	}
+	if msg == "" {
+		msg = "request failed"
+	}
+
+	var details []string
+	if e.StatusCode != 0 {
+		details = append(details, fmt.Sprintf("status: %d", e.StatusCode))
+	}
+	if e.Code != "" {
+		details = append(details, "code: "+e.Code)
+	}
+	if e.RequestID != "" {
+		details = append(details, "request_id: "+e.RequestID)
+	}
+	if e.TaskID != "" {
+		details = append(details, "task_id: "+e.TaskID)
+	}
+	if len(details) == 0 {
+		return "dashscope: " + msg
+	}
+	return fmt.Sprintf("dashscope: %s (%s)", msg, strings.Join(details, ", "))
+}
+
+// hasCode reports whether the error code is code or one of its sub-codes,
+// e.g. "Throttling.RateQuota" has code "Throttling".
+func (e *APIError) hasCode(code string) bool {
+	return e.Code == code || strings.HasPrefix(e.Code, code+".")
+}
+
+// IsRateLimited reports whether the request was throttled.
+func (e *APIError) IsRateLimited() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.hasCode(ErrCodeThrottling)
+}
+
+// IsAuth reports whether the request was rejected for authentication or
+// authorization reasons.
+func (e *APIError) IsAuth() bool {
+	return e.StatusCode == http.StatusUnauthorized ||
+		e.StatusCode == http.StatusForbidden ||
+		e.hasCode(ErrCodeInvalidAPIKey) ||
+		e.hasCode(ErrCodeAccessDenied)
+}
+
+// IsInvalidParameter reports whether the request was rejected as malformed.
+func (e *APIError) IsInvalidParameter() bool {
+	return e.hasCode(ErrCodeInvalidParameter)
+}
+
+// IsContentFiltered reports whether the input or output was blocked by
+// content moderation.
+func (e *APIError) IsContentFiltered() bool {
+	return e.hasCode(ErrCodeDataInspectionFailed) || e.Code == "data_inspection_failed"
+}
+
+// errorBody is the error envelope DashScope returns on failed requests. The
+// compatible-mode endpoints nest the code and message in an OpenAI-style
+// error object.
+type errorBody struct {
+	RequestID string `json:"request_id"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Error     *struct {
+		Code    string `json:"code"`
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// newAPIError builds an APIError from a failed HTTP response body.
+func newAPIError(statusCode int, header http.Header, body []byte) *APIError {
+	var eb errorBody
+	if err := json.Unmarshal(body, &eb); err != nil {
+		eb.Message = strings.TrimSpace(string(body))
+	}
+	if e := eb.Error; e != nil {
+		eb.Code, eb.Message = e.Code, e.Message
+		if eb.Code == "" {
+			eb.Code = e.Type
+		}
+	}
+	if eb.RequestID == "" && header != nil {
+		eb.RequestID = header.Get("X-Request-Id")
+	}
+	return &APIError{
+		StatusCode: statusCode,
+		Code:       eb.Code,
+		Message:    eb.Message,
+		RequestID:  eb.RequestID,
+	}
+}
+
+// streamFailure describes an error that ended a stream, for reporting it as
+// the final chunk.
+func streamFailure(err error) (statusCode int, code, message, requestID string) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode, apiErr.Code, apiErr.Message, apiErr.RequestID
+	}
+	return 0, "", err.Error(), ""
+}
+
+// decodeResponse reads resp into out. For non-200 statuses out is filled on
+// a best-effort basis and an *APIError is returned.
+func decodeResponse(resp *http.Response, out interface{}) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		json.Unmarshal(body, out)
+		return newAPIError(resp.StatusCode, resp.Header, body)
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return nil
+}
+
+// checkStreamResponse returns an *APIError if a streaming request was not
+// accepted, consuming and closing the body.
+func checkStreamResponse(resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return newAPIError(resp.StatusCode, resp.Header, body)
+}
+
+// taskError returns an *APIError if an async task failed, was canceled or
+// is unknown, which DashScope reports for expired or nonexistent tasks.
+func taskError(resp *TaskResponse) error {
+	switch resp.Output.TaskStatus {
+	case TaskStatusFailed, TaskStatusCanceled, TaskStatusUnknown:
+	default:
+		return nil
+	}
+	apiErr := &APIError{
+		Code:      resp.Output.Code,
+		Message:   resp.Output.Message,
+		RequestID: resp.RequestID,
+		TaskID:    resp.Output.TaskID,
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = "task " + strings.ToLower(resp.Output.TaskStatus)
+	}
+	return apiErr
+}
@@ -0,0 +1,128 @@
+// Package expvarmetrics records DashScope SDK metrics as expvar variables,
+// served as JSON at /debug/vars.
+//
+//	rec := expvarmetrics.NewRecorder("dashscope")
+//	client := dashscope.NewClient(dashscope.WithMetrics(rec))
+//
+// The published map has the following layout, keyed by "operation/model":
+//
+//	{
+//	  "operations": {"Generation.Call/qwen-max": {"count": 3, "errors": 1,
+//	      "duration_seconds": 4.2, "time_to_first_token_seconds": 0,
+//	      "input_tokens": 120, "output_tokens": 380, ...}},
+//	  "sessions":   {"Recognition/paraformer-realtime-v2": {...}},
+//	  "errors":     {"Throttling.RateQuota": 1},
+//	  "retries":    {"generation/qwen-max": 2}
+//	}
+//
+// Durations are sums; divide by count for the mean.
+package expvarmetrics
+
+import (
+	"expvar"
+	"sync"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+)
+
+// Recorder is a dashscope.MetricsRecorder backed by an expvar.Map.
+type Recorder struct {
+	vars       *expvar.Map
+	operations *expvar.Map
+	sessions   *expvar.Map
+	errors     *expvar.Map
+	retries    *expvar.Map
+
+	mu sync.Mutex
+}
+
+// NewRecorder creates a recorder and publishes it under name. Like
+// expvar.Publish, it panics if name is already in use.
+func NewRecorder(name string) *Recorder {
+	r := NewUnpublishedRecorder()
+	expvar.Publish(name, r.vars)
+	return r
+}
+
+// NewUnpublishedRecorder creates a recorder without publishing it. Use Map to
+// access the variables.
+func NewUnpublishedRecorder() *Recorder {
+	r := &Recorder{
+		vars:       new(expvar.Map),
+		operations: new(expvar.Map),
+		sessions:   new(expvar.Map),
+		errors:     new(expvar.Map),
+		retries:    new(expvar.Map),
+	}
+	r.vars.Set("operations", r.operations)
+	r.vars.Set("sessions", r.sessions)
+	r.vars.Set("errors", r.errors)
+	r.vars.Set("retries", r.retries)
+	return r
+}
+
+// Map returns the root map holding all recorded variables.
+func (r *Recorder) Map() *expvar.Map {
+	return r.vars
+}
+
+// RecordOperation implements dashscope.MetricsRecorder.
+func (r *Recorder) RecordOperation(m dashscope.OperationMetrics) {
+	parent := r.operations
+	if m.Session {
+		parent = r.sessions
+	}
+	stats := r.child(parent, key(m.Operation, m.Info.Model))
+
+	stats.Add("count", 1)
+	stats.AddFloat("duration_seconds", m.Duration.Seconds())
+	if m.TimeToFirstToken > 0 {
+		stats.Add("streams", 1)
+		stats.AddFloat("time_to_first_token_seconds", m.TimeToFirstToken.Seconds())
+	}
+	if m.InputTokens > 0 {
+		stats.Add("input_tokens", int64(m.InputTokens))
+	}
+	if m.OutputTokens > 0 {
+		stats.Add("output_tokens", int64(m.OutputTokens))
+	}
+	if m.Characters > 0 {
+		stats.Add("characters", int64(m.Characters))
+	}
+	if m.Images > 0 {
+		stats.Add("images", int64(m.Images))
+	}
+
+	if m.Err != nil {
+		stats.Add("errors", 1)
+		r.errors.Add(m.Result(), 1)
+	}
+}
+
+// RecordRetry implements dashscope.MetricsRecorder.
+func (r *Recorder) RecordRetry(info dashscope.CallInfo, attempt dashscope.RetryAttempt) {
+	r.retries.Add(key(info.Service, info.Model), 1)
+}
+
+// child returns the map stored under name in parent, creating it if needed.
+func (r *Recorder) child(parent *expvar.Map, name string) *expvar.Map {
+	if m, ok := parent.Get(name).(*expvar.Map); ok {
+		return m
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if m, ok := parent.Get(name).(*expvar.Map); ok {
+		return m
+	}
+	m := new(expvar.Map)
+	parent.Set(name, m)
+	return m
+}
+
+func key(name, model string) string {
+	if model == "" {
+		return name
+	}
+	return name + "/" + model
+}
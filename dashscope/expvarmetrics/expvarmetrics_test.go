@@ -0,0 +1,93 @@
+package expvarmetrics_test
+
+import (
+	"context"
+	"expvar"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+	"github.com/ceoifung/go-dashscope/dashscope/dashscopetest"
+	"github.com/ceoifung/go-dashscope/dashscope/expvarmetrics"
+)
+
+// get returns the variable at path below m, or nil.
+func get(m *expvar.Map, path ...string) expvar.Var {
+	var v expvar.Var = m
+	for _, name := range path {
+		parent, ok := v.(*expvar.Map)
+		if !ok {
+			return nil
+		}
+		v = parent.Get(name)
+	}
+	return v
+}
+
+func TestRecorder(t *testing.T) {
+	srv := dashscopetest.NewServer()
+	defer srv.Close()
+	srv.Enqueue(dashscope.ServiceGeneration,
+		dashscopetest.Fail(http.StatusTooManyRequests, dashscope.ErrCodeThrottling, "slow down"),
+		dashscopetest.Response{Body: map[string]interface{}{
+			"output": map[string]interface{}{"text": "Hi", "finish_reason": "stop"},
+			"usage":  map[string]interface{}{"input_tokens": 3, "output_tokens": 2, "total_tokens": 5},
+		}},
+		dashscopetest.Fail(http.StatusBadRequest, dashscope.ErrCodeInvalidParameter, "bad input"))
+
+	rec := expvarmetrics.NewUnpublishedRecorder()
+	policy := dashscope.DefaultRetryPolicy()
+	policy.InitialBackoff, policy.MaxBackoff, policy.RespectRetryAfter = time.Millisecond, time.Millisecond, false
+	c := srv.Client(dashscope.WithMetrics(rec), dashscope.WithRetryPolicy(policy))
+
+	req := dashscope.GenerationRequest{Model: dashscope.QwenTurbo, Input: dashscope.GenerationInput{Prompt: "Hi"}}
+	if _, err := c.Generation().Call(context.Background(), req); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if _, err := c.Generation().Call(context.Background(), req); err == nil {
+		t.Fatal("second Call succeeded, want an error")
+	}
+	if _, err := c.SpeechSynthesizer("cosyvoice-v1").Call(context.Background(), "Hello", nil, nil); err != nil {
+		t.Fatalf("SpeechSynthesizer.Call: %v", err)
+	}
+
+	vars := rec.Map()
+	tests := []struct {
+		path []string
+		want string
+	}{
+		{[]string{"operations", "Generation.Call/qwen-turbo", "count"}, "2"},
+		{[]string{"operations", "Generation.Call/qwen-turbo", "errors"}, "1"},
+		{[]string{"operations", "Generation.Call/qwen-turbo", "input_tokens"}, "3"},
+		{[]string{"operations", "Generation.Call/qwen-turbo", "output_tokens"}, "2"},
+		{[]string{"sessions", "SpeechSynthesizer.Call/cosyvoice-v1", "count"}, "1"},
+		{[]string{"sessions", "SpeechSynthesizer.Call/cosyvoice-v1", "characters"}, "5"},
+		{[]string{"sessions", "SpeechSynthesizer.Call/cosyvoice-v1", "streams"}, "1"},
+		{[]string{"errors", dashscope.ErrCodeInvalidParameter}, "1"},
+		{[]string{"retries", "generation/qwen-turbo"}, "1"},
+	}
+	for _, tt := range tests {
+		v := get(vars, tt.path...)
+		if v == nil {
+			t.Errorf("%v is not set, want %s", tt.path, tt.want)
+			continue
+		}
+		if got := v.String(); got != tt.want {
+			t.Errorf("%v = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+	if v := get(vars, "operations", "SpeechSynthesizer.Call/cosyvoice-v1"); v != nil {
+		t.Errorf("session recorded as an operation: %s", v)
+	}
+	if v, ok := get(vars, "operations", "Generation.Call/qwen-turbo", "duration_seconds").(*expvar.Float); !ok || v.Value() <= 0 {
+		t.Errorf("duration_seconds = %v, want a positive sum", v)
+	}
+}
+
+func TestNewRecorderPublishes(t *testing.T) {
+	rec := expvarmetrics.NewRecorder("dashscope_test")
+	if expvar.Get("dashscope_test") != rec.Map() {
+		t.Error("recorder not published under its name")
+	}
+}
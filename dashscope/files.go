@@ -0,0 +1,295 @@
+package dashscope
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// File purposes
+const (
+	FilePurposeFileExtract = "file-extract" // Documents for qwen-long
+	FilePurposeBatch       = "batch"        // Batch inference input
+	FilePurposeFineTune    = "fine-tune"
+)
+
+// Files handles the file storage of DashScope: documents for qwen-long,
+// batch inference input and output, and fine-tuning datasets. It uses the
+// OpenAI-compatible endpoints.
+type Files struct {
+	APIKey    string
+	Workspace string
+	client    *http.Client
+	c         *Client
+}
+
+// NewFiles creates a new Files client.
+func NewFiles(apiKey string) *Files {
+	return NewClient(WithAPIKey(apiKey)).Files()
+}
+
+// SetHTTPClient sets a custom HTTP client.
+func (f *Files) SetHTTPClient(client *http.Client) {
+	f.client = client
+}
+
+// SetWorkspace sets the workspace ID.
+func (f *Files) SetWorkspace(workspace string) {
+	f.Workspace = workspace
+}
+
+// File describes a stored file.
+type File struct {
+	ID            string `json:"id"`
+	Object        string `json:"object"` // "file"
+	Bytes         int64  `json:"bytes"`
+	CreatedAt     int64  `json:"created_at"`
+	Filename      string `json:"filename"`
+	Purpose       string `json:"purpose"`
+	Status        string `json:"status,omitempty"` // e.g. "processed" or "error"
+	StatusDetails string `json:"status_details,omitempty"`
+}
+
+// FileList is a page of files.
+type FileList struct {
+	Object  string `json:"object"` // "list"
+	Data    []File `json:"data"`
+	HasMore bool   `json:"has_more"`
+	FirstID string `json:"first_id,omitempty"`
+	LastID  string `json:"last_id,omitempty"`
+}
+
+// ListFilesParams selects a page of files. Pass the LastID of a page as
+// After to get the next one.
+type ListFilesParams struct {
+	After   string
+	Limit   int
+	Purpose string
+}
+
+// FileDeleted confirms the deletion of a file.
+type FileDeleted struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"` // "file"
+	Deleted bool   `json:"deleted"`
+}
+
+// maxBufferedUpload is the size up to which uploads are held in memory so
+// that they can be retried.
+const maxBufferedUpload = 8 << 20
+
+// Upload stores the content read from r as filename. Content up to 8 MiB is
+// buffered and retried like any other request; larger content is streamed
+// and sent only once, since r cannot be read again.
+func (f *Files) Upload(ctx context.Context, filename, purpose string, r io.Reader) (_ *File, err error) {
+	endpoint := f.c.compatibleURL(CompatibleFilesPath)
+
+	info := CallInfo{Service: ServiceFiles}
+	ctx, op := f.c.startOperation(ctx, "Files.Upload", info)
+	defer func() { op.end(err) }()
+
+	ctx, cancel := f.c.withTimeout(ctx)
+	defer cancel()
+
+	head, err := io.ReadAll(io.LimitReader(r, maxBufferedUpload+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	// A buffered body lets the request set GetBody, which retries need.
+	var body io.Reader
+	var form *multipart.Writer
+	if len(head) <= maxBufferedUpload {
+		var buf bytes.Buffer
+		form = multipart.NewWriter(&buf)
+		if err := writeFileForm(form, filename, purpose, bytes.NewReader(head)); err != nil {
+			return nil, fmt.Errorf("failed to write form: %w", err)
+		}
+		body = &buf
+	} else {
+		pr, pw := io.Pipe()
+		form = multipart.NewWriter(pw)
+		go func() {
+			pw.CloseWithError(writeFileForm(form, filename, purpose, io.MultiReader(bytes.NewReader(head), r)))
+		}()
+		defer pr.Close()
+		body = pr
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", endpoint, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", form.FormDataContentType())
+	f.c.setHeaders(httpReq.Header, f.APIKey, f.Workspace)
+
+	resp, err := f.c.do(f.client, httpReq, info)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var file File
+	if err := decodeResponse(resp, &file); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+func writeFileForm(form *multipart.Writer, filename, purpose string, r io.Reader) error {
+	if err := form.WriteField("purpose", purpose); err != nil {
+		return err
+	}
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, r); err != nil {
+		return err
+	}
+	return form.Close()
+}
+
+// UploadFile stores the local file at path under its base name.
+func (f *Files) UploadFile(ctx context.Context, path, purpose string) (*File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return f.Upload(ctx, filepath.Base(path), purpose, file)
+}
+
+// List returns a page of files. A nil params returns the first page.
+func (f *Files) List(ctx context.Context, params *ListFilesParams) (_ *FileList, err error) {
+	query := url.Values{}
+	if params != nil {
+		if params.After != "" {
+			query.Set("after", params.After)
+		}
+		if params.Limit > 0 {
+			query.Set("limit", strconv.Itoa(params.Limit))
+		}
+		if params.Purpose != "" {
+			query.Set("purpose", params.Purpose)
+		}
+	}
+	path := CompatibleFilesPath
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var list FileList
+	if err := f.call(ctx, "Files.List", "GET", path, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// Get retrieves a file.
+func (f *Files) Get(ctx context.Context, fileID string) (*File, error) {
+	var file File
+	if err := f.call(ctx, "Files.Get", "GET", CompatibleFilesPath+"/"+url.PathEscape(fileID), &file); err != nil {
+		return nil, err
+	}
+	return &file, nil
+}
+
+// Delete deletes a file.
+func (f *Files) Delete(ctx context.Context, fileID string) (*FileDeleted, error) {
+	var deleted FileDeleted
+	if err := f.call(ctx, "Files.Delete", "DELETE", CompatibleFilesPath+"/"+url.PathEscape(fileID), &deleted); err != nil {
+		return nil, err
+	}
+	return &deleted, nil
+}
+
+// Download writes the content of a file, such as the output of a batch
+// job, to w.
+func (f *Files) Download(ctx context.Context, fileID string, w io.Writer) (err error) {
+	endpoint := f.c.compatibleURL(CompatibleFilesPath + "/" + url.PathEscape(fileID) + "/content")
+
+	info := CallInfo{Service: ServiceFiles}
+	ctx, op := f.c.startOperation(ctx, "Files.Download", info)
+	defer func() { op.end(err) }()
+
+	ctx, cancel := f.c.withTimeout(ctx)
+	defer cancel()
+
+	httpReq, err := f.c.newRequest(ctx, "GET", endpoint, nil, f.APIKey, f.Workspace)
+	if err != nil {
+		return err
+	}
+
+	resp, err := f.c.do(f.client, httpReq, info)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return decodeResponse(resp, &struct{}{})
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("failed to read file content: %w", err)
+	}
+	return nil
+}
+
+// call sends a request without a body to a compatible-mode path.
+func (f *Files) call(ctx context.Context, name, method, path string, out interface{}) (err error) {
+	endpoint := f.c.compatibleURL(path)
+
+	info := CallInfo{Service: ServiceFiles}
+	ctx, op := f.c.startOperation(ctx, name, info)
+	defer func() { op.end(err) }()
+
+	ctx, cancel := f.c.withTimeout(ctx)
+	defer cancel()
+
+	httpReq, err := f.c.newRequest(ctx, method, endpoint, nil, f.APIKey, f.Workspace)
+	if err != nil {
+		return err
+	}
+
+	resp, err := f.c.do(f.client, httpReq, info)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return decodeResponse(resp, out)
+}
+
+// NewFileMessage returns a system message referencing uploaded documents,
+// which qwen-long reads as context:
+//
+//	messages := []dashscope.Message{
+//		dashscope.NewFileMessage(file.ID),
+//		{Role: dashscope.RoleUser, Content: "Summarize the document."},
+//	}
+func NewFileMessage(fileIDs ...string) Message {
+	refs := make([]string, len(fileIDs))
+	for i, id := range fileIDs {
+		refs[i] = "fileid://" + id
+	}
+	return Message{Role: RoleSystem, Content: strings.Join(refs, ",")}
+}
+
+// UploadDocument uploads the local document at path for document chat and
+// returns a system message referencing it, along with the stored file.
+func (f *Files) UploadDocument(ctx context.Context, path string) (Message, *File, error) {
+	file, err := f.UploadFile(ctx, path, FilePurposeFileExtract)
+	if err != nil {
+		return Message{}, nil, err
+	}
+	return NewFileMessage(file.ID), file, nil
+}
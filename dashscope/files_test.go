@@ -0,0 +1,241 @@
+package dashscope_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+	"github.com/ceoifung/go-dashscope/dashscope/dashscopetest"
+)
+
+// onlyReader hides the type of a reader, as a file or network stream would.
+type onlyReader struct{ io.Reader }
+
+func TestFilesUpload(t *testing.T) {
+	content := []byte("line one\nline two\x00\xff\n")
+	tests := []struct {
+		name string
+		r    io.Reader
+	}{
+		{"bytes", bytes.NewReader(content)},
+		{"stream", onlyReader{bytes.NewReader(content)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := dashscopetest.NewServer()
+			defer srv.Close()
+
+			file, err := srv.Client().Files().Upload(context.Background(), "notes.txt", dashscope.FilePurposeFileExtract, tt.r)
+			if err != nil {
+				t.Fatalf("Upload: %v", err)
+			}
+			if file.ID == "" || file.Filename != "notes.txt" || file.Purpose != dashscope.FilePurposeFileExtract ||
+				file.Bytes != int64(len(content)) {
+				t.Errorf("file = %+v, want notes.txt with %d bytes", file, len(content))
+			}
+
+			req := srv.RequestsFor(dashscope.ServiceFiles)[0]
+			if req.Method != "POST" || req.Path != dashscope.CompatibleFilesPath {
+				t.Errorf("request %s %s, want POST %s", req.Method, req.Path, dashscope.CompatibleFilesPath)
+			}
+			mediaType, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+			if err != nil || mediaType != "multipart/form-data" {
+				t.Fatalf("content type = %q, want multipart/form-data", req.Header.Get("Content-Type"))
+			}
+			form, err := multipart.NewReader(bytes.NewReader(req.Body), params["boundary"]).ReadForm(1 << 20)
+			if err != nil {
+				t.Fatalf("reading the form: %v", err)
+			}
+			if got := form.Value["purpose"]; len(got) != 1 || got[0] != dashscope.FilePurposeFileExtract {
+				t.Errorf("purpose = %q, want %q", got, dashscope.FilePurposeFileExtract)
+			}
+			parts := form.File["file"]
+			if len(parts) != 1 || parts[0].Filename != "notes.txt" {
+				t.Fatalf("file parts = %+v, want notes.txt", parts)
+			}
+			part, err := parts[0].Open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer part.Close()
+			if got, _ := io.ReadAll(part); !bytes.Equal(got, content) {
+				t.Errorf("uploaded content = %q, want %q", got, content)
+			}
+
+			var buf bytes.Buffer
+			if err := srv.Client().Files().Download(context.Background(), file.ID, &buf); err != nil {
+				t.Fatalf("Download: %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), content) {
+				t.Errorf("downloaded %q, want %q", buf.Bytes(), content)
+			}
+		})
+	}
+}
+
+func TestFilesUploadRetry(t *testing.T) {
+	srv := dashscopetest.NewServer()
+	defer srv.Close()
+	srv.Enqueue(dashscope.ServiceFiles, dashscopetest.Fail(http.StatusServiceUnavailable, "ServiceUnavailable", "try again"))
+
+	files := srv.Client(dashscope.WithRetryPolicy(fastRetry())).Files()
+	file, err := files.Upload(context.Background(), "data.jsonl", dashscope.FilePurposeBatch, onlyReader{strings.NewReader("{}\n")})
+	if err != nil {
+		t.Fatalf("Upload: %v", err)
+	}
+	requests := srv.RequestsFor(dashscope.ServiceFiles)
+	if len(requests) != 2 {
+		t.Fatalf("%d requests sent, want a retry", len(requests))
+	}
+	if !bytes.Equal(requests[0].Body, requests[1].Body) {
+		t.Error("retried upload sent a different body")
+	}
+	if file.Bytes != 3 {
+		t.Errorf("stored %d bytes, want 3", file.Bytes)
+	}
+}
+
+func TestFilesUploadLargeNotRetried(t *testing.T) {
+	srv := dashscopetest.NewServer()
+	defer srv.Close()
+	srv.Enqueue(dashscope.ServiceFiles, dashscopetest.Fail(http.StatusServiceUnavailable, "ServiceUnavailable", "try again"))
+
+	large := bytes.Repeat([]byte("x"), 8<<20+1)
+	files := srv.Client(dashscope.WithRetryPolicy(fastRetry())).Files()
+	_, err := files.Upload(context.Background(), "large.jsonl", dashscope.FilePurposeBatch, onlyReader{bytes.NewReader(large)})
+	var apiErr *dashscope.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Upload error = %v, want the 503", err)
+	}
+	if n := len(srv.RequestsFor(dashscope.ServiceFiles)); n != 1 {
+		t.Errorf("%d requests sent, want a streamed upload sent once", n)
+	}
+}
+
+func TestFilesListGetDelete(t *testing.T) {
+	srv := dashscopetest.NewServer()
+	defer srv.Close()
+	files := srv.Client().Files()
+	ctx := context.Background()
+
+	var ids []string
+	for _, purpose := range []string{dashscope.FilePurposeFileExtract, dashscope.FilePurposeBatch, dashscope.FilePurposeFileExtract} {
+		file, err := files.Upload(ctx, "f.txt", purpose, strings.NewReader("x"))
+		if err != nil {
+			t.Fatalf("Upload: %v", err)
+		}
+		ids = append(ids, file.ID)
+	}
+
+	first, err := files.List(ctx, &dashscope.ListFilesParams{Limit: 2})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(first.Data) != 2 || !first.HasMore || first.FirstID != ids[0] || first.LastID != ids[1] {
+		t.Errorf("first page = %+v, want the first two files and more", first)
+	}
+	next, err := files.List(ctx, &dashscope.ListFilesParams{After: first.LastID, Limit: 2})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(next.Data) != 1 || next.HasMore || next.Data[0].ID != ids[2] {
+		t.Errorf("next page = %+v, want the last file", next)
+	}
+	extract, err := files.List(ctx, &dashscope.ListFilesParams{Purpose: dashscope.FilePurposeFileExtract})
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(extract.Data) != 2 || extract.Data[0].ID != ids[0] || extract.Data[1].ID != ids[2] {
+		t.Errorf("file-extract page = %+v, want the two documents", extract)
+	}
+	all, err := files.List(ctx, nil)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(all.Data) != 3 {
+		t.Errorf("listed %d files, want 3", len(all.Data))
+	}
+
+	file, err := files.Get(ctx, ids[1])
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if file.ID != ids[1] || file.Purpose != dashscope.FilePurposeBatch {
+		t.Errorf("file = %+v, want the batch input", file)
+	}
+
+	deleted, err := files.Delete(ctx, ids[1])
+	if err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if deleted.ID != ids[1] || !deleted.Deleted {
+		t.Errorf("deleted = %+v, want %s deleted", deleted, ids[1])
+	}
+	_, err = files.Get(ctx, ids[1])
+	var apiErr *dashscope.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Get after Delete error = %v, want a 404", err)
+	}
+	if err := files.Download(ctx, ids[1], io.Discard); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Download after Delete error = %v, want a 404", err)
+	}
+}
+
+func TestFilesListQuery(t *testing.T) {
+	srv, last := capture(t, `{"object":"list","data":[]}`)
+	files := dashscope.NewClient(dashscope.WithAPIKey("sk-test"), dashscope.WithCompatibleBaseURL(srv.URL)).Files()
+
+	tests := []struct {
+		name   string
+		params *dashscope.ListFilesParams
+		want   string
+	}{
+		{"nil", nil, ""},
+		{"empty", &dashscope.ListFilesParams{}, ""},
+		{"all", &dashscope.ListFilesParams{After: "file-1", Limit: 10, Purpose: dashscope.FilePurposeBatch}, "after=file-1&limit=10&purpose=batch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := files.List(context.Background(), tt.params); err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if got := last().URL.RawQuery; got != tt.want {
+				t.Errorf("query = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilesEscapedID(t *testing.T) {
+	srv, last := capture(t, `{"id":"file/1 x","deleted":true}`)
+	files := dashscope.NewClient(dashscope.WithAPIKey("sk-test"), dashscope.WithCompatibleBaseURL(srv.URL)).Files()
+	ctx := context.Background()
+	const want = dashscope.CompatibleFilesPath + "/file%2F1%20x"
+
+	tests := []struct {
+		name string
+		call func() error
+		want string
+	}{
+		{"Get", func() error { _, err := files.Get(ctx, "file/1 x"); return err }, want},
+		{"Delete", func() error { _, err := files.Delete(ctx, "file/1 x"); return err }, want},
+		{"Download", func() error { return files.Download(ctx, "file/1 x", io.Discard) }, want + "/content"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if got := last().URL.EscapedPath(); got != tt.want {
+				t.Errorf("path = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,15 +1,9 @@
 package dashscope
 
 import (
-	"bufio"
-	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
-	"strings"
 )
 
 // Generation models
@@ -18,6 +12,8 @@ const (
 	QwenPlus  = "qwen-plus"
 	QwenMax   = "qwen-max"
 	QwenFlash = "qwen-flash"
+	QwQPlus   = "qwq-plus"  // Reasoning model, thinks before every reply
+	QwenLong  = "qwen-long" // Long documents, referenced with NewFileMessage
 )
 
 // GenerationRequest represents the request body for generation.
@@ -35,17 +31,26 @@ type GenerationInput struct {
 
 // GenerationParameters represents the parameters for generation.
 type GenerationParameters struct {
-	ResultFormat      string      `json:"result_format,omitempty"`
-	Seed              uint64      `json:"seed,omitempty"`
-	MaxTokens         int         `json:"max_tokens,omitempty"`
-	TopP              float64     `json:"top_p,omitempty"`
-	TopK              int         `json:"top_k,omitempty"`
-	RepetitionPenalty float64     `json:"repetition_penalty,omitempty"`
-	Temperature       float64     `json:"temperature,omitempty"`
-	Stop              interface{} `json:"stop,omitempty"` // string or []string
-	EnableSearch      bool        `json:"enable_search,omitempty"`
-	IncrementalOutput bool        `json:"incremental_output,omitempty"`
-	Stream            bool        `json:"stream,omitempty"`
+	ResultFormat      string          `json:"result_format,omitempty"`
+	Seed              uint64          `json:"seed,omitempty"`
+	MaxTokens         int             `json:"max_tokens,omitempty"`
+	TopP              float64         `json:"top_p,omitempty"`
+	TopK              int             `json:"top_k,omitempty"`
+	RepetitionPenalty float64         `json:"repetition_penalty,omitempty"`
+	Temperature       float64         `json:"temperature,omitempty"`
+	Stop              interface{}     `json:"stop,omitempty"` // string or []string
+	EnableSearch      bool            `json:"enable_search,omitempty"`
+	IncrementalOutput bool            `json:"incremental_output,omitempty"`
+	Stream            bool            `json:"stream,omitempty"`
+	Tools             []Tool          `json:"tools,omitempty"`
+	ToolChoice        interface{}     `json:"tool_choice,omitempty"` // ToolChoiceAuto, ToolChoiceNone or ToolChoiceFunction(name)
+	ParallelToolCalls bool            `json:"parallel_tool_calls,omitempty"`
+	ResponseFormat    *ResponseFormat `json:"response_format,omitempty"`
+	// EnableThinking switches the thinking mode of hybrid models such as
+	// Qwen3; nil leaves the model's default. ThinkingBudget caps the
+	// reasoning tokens.
+	EnableThinking *bool `json:"enable_thinking,omitempty"`
+	ThinkingBudget int   `json:"thinking_budget,omitempty"`
 }
 
 // GenerationResponse represents the response from generation.
@@ -73,9 +78,15 @@ type Choice struct {
 
 // GenerationUsage represents the token usage.
 type GenerationUsage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
-	TotalTokens  int `json:"total_tokens"`
+	InputTokens         int                 `json:"input_tokens"`
+	OutputTokens        int                 `json:"output_tokens"` // Including reasoning tokens
+	TotalTokens         int                 `json:"total_tokens"`
+	OutputTokensDetails OutputTokensDetails `json:"output_tokens_details,omitzero"`
+}
+
+// OutputTokensDetails breaks down the output tokens.
+type OutputTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens,omitempty"`
 }
 
 // Generation handles the text generation API.
@@ -83,17 +94,12 @@ type Generation struct {
 	APIKey    string
 	Workspace string
 	client    *http.Client
+	c         *Client
 }
 
 // NewGeneration creates a new Generation client.
 func NewGeneration(apiKey string) *Generation {
-	if apiKey == "" {
-		apiKey = os.Getenv("DASHSCOPE_API_KEY")
-	}
-	return &Generation{
-		APIKey: apiKey,
-		client: &http.Client{}, // Default client with no timeout
-	}
+	return NewClient(WithAPIKey(apiKey)).Generation()
 }
 
 // SetHTTPClient sets a custom HTTP client.
@@ -107,118 +113,147 @@ func (g *Generation) SetWorkspace(workspace string) {
 }
 
 // Call performs a synchronous generation request.
-func (g *Generation) Call(ctx context.Context, req GenerationRequest) (*GenerationResponse, error) {
-	url := QwenGenerationURL
+//
+// DashScope only serves thinking mode as a stream, so when EnableThinking is
+// set, or left unset for a model that thinks by default such as QwQ and
+// Qwen3, Call streams the request with incremental output and returns the
+// assembled reply, its reasoning in Message.ReasoningContent.
+func (g *Generation) Call(ctx context.Context, req GenerationRequest) (_ *GenerationResponse, err error) {
+	url := g.c.url(QwenGenerationPath)
 
 	if req.Parameters == nil {
 		req.Parameters = &GenerationParameters{}
 	}
 	req.Parameters.Stream = false
-
-	jsonData, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	// Tool calls are only returned in the message format.
+	if len(req.Parameters.Tools) > 0 && req.Parameters.ResultFormat == "" {
+		req.Parameters.ResultFormat = "message"
 	}
-
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	req.Input.Messages = withoutReasoning(req.Input.Messages)
+	// Thinking is only served as a stream.
+	if thinking(req.Model, req.Parameters.EnableThinking) {
+		return g.collect(ctx, req)
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+g.APIKey)
-	if g.Workspace != "" {
-		httpReq.Header.Set("X-DashScope-WorkSpace", g.Workspace)
+	info := CallInfo{Service: ServiceGeneration, Model: req.Model}
+	ctx, op := g.c.startOperation(ctx, "Generation.Call", info)
+	defer func() { op.end(err) }()
+
+	ctx, cancel := g.c.withTimeout(ctx)
+	defer cancel()
+
+	if err := op.reserve(ctx, estimateGenerationTokens(req, op.counter(ctx))); err != nil {
+		return nil, err
 	}
 
-	resp, err := g.client.Do(httpReq)
+	httpReq, err := g.c.newRequest(ctx, "POST", url, req, g.APIKey, g.Workspace)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	resp, err := g.c.do(g.client, httpReq, info)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
+	defer resp.Body.Close()
 
 	var result GenerationResponse
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
-	}
-
+	err = decodeResponse(resp, &result)
 	result.StatusCode = resp.StatusCode
-
-	if resp.StatusCode != http.StatusOK {
-		return &result, fmt.Errorf("API error: %s (code: %s, request_id: %s)", result.Message, result.Code, result.RequestID)
+	op.setRequestID(result.RequestID)
+	op.setUsage(result.Usage.InputTokens, result.Usage.OutputTokens)
+	if err != nil {
+		return &result, err
 	}
 
 	return &result, nil
 }
 
+// Stream performs a streaming generation request. The caller must read the
+// stream to the end or Close it.
+func (g *Generation) Stream(ctx context.Context, req GenerationRequest) (*Stream[GenerationResponse], error) {
+	return g.stream(ctx, req, "Generation.Stream")
+}
+
 // CallStream performs a streaming generation request.
-// It returns a channel that receives GenerationResponse updates.
+// It returns a channel that receives GenerationResponse updates. A failure
+// ends the stream with a final response carrying its code and message. The
+// channel is closed early when ctx is canceled, so cancel ctx before
+// abandoning the channel.
 func (g *Generation) CallStream(ctx context.Context, req GenerationRequest) (<-chan GenerationResponse, error) {
-	url := QwenGenerationURL
+	stream, err := g.stream(ctx, req, "Generation.CallStream")
+	if err != nil {
+		return nil, err
+	}
+	return streamChannel(stream, func(err error) GenerationResponse {
+		var failed GenerationResponse
+		failed.StatusCode, failed.Code, failed.Message, failed.RequestID = streamFailure(err)
+		return failed
+	}), nil
+}
+
+func (g *Generation) stream(ctx context.Context, req GenerationRequest, name string) (_ *Stream[GenerationResponse], err error) {
+	url := g.c.url(QwenGenerationPath)
 
 	if req.Parameters == nil {
 		req.Parameters = &GenerationParameters{}
 	}
 	req.Parameters.Stream = true
-	// Enable incremental output by default for streaming if not specified
-	// if !req.Parameters.IncrementalOutput {
-	// 	req.Parameters.IncrementalOutput = true
-	// }
+	// Tool calls are only returned in the message format.
+	if len(req.Parameters.Tools) > 0 && req.Parameters.ResultFormat == "" {
+		req.Parameters.ResultFormat = "message"
+	}
+	req.Input.Messages = withoutReasoning(req.Input.Messages)
 
-	jsonData, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	info := CallInfo{Service: ServiceGeneration, Model: req.Model, Stream: true}
+	ctx, op := g.c.startOperation(ctx, name, info)
+	defer func() {
+		if err != nil {
+			op.end(err)
+		}
+	}()
+
+	if err := op.reserve(ctx, estimateGenerationTokens(req, op.counter(ctx))); err != nil {
+		return nil, err
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	httpReq, err := g.c.newRequest(ctx, "POST", url, req, g.APIKey, g.Workspace)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+g.APIKey)
 	httpReq.Header.Set("Accept", "text/event-stream")
-	httpReq.Header.Set("X-DashScope-SSE", "enable") // Python SDK sends this via 'stream' param in body, but standard SSE might need headers?
-	// Wait, Python SDK sends stream=True in body.
-	// It relies on 'stream' parameter in the JSON body, not Accept header primarily, but Requests lib might handle it?
-	// api_request_factory.py doesn't seem to set Accept: text/event-stream explicitly for HTTP,
-	// but maybe the server responds with it if stream=True in body.
+	httpReq.Header.Set("X-DashScope-SSE", "enable")
 
-	if g.Workspace != "" {
-		httpReq.Header.Set("X-DashScope-WorkSpace", g.Workspace)
-	}
-
-	resp, err := g.client.Do(httpReq)
+	resp, err := g.c.do(g.client, httpReq, info)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
+	if err := checkStreamResponse(resp); err != nil {
+		return nil, err
+	}
 
-	ch := make(chan GenerationResponse)
-
-	go func() {
-		defer resp.Body.Close()
-		defer close(ch)
-
-		scanner := bufio.NewScanner(resp.Body)
-		for scanner.Scan() {
-			line := scanner.Text()
-			if strings.HasPrefix(line, "data:") {
-				data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
-				var result GenerationResponse
-				if err := json.Unmarshal([]byte(data), &result); err != nil {
-					// Handle error or log?
-					continue
-				}
-				result.StatusCode = resp.StatusCode
-				ch <- result
-			}
-		}
-	}()
+	return newStream(ctx, op, resp, func(chunk *GenerationResponse) {
+		chunk.StatusCode = resp.StatusCode
+		op.markFirstToken()
+		op.setRequestID(chunk.RequestID)
+		op.setUsage(chunk.Usage.InputTokens, chunk.Usage.OutputTokens)
+	}), nil
+}
 
-	return ch, nil
+// estimateGenerationTokens estimates the tokens a request will consume,
+// counting the prompt, the messages and the requested output budget.
+func estimateGenerationTokens(req GenerationRequest, count func(string) int) int {
+	n := count(req.Input.Prompt)
+	for _, msg := range req.Input.Messages {
+		n += count(msg.Content)
+		for _, call := range msg.ToolCalls {
+			n += count(call.Function.Arguments)
+		}
+	}
+	if req.Parameters != nil {
+		n += req.Parameters.MaxTokens
+		n += estimateToolTokens(req.Parameters.Tools, count)
+	}
+	return n
 }
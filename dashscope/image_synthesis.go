@@ -8,12 +8,10 @@
 package dashscope
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
 )
 
 // Image Synthesis Models
@@ -27,17 +25,12 @@ const (
 type ImageSynthesis struct {
 	APIKey string
 	client *http.Client
+	c      *Client
 }
 
 // NewImageSynthesis creates a new ImageSynthesis client.
 func NewImageSynthesis(apiKey string) *ImageSynthesis {
-	if apiKey == "" {
-		apiKey = os.Getenv("DASHSCOPE_API_KEY")
-	}
-	return &ImageSynthesis{
-		APIKey: apiKey,
-		client: &http.Client{},
-	}
+	return NewClient(WithAPIKey(apiKey)).ImageSynthesis()
 }
 
 // SetHTTPClient sets a custom HTTP client.
@@ -90,19 +83,20 @@ type ImageSynthesisUsage struct {
 }
 
 // Call performs the image synthesis request (submit and wait).
-func (s *ImageSynthesis) Call(ctx context.Context, req ImageSynthesisRequest) (*ImageSynthesisResponse, error) {
+func (s *ImageSynthesis) Call(ctx context.Context, req ImageSynthesisRequest) (_ *ImageSynthesisResponse, err error) {
+	ctx, op := s.c.startOperation(ctx, "ImageSynthesis.Call", CallInfo{Service: ServiceImageSynthesis, Model: req.Model})
+	defer func() { op.end(err) }()
+
 	// 1. Submit async task
 	taskID, err := s.AsyncCall(ctx, req)
 	if err != nil {
 		return nil, err
 	}
+	op.setTaskID(taskID)
 
 	// 2. Wait for task completion
-	// Note: WaitForTask needs to be updated to support Context and potentially Client.
-	// For now, we'll keep using the standalone function but we should update it.
-	// Actually, let's update WaitForTask to accept context later.
-	taskResp, err := WaitForTask(ctx, s.APIKey, taskID)
-	if err != nil {
+	taskResp, err := s.c.waitForTask(ctx, s.client, s.APIKey, taskID)
+	if taskResp == nil {
 		return nil, err
 	}
 
@@ -125,47 +119,51 @@ func (s *ImageSynthesis) Call(ctx context.Context, req ImageSynthesisRequest) (*
 	if taskResp.Usage != nil {
 		usageBytes, _ := json.Marshal(taskResp.Usage)
 		json.Unmarshal(usageBytes, &resp.Usage)
+		op.setImageCount(resp.Usage.ImageCount)
 	}
 
-	return resp, nil
+	return resp, err
 }
 
 // AsyncCall submits the image synthesis task and returns the task ID.
-func (s *ImageSynthesis) AsyncCall(ctx context.Context, req ImageSynthesisRequest) (string, error) {
-	url := ImageSynthesisURL
+func (s *ImageSynthesis) AsyncCall(ctx context.Context, req ImageSynthesisRequest) (_ string, err error) {
+	url := s.c.url(ImageSynthesisPath)
 
 	// Basic routing based on known models/tasks if needed,
 	// but standard text2image uses the above URL.
 	// For background generation, it might be different, but let's stick to text2image for now.
 
-	jsonData, err := json.Marshal(req)
-	if err != nil {
+	info := CallInfo{Service: ServiceImageSynthesis, Model: req.Model}
+	ctx, op := s.c.startOperation(ctx, "ImageSynthesis.AsyncCall", info)
+	defer func() { op.end(err) }()
+
+	ctx, cancel := s.c.withTimeout(ctx)
+	defer cancel()
+
+	// Async submissions count against the request quota only.
+	if err := op.reserve(ctx, 0); err != nil {
 		return "", err
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	httpReq, err := s.c.newRequest(ctx, "POST", url, req, s.APIKey, "")
 	if err != nil {
 		return "", err
 	}
-
-	httpReq.Header.Set("Authorization", "Bearer "+s.APIKey)
-	httpReq.Header.Set("Content-Type", "application/json")
 	httpReq.Header.Set("X-DashScope-Async", "enable")
 
-	resp, err := s.client.Do(httpReq)
+	resp, err := s.c.do(s.client, httpReq, info)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 
 	var taskResp TaskResponse
-	if err := json.NewDecoder(resp.Body).Decode(&taskResp); err != nil {
+	err = decodeResponse(resp, &taskResp)
+	op.setRequestID(taskResp.RequestID)
+	if err != nil {
 		return "", err
 	}
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("async call failed: %s (%s)", taskResp.Message, taskResp.Code)
-	}
+	op.setTaskID(taskResp.Output.TaskID)
 
 	return taskResp.Output.TaskID, nil
 }
@@ -0,0 +1,20 @@
+// Package models describes the behaviour of DashScope model families.
+package models
+
+import "strings"
+
+// ThinksByDefault reports whether model runs in thinking mode when a request
+// leaves enable_thinking unset. QwQ, QVQ and the thinking editions always
+// think, and so do the hybrid Qwen3 models; their instruct and coder
+// editions and qwen3-max do not. Mistaking a model for a thinking one only
+// costs a stream, while the reverse fails the request.
+func ThinksByDefault(model string) bool {
+	switch {
+	case strings.HasPrefix(model, "qwq"), strings.HasPrefix(model, "qvq"), strings.Contains(model, "-thinking"):
+		return true
+	case strings.HasPrefix(model, "qwen3-"):
+		return !strings.Contains(model, "-instruct") && !strings.Contains(model, "-coder") &&
+			!strings.HasPrefix(model, "qwen3-max")
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package models
+
+import "testing"
+
+func TestThinksByDefault(t *testing.T) {
+	tests := []struct {
+		model string
+		want  bool
+	}{
+		{"qwen-plus", false},
+		{"qwen-turbo", false},
+		{"qwq-plus", true},
+		{"qvq-max", true},
+		{"qwen3-32b", true},
+		{"qwen3-235b-a22b", true},
+		{"qwen3-235b-a22b-thinking-2507", true},
+		{"qwen3-235b-a22b-instruct-2507", false},
+		{"qwen3-coder-plus", false},
+		{"qwen3-max", false},
+		{"qwen-plus-2025-04-28-thinking", true},
+	}
+	for _, tt := range tests {
+		if got := ThinksByDefault(tt.model); got != tt.want {
+			t.Errorf("ThinksByDefault(%q) = %t, want %t", tt.model, got, tt.want)
+		}
+	}
+}
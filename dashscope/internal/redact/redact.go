@@ -0,0 +1,25 @@
+// Package redact removes DashScope credentials from logged and recorded
+// traffic.
+package redact
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Placeholder replaces redacted credentials.
+const Placeholder = "[REDACTED]"
+
+// APIKeyPattern matches DashScope API keys.
+var APIKeyPattern = regexp.MustCompile(`sk-[A-Za-z0-9]{16,}`)
+
+// String replaces the given secrets, and anything that looks like an API key,
+// in s with Placeholder.
+func String(s string, secrets ...string) string {
+	for _, secret := range secrets {
+		if secret != "" {
+			s = strings.ReplaceAll(s, secret, Placeholder)
+		}
+	}
+	return APIKeyPattern.ReplaceAllString(s, Placeholder)
+}
@@ -0,0 +1,25 @@
+package redact
+
+import "testing"
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		secrets []string
+		want    string
+	}{
+		{"no secrets", "hello", nil, "hello"},
+		{"API key", `{"key":"sk-0123456789abcdef0123"}`, nil, `{"key":"[REDACTED]"}`},
+		{"short key", "sk-short", nil, "sk-short"},
+		{"given secret", "token=secret&q=1", []string{"secret"}, "token=[REDACTED]&q=1"},
+		{"empty secret", "hello", []string{""}, "hello"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := String(tt.s, tt.secrets...); got != tt.want {
+				t.Errorf("String(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package dashscope
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ceoifung/go-dashscope/dashscope/internal/redact"
+	"github.com/gorilla/websocket"
+)
+
+// WithLogger logs requests, retries, websocket sessions and the outcome of
+// every operation to logger.
+//
+// Levels: failed operations are logged at Error, retries at Warn, finished
+// operations and websocket connections at Info, and individual HTTP attempts
+// and websocket messages at Debug.
+func WithLogger(logger *slog.Logger) ClientOption {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithBodyLogging includes request and response bodies, headers and websocket
+// JSON messages in the Debug level logs. The Authorization header and API keys
+// are always redacted. Streamed response bodies are not logged.
+func WithBodyLogging(enabled bool) ClientOption {
+	return func(c *Client) {
+		c.logBodies = enabled
+	}
+}
+
+// log returns the client's logger, or a logger discarding everything.
+func (c *Client) log() *slog.Logger {
+	if c.logger == nil {
+		return slog.New(slog.DiscardHandler)
+	}
+	return c.logger
+}
+
+// logBody reports whether bodies should be logged for ctx.
+func (c *Client) logBody(ctx context.Context) bool {
+	return c.logBodies && c.logger != nil && c.logger.Enabled(ctx, slog.LevelDebug)
+}
+
+// redactHeader returns a loggable copy of header.
+func redactHeader(header http.Header) http.Header {
+	out := header.Clone()
+	for _, name := range []string{"Authorization", "X-DashScope-ApiKey"} {
+		if out.Get(name) != "" {
+			out.Set(name, redact.Placeholder)
+		}
+	}
+	return out
+}
+
+// bearerToken returns the API key sent in header.
+func bearerToken(header http.Header) string {
+	return strings.TrimPrefix(header.Get("Authorization"), "Bearer ")
+}
+
+func callAttrs(info CallInfo) []any {
+	attrs := []any{slog.String("service", info.Service)}
+	if info.Model != "" {
+		attrs = append(attrs, slog.String("model", info.Model))
+	}
+	if info.TaskID != "" {
+		attrs = append(attrs, slog.String("task_id", info.TaskID))
+	}
+	return attrs
+}
+
+// logHTTP wraps next with Debug logging of each HTTP attempt.
+func (c *Client) logHTTP(info CallInfo, next HTTPHandler) HTTPHandler {
+	if c.logger == nil {
+		return next
+	}
+	return func(req *http.Request) (*http.Response, error) {
+		ctx := req.Context()
+		logger := c.logger.With(callAttrs(info)...)
+		key := bearerToken(req.Header)
+
+		attrs := []any{
+			slog.String("method", req.Method),
+			slog.String("url", redact.String(req.URL.String(), key)),
+		}
+		if c.logBody(ctx) {
+			attrs = append(attrs, slog.Any("header", redactHeader(req.Header)))
+			if req.GetBody != nil {
+				if body, err := req.GetBody(); err == nil {
+					data, _ := io.ReadAll(body)
+					body.Close()
+					attrs = append(attrs, slog.String("body", redact.String(string(data), key)))
+				}
+			}
+		}
+		logger.DebugContext(ctx, "dashscope: http request", attrs...)
+
+		start := time.Now()
+		resp, err := next(req)
+		if err != nil {
+			logger.DebugContext(ctx, "dashscope: http request failed",
+				slog.String("method", req.Method),
+				slog.Duration("duration", time.Since(start)),
+				slog.Any("error", err))
+			return nil, err
+		}
+
+		attrs = []any{
+			slog.Int("status", resp.StatusCode),
+			slog.Duration("duration", time.Since(start)),
+		}
+		if id := resp.Header.Get("X-Request-Id"); id != "" {
+			attrs = append(attrs, slog.String("request_id", id))
+		}
+		if c.logBody(ctx) && !info.Stream {
+			data, readErr := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			resp.Body = io.NopCloser(bytes.NewReader(data))
+			if readErr == nil {
+				attrs = append(attrs, slog.String("body", redact.String(string(data), key)))
+			}
+		}
+		logger.DebugContext(ctx, "dashscope: http response", attrs...)
+		return resp, nil
+	}
+}
+
+// logRetry logs a retried HTTP attempt at Warn.
+func (c *Client) logRetry(ctx context.Context, info CallInfo, retry RetryAttempt) {
+	attrs := append(callAttrs(info),
+		slog.Int("attempt", retry.Attempt),
+		slog.Duration("backoff", retry.Backoff),
+		slog.Any("error", retry.Err),
+	)
+	if retry.StatusCode != 0 {
+		attrs = append(attrs, slog.Int("status", retry.StatusCode))
+	}
+	c.log().WarnContext(ctx, "dashscope: retrying request", attrs...)
+}
+
+// logMessage logs a websocket text message at Debug. Binary audio frames are
+// too frequent to log.
+func (w *wsConn) logMessage(msg *WebsocketMessage) {
+	ctx := w.ctx
+	if msg.Type == websocket.BinaryMessage || !w.c.log().Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+
+	attrs := callAttrs(w.info)
+	if msg.Direction == Outbound {
+		attrs = append(attrs, slog.String("direction", "outbound"))
+	} else {
+		attrs = append(attrs, slog.String("direction", "inbound"))
+	}
+	if msg.Action != "" {
+		attrs = append(attrs, slog.String("action", msg.Action))
+	}
+	if msg.Event != "" {
+		attrs = append(attrs, slog.String("event", msg.Event))
+	}
+	if w.c.logBody(ctx) {
+		attrs = append(attrs, slog.String("body", redact.String(string(msg.Data), w.apiKey)))
+	}
+	w.c.logger.DebugContext(ctx, "dashscope: websocket message", attrs...)
+}
@@ -0,0 +1,86 @@
+package dashscope_test
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+	"github.com/ceoifung/go-dashscope/dashscope/dashscopetest"
+)
+
+// leakedKey looks like a DashScope API key but is not the client's.
+const leakedKey = "sk-0123456789abcdef0123"
+
+func TestLoggingRedaction(t *testing.T) {
+	srv := dashscopetest.NewServer()
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	c := srv.Client(
+		dashscope.WithLogger(logger),
+		dashscope.WithBodyLogging(true),
+		dashscope.WithMiddleware(dashscope.MiddlewareFuncs{
+			HTTP: func(info dashscope.CallInfo, req *http.Request, next dashscope.HTTPHandler) (*http.Response, error) {
+				req.Header.Set("X-DashScope-ApiKey", leakedKey)
+				return next(req)
+			},
+		}),
+	)
+
+	prompt := "My keys are " + leakedKey + " and " + srv.APIKey
+	if _, err := c.Generation().Call(context.Background(), dashscope.GenerationRequest{
+		Model: dashscope.QwenTurbo,
+		Input: dashscope.GenerationInput{Prompt: prompt},
+	}); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if _, err := c.SpeechSynthesizer("cosyvoice-v1").Call(context.Background(), prompt, nil, nil); err != nil {
+		t.Fatalf("SpeechSynthesizer.Call: %v", err)
+	}
+
+	logs := buf.String()
+	for _, want := range []string{
+		`"msg":"dashscope: http request"`,
+		`"msg":"dashscope: websocket message"`,
+		`"Authorization":["[REDACTED]"]`,
+		`"X-Dashscope-Apikey":["[REDACTED]"]`,
+		`My keys are [REDACTED] and [REDACTED]`,
+	} {
+		if !strings.Contains(logs, want) {
+			t.Errorf("logs do not contain %s", want)
+		}
+	}
+	for _, secret := range []string{srv.APIKey, leakedKey} {
+		if strings.Contains(logs, secret) {
+			t.Errorf("logs contain %q:\n%s", secret, logs)
+		}
+	}
+}
+
+func TestLoggingWithoutBodies(t *testing.T) {
+	srv := dashscopetest.NewServer()
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	c := srv.Client(dashscope.WithLogger(logger))
+	if _, err := c.Generation().Call(context.Background(), dashscope.GenerationRequest{
+		Model: dashscope.QwenTurbo,
+		Input: dashscope.GenerationInput{Prompt: "Hello " + leakedKey},
+	}); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+
+	logs := buf.String()
+	if !strings.Contains(logs, `"msg":"dashscope: operation finished"`) {
+		t.Errorf("logs do not report the finished operation:\n%s", logs)
+	}
+	if strings.Contains(logs, "Hello") || strings.Contains(logs, `"header"`) {
+		t.Errorf("logs contain bodies or headers without WithBodyLogging:\n%s", logs)
+	}
+}
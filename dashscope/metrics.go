@@ -0,0 +1,83 @@
+package dashscope
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// MetricsRecorder receives measurements of DashScope operations. The SDK
+// calls it once when every operation finishes and before every retried HTTP
+// attempt. Implementations are called concurrently and should not block.
+//
+// The prommetrics and expvarmetrics packages provide ready-made recorders.
+type MetricsRecorder interface {
+	RecordOperation(m OperationMetrics)
+	RecordRetry(info CallInfo, attempt RetryAttempt)
+}
+
+// OperationMetrics describes a finished operation.
+type OperationMetrics struct {
+	// Operation names the SDK call, such as "Generation.Call",
+	// "ImageSynthesis.AsyncCall", "WaitForTask" or "Recognition".
+	Operation string
+	Info      CallInfo
+
+	// Session reports whether the operation is a websocket session
+	// (speech synthesis, recognition or multimodal dialog). Its Duration is
+	// the lifetime of the session.
+	Session bool
+
+	Duration time.Duration
+	// TimeToFirstToken is the delay until the first streamed chunk or audio
+	// frame, zero for non-streaming operations.
+	TimeToFirstToken time.Duration
+
+	// Usage reported by DashScope. Embedding, rerank and understanding
+	// calls report their total tokens as InputTokens.
+	InputTokens  int
+	OutputTokens int
+	Characters   int // Speech synthesis
+	Images       int // Image synthesis
+
+	// Set when the operation failed.
+	Err        error
+	StatusCode int    // HTTP status of an *APIError
+	ErrorCode  string // DashScope error code of an *APIError
+}
+
+// Result summarizes the outcome as a label value: "ok", the DashScope error
+// code or HTTP status of a failed call, "canceled", "timeout" or "error".
+func (m OperationMetrics) Result() string {
+	switch {
+	case m.Err == nil:
+		return "ok"
+	case m.ErrorCode != "":
+		return m.ErrorCode
+	case m.StatusCode != 0:
+		return strconv.Itoa(m.StatusCode)
+	case errors.Is(m.Err, context.Canceled):
+		return "canceled"
+	case errors.Is(m.Err, context.DeadlineExceeded):
+		return "timeout"
+	default:
+		return "error"
+	}
+}
+
+// WithMetrics reports operation metrics to recorder.
+func WithMetrics(recorder MetricsRecorder) ClientOption {
+	return func(c *Client) {
+		c.metrics = recorder
+	}
+}
+
+// websocket reports whether info belongs to a websocket service.
+func (info CallInfo) websocket() bool {
+	switch info.Service {
+	case ServiceSpeechSynthesis, ServiceRecognition, ServiceMultiModalDialog:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package dashscope_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+	"github.com/ceoifung/go-dashscope/dashscope/dashscopetest"
+)
+
+// recorder is a MetricsRecorder keeping what it is given.
+type recorder struct {
+	mu         sync.Mutex
+	operations []dashscope.OperationMetrics
+	retries    []dashscope.RetryAttempt
+}
+
+func (r *recorder) RecordOperation(m dashscope.OperationMetrics) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.operations = append(r.operations, m)
+}
+
+func (r *recorder) RecordRetry(info dashscope.CallInfo, attempt dashscope.RetryAttempt) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.retries = append(r.retries, attempt)
+}
+
+func TestMetricsRecorder(t *testing.T) {
+	srv := dashscopetest.NewServer()
+	defer srv.Close()
+	srv.Enqueue(dashscope.ServiceGeneration,
+		dashscopetest.Fail(http.StatusTooManyRequests, dashscope.ErrCodeThrottling, "slow down"),
+		dashscopetest.Response{Body: map[string]interface{}{
+			"output": map[string]interface{}{"text": "Hi", "finish_reason": "stop"},
+			"usage":  map[string]interface{}{"input_tokens": 3, "output_tokens": 2, "total_tokens": 5},
+		}},
+		dashscopetest.Fail(http.StatusBadRequest, dashscope.ErrCodeInvalidParameter, "bad input"))
+
+	rec := &recorder{}
+	c := srv.Client(dashscope.WithMetrics(rec), dashscope.WithRetryPolicy(fastRetry()))
+	req := dashscope.GenerationRequest{Model: dashscope.QwenTurbo, Input: dashscope.GenerationInput{Prompt: "Hi"}}
+	if _, err := c.Generation().Call(context.Background(), req); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if _, err := c.Generation().Call(context.Background(), req); err == nil {
+		t.Fatal("second Call succeeded, want an error")
+	}
+	if _, err := c.SpeechSynthesizer("cosyvoice-v1").Call(context.Background(), "Hello", nil, nil); err != nil {
+		t.Fatalf("SpeechSynthesizer.Call: %v", err)
+	}
+
+	if len(rec.retries) != 1 || rec.retries[0].StatusCode != http.StatusTooManyRequests {
+		t.Errorf("retries = %+v, want one after a 429", rec.retries)
+	}
+	if len(rec.operations) != 3 {
+		t.Fatalf("%d operations recorded, want 3", len(rec.operations))
+	}
+
+	ok, failed, session := rec.operations[0], rec.operations[1], rec.operations[2]
+	if ok.Operation != "Generation.Call" || ok.Info.Model != dashscope.QwenTurbo || ok.Session {
+		t.Errorf("operation = %q %+v session %t, want a Generation.Call of %s", ok.Operation, ok.Info, ok.Session, dashscope.QwenTurbo)
+	}
+	if ok.InputTokens != 3 || ok.OutputTokens != 2 || ok.Result() != "ok" || ok.Duration <= 0 {
+		t.Errorf("successful call = %+v, want 3 input and 2 output tokens", ok)
+	}
+	if failed.StatusCode != http.StatusBadRequest || failed.ErrorCode != dashscope.ErrCodeInvalidParameter || failed.Err == nil {
+		t.Errorf("failed call = %+v, want a 400 %s", failed, dashscope.ErrCodeInvalidParameter)
+	}
+	if !session.Session || session.Characters != 5 || session.TimeToFirstToken <= 0 {
+		t.Errorf("synthesis = %+v, want a session billing 5 characters", session)
+	}
+}
+
+func TestOperationMetricsResult(t *testing.T) {
+	tests := []struct {
+		m    dashscope.OperationMetrics
+		want string
+	}{
+		{dashscope.OperationMetrics{}, "ok"},
+		{dashscope.OperationMetrics{Err: errors.New("x"), StatusCode: 429, ErrorCode: dashscope.ErrCodeThrottling}, dashscope.ErrCodeThrottling},
+		{dashscope.OperationMetrics{Err: errors.New("x"), StatusCode: 502}, "502"},
+		{dashscope.OperationMetrics{Err: fmt.Errorf("call: %w", context.Canceled)}, "canceled"},
+		{dashscope.OperationMetrics{Err: context.DeadlineExceeded}, "timeout"},
+		{dashscope.OperationMetrics{Err: errors.New("x")}, "error"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.Result(); got != tt.want {
+			t.Errorf("Result of %+v = %q, want %q", tt.m, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package dashscope
+
+import (
+	"context"
+	"net/http"
+)
+
+// Service names reported in CallInfo.
+const (
+	ServiceGeneration           = "generation"
+	ServiceMultiModalGeneration = "multimodal-generation"
+	ServiceTextEmbedding        = "text-embedding"
+	ServiceMultimodalEmbedding  = "multimodal-embedding"
+	ServiceTextReRank           = "text-rerank"
+	ServiceUnderstanding        = "understanding"
+	ServiceImageSynthesis       = "image-synthesis"
+	ServiceTranscription        = "transcription"
+	ServiceTask                 = "task"
+	ServiceSpeechSynthesis      = "speech-synthesis"
+	ServiceRecognition          = "recognition"
+	ServiceMultiModalDialog     = "multimodal-dialog"
+	ServiceTokenization         = "tokenization"
+	ServiceChatCompletions      = "chat-completions"
+	ServiceEmbeddings           = "embeddings"
+	ServiceModels               = "models"
+	ServiceApplication          = "application"
+	ServiceFiles                = "files"
+	ServiceBatches              = "batches"
+)
+
+// CallInfo describes the DashScope operation a request or message belongs to.
+type CallInfo struct {
+	Service string // One of the Service* constants
+	Model   string
+	TaskID  string // Async task or websocket task ID, if known
+	Stream  bool   // Whether the HTTP response is streamed
+}
+
+// HTTPHandler sends an HTTP request to DashScope.
+type HTTPHandler func(req *http.Request) (*http.Response, error)
+
+// Direction is the direction of a websocket message.
+type Direction int
+
+const (
+	Outbound Direction = iota // Client to DashScope
+	Inbound                   // DashScope to client
+)
+
+// WebsocketMessage is a single websocket frame exchanged with DashScope.
+type WebsocketMessage struct {
+	Direction Direction
+	Type      int    // websocket.TextMessage or websocket.BinaryMessage
+	Data      []byte // Middleware may replace Data, e.g. to scrub it
+	Action    string // Outbound action such as "run-task", "finish-task" or "Start"
+	Event     string // Inbound event such as "task-started", or a dialog directive
+}
+
+// WebsocketHandler processes a websocket message. For outbound messages the
+// final handler writes to the connection; for inbound messages it hands the
+// message to the service.
+type WebsocketHandler func(ctx context.Context, msg *WebsocketMessage) error
+
+// Middleware intercepts DashScope traffic. HandleHTTP wraps every HTTP
+// attempt, including retries and task polling. HandleWebsocket sees every
+// outbound action and inbound event of the websocket services. Implementations
+// must call next to continue the chain.
+type Middleware interface {
+	HandleHTTP(info CallInfo, req *http.Request, next HTTPHandler) (*http.Response, error)
+	HandleWebsocket(ctx context.Context, info CallInfo, msg *WebsocketMessage, next WebsocketHandler) error
+}
+
+// MiddlewareFuncs adapts plain functions to Middleware. Nil fields pass
+// traffic through unchanged.
+type MiddlewareFuncs struct {
+	HTTP      func(info CallInfo, req *http.Request, next HTTPHandler) (*http.Response, error)
+	Websocket func(ctx context.Context, info CallInfo, msg *WebsocketMessage, next WebsocketHandler) error
+}
+
+func (m MiddlewareFuncs) HandleHTTP(info CallInfo, req *http.Request, next HTTPHandler) (*http.Response, error) {
+	if m.HTTP == nil {
+		return next(req)
+	}
+	return m.HTTP(info, req, next)
+}
+
+func (m MiddlewareFuncs) HandleWebsocket(ctx context.Context, info CallInfo, msg *WebsocketMessage, next WebsocketHandler) error {
+	if m.Websocket == nil {
+		return next(ctx, msg)
+	}
+	return m.Websocket(ctx, info, msg, next)
+}
+
+// WithMiddleware appends middleware to the client. The first middleware is
+// the outermost.
+func WithMiddleware(middleware ...Middleware) ClientOption {
+	return func(c *Client) {
+		c.middleware = append(c.middleware, middleware...)
+	}
+}
+
+// httpHandler returns client.Do wrapped in the client's middleware. Logging
+// is innermost so it records what is actually sent.
+func (c *Client) httpHandler(client *http.Client, info CallInfo) HTTPHandler {
+	h := c.logHTTP(info, client.Do)
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		mw, next := c.middleware[i], h
+		h = func(req *http.Request) (*http.Response, error) {
+			return mw.HandleHTTP(info, req, next)
+		}
+	}
+	return h
+}
+
+// websocketHandler returns final wrapped in the client's middleware.
+func (c *Client) websocketHandler(info CallInfo, final WebsocketHandler) WebsocketHandler {
+	h := final
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		mw, next := c.middleware[i], h
+		h = func(ctx context.Context, msg *WebsocketMessage) error {
+			return mw.HandleWebsocket(ctx, info, msg, next)
+		}
+	}
+	return h
+}
@@ -0,0 +1,223 @@
+package dashscope_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+	"github.com/ceoifung/go-dashscope/dashscope/dashscopetest"
+)
+
+// fastRetry is the default retry policy with negligible backoff.
+func fastRetry() *dashscope.RetryPolicy {
+	policy := dashscope.DefaultRetryPolicy()
+	policy.InitialBackoff = time.Millisecond
+	policy.MaxBackoff = time.Millisecond
+	policy.RespectRetryAfter = false
+	return policy
+}
+
+// tracer records the middleware calls made through it.
+type tracer struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (tr *tracer) add(call string) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.calls = append(tr.calls, call)
+}
+
+func (tr *tracer) String() string {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return strings.Join(tr.calls, " ")
+}
+
+// named is a middleware recording its HTTP calls under name.
+func (tr *tracer) named(name string) dashscope.Middleware {
+	return dashscope.MiddlewareFuncs{
+		HTTP: func(info dashscope.CallInfo, req *http.Request, next dashscope.HTTPHandler) (*http.Response, error) {
+			tr.add(name + ">" + info.Service)
+			resp, err := next(req)
+			tr.add("<" + name)
+			return resp, err
+		},
+	}
+}
+
+func TestHTTPMiddleware(t *testing.T) {
+	generate := func(c *dashscope.Client) (*dashscope.GenerationResponse, error) {
+		return c.Generation().Call(context.Background(), dashscope.GenerationRequest{
+			Model: dashscope.QwenTurbo,
+			Input: dashscope.GenerationInput{Prompt: "Hi"},
+		})
+	}
+	canned := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(`{"request_id":"req-canned","output":{"text":"canned"}}`)),
+	}
+	errBlocked := errors.New("blocked")
+
+	tests := []struct {
+		name         string
+		middleware   func(tr *tracer) []dashscope.Middleware
+		responses    []dashscopetest.Response
+		wantCalls    string
+		wantHeader   string // X-Test header received by the server
+		wantRequests int
+		wantText     string
+		wantErr      error
+	}{
+		{
+			name: "chain order",
+			middleware: func(tr *tracer) []dashscope.Middleware {
+				return []dashscope.Middleware{tr.named("a"), tr.named("b")}
+			},
+			wantCalls:    "a>generation b>generation <b <a",
+			wantRequests: 1,
+		},
+		{
+			name: "every attempt",
+			middleware: func(tr *tracer) []dashscope.Middleware {
+				return []dashscope.Middleware{tr.named("a")}
+			},
+			responses:    []dashscopetest.Response{dashscopetest.Fail(http.StatusTooManyRequests, dashscope.ErrCodeThrottling, "slow down")},
+			wantCalls:    "a>generation <a a>generation <a",
+			wantRequests: 2,
+		},
+		{
+			name: "nil funcs pass through",
+			middleware: func(tr *tracer) []dashscope.Middleware {
+				return []dashscope.Middleware{dashscope.MiddlewareFuncs{}, tr.named("a")}
+			},
+			wantCalls:    "a>generation <a",
+			wantRequests: 1,
+		},
+		{
+			name: "modified request",
+			middleware: func(tr *tracer) []dashscope.Middleware {
+				return []dashscope.Middleware{dashscope.MiddlewareFuncs{
+					HTTP: func(info dashscope.CallInfo, req *http.Request, next dashscope.HTTPHandler) (*http.Response, error) {
+						req.Header.Set("X-Test", info.Model)
+						return next(req)
+					},
+				}}
+			},
+			wantHeader:   dashscope.QwenTurbo,
+			wantRequests: 1,
+		},
+		{
+			name: "short-circuited response",
+			middleware: func(tr *tracer) []dashscope.Middleware {
+				return []dashscope.Middleware{dashscope.MiddlewareFuncs{
+					HTTP: func(info dashscope.CallInfo, req *http.Request, next dashscope.HTTPHandler) (*http.Response, error) {
+						return canned, nil
+					},
+				}, tr.named("inner")}
+			},
+			wantText: "canned",
+		},
+		{
+			name: "short-circuited error",
+			middleware: func(tr *tracer) []dashscope.Middleware {
+				return []dashscope.Middleware{dashscope.MiddlewareFuncs{
+					HTTP: func(info dashscope.CallInfo, req *http.Request, next dashscope.HTTPHandler) (*http.Response, error) {
+						return nil, errBlocked
+					},
+				}}
+			},
+			wantErr: errBlocked,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := dashscopetest.NewServer()
+			defer srv.Close()
+			srv.Enqueue(dashscope.ServiceGeneration, tt.responses...)
+
+			tr := &tracer{}
+			c := srv.Client(dashscope.WithRetryPolicy(fastRetry()), dashscope.WithMiddleware(tt.middleware(tr)...))
+			resp, err := generate(c)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Call error = %v, want %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("Call: %v", err)
+			}
+
+			if got := tr.String(); got != tt.wantCalls {
+				t.Errorf("calls = %q, want %q", got, tt.wantCalls)
+			}
+			requests := srv.RequestsFor(dashscope.ServiceGeneration)
+			if len(requests) != tt.wantRequests {
+				t.Fatalf("%d requests reached the server, want %d", len(requests), tt.wantRequests)
+			}
+			if tt.wantHeader != "" {
+				if got := requests[0].Header.Get("X-Test"); got != tt.wantHeader {
+					t.Errorf("X-Test = %q, want %q", got, tt.wantHeader)
+				}
+			}
+			if tt.wantText != "" && resp.Output.Text != tt.wantText {
+				t.Errorf("text = %q, want %q", resp.Output.Text, tt.wantText)
+			}
+		})
+	}
+}
+
+func TestWebsocketMiddleware(t *testing.T) {
+	srv := dashscopetest.NewServer()
+	defer srv.Close()
+
+	tr := &tracer{}
+	record := func(name string) dashscope.Middleware {
+		return dashscope.MiddlewareFuncs{
+			Websocket: func(ctx context.Context, info dashscope.CallInfo, msg *dashscope.WebsocketMessage, next dashscope.WebsocketHandler) error {
+				switch {
+				case msg.Direction == dashscope.Outbound:
+					tr.add(name + ">" + msg.Action)
+				case msg.Event != "":
+					tr.add(name + "<" + msg.Event)
+				}
+				return next(ctx, msg)
+			},
+		}
+	}
+	c := srv.Client(dashscope.WithMiddleware(record("a"), record("b")))
+	if _, err := c.SpeechSynthesizer("cosyvoice-v1").Call(context.Background(), "Hello", nil, nil); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	calls := tr.String()
+	if !strings.HasPrefix(calls, "a>run-task b>run-task a<task-started b<task-started") {
+		t.Errorf("calls = %q, want run-task then task-started through a, then b", calls)
+	}
+	if !strings.HasSuffix(calls, "a<task-finished b<task-finished") {
+		t.Errorf("calls = %q, want task-finished last", calls)
+	}
+
+	errBlocked := errors.New("blocked")
+	c = srv.Client(dashscope.WithMiddleware(dashscope.MiddlewareFuncs{
+		Websocket: func(ctx context.Context, info dashscope.CallInfo, msg *dashscope.WebsocketMessage, next dashscope.WebsocketHandler) error {
+			if msg.Direction == dashscope.Outbound {
+				return errBlocked
+			}
+			return next(ctx, msg)
+		},
+	}))
+	before := len(srv.RequestsFor(dashscope.ServiceSpeechSynthesis))
+	if _, err := c.SpeechSynthesizer("cosyvoice-v1").Call(context.Background(), "Hello", nil, nil); !errors.Is(err, errBlocked) {
+		t.Errorf("Call error = %v, want %v", err, errBlocked)
+	}
+	if n := len(srv.RequestsFor(dashscope.ServiceSpeechSynthesis)); n != before {
+		t.Errorf("%d messages reached the server after the middleware blocked them", n-before)
+	}
+}
@@ -1,26 +1,24 @@
 package dashscope
 
 import (
-	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
-// const QwenVLGenerationURL = "https://dashscope.aliyuncs.com/api/v1/services/aigc/multimodal-generation/generation"
-
 // MultiModal Conversation Models
 const (
 	QwenVLChatV1     = "qwen-vl-chat-v1"
 	QwenVLChatV1Plus = "qwen-vl-plus"
 	QwenVLChatV1Max  = "qwen-vl-max"
+	QVQMax           = "qvq-max" // Visual reasoning model, thinks before every reply
 )
 
 // WebSocket actions
@@ -55,21 +53,14 @@ type MultiModalConversation struct {
 	APIKey    string
 	Workspace string
 	client    *http.Client
+	c         *Client
 }
 
 // NewMultiModalConversation creates a new MultiModalConversation client.
 func NewMultiModalConversation(apiKey string) *MultiModalConversation {
-	if apiKey == "" {
-		apiKey = os.Getenv("DASHSCOPE_API_KEY")
-	}
-	return &MultiModalConversation{
-		APIKey: apiKey,
-		client: &http.Client{},
-	}
+	return NewClient(WithAPIKey(apiKey)).MultiModalConversation()
 }
 
-// ... (existing Call and CallStream methods remain, adding new types below)
-
 // Realtime/WebSocket types based on Python SDK
 
 type MultiModalHeader struct {
@@ -159,6 +150,9 @@ type MultiModalDialog struct {
 	DialogID  string
 	Workspace string
 	done      chan struct{}
+	c         *Client
+	ws        *wsConn
+	op        *operation
 }
 
 func (m *MultiModalConversation) NewDialog(appID string, callback MultiModalCallback) *MultiModalDialog {
@@ -168,6 +162,7 @@ func (m *MultiModalConversation) NewDialog(appID string, callback MultiModalCall
 		Callback:  callback,
 		Workspace: m.Workspace,
 		done:      make(chan struct{}),
+		c:         m.c,
 	}
 }
 
@@ -187,8 +182,9 @@ type MultiModalConversationInput struct {
 }
 
 type MultiModalMessage struct {
-	Role    string                  `json:"role"`
-	Content []MultiModalContentItem `json:"content"`
+	Role             string                  `json:"role"`
+	Content          []MultiModalContentItem `json:"content"`
+	ReasoningContent string                  `json:"reasoning_content,omitempty"`
 }
 
 type MultiModalContentItem struct {
@@ -197,11 +193,16 @@ type MultiModalContentItem struct {
 }
 
 type MultiModalConversationParameters struct {
-	TopP         float64 `json:"top_p,omitempty"`
-	TopK         int     `json:"top_k,omitempty"`
-	Seed         int     `json:"seed,omitempty"`
-	EnableSearch bool    `json:"enable_search,omitempty"`
-	ResultFormat string  `json:"result_format,omitempty"` // "message"
+	TopP              float64 `json:"top_p,omitempty"`
+	TopK              int     `json:"top_k,omitempty"`
+	Seed              int     `json:"seed,omitempty"`
+	EnableSearch      bool    `json:"enable_search,omitempty"`
+	ResultFormat      string  `json:"result_format,omitempty"` // "message"
+	IncrementalOutput bool    `json:"incremental_output,omitempty"`
+	// EnableThinking and ThinkingBudget control the thinking mode, as in
+	// GenerationParameters.
+	EnableThinking *bool `json:"enable_thinking,omitempty"`
+	ThinkingBudget int   `json:"thinking_budget,omitempty"`
 }
 
 type MultiModalConversationResponse struct {
@@ -211,6 +212,7 @@ type MultiModalConversationResponse struct {
 	} `json:"output"`
 	Usage      MultiModalUsage `json:"usage"`
 	StatusCode int             `json:"status_code,omitempty"`
+	Code       string          `json:"code,omitempty"`
 	Message    string          `json:"message,omitempty"`
 }
 
@@ -220,14 +222,15 @@ type MultiModalChoice struct {
 }
 
 type MultiModalUsage struct {
-	InputTokens  int `json:"input_tokens"`
-	OutputTokens int `json:"output_tokens"`
-	ImageCount   int `json:"image_count"`
+	InputTokens         int                 `json:"input_tokens"`
+	OutputTokens        int                 `json:"output_tokens"`
+	ImageCount          int                 `json:"image_count"`
+	OutputTokensDetails OutputTokensDetails `json:"output_tokens_details,omitzero"`
 }
 
 // Call performs a synchronous multimodal conversation request.
-func (m *MultiModalConversation) Call(ctx context.Context, req MultiModalConversationRequest) (*MultiModalConversationResponse, error) {
-	url := QwenVLGenerationURL
+func (m *MultiModalConversation) Call(ctx context.Context, req MultiModalConversationRequest) (_ *MultiModalConversationResponse, err error) {
+	url := m.c.url(QwenVLGenerationPath)
 
 	if req.Parameters == nil {
 		req.Parameters = &MultiModalConversationParameters{}
@@ -236,120 +239,124 @@ func (m *MultiModalConversation) Call(ctx context.Context, req MultiModalConvers
 	if req.Parameters.ResultFormat == "" {
 		req.Parameters.ResultFormat = "message"
 	}
+	// Thinking is only served as a stream.
+	if thinking(req.Model, req.Parameters.EnableThinking) {
+		return m.collect(ctx, req)
+	}
 
-	jsonData, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	info := CallInfo{Service: ServiceMultiModalGeneration, Model: req.Model}
+	ctx, op := m.c.startOperation(ctx, "MultiModalConversation.Call", info)
+	defer func() { op.end(err) }()
+
+	ctx, cancel := m.c.withTimeout(ctx)
+	defer cancel()
+
+	if err := op.reserve(ctx, estimateMultiModalTokens(req, op.counter(ctx))); err != nil {
+		return nil, err
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	httpReq, err := m.c.newRequest(ctx, "POST", url, req, m.APIKey, m.Workspace)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+m.APIKey)
-	httpReq.Header.Set("X-DashScope-WorkSpace", m.Workspace)
-
-	resp, err := m.client.Do(httpReq)
+	resp, err := m.c.do(m.client, httpReq, info)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	var mmResp MultiModalConversationResponse
-	if err := json.NewDecoder(resp.Body).Decode(&mmResp); err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return &mmResp, fmt.Errorf("multimodal conversation failed: %s (%s)", mmResp.Message, mmResp.RequestID)
+	err = decodeResponse(resp, &mmResp)
+	op.setRequestID(mmResp.RequestID)
+	op.setUsage(mmResp.Usage.InputTokens, mmResp.Usage.OutputTokens)
+	if err != nil {
+		return &mmResp, err
 	}
 
 	return &mmResp, nil
 }
 
-// CallStream performs a streaming multimodal conversation request.
+// Stream performs a streaming multimodal conversation request. The caller
+// must read the stream to the end or Close it.
+func (m *MultiModalConversation) Stream(ctx context.Context, req MultiModalConversationRequest) (*Stream[MultiModalConversationResponse], error) {
+	return m.stream(ctx, req, "MultiModalConversation.Stream")
+}
+
+// CallStream performs a streaming multimodal conversation request. A failure
+// ends the stream with a final response carrying its code and message. The
+// channel is closed early when ctx is canceled.
 func (m *MultiModalConversation) CallStream(ctx context.Context, req MultiModalConversationRequest) (<-chan MultiModalConversationResponse, error) {
-	url := QwenVLGenerationURL
+	stream, err := m.stream(ctx, req, "MultiModalConversation.CallStream")
+	if err != nil {
+		return nil, err
+	}
+	return streamChannel(stream, func(err error) MultiModalConversationResponse {
+		var failed MultiModalConversationResponse
+		failed.StatusCode, failed.Code, failed.Message, failed.RequestID = streamFailure(err)
+		return failed
+	}), nil
+}
 
-	// Ensure stream parameter is true?
-	// The Python SDK seems to rely on the body param.
-	// But let's check if parameters exist.
-	// Note: The struct definition for MultiModalConversationParameters might not have Stream field explicitly defined
-	// in previous steps? Let's assume it does or we rely on the user setting it,
-	// or we just send headers.
-	// Python SDK: "input": {...}, "parameters": {"stream": True}
+func (m *MultiModalConversation) stream(ctx context.Context, req MultiModalConversationRequest, name string) (_ *Stream[MultiModalConversationResponse], err error) {
+	url := m.c.url(QwenVLGenerationPath)
 
-	// We can't easily inject "stream": true into req.Parameters if it's a specific struct without that field
-	// or if we don't want to use reflection.
-	// However, standard DashScope API usually respects X-DashScope-SSE: enable.
+	info := CallInfo{Service: ServiceMultiModalGeneration, Model: req.Model, Stream: true}
+	ctx, op := m.c.startOperation(ctx, name, info)
+	defer func() {
+		if err != nil {
+			op.end(err)
+		}
+	}()
 
-	jsonData, err := json.Marshal(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	if err := op.reserve(ctx, estimateMultiModalTokens(req, op.counter(ctx))); err != nil {
+		return nil, err
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	httpReq, err := m.c.newRequest(ctx, "POST", url, req, m.APIKey, m.Workspace)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
 
-	httpReq.Header.Set("Content-Type", "application/json")
-	httpReq.Header.Set("Authorization", "Bearer "+m.APIKey)
 	httpReq.Header.Set("X-DashScope-SSE", "enable")
-	httpReq.Header.Set("X-DashScope-WorkSpace", m.Workspace)
-
-	resp, err := m.client.Do(httpReq)
+	resp, err := m.c.do(m.client, httpReq, info)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
+	if err := checkStreamResponse(resp); err != nil {
+		return nil, err
+	}
 
-	ch := make(chan MultiModalConversationResponse)
-
-	go func() {
-		defer resp.Body.Close()
-		defer close(ch)
-
-		scanner := bufio.NewScanner(resp.Body)
-		for scanner.Scan() {
-			line := scanner.Text()
-			if strings.HasPrefix(line, "data:") {
-				data := strings.TrimPrefix(line, "data:")
-				var mmResp MultiModalConversationResponse
-				if err := json.Unmarshal([]byte(data), &mmResp); err != nil {
-					// Handle parsing error if needed
-					continue
-				}
-				ch <- mmResp
-			}
-		}
-	}()
-
-	return ch, nil
+	return newStream(ctx, op, resp, func(chunk *MultiModalConversationResponse) {
+		op.markFirstToken()
+		op.setRequestID(chunk.RequestID)
+		op.setUsage(chunk.Usage.InputTokens, chunk.Usage.OutputTokens)
+	}), nil
 }
 
 func (d *MultiModalDialog) Start(ctx context.Context, model string) error {
 	d.Model = model
-	u := "wss://dashscope.aliyuncs.com/api-ws/v1/inference/"
-	header := http.Header{}
-	header.Add("Authorization", "Bearer "+d.APIKey)
-	if d.Workspace != "" {
-		header.Add("X-DashScope-WorkSpace", d.Workspace)
+	d.TaskID = strings.ReplaceAll(uuid.New().String(), "-", "")
+	info := CallInfo{
+		Service: ServiceMultiModalDialog,
+		Model:   d.Model,
+		TaskID:  d.TaskID,
 	}
+	ctx, d.op = d.c.startOperation(ctx, "MultiModalDialog", info)
 
-	conn, _, err := websocket.DefaultDialer.DialContext(ctx, u, header)
+	conn, err := d.c.dialSession(ctx, info, d.APIKey, d.Workspace)
 	if err != nil {
+		d.op.end(err)
 		return fmt.Errorf("websocket dial failed: %w", err)
 	}
-	d.Conn = conn
+	d.ws = conn
+	d.Conn = conn.conn
 	d.Callback.OnConnected()
 
 	// Start reading loop
 	go d.readLoop()
 
 	// Send Start request
-	d.TaskID = strings.ReplaceAll(uuid.New().String(), "-", "")
 	req := MultiModalRealtimeRequest{
 		Header: MultiModalHeader{
 			Action:    ActionStart,
@@ -382,23 +389,29 @@ func (d *MultiModalDialog) Start(ctx context.Context, model string) error {
 		},
 	}
 
-	return d.Conn.WriteJSON(req)
+	return d.ws.writeJSON(ActionStart, req)
 }
 
 func (d *MultiModalDialog) readLoop() {
+	var sessionErr error
 	defer func() {
+		d.op.end(sessionErr)
 		close(d.done)
 		d.Callback.OnClose(0, "connection closed")
 	}()
 
 	for {
-		messageType, data, err := d.Conn.ReadMessage()
+		messageType, data, err := d.ws.read()
 		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				sessionErr = err
+			}
 			d.Callback.OnError(err)
 			return
 		}
 
 		if messageType == websocket.BinaryMessage {
+			d.op.markFirstToken()
 			d.Callback.OnAudioData(data)
 			continue
 		}
@@ -411,6 +424,7 @@ func (d *MultiModalDialog) readLoop() {
 		switch resp.Payload.Output.Directive {
 		case ResponseStarted:
 			d.DialogID = resp.Payload.Output.DialogID
+			d.op.setAttributes(AttrDialogID.String(d.DialogID))
 			d.Callback.OnStarted(d.DialogID)
 		case ResponseStopped:
 			d.Callback.OnStopped()
@@ -427,13 +441,17 @@ func (d *MultiModalDialog) readLoop() {
 		case ResponseRespondingEnded:
 			d.Callback.OnRespondingEnded()
 		case ResponseError:
-			d.Callback.OnError(fmt.Errorf("server error: %s", resp.Payload.Output.Text))
+			sessionErr = &APIError{
+				Message: resp.Payload.Output.Text,
+				TaskID:  d.TaskID,
+			}
+			d.Callback.OnError(sessionErr)
 		}
 	}
 }
 
 func (d *MultiModalDialog) SendAudio(data []byte) error {
-	return d.Conn.WriteMessage(websocket.BinaryMessage, data)
+	return d.ws.writeBinary(data)
 }
 
 func (d *MultiModalDialog) StopSpeech() error {
@@ -443,12 +461,24 @@ func (d *MultiModalDialog) StopSpeech() error {
 			TaskID: d.TaskID,
 		},
 	}
-	return d.Conn.WriteJSON(req)
+	return d.ws.writeJSON(ActionStopSpeech, req)
 }
 
 func (d *MultiModalDialog) Close() error {
-	if d.Conn != nil {
-		return d.Conn.Close()
+	if d.ws != nil {
+		return d.ws.close()
 	}
 	return nil
 }
+
+// estimateMultiModalTokens estimates the text tokens of a request. Images
+// are not counted and are corrected from the reported usage.
+func estimateMultiModalTokens(req MultiModalConversationRequest, count func(string) int) int {
+	n := 0
+	for _, msg := range req.Input.Messages {
+		for _, item := range msg.Content {
+			n += count(item.Text)
+		}
+	}
+	return n
+}
@@ -8,12 +8,9 @@
 package dashscope
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
-	"os"
 )
 
 // NLU Models
@@ -25,17 +22,12 @@ const (
 type Understanding struct {
 	APIKey string
 	client *http.Client
+	c      *Client
 }
 
 // NewUnderstanding creates a new Understanding client.
 func NewUnderstanding(apiKey string) *Understanding {
-	if apiKey == "" {
-		apiKey = os.Getenv("DASHSCOPE_API_KEY")
-	}
-	return &Understanding{
-		APIKey: apiKey,
-		client: &http.Client{},
-	}
+	return NewClient(WithAPIKey(apiKey)).Understanding()
 }
 
 // SetHTTPClient sets a custom HTTP client.
@@ -72,35 +64,38 @@ type UnderstandingUsage struct {
 }
 
 // Call performs the understanding request.
-func (u *Understanding) Call(ctx context.Context, req UnderstandingRequest) (*UnderstandingResponse, error) {
-	url := NLUUnderstandingURL
+func (u *Understanding) Call(ctx context.Context, req UnderstandingRequest) (_ *UnderstandingResponse, err error) {
+	url := u.c.url(NLUUnderstandingPath)
 
-	jsonData, err := json.Marshal(req)
-	if err != nil {
+	info := CallInfo{Service: ServiceUnderstanding, Model: req.Model}
+	ctx, op := u.c.startOperation(ctx, "Understanding.Call", info)
+	defer func() { op.end(err) }()
+
+	ctx, cancel := u.c.withTimeout(ctx)
+	defer cancel()
+
+	count := op.counter(ctx)
+	if err := op.reserve(ctx, count(req.Input.Sentence)+count(req.Input.Labels)); err != nil {
 		return nil, err
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	httpReq, err := u.c.newRequest(ctx, "POST", url, req, u.APIKey, "")
 	if err != nil {
 		return nil, err
 	}
 
-	httpReq.Header.Set("Authorization", "Bearer "+u.APIKey)
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	resp, err := u.client.Do(httpReq)
+	resp, err := u.c.do(u.client, httpReq, info)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	var uResp UnderstandingResponse
-	if err := json.NewDecoder(resp.Body).Decode(&uResp); err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return &uResp, fmt.Errorf("understanding failed: %s (%s)", uResp.Message, uResp.RequestID)
+	err = decodeResponse(resp, &uResp)
+	op.setRequestID(uResp.RequestID)
+	op.setUsage(uResp.Usage.TotalTokens, 0)
+	if err != nil {
+		return &uResp, err
 	}
 
 	return &uResp, nil
@@ -0,0 +1,225 @@
+package dashscope
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// operation tracks a single DashScope operation from start to end.
+type operation struct {
+	c           *Client
+	ctx         context.Context
+	name        string
+	info        CallInfo
+	span        trace.Span
+	start       time.Time
+	reservation *Reservation
+	requestID   string
+
+	inputTokens  int
+	outputTokens int
+	characters   int
+	images       int
+
+	mu         sync.Mutex
+	firstToken time.Duration
+	ended      bool
+}
+
+// startOperation starts tracking an operation. The returned context carries
+// its span, so nested HTTP attempts and task polls are recorded beneath it.
+func (c *Client) startOperation(ctx context.Context, name string, info CallInfo) (context.Context, *operation) {
+	tracer := c.tracer
+	if tracer == nil {
+		tracer = noop.NewTracerProvider().Tracer(tracerName)
+	}
+
+	attrs := []attribute.KeyValue{
+		AttrSystem.String("dashscope"),
+		AttrService.String(info.Service),
+	}
+	if info.Model != "" {
+		attrs = append(attrs, AttrModel.String(info.Model))
+	}
+	if info.TaskID != "" {
+		attrs = append(attrs, AttrTaskID.String(info.TaskID))
+	}
+
+	ctx, span := tracer.Start(ctx, "dashscope."+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...))
+
+	c.log().DebugContext(ctx, "dashscope: operation started",
+		append([]any{slog.String("operation", name)}, callAttrs(info)...)...)
+
+	return ctx, &operation{
+		c:     c,
+		ctx:   ctx,
+		name:  name,
+		info:  info,
+		span:  span,
+		start: time.Now(),
+	}
+}
+
+// reserve waits for rate limiter capacity for estimatedTokens. The charge is
+// corrected with the token usage recorded by setUsage when the operation ends.
+func (o *operation) reserve(ctx context.Context, estimatedTokens int) error {
+	reservation, err := o.c.reserve(ctx, o.info.Model, estimatedTokens)
+	if err != nil {
+		return err
+	}
+	o.reservation = reservation
+	return nil
+}
+
+// counter returns the token counter sizing the reservation, which only
+// consults the client's TokenCounters when a rate limiter is set.
+func (o *operation) counter(ctx context.Context) func(string) int {
+	if o.c.limiter == nil {
+		return estimateTokens
+	}
+	return o.c.tokenCounter(ctx, o.info.Model)
+}
+
+func (o *operation) setRequestID(requestID string) {
+	if requestID != "" {
+		o.requestID = requestID
+		o.span.SetAttributes(AttrRequestID.String(requestID))
+	}
+}
+
+func (o *operation) setTaskID(taskID string) {
+	if taskID != "" {
+		o.info.TaskID = taskID
+		o.span.SetAttributes(AttrTaskID.String(taskID))
+	}
+}
+
+func (o *operation) setUsage(inputTokens, outputTokens int) {
+	o.inputTokens, o.outputTokens = inputTokens, outputTokens
+	o.span.SetAttributes(
+		AttrInputTokens.Int(inputTokens),
+		AttrOutputTokens.Int(outputTokens),
+	)
+}
+
+func (o *operation) setCharacters(characters int) {
+	o.characters = characters
+	o.span.SetAttributes(AttrCharacters.Int(characters))
+}
+
+func (o *operation) setImageCount(images int) {
+	o.images = images
+	o.span.SetAttributes(AttrImageCount.Int(images))
+}
+
+func (o *operation) setAttributes(attrs ...attribute.KeyValue) {
+	o.span.SetAttributes(attrs...)
+}
+
+// markFirstToken records the time to the first streamed chunk or audio frame.
+// Later calls are ignored.
+func (o *operation) markFirstToken() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.firstToken != 0 {
+		return
+	}
+	o.firstToken = time.Since(o.start)
+	o.span.SetAttributes(AttrTimeToFirstToken.Float64(o.firstToken.Seconds()))
+}
+
+// event records a named point in the operation, such as a task poll.
+func (o *operation) event(name string, attrs ...attribute.KeyValue) {
+	o.span.AddEvent(name, trace.WithAttributes(attrs...))
+}
+
+// end finishes the operation. Only the first call has an effect.
+func (o *operation) end(err error) {
+	o.mu.Lock()
+	if o.ended {
+		o.mu.Unlock()
+		return
+	}
+	o.ended = true
+	o.mu.Unlock()
+
+	duration := time.Since(o.start)
+	o.reservation.Done(o.inputTokens + o.outputTokens)
+
+	var apiErr *APIError
+	if err != nil {
+		if errors.As(err, &apiErr) {
+			if apiErr.StatusCode != 0 {
+				o.span.SetAttributes(AttrStatusCode.Int(apiErr.StatusCode))
+			}
+			if apiErr.Code != "" {
+				o.span.SetAttributes(AttrErrorCode.String(apiErr.Code))
+			}
+			o.setRequestID(apiErr.RequestID)
+		}
+		o.span.RecordError(err)
+		o.span.SetStatus(codes.Error, err.Error())
+	}
+	o.span.End()
+	o.log(err, apiErr, duration)
+
+	if o.c.metrics != nil {
+		m := OperationMetrics{
+			Operation:        o.name,
+			Info:             o.info,
+			Session:          o.info.websocket(),
+			Duration:         duration,
+			TimeToFirstToken: o.firstToken,
+			InputTokens:      o.inputTokens,
+			OutputTokens:     o.outputTokens,
+			Characters:       o.characters,
+			Images:           o.images,
+			Err:              err,
+		}
+		if apiErr != nil {
+			m.StatusCode = apiErr.StatusCode
+			m.ErrorCode = apiErr.Code
+		}
+		o.c.metrics.RecordOperation(m)
+	}
+}
+
+// log records the outcome of the operation: Error for failures, Info otherwise.
+func (o *operation) log(err error, apiErr *APIError, duration time.Duration) {
+	logger := o.c.log()
+	attrs := append([]any{slog.String("operation", o.name)}, callAttrs(o.info)...)
+	if o.requestID != "" {
+		attrs = append(attrs, slog.String("request_id", o.requestID))
+	}
+	attrs = append(attrs, slog.Duration("duration", duration))
+
+	if err != nil {
+		if apiErr != nil {
+			attrs = append(attrs, slog.Int("status", apiErr.StatusCode), slog.String("code", apiErr.Code))
+		}
+		attrs = append(attrs, slog.Any("error", err))
+		logger.ErrorContext(o.ctx, "dashscope: operation failed", attrs...)
+		return
+	}
+
+	if o.inputTokens+o.outputTokens > 0 {
+		attrs = append(attrs, slog.Int("input_tokens", o.inputTokens), slog.Int("output_tokens", o.outputTokens))
+	}
+	if o.characters > 0 {
+		attrs = append(attrs, slog.Int("characters", o.characters))
+	}
+	if o.images > 0 {
+		attrs = append(attrs, slog.Int("images", o.images))
+	}
+	logger.InfoContext(o.ctx, "dashscope: operation finished", attrs...)
+}
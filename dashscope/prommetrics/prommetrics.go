@@ -0,0 +1,142 @@
+// Package prommetrics records DashScope SDK metrics with Prometheus.
+//
+//	rec := prommetrics.NewRecorder()
+//	prometheus.MustRegister(rec)
+//	client := dashscope.NewClient(dashscope.WithMetrics(rec))
+package prommetrics
+
+import (
+	"strconv"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Recorder is a dashscope.MetricsRecorder and a prometheus.Collector.
+type Recorder struct {
+	duration   *prometheus.HistogramVec
+	firstToken *prometheus.HistogramVec
+	sessions   *prometheus.HistogramVec
+	tokens     *prometheus.CounterVec
+	characters *prometheus.CounterVec
+	images     *prometheus.CounterVec
+	errors     *prometheus.CounterVec
+	retries    *prometheus.CounterVec
+}
+
+// NewRecorder creates a recorder whose metrics are prefixed with "dashscope_".
+func NewRecorder() *Recorder {
+	return NewRecorderWithNamespace("dashscope")
+}
+
+// NewRecorderWithNamespace creates a recorder whose metrics are prefixed with
+// namespace.
+func NewRecorderWithNamespace(namespace string) *Recorder {
+	return &Recorder{
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of DashScope HTTP operations.",
+			Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+		}, []string{"operation", "model", "result"}),
+		firstToken: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "time_to_first_token_seconds",
+			Help:      "Delay until the first streamed chunk or audio frame.",
+			Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2, 4, 8, 16},
+		}, []string{"operation", "model"}),
+		sessions: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "websocket_session_duration_seconds",
+			Help:      "Lifetime of DashScope websocket sessions.",
+			Buckets:   []float64{0.5, 1, 5, 15, 30, 60, 300, 900, 1800, 3600},
+		}, []string{"operation", "model", "result"}),
+		tokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tokens_total",
+			Help:      "Tokens reported by DashScope, by direction.",
+		}, []string{"operation", "model", "direction"}),
+		characters: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "characters_total",
+			Help:      "Characters billed for speech synthesis.",
+		}, []string{"operation", "model"}),
+		images: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "images_total",
+			Help:      "Images generated by image synthesis.",
+		}, []string{"operation", "model"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "errors_total",
+			Help:      "Failed operations by error code.",
+		}, []string{"operation", "model", "code"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "retries_total",
+			Help:      "Retried HTTP attempts.",
+		}, []string{"service", "model", "status"}),
+	}
+}
+
+func (r *Recorder) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		r.duration, r.firstToken, r.sessions,
+		r.tokens, r.characters, r.images,
+		r.errors, r.retries,
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (r *Recorder) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range r.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (r *Recorder) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range r.collectors() {
+		c.Collect(ch)
+	}
+}
+
+// RecordOperation implements dashscope.MetricsRecorder.
+func (r *Recorder) RecordOperation(m dashscope.OperationMetrics) {
+	op, model, result := m.Operation, m.Info.Model, m.Result()
+
+	if m.Session {
+		r.sessions.WithLabelValues(op, model, result).Observe(m.Duration.Seconds())
+	} else {
+		r.duration.WithLabelValues(op, model, result).Observe(m.Duration.Seconds())
+	}
+	if m.TimeToFirstToken > 0 {
+		r.firstToken.WithLabelValues(op, model).Observe(m.TimeToFirstToken.Seconds())
+	}
+
+	if m.InputTokens > 0 {
+		r.tokens.WithLabelValues(op, model, "input").Add(float64(m.InputTokens))
+	}
+	if m.OutputTokens > 0 {
+		r.tokens.WithLabelValues(op, model, "output").Add(float64(m.OutputTokens))
+	}
+	if m.Characters > 0 {
+		r.characters.WithLabelValues(op, model).Add(float64(m.Characters))
+	}
+	if m.Images > 0 {
+		r.images.WithLabelValues(op, model).Add(float64(m.Images))
+	}
+
+	if m.Err != nil {
+		r.errors.WithLabelValues(op, model, result).Inc()
+	}
+}
+
+// RecordRetry implements dashscope.MetricsRecorder.
+func (r *Recorder) RecordRetry(info dashscope.CallInfo, attempt dashscope.RetryAttempt) {
+	status := "error"
+	if attempt.StatusCode != 0 {
+		status = strconv.Itoa(attempt.StatusCode)
+	}
+	r.retries.WithLabelValues(info.Service, info.Model, status).Inc()
+}
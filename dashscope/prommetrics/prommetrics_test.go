@@ -0,0 +1,93 @@
+package prommetrics_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+	"github.com/ceoifung/go-dashscope/dashscope/dashscopetest"
+	"github.com/ceoifung/go-dashscope/dashscope/prommetrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRecorder(t *testing.T) {
+	srv := dashscopetest.NewServer()
+	defer srv.Close()
+	srv.Enqueue(dashscope.ServiceGeneration,
+		dashscopetest.Fail(http.StatusTooManyRequests, dashscope.ErrCodeThrottling, "slow down"),
+		dashscopetest.Response{Body: map[string]interface{}{
+			"output": map[string]interface{}{"text": "Hi", "finish_reason": "stop"},
+			"usage":  map[string]interface{}{"input_tokens": 3, "output_tokens": 2, "total_tokens": 5},
+		}},
+		dashscopetest.Fail(http.StatusBadRequest, dashscope.ErrCodeInvalidParameter, "bad input"))
+
+	rec := prommetrics.NewRecorder()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(rec)
+
+	policy := dashscope.DefaultRetryPolicy()
+	policy.InitialBackoff, policy.MaxBackoff, policy.RespectRetryAfter = time.Millisecond, time.Millisecond, false
+	c := srv.Client(dashscope.WithMetrics(rec), dashscope.WithRetryPolicy(policy))
+
+	req := dashscope.GenerationRequest{Model: dashscope.QwenTurbo, Input: dashscope.GenerationInput{Prompt: "Hi"}}
+	if _, err := c.Generation().Call(context.Background(), req); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if _, err := c.Generation().Call(context.Background(), req); err == nil {
+		t.Fatal("second Call succeeded, want an error")
+	}
+	if _, err := c.SpeechSynthesizer("cosyvoice-v1").Call(context.Background(), "Hello", nil, nil); err != nil {
+		t.Fatalf("SpeechSynthesizer.Call: %v", err)
+	}
+
+	const want = `
+# HELP dashscope_characters_total Characters billed for speech synthesis.
+# TYPE dashscope_characters_total counter
+dashscope_characters_total{model="cosyvoice-v1",operation="SpeechSynthesizer.Call"} 5
+# HELP dashscope_errors_total Failed operations by error code.
+# TYPE dashscope_errors_total counter
+dashscope_errors_total{code="InvalidParameter",model="qwen-turbo",operation="Generation.Call"} 1
+# HELP dashscope_retries_total Retried HTTP attempts.
+# TYPE dashscope_retries_total counter
+dashscope_retries_total{model="qwen-turbo",service="generation",status="429"} 1
+# HELP dashscope_tokens_total Tokens reported by DashScope, by direction.
+# TYPE dashscope_tokens_total counter
+dashscope_tokens_total{direction="input",model="qwen-turbo",operation="Generation.Call"} 3
+dashscope_tokens_total{direction="output",model="qwen-turbo",operation="Generation.Call"} 2
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want),
+		"dashscope_characters_total", "dashscope_errors_total", "dashscope_retries_total", "dashscope_tokens_total"); err != nil {
+		t.Error(err)
+	}
+
+	// One duration series per result, and one session and first audio frame.
+	histograms := map[string]int{
+		"dashscope_operation_duration_seconds":         2,
+		"dashscope_websocket_session_duration_seconds": 1,
+		"dashscope_time_to_first_token_seconds":        1,
+		"dashscope_images_total":                       0,
+	}
+	for name, want := range histograms {
+		if got := testutil.CollectAndCount(rec, name); got != want {
+			t.Errorf("%s has %d series, want %d", name, got, want)
+		}
+	}
+}
+
+func TestRecorderNamespace(t *testing.T) {
+	rec := prommetrics.NewRecorderWithNamespace("llm")
+	rec.RecordRetry(dashscope.CallInfo{Service: dashscope.ServiceGeneration}, dashscope.RetryAttempt{})
+
+	const want = `
+# HELP llm_retries_total Retried HTTP attempts.
+# TYPE llm_retries_total counter
+llm_retries_total{model="",service="generation",status="error"} 1
+`
+	if err := testutil.CollectAndCompare(rec, strings.NewReader(want), "llm_retries_total"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,230 @@
+package dashscope
+
+import (
+	"context"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// RateLimit is a per-model quota.
+type RateLimit struct {
+	RequestsPerMinute int // Zero means unlimited
+	TokensPerMinute   int // Zero means unlimited
+}
+
+// RateLimiter throttles requests on the client side so that per-model RPM and
+// TPM quotas are not exceeded. Calls block until capacity is available or
+// their context is done.
+//
+// Token usage is charged up front from an estimate of the request and later
+// corrected with the usage reported in the response.
+type RateLimiter struct {
+	mu      sync.Mutex
+	limits  map[string]RateLimit
+	def     *RateLimit
+	buckets map[string]*modelBuckets
+}
+
+type modelBuckets struct {
+	requests *bucket
+	tokens   *bucket
+}
+
+// NewRateLimiter creates a RateLimiter with limits keyed by model name.
+func NewRateLimiter(limits map[string]RateLimit) *RateLimiter {
+	l := &RateLimiter{
+		limits:  make(map[string]RateLimit),
+		buckets: make(map[string]*modelBuckets),
+	}
+	for model, limit := range limits {
+		l.limits[model] = limit
+	}
+	return l
+}
+
+// SetLimit sets the quota for model.
+func (l *RateLimiter) SetLimit(model string, limit RateLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits[model] = limit
+	delete(l.buckets, model)
+}
+
+// SetDefaultLimit sets the quota applied to models without a limit of their own.
+func (l *RateLimiter) SetDefaultLimit(limit RateLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.def = &limit
+	l.buckets = make(map[string]*modelBuckets)
+}
+
+// WithRateLimiter attaches a client-side rate limiter.
+func WithRateLimiter(limiter *RateLimiter) ClientOption {
+	return func(c *Client) {
+		c.limiter = limiter
+	}
+}
+
+// Reservation is capacity taken from a RateLimiter for a single request.
+// A nil Reservation is valid and does nothing.
+type Reservation struct {
+	limiter  *RateLimiter
+	model    string
+	estimate int
+}
+
+// Wait blocks until model has capacity for one request of estimatedTokens
+// tokens, then charges it. Call Done on the returned Reservation with the
+// actual token usage once known.
+func (l *RateLimiter) Wait(ctx context.Context, model string, estimatedTokens int) (*Reservation, error) {
+	for {
+		l.mu.Lock()
+		b := l.bucketsFor(model)
+		if b == nil {
+			l.mu.Unlock()
+			return nil, nil
+		}
+
+		now := time.Now()
+		tokens := float64(estimatedTokens)
+		var wait time.Duration
+		if b.requests != nil {
+			b.requests.refill(now)
+			wait = b.requests.wait(1)
+		}
+		if b.tokens != nil {
+			b.tokens.refill(now)
+			if tokens > b.tokens.capacity {
+				tokens = b.tokens.capacity
+			}
+			if d := b.tokens.wait(tokens); d > wait {
+				wait = d
+			}
+		}
+
+		if wait == 0 {
+			if b.requests != nil {
+				b.requests.level--
+			}
+			if b.tokens != nil {
+				b.tokens.level -= tokens
+			}
+			l.mu.Unlock()
+			return &Reservation{limiter: l, model: model, estimate: int(tokens)}, nil
+		}
+		l.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Done corrects the charged token estimate with the actual usage.
+func (r *Reservation) Done(actualTokens int) {
+	if r == nil {
+		return
+	}
+	l := r.limiter
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b := l.buckets[r.model]
+	if b == nil || b.tokens == nil {
+		return
+	}
+	b.tokens.refill(time.Now())
+	b.tokens.level += float64(r.estimate - actualTokens)
+	if b.tokens.level > b.tokens.capacity {
+		b.tokens.level = b.tokens.capacity
+	}
+}
+
+// bucketsFor returns the buckets for model, or nil if it is unlimited.
+// l.mu must be held.
+func (l *RateLimiter) bucketsFor(model string) *modelBuckets {
+	if b, ok := l.buckets[model]; ok {
+		return b
+	}
+
+	limit, ok := l.limits[model]
+	if !ok {
+		if l.def == nil {
+			return nil
+		}
+		limit = *l.def
+	}
+
+	b := &modelBuckets{}
+	if limit.RequestsPerMinute > 0 {
+		b.requests = newBucket(limit.RequestsPerMinute)
+	}
+	if limit.TokensPerMinute > 0 {
+		b.tokens = newBucket(limit.TokensPerMinute)
+	}
+	if b.requests == nil && b.tokens == nil {
+		b = nil
+	}
+	l.buckets[model] = b
+	return b
+}
+
+// bucket is a token bucket refilled continuously over one minute.
+type bucket struct {
+	rate     float64 // units per second
+	capacity float64
+	level    float64
+	last     time.Time
+}
+
+func newBucket(perMinute int) *bucket {
+	return &bucket{
+		rate:     float64(perMinute) / 60,
+		capacity: float64(perMinute),
+		level:    float64(perMinute),
+		last:     time.Now(),
+	}
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.level += now.Sub(b.last).Seconds() * b.rate
+	if b.level > b.capacity {
+		b.level = b.capacity
+	}
+	b.last = now
+}
+
+func (b *bucket) wait(n float64) time.Duration {
+	if b.level >= n {
+		return 0
+	}
+	return time.Duration((n - b.level) / b.rate * float64(time.Second))
+}
+
+// reserve waits on the client's rate limiter, if any.
+func (c *Client) reserve(ctx context.Context, model string, estimatedTokens int) (*Reservation, error) {
+	if c.limiter == nil {
+		return nil, nil
+	}
+	return c.limiter.Wait(ctx, model, estimatedTokens)
+}
+
+// estimateTokens roughly estimates the token count of text: one token per
+// CJK character and one per four other characters.
+func estimateTokens(text string) int {
+	var cjk, other int
+	for _, r := range text {
+		if unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+			unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r) {
+			cjk++
+		} else {
+			other++
+		}
+	}
+	return cjk + (other+3)/4
+}
@@ -0,0 +1,175 @@
+package dashscope
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBucket(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name      string
+		perMinute int
+		level     float64
+		elapsed   time.Duration
+		n         float64
+		wantLevel float64
+		wantWait  time.Duration
+	}{
+		{"full", 60, 60, 0, 1, 60, 0},
+		{"empty", 60, 0, 0, 1, 0, time.Second},
+		{"refilled", 60, 0, 2 * time.Second, 1, 2, 0},
+		{"refill capped", 60, 59, time.Minute, 1, 60, 0},
+		{"partial", 120, 0.5, 0, 1, 0.5, 250 * time.Millisecond},
+		{"large request", 600, 0, 0, 300, 0, 30 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBucket(tt.perMinute)
+			b.level, b.last = tt.level, start
+			b.refill(start.Add(tt.elapsed))
+			if b.level != tt.wantLevel {
+				t.Errorf("level = %v, want %v", b.level, tt.wantLevel)
+			}
+			if got := b.wait(tt.n); got != tt.wantWait {
+				t.Errorf("wait(%v) = %v, want %v", tt.n, got, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	tests := []struct {
+		name      string
+		limits    map[string]RateLimit
+		def       *RateLimit
+		model     string
+		estimates []int // Requests that must pass immediately
+		blocked   int   // Estimate of a request that must block, or -1
+	}{
+		{
+			name:      "unlimited model",
+			limits:    map[string]RateLimit{QwenMax: {RequestsPerMinute: 1}},
+			model:     QwenTurbo,
+			estimates: []int{10, 10, 10},
+			blocked:   -1,
+		},
+		{
+			name:      "requests per minute",
+			limits:    map[string]RateLimit{QwenTurbo: {RequestsPerMinute: 2}},
+			model:     QwenTurbo,
+			estimates: []int{0, 0},
+			blocked:   0,
+		},
+		{
+			name:      "tokens per minute",
+			limits:    map[string]RateLimit{QwenTurbo: {TokensPerMinute: 1000}},
+			model:     QwenTurbo,
+			estimates: []int{600, 300},
+			blocked:   200,
+		},
+		{
+			name:      "estimate above capacity",
+			limits:    map[string]RateLimit{QwenTurbo: {TokensPerMinute: 100}},
+			model:     QwenTurbo,
+			estimates: []int{5000},
+			blocked:   1,
+		},
+		{
+			name:      "default limit",
+			def:       &RateLimit{RequestsPerMinute: 1},
+			model:     QwenPlus,
+			estimates: []int{0},
+			blocked:   0,
+		},
+		{
+			name:      "zero limit",
+			limits:    map[string]RateLimit{QwenTurbo: {}},
+			model:     QwenTurbo,
+			estimates: []int{100, 100},
+			blocked:   -1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewRateLimiter(tt.limits)
+			if tt.def != nil {
+				l.SetDefaultLimit(*tt.def)
+			}
+			for _, estimate := range tt.estimates {
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+				_, err := l.Wait(ctx, tt.model, estimate)
+				cancel()
+				if err != nil {
+					t.Fatalf("Wait(%d) = %v, want immediate capacity", estimate, err)
+				}
+			}
+			if tt.blocked < 0 {
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			if _, err := l.Wait(ctx, tt.model, tt.blocked); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("Wait(%d) = %v, want it to block until the deadline", tt.blocked, err)
+			}
+		})
+	}
+}
+
+func TestReservationDone(t *testing.T) {
+	tests := []struct {
+		name      string
+		estimate  int
+		actual    int
+		wantLevel float64
+	}{
+		{"overestimated", 800, 200, 800},
+		{"underestimated", 200, 500, 500},
+		{"exact", 300, 300, 700},
+		{"refund capped", 100, 0, 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewRateLimiter(map[string]RateLimit{QwenTurbo: {TokensPerMinute: 1000}})
+			r, err := l.Wait(context.Background(), QwenTurbo, tt.estimate)
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Done(tt.actual)
+
+			// Allow for the refill since the reservation.
+			level := l.buckets[QwenTurbo].tokens.level
+			if level < tt.wantLevel || level > tt.wantLevel+1 {
+				t.Errorf("level = %v, want %v", level, tt.wantLevel)
+			}
+		})
+	}
+
+	var nilReservation *Reservation
+	nilReservation.Done(100)
+}
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"a", 1},
+		{"abcd", 1},
+		{"abcde", 2},
+		{"你好", 2},
+		{"你好 world", 2 + 2},
+		{"こんにちは", 5},
+		{"안녕", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := estimateTokens(tt.text); got != tt.want {
+				t.Errorf("estimateTokens(%q) = %d, want %d", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -4,8 +4,6 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
-	"net/http"
 	"strings"
 	"sync"
 	"time"
@@ -37,22 +35,28 @@ type Recognition struct {
 	Format     string
 	SampleRate int
 	Workspace  string
-	conn       *websocket.Conn
+	conn       *wsConn
 	callback   RecognitionCallback
 	mu         sync.Mutex
 	running    bool
 	taskID     string
 	wg         sync.WaitGroup
+	c          *Client
+	op         *operation
 }
 
 // NewRecognition creates a new recognition client.
 func NewRecognition(model, apiKey, format string, sampleRate int) *Recognition {
-	return &Recognition{
-		Model:      model,
-		APIKey:     apiKey,
-		Format:     format,
-		SampleRate: sampleRate,
+	return NewClient(WithAPIKey(apiKey)).Recognition(model, format, sampleRate)
+}
+
+// client returns the Client of r, or the default client if r was built as a
+// struct literal.
+func (r *Recognition) client() *Client {
+	if r.c == nil {
+		return defaultClient()
 	}
+	return r.c
 }
 
 // Start starts the recognition session.
@@ -65,18 +69,17 @@ func (r *Recognition) Start(ctx context.Context, callback RecognitionCallback, p
 	// Generate Task ID
 	r.taskID = strings.ReplaceAll(uuid.New().String(), "-", "")
 
-	// WebSocket URL
-	url := BaseWebsocketURL
-
-	header := http.Header{}
-	header.Set("Authorization", "Bearer "+r.APIKey)
-	if r.Workspace != "" {
-		header.Set("X-DashScope-Workspace", r.Workspace)
+	info := CallInfo{
+		Service: ServiceRecognition,
+		Model:   r.Model,
+		TaskID:  r.taskID,
 	}
+	c := r.client()
+	ctx, r.op = c.startOperation(ctx, "Recognition", info)
 
-	dialer := websocket.DefaultDialer
-	conn, _, err := dialer.DialContext(ctx, url, header)
+	conn, err := c.dialSession(ctx, info, r.APIKey, r.Workspace)
 	if err != nil {
+		r.op.end(err)
 		return err
 	}
 	r.conn = conn
@@ -92,7 +95,7 @@ func (r *Recognition) Start(ctx context.Context, callback RecognitionCallback, p
 
 	reqPayload := map[string]interface{}{
 		"header": map[string]interface{}{
-			"action":    "run-task",
+			"action":    string(ActionRunTask),
 			"task_id":   r.taskID,
 			"streaming": "duplex",
 		},
@@ -106,9 +109,10 @@ func (r *Recognition) Start(ctx context.Context, callback RecognitionCallback, p
 		},
 	}
 
-	if err := conn.WriteJSON(reqPayload); err != nil {
-		conn.Close()
+	if err := conn.writeJSON(string(ActionRunTask), reqPayload); err != nil {
+		conn.close()
 		r.running = false
+		r.op.end(err)
 		return err
 	}
 
@@ -132,7 +136,7 @@ func (r *Recognition) Stop() {
 	// Send finish-task message
 	finishPayload := map[string]interface{}{
 		"header": map[string]interface{}{
-			"action":    "finish-task",
+			"action":    string(ActionFinishTask),
 			"task_id":   r.taskID,
 			"streaming": "duplex",
 		},
@@ -140,7 +144,7 @@ func (r *Recognition) Stop() {
 			"input": map[string]interface{}{},
 		},
 	}
-	r.conn.WriteJSON(finishPayload)
+	r.conn.writeJSON(string(ActionFinishTask), finishPayload)
 	r.mu.Unlock()
 
 	// Wait for readLoop to finish (which happens on task-finished or error)
@@ -158,7 +162,7 @@ func (r *Recognition) Stop() {
 		// Timeout, force close
 		r.mu.Lock()
 		if r.conn != nil {
-			r.conn.Close()
+			r.conn.close()
 		}
 		r.mu.Unlock()
 	}
@@ -175,11 +179,13 @@ func (r *Recognition) SendAudioFrame(data []byte) error {
 	if !r.running {
 		return errors.New("recognition not running")
 	}
-	return r.conn.WriteMessage(websocket.BinaryMessage, data)
+	return r.conn.writeBinary(data)
 }
 
 func (r *Recognition) readLoop() {
+	var sessionErr error
 	defer r.wg.Done()
+	defer func() { r.op.end(sessionErr) }()
 	defer func() {
 		if r.callback != nil {
 			r.callback.OnClose()
@@ -187,11 +193,12 @@ func (r *Recognition) readLoop() {
 	}()
 
 	for {
-		messageType, message, err := r.conn.ReadMessage()
+		messageType, message, err := r.conn.read()
 		if err != nil {
-			if r.running && r.callback != nil {
-				// Only report error if we didn't intentionally close
-				if !strings.Contains(err.Error(), "use of closed network connection") {
+			// Only report error if we didn't intentionally close
+			if r.running && !strings.Contains(err.Error(), "use of closed network connection") {
+				sessionErr = err
+				if r.callback != nil {
 					r.callback.OnError(err)
 				}
 			}
@@ -214,8 +221,15 @@ func (r *Recognition) readLoop() {
 
 			event := header["event"].(string)
 			if event == "task-failed" {
+				code, _ := header["error_code"].(string)
+				message, _ := header["error_message"].(string)
+				sessionErr = &APIError{
+					Code:    code,
+					Message: message,
+					TaskID:  r.taskID,
+				}
 				if r.callback != nil {
-					r.callback.OnError(fmt.Errorf("task failed: %v", header["error_message"]))
+					r.callback.OnError(sessionErr)
 				}
 				return // Stop on failure
 			} else if event == "task-finished" {
@@ -228,6 +242,7 @@ func (r *Recognition) readLoop() {
 			} else if event == "result-generated" {
 				payload, ok := resp["payload"].(map[string]interface{})
 				if ok {
+					r.op.markFirstToken()
 					result := &RecognitionResult{
 						Response: resp,
 					}
@@ -1,12 +1,8 @@
 package dashscope
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
 	"net/http"
-	"os"
 )
 
 // ReRank Models
@@ -18,17 +14,12 @@ const (
 type TextReRank struct {
 	APIKey string
 	client *http.Client
+	c      *Client
 }
 
 // NewTextReRank creates a new TextReRank client.
 func NewTextReRank(apiKey string) *TextReRank {
-	if apiKey == "" {
-		apiKey = os.Getenv("DASHSCOPE_API_KEY")
-	}
-	return &TextReRank{
-		APIKey: apiKey,
-		client: &http.Client{},
-	}
+	return NewClient(WithAPIKey(apiKey)).TextReRank()
 }
 
 // SetHTTPClient sets a custom HTTP client.
@@ -73,35 +64,38 @@ type ReRankUsage struct {
 }
 
 // Call performs the text rerank request.
-func (r *TextReRank) Call(ctx context.Context, req TextReRankRequest) (*TextReRankResponse, error) {
-	url := TextReRankURL
+func (r *TextReRank) Call(ctx context.Context, req TextReRankRequest) (_ *TextReRankResponse, err error) {
+	url := r.c.url(TextReRankPath)
 
-	jsonData, err := json.Marshal(req)
-	if err != nil {
+	info := CallInfo{Service: ServiceTextReRank, Model: req.Model}
+	ctx, op := r.c.startOperation(ctx, "TextReRank.Call", info)
+	defer func() { op.end(err) }()
+
+	ctx, cancel := r.c.withTimeout(ctx)
+	defer cancel()
+
+	count := op.counter(ctx)
+	if err := op.reserve(ctx, count(req.Input.Query)+estimateTextsTokens(req.Input.Documents, count)); err != nil {
 		return nil, err
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	httpReq, err := r.c.newRequest(ctx, "POST", url, req, r.APIKey, "")
 	if err != nil {
 		return nil, err
 	}
 
-	httpReq.Header.Set("Authorization", "Bearer "+r.APIKey)
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	resp, err := r.client.Do(httpReq)
+	resp, err := r.c.do(r.client, httpReq, info)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	var rrResp TextReRankResponse
-	if err := json.NewDecoder(resp.Body).Decode(&rrResp); err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return &rrResp, fmt.Errorf("text rerank failed: %s (%s)", rrResp.Message, rrResp.RequestID)
+	err = decodeResponse(resp, &rrResp)
+	op.setRequestID(rrResp.RequestID)
+	op.setUsage(rrResp.Usage.TotalTokens, 0)
+	if err != nil {
+		return &rrResp, err
 	}
 
 	return &rrResp, nil
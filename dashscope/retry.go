@@ -0,0 +1,254 @@
+package dashscope
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RetryPolicy configures automatic retries of transient failures.
+//
+// Non-streaming calls are retried on connection errors and on responses whose
+// status or DashScope error code is retryable. Streaming calls are retried
+// under the same rules, but only until the server accepts the stream; once
+// bytes have been delivered to the caller no retry is attempted.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	// Values below 2 disable retries.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts.
+	MaxBackoff time.Duration
+	// Multiplier grows the delay after each attempt.
+	Multiplier float64
+	// Jitter randomly shortens each delay by up to this fraction (0 to 1).
+	Jitter float64
+
+	// RetryableStatusCodes lists HTTP statuses that are retried.
+	RetryableStatusCodes []int
+	// RetryableCodes lists DashScope error codes that are retried regardless
+	// of status. Sub-codes match, so "Throttling" covers "Throttling.RateQuota".
+	RetryableCodes []string
+
+	// RespectRetryAfter uses the server's Retry-After header as the delay
+	// when present, capped at MaxBackoff.
+	RespectRetryAfter bool
+
+	// OnRetry, if set, is called before waiting for each retry.
+	OnRetry func(RetryAttempt)
+}
+
+// RetryAttempt describes a failed attempt that is about to be retried.
+type RetryAttempt struct {
+	Attempt    int           // Attempt that failed, starting at 1
+	StatusCode int           // HTTP status, zero for connection errors
+	Err        error         // *APIError or transport error
+	Backoff    time.Duration // Delay before the next attempt
+	Method     string
+	URL        string
+}
+
+// DefaultRetryPolicy returns a policy retrying throttling, 5xx responses and
+// connection errors up to three times with exponential backoff.
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    4,
+		InitialBackoff: 500 * time.Millisecond,
+		MaxBackoff:     8 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+		RetryableStatusCodes: []int{
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+		RetryableCodes:    []string{ErrCodeThrottling, ErrCodeInternalError},
+		RespectRetryAfter: true,
+	}
+}
+
+// WithRetryPolicy enables automatic retries. A nil policy disables them.
+func WithRetryPolicy(policy *RetryPolicy) ClientOption {
+	return func(c *Client) {
+		c.retry = policy
+	}
+}
+
+func (p *RetryPolicy) retryableStatus(apiErr *APIError) bool {
+	for _, code := range p.RetryableStatusCodes {
+		if apiErr.StatusCode == code {
+			return true
+		}
+	}
+	for _, code := range p.RetryableCodes {
+		if apiErr.hasCode(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the delay after the given failed attempt.
+func (p *RetryPolicy) backoff(attempt int, header http.Header) time.Duration {
+	if p.RespectRetryAfter && header != nil {
+		if d, ok := parseRetryAfter(header.Get("Retry-After")); ok {
+			if p.MaxBackoff > 0 && d > p.MaxBackoff {
+				d = p.MaxBackoff
+			}
+			return d
+		}
+	}
+
+	mult := p.Multiplier
+	if mult < 1 {
+		mult = 1
+	}
+	d := float64(p.InitialBackoff) * math.Pow(mult, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d -= d * math.Min(p.Jitter, 1) * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+func parseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
+
+// retryableError reports whether a transport error is worth retrying:
+// timeouts, reset or refused connections and truncated responses. Other
+// errors, such as DNS or TLS failures, would fail again.
+func retryableError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// do sends req with client through the middleware chain, retrying according
+// to the client's retry policy. The returned response has an unread body;
+// non-200 responses that are not retried are returned as-is for the caller
+// to decode.
+func (c *Client) do(client *http.Client, req *http.Request, info CallInfo) (*http.Response, error) {
+	send := c.httpHandler(client, info)
+	policy := c.retry
+	if policy == nil || policy.MaxAttempts < 2 || (req.Body != nil && req.GetBody == nil) {
+		return send(req)
+	}
+
+	ctx := req.Context()
+	for attempt := 1; ; attempt++ {
+		r := req
+		if attempt > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = req.Clone(ctx)
+			r.Body = body
+		}
+
+		resp, err := send(r)
+
+		var header http.Header
+		var body []byte
+		statusCode := 0
+		if err != nil {
+			if attempt >= policy.MaxAttempts || !retryableError(err) {
+				return nil, err
+			}
+		} else {
+			if resp.StatusCode == http.StatusOK || attempt >= policy.MaxAttempts {
+				return resp, nil
+			}
+			var readErr error
+			body, readErr = io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if readErr != nil {
+				return nil, readErr
+			}
+			apiErr := newAPIError(resp.StatusCode, resp.Header, body)
+			if !policy.retryableStatus(apiErr) {
+				resp.Body = io.NopCloser(bytes.NewReader(body))
+				return resp, nil
+			}
+			err = apiErr
+			header = resp.Header
+			statusCode = resp.StatusCode
+		}
+
+		backoff := policy.backoff(attempt, header)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+			// The next attempt could not start in time; report this one.
+			if resp != nil {
+				resp.Body = io.NopCloser(bytes.NewReader(body))
+				return resp, nil
+			}
+			return nil, err
+		}
+		trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+			attribute.Int("attempt", attempt),
+			attribute.String("error", err.Error()),
+			attribute.Float64("backoff", backoff.Seconds()),
+		))
+		retry := RetryAttempt{
+			Attempt:    attempt,
+			StatusCode: statusCode,
+			Err:        err,
+			Backoff:    backoff,
+			Method:     req.Method,
+			URL:        req.URL.String(),
+		}
+		c.logRetry(ctx, info, retry)
+		if c.metrics != nil {
+			c.metrics.RecordRetry(info, retry)
+		}
+		if policy.OnRetry != nil {
+			policy.OnRetry(retry)
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
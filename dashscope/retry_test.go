@@ -0,0 +1,213 @@
+package dashscope
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := &RetryPolicy{
+		InitialBackoff:    500 * time.Millisecond,
+		MaxBackoff:        8 * time.Second,
+		Multiplier:        2,
+		RespectRetryAfter: true,
+	}
+	ignoreRetryAfter := *policy
+	ignoreRetryAfter.RespectRetryAfter = false
+	noMultiplier := *policy
+	noMultiplier.Multiplier = 0
+
+	tests := []struct {
+		name       string
+		policy     *RetryPolicy
+		attempt    int
+		retryAfter string
+		want       time.Duration
+	}{
+		{"first attempt", policy, 1, "", 500 * time.Millisecond},
+		{"third attempt", policy, 3, "", 2 * time.Second},
+		{"capped", policy, 10, "", 8 * time.Second},
+		{"multiplier below one", &noMultiplier, 4, "", 500 * time.Millisecond},
+		{"retry after seconds", policy, 1, "3", 3 * time.Second},
+		{"retry after zero", policy, 2, "0", 0},
+		{"retry after capped", policy, 1, "120", 8 * time.Second},
+		{"retry after invalid", policy, 2, "soon", time.Second},
+		{"retry after ignored", &ignoreRetryAfter, 1, "3", 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.retryAfter != "" {
+				header.Set("Retry-After", tt.retryAfter)
+			}
+			if got := tt.policy.backoff(tt.attempt, header); got != tt.want {
+				t.Errorf("backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoffJitter(t *testing.T) {
+	tests := []struct {
+		jitter float64
+		min    time.Duration
+	}{
+		{0.2, 800 * time.Millisecond},
+		{1, 0},
+		{5, 0}, // Clamped to 1
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.jitter), func(t *testing.T) {
+			policy := &RetryPolicy{InitialBackoff: time.Second, Multiplier: 2, Jitter: tt.jitter}
+			for i := 0; i < 100; i++ {
+				if got := policy.backoff(1, nil); got < tt.min || got > time.Second {
+					t.Fatalf("backoff = %v, want between %v and %v", got, tt.min, time.Second)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"", 0, false},
+		{"5", 5 * time.Second, true},
+		{"-1", 0, false},
+		{"abc", 0, false},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := parseRetryAfter(tt.value)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	future := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if d, ok := parseRetryAfter(future); !ok || d <= 0 || d > time.Minute {
+		t.Errorf("parseRetryAfter(%q) = %v, %v, want up to a minute", future, d, ok)
+	}
+}
+
+// timeoutError is a net.Error reporting a timeout.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestRetryableError(t *testing.T) {
+	urlErr := func(err error) error {
+		return &url.Error{Op: "Post", URL: "https://dashscope.aliyuncs.com", Err: err}
+	}
+	opErr := func(err error) error {
+		return &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", err)}
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"connection reset", urlErr(opErr(syscall.ECONNRESET)), true},
+		{"connection refused", urlErr(opErr(syscall.ECONNREFUSED)), true},
+		{"unexpected eof", urlErr(io.ErrUnexpectedEOF), true},
+		{"timeout", urlErr(timeoutError{}), true},
+		{"dns failure", urlErr(&net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}), false},
+		{"unsupported scheme", urlErr(errors.New("unsupported protocol scheme")), false},
+		{"eof", urlErr(io.EOF), false},
+		{"canceled", urlErr(context.Canceled), false},
+		{"deadline exceeded", urlErr(context.DeadlineExceeded), false},
+		{"plain error", errors.New("boom"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryableError(tt.err); got != tt.want {
+				t.Errorf("retryableError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyRetryableStatus(t *testing.T) {
+	policy := DefaultRetryPolicy()
+	tests := []struct {
+		name string
+		err  *APIError
+		want bool
+	}{
+		{"too many requests", &APIError{StatusCode: 429}, true},
+		{"internal server error", &APIError{StatusCode: 500}, true},
+		{"gateway timeout", &APIError{StatusCode: 504}, true},
+		{"bad request", &APIError{StatusCode: 400, Code: ErrCodeInvalidParameter}, false},
+		{"unauthorized", &APIError{StatusCode: 401, Code: ErrCodeInvalidAPIKey}, false},
+		{"throttling sub-code", &APIError{StatusCode: 400, Code: "Throttling.RateQuota"}, true},
+		{"internal error code", &APIError{StatusCode: 400, Code: ErrCodeInternalError}, true},
+		{"code prefix only", &APIError{StatusCode: 400, Code: "ThrottlingX"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.retryableStatus(tt.err); got != tt.want {
+				t.Errorf("retryableStatus(%+v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDoRetryAfterBeyondDeadline(t *testing.T) {
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("Retry-After", "30")
+		w.WriteHeader(http.StatusTooManyRequests)
+		io.WriteString(w, `{"code":"Throttling","message":"slow down"}`)
+	}))
+	defer srv.Close()
+
+	c := NewClient(WithAPIKey("sk-test"), WithRetryPolicy(&RetryPolicy{
+		MaxAttempts:          4,
+		InitialBackoff:       time.Millisecond,
+		RetryableStatusCodes: []int{http.StatusTooManyRequests},
+		RespectRetryAfter:    true,
+	}))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, err := c.newRequest(ctx, "GET", srv.URL, nil, "sk-test", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	resp, err := c.do(c.httpClient, req, CallInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("do waited %v for a retry past the deadline", elapsed)
+	}
+	if attempts != 1 {
+		t.Errorf("attempts = %d, want 1", attempts)
+	}
+	var out struct{}
+	var apiErr *APIError
+	if err := decodeResponse(resp, &out); !errors.As(err, &apiErr) || apiErr.Code != ErrCodeThrottling {
+		t.Errorf("decodeResponse error = %v, want the throttling error", err)
+	}
+}
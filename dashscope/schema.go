@@ -0,0 +1,267 @@
+package dashscope
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON schema, as used for tool parameters and structured
+// output.
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"` // false or a *Schema
+}
+
+// SchemaFor derives the JSON schema of T. See SchemaOf.
+func SchemaFor[T any]() *Schema {
+	return SchemaOf(reflect.TypeOf((*T)(nil)).Elem())
+}
+
+// SchemaOf derives the JSON schema of values of type t, following the
+// encoding/json field names. Struct fields are required unless they are
+// pointers or tagged omitempty, and may be documented with the tags
+// `description:"..."` and `enum:"a,b,c"`. Enum values are parsed according
+// to the field's kind; SchemaOf panics if they cannot be, or if the field is
+// not a string, number or boolean.
+func SchemaOf(t reflect.Type) *Schema {
+	return schemaOf(t, map[reflect.Type]bool{})
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	rawJSONType   = reflect.TypeOf(json.RawMessage(nil))
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+func schemaOf(t reflect.Type, seen map[reflect.Type]bool) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawJSONType, t.Implements(marshalerType), reflect.PointerTo(t).Implements(marshalerType):
+		// Custom-encoded types are left open.
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string"} // base64
+		}
+		return &Schema{Type: "array", Items: schemaOf(t.Elem(), seen)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaOf(t.Elem(), seen)}
+	case reflect.Struct:
+		if seen[t] {
+			// Recursive types are left open.
+			return &Schema{Type: "object"}
+		}
+		seen[t] = true
+		defer delete(seen, t)
+		s := &Schema{
+			Type:                 "object",
+			Properties:           map[string]*Schema{},
+			AdditionalProperties: false,
+		}
+		addFields(s, t, seen)
+		return s
+	}
+	// Interfaces and other kinds accept any value.
+	return &Schema{}
+}
+
+func addFields(s *Schema, t reflect.Type, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				addFields(s, ft, seen)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		prop := schemaOf(f.Type, seen)
+		if desc := f.Tag.Get("description"); desc != "" {
+			prop.Description = desc
+		}
+		if enum := f.Tag.Get("enum"); enum != "" {
+			prop.Enum = enumValues(f, enum)
+		}
+		s.Properties[name] = prop
+		if f.Type.Kind() != reflect.Pointer && !strings.Contains(","+opts+",", ",omitempty,") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// enumValues parses the enum tag of field f.
+func enumValues(f reflect.StructField, tag string) []interface{} {
+	t := f.Type
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var values []interface{}
+	for _, s := range strings.Split(tag, ",") {
+		var v interface{}
+		var err error
+		switch t.Kind() {
+		case reflect.String:
+			v = s
+		case reflect.Bool:
+			v, err = strconv.ParseBool(s)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			v, err = strconv.ParseInt(s, 10, t.Bits())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			v, err = strconv.ParseUint(s, 10, t.Bits())
+		case reflect.Float32, reflect.Float64:
+			v, err = strconv.ParseFloat(s, t.Bits())
+		default:
+			panic(fmt.Sprintf("dashscope: enum tag on field %s of kind %s", f.Name, t.Kind()))
+		}
+		if err != nil {
+			panic(fmt.Sprintf("dashscope: invalid enum value %q for field %s: %v", s, f.Name, err))
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// enumContains reports whether v, a value decoded from JSON, is one of enum.
+func enumContains(enum []interface{}, v interface{}) bool {
+	for _, e := range enum {
+		switch e := e.(type) {
+		case int64:
+			if n, ok := v.(float64); ok && n == float64(e) {
+				return true
+			}
+		case uint64:
+			if n, ok := v.(float64); ok && n == float64(e) {
+				return true
+			}
+		default:
+			if v == e {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Validate reports whether v, a value decoded from JSON into interface{},
+// conforms to the schema. Null is accepted for optional properties.
+func (s *Schema) Validate(v interface{}) error {
+	return s.validate("$", v)
+}
+
+func (s *Schema) validate(path string, v interface{}) error {
+	if len(s.Enum) > 0 && !enumContains(s.Enum, v) {
+		data, _ := json.Marshal(s.Enum)
+		return fmt.Errorf("%s: must be one of %s", path, data)
+	}
+
+	switch s.Type {
+	case "":
+		return nil
+	case "string":
+		if _, ok := v.(string); !ok {
+			return fmt.Errorf("%s: expected a string", path)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: expected a boolean", path)
+		}
+	case "number", "integer":
+		n, ok := v.(float64)
+		if !ok {
+			return fmt.Errorf("%s: expected a %s", path, s.Type)
+		}
+		if s.Type == "integer" && n != math.Trunc(n) {
+			return fmt.Errorf("%s: expected an integer", path)
+		}
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an array", path)
+		}
+		if s.Items != nil {
+			for i, item := range items {
+				if err := s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item); err != nil {
+					return err
+				}
+			}
+		}
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an object", path)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+		for _, name := range slices.Sorted(maps.Keys(obj)) {
+			value := obj[name]
+			prop, ok := s.Properties[name]
+			if !ok {
+				switch extra := s.AdditionalProperties.(type) {
+				case bool:
+					if !extra {
+						return fmt.Errorf("%s: unexpected property %q", path, name)
+					}
+					continue
+				case *Schema:
+					prop = extra
+				default:
+					continue
+				}
+			}
+			if value == nil && !slices.Contains(s.Required, name) {
+				continue
+			}
+			if err := prop.validate(path+"."+name, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package dashscope
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type schemaColor int
+
+func (c schemaColor) MarshalJSON() ([]byte, error) { return json.Marshal(int(c)) }
+
+type schemaPoint struct{ X, Y int }
+
+func (p *schemaPoint) MarshalJSON() ([]byte, error) { return json.Marshal([]int{p.X, p.Y}) }
+
+type schemaNode struct {
+	Value    string        `json:"value"`
+	Children []*schemaNode `json:"children,omitempty"`
+}
+
+type schemaBase struct {
+	ID string `json:"id"`
+}
+
+type schemaArgs struct {
+	schemaBase
+	City     string            `json:"city" description:"City name"`
+	Unit     string            `json:"unit,omitempty" enum:"celsius,fahrenheit"`
+	Days     int               `json:"days" enum:"1,3,7"`
+	Ratio    *float64          `json:"ratio" enum:"0.5,1.5"`
+	Strict   bool              `json:"strict" enum:"true"`
+	Tags     []string          `json:"tags,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	At       time.Time         `json:"at,omitempty"`
+	Raw      json.RawMessage   `json:"raw,omitempty"`
+	Data     []byte            `json:"data,omitempty"`
+	Point    schemaPoint       `json:"point,omitempty"`
+	Tree     *schemaNode       `json:"tree,omitempty"`
+	Any      interface{}       `json:"any,omitempty"`
+	Skipped  string            `json:"-"`
+	internal string
+}
+
+func TestSchemaOf(t *testing.T) {
+	s := SchemaFor[schemaArgs]()
+
+	if want := []string{"id", "city", "days", "strict"}; !reflect.DeepEqual(s.Required, want) {
+		t.Errorf("required = %q, want %q", s.Required, want)
+	}
+	for _, name := range []string{"Skipped", "-", "internal", "schemaBase"} {
+		if _, ok := s.Properties[name]; ok {
+			t.Errorf("property %q present", name)
+		}
+	}
+
+	tests := []struct {
+		property string
+		want     *Schema
+	}{
+		{"id", &Schema{Type: "string"}},
+		{"city", &Schema{Type: "string", Description: "City name"}},
+		{"unit", &Schema{Type: "string", Enum: []interface{}{"celsius", "fahrenheit"}}},
+		{"days", &Schema{Type: "integer", Enum: []interface{}{int64(1), int64(3), int64(7)}}},
+		{"ratio", &Schema{Type: "number", Enum: []interface{}{0.5, 1.5}}},
+		{"strict", &Schema{Type: "boolean", Enum: []interface{}{true}}},
+		{"tags", &Schema{Type: "array", Items: &Schema{Type: "string"}}},
+		{"labels", &Schema{Type: "object", AdditionalProperties: &Schema{Type: "string"}}},
+		{"at", &Schema{Type: "string", Format: "date-time"}},
+		{"raw", &Schema{}},
+		{"data", &Schema{Type: "string"}},
+		{"point", &Schema{}},
+		{"any", &Schema{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.property, func(t *testing.T) {
+			if got := s.Properties[tt.property]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("schema = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	tree := s.Properties["tree"]
+	if children := tree.Properties["children"]; children == nil || !reflect.DeepEqual(children.Items, &Schema{Type: "object"}) {
+		t.Errorf("recursive children = %+v, want an open object", children)
+	}
+}
+
+func TestSchemaOfMarshaler(t *testing.T) {
+	type wrapper struct {
+		Color schemaColor `json:"color"`
+	}
+	if got := SchemaFor[wrapper]().Properties["color"]; !reflect.DeepEqual(got, &Schema{}) {
+		t.Errorf("schema of a type with MarshalJSON = %+v, want an open schema", got)
+	}
+	if got := SchemaFor[schemaPoint](); !reflect.DeepEqual(got, &Schema{}) {
+		t.Errorf("schema of a type with a pointer MarshalJSON = %+v, want an open schema", got)
+	}
+}
+
+func TestSchemaOfInvalidEnum(t *testing.T) {
+	tests := []struct {
+		name string
+		typ  reflect.Type
+	}{
+		{"unparsable value", reflect.TypeOf(struct {
+			N int `json:"n" enum:"1,two"`
+		}{})},
+		{"out of range", reflect.TypeOf(struct {
+			N int8 `json:"n" enum:"1000"`
+		}{})},
+		{"unsupported kind", reflect.TypeOf(struct {
+			Tags []string `json:"tags" enum:"a,b"`
+		}{})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("SchemaOf did not panic")
+				}
+			}()
+			SchemaOf(tt.typ)
+		})
+	}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	s := SchemaFor[schemaArgs]()
+	valid := `{"id":"1","city":"Hangzhou","days":3,"ratio":null,"strict":true}`
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string // Substring of the error, empty for success
+	}{
+		{"valid", valid, ""},
+		{"all fields", `{"id":"1","city":"Hangzhou","unit":"celsius","days":7,"ratio":1.5,"strict":true,
+			"tags":["a"],"labels":{"k":"v"},"at":"2024-01-01T00:00:00Z","raw":[1],"point":[1,2],
+			"tree":{"value":"a","children":[{"value":"b"}]},"any":{"x":1}}`, ""},
+		{"missing required", `{"id":"1","days":3,"strict":true}`, `$: missing required property "city"`},
+		{"unexpected property", strings.Replace(valid, `"id"`, `"extra":1,"id"`, 1), `$: unexpected property "extra"`},
+		{"wrong type", strings.Replace(valid, `"Hangzhou"`, `42`, 1), "$.city: expected a string"},
+		{"string enum", strings.Replace(valid, `"id"`, `"unit":"kelvin","id"`, 1), `$.unit: must be one of ["celsius","fahrenheit"]`},
+		{"integer enum", strings.Replace(valid, `"days":3`, `"days":2`, 1), "$.days: must be one of [1,3,7]"},
+		{"integer enum as string", strings.Replace(valid, `"days":3`, `"days":"3"`, 1), "$.days: must be one of"},
+		{"number enum", strings.Replace(valid, `null`, `1`, 1), "$.ratio: must be one of [0.5,1.5]"},
+		{"boolean enum", strings.Replace(valid, `true`, `false`, 1), "$.strict: must be one of [true]"},
+		{"array items", strings.Replace(valid, `"id"`, `"tags":["a",1],"id"`, 1), "$.tags[1]: expected a string"},
+		{"nested object", strings.Replace(valid, `"id"`, `"tree":{"value":1},"id"`, 1), "$.tree.value: expected a string"},
+		{"map values", strings.Replace(valid, `"id"`, `"labels":{"k":1},"id"`, 1), "$.labels.k: expected a string"},
+		{"not an object", `[]`, "$: expected an object"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v interface{}
+			if err := json.Unmarshal([]byte(tt.input), &v); err != nil {
+				t.Fatal(err)
+			}
+			err := s.Validate(v)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
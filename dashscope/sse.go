@@ -0,0 +1,147 @@
+package dashscope
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SSEEvent is a server-sent event.
+type SSEEvent struct {
+	// ID is the last event ID seen on the stream. DashScope numbers its
+	// events from 1.
+	ID string
+	// Event is the event name, "message" if the server sent none. DashScope
+	// sends "result" for chunks and "error" for failures.
+	Event string
+	// Data holds the data lines of the event joined by newlines.
+	Data string
+	// Retry is the reconnection delay requested by the server, if any.
+	Retry time.Duration
+	// StatusCode is the status DashScope reports per event in its
+	// ":HTTP_STATUS/<code>" comment, zero if absent.
+	StatusCode int
+}
+
+// SSEReader reads server-sent events following the WHATWG specification.
+// Lines may end in "\n", "\r\n" or "\r" and have no length limit.
+type SSEReader struct {
+	r      *bufio.Reader
+	lastID string
+	peeked bool // A "\r" ended the previous line and a "\n" may follow
+}
+
+// NewSSEReader returns a reader decoding events from r.
+func NewSSEReader(r io.Reader) *SSEReader {
+	return &SSEReader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next event, or io.EOF once the stream ends. As the
+// specification requires, an event cut off by the end of the stream before
+// its terminating blank line is discarded.
+func (s *SSEReader) Next() (*SSEEvent, error) {
+	var (
+		data    strings.Builder
+		hasData bool
+		ev      = SSEEvent{}
+	)
+
+	for {
+		line, err := s.readLine()
+		if err != nil {
+			// A final line without terminator is incomplete too.
+			return nil, err
+		}
+
+		if line == "" {
+			if hasData {
+				return s.dispatch(&ev, &data), nil
+			}
+			// Events without data are not dispatched.
+			ev = SSEEvent{}
+			continue
+		}
+
+		if strings.HasPrefix(line, ":") {
+			comment := strings.TrimSpace(line[1:])
+			if code, ok := strings.CutPrefix(comment, "HTTP_STATUS/"); ok {
+				ev.StatusCode, _ = strconv.Atoi(code)
+			}
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+			hasData = true
+		case "event":
+			ev.Event = value
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				s.lastID = value
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				ev.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
+
+func (s *SSEReader) dispatch(ev *SSEEvent, data *strings.Builder) *SSEEvent {
+	ev.ID = s.lastID
+	if ev.Event == "" {
+		ev.Event = "message"
+	}
+	ev.Data = strings.TrimSuffix(data.String(), "\n")
+	return ev
+}
+
+// readLine reads a line without its terminator.
+func (s *SSEReader) readLine() (string, error) {
+	var b strings.Builder
+	for {
+		c, err := s.r.ReadByte()
+		if err != nil {
+			return b.String(), err
+		}
+		if s.peeked {
+			s.peeked = false
+			if c == '\n' {
+				continue
+			}
+		}
+		switch c {
+		case '\n':
+			return b.String(), nil
+		case '\r':
+			s.peeked = true
+			return b.String(), nil
+		}
+		b.WriteByte(c)
+	}
+}
+
+// decodeEvent decodes a DashScope stream event into out. Error events, and
+// the error objects of compatible-mode streams, are returned as *APIError,
+// the [DONE] sentinel ending compatible-mode streams as io.EOF and
+// undecodable chunks as errors.
+func decodeEvent(ev *SSEEvent, out interface{}) error {
+	if ev.Event == "error" || strings.HasPrefix(ev.Data, `{"error":`) {
+		return newAPIError(ev.StatusCode, nil, []byte(ev.Data))
+	}
+	if ev.Data == "[DONE]" {
+		return io.EOF
+	}
+	if err := json.Unmarshal([]byte(ev.Data), out); err != nil {
+		return fmt.Errorf("dashscope: malformed stream event %s: %w", ev.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package dashscope
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSSEReader(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []SSEEvent
+	}{
+		{
+			name:  "dashscope chunk",
+			input: "id:1\nevent:result\n:HTTP_STATUS/200\ndata:{\"output\":{}}\n\n",
+			want:  []SSEEvent{{ID: "1", Event: "result", Data: `{"output":{}}`, StatusCode: 200}},
+		},
+		{
+			name:  "default event name",
+			input: "data: hello\n\n",
+			want:  []SSEEvent{{Event: "message", Data: "hello"}},
+		},
+		{
+			name:  "multi-line data",
+			input: "data: first\ndata:second\ndata\n\n",
+			want:  []SSEEvent{{Event: "message", Data: "first\nsecond\n"}},
+		},
+		{
+			name:  "only one leading space is stripped",
+			input: "data:  indented\n\n",
+			want:  []SSEEvent{{Event: "message", Data: " indented"}},
+		},
+		{
+			name:  "crlf and cr line endings",
+			input: "event: a\r\ndata: 1\r\n\r\nevent: b\rdata: 2\r\r",
+			want:  []SSEEvent{{Event: "a", Data: "1"}, {Event: "b", Data: "2"}},
+		},
+		{
+			name:  "id persists across events",
+			input: "id: 7\ndata: a\n\ndata: b\n\nid\ndata: c\n\n",
+			want:  []SSEEvent{{ID: "7", Event: "message", Data: "a"}, {ID: "7", Event: "message", Data: "b"}, {Event: "message", Data: "c"}},
+		},
+		{
+			name:  "id with null is ignored",
+			input: "id: 1\ndata: a\n\nid: 2\x00\ndata: b\n\n",
+			want:  []SSEEvent{{ID: "1", Event: "message", Data: "a"}, {ID: "1", Event: "message", Data: "b"}},
+		},
+		{
+			name:  "retry",
+			input: "retry: 1500\ndata: a\n\nretry: soon\ndata: b\n\n",
+			want:  []SSEEvent{{Event: "message", Data: "a", Retry: 1500 * time.Millisecond}, {Event: "message", Data: "b"}},
+		},
+		{
+			name:  "events without data are skipped",
+			input: "event: ping\n\n: keep-alive\n\ndata: a\n\n",
+			want:  []SSEEvent{{Event: "message", Data: "a"}},
+		},
+		{
+			name:  "unknown fields are ignored",
+			input: "foo: bar\ndata: a\n\n",
+			want:  []SSEEvent{{Event: "message", Data: "a"}},
+		},
+		{
+			name:  "partial event at eof is discarded",
+			input: "data: a\n\ndata: b\n",
+			want:  []SSEEvent{{Event: "message", Data: "a"}},
+		},
+		{
+			name:  "unterminated line at eof is discarded",
+			input: "data: a\n\ndata: b",
+			want:  []SSEEvent{{Event: "message", Data: "a"}},
+		},
+		{
+			name:  "long line",
+			input: "data: " + strings.Repeat("x", 100000) + "\n\n",
+			want:  []SSEEvent{{Event: "message", Data: strings.Repeat("x", 100000)}},
+		},
+		{
+			name:  "empty",
+			input: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewSSEReader(strings.NewReader(tt.input))
+			var got []SSEEvent
+			for {
+				ev, err := r.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Next: %v", err)
+				}
+				got = append(got, *ev)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d events %+v, want %d", len(got), got, len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("event %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSSEReaderReadError(t *testing.T) {
+	boom := errors.New("boom")
+	r := NewSSEReader(io.MultiReader(strings.NewReader("data: a\n\ndata: b\n"), errReader{boom}))
+	if ev, err := r.Next(); err != nil || ev.Data != "a" {
+		t.Fatalf("Next = %+v, %v, want the first event", ev, err)
+	}
+	if _, err := r.Next(); err != boom {
+		t.Errorf("Next error = %v, want %v", err, boom)
+	}
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+func TestDecodeEvent(t *testing.T) {
+	type chunk struct {
+		Text string `json:"text"`
+	}
+	tests := []struct {
+		name     string
+		event    SSEEvent
+		wantText string
+		wantErr  error  // Matched with errors.Is
+		wantCode string // Code of the expected *APIError
+	}{
+		{
+			name:     "chunk",
+			event:    SSEEvent{Event: "result", Data: `{"text":"hi"}`, StatusCode: 200},
+			wantText: "hi",
+		},
+		{
+			name:     "error event",
+			event:    SSEEvent{Event: "error", Data: `{"code":"DataInspectionFailed","message":"unsafe"}`, StatusCode: 400},
+			wantCode: ErrCodeDataInspectionFailed,
+		},
+		{
+			name:     "compatible-mode error",
+			event:    SSEEvent{Event: "message", Data: `{"error":{"code":"invalid_parameter_error","message":"bad"}}`},
+			wantCode: "invalid_parameter_error",
+		},
+		{
+			name:    "done sentinel",
+			event:   SSEEvent{Event: "message", Data: "[DONE]"},
+			wantErr: io.EOF,
+		},
+		{
+			name:  "malformed",
+			event: SSEEvent{ID: "3", Event: "result", Data: `{"text":`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out chunk
+			err := decodeEvent(&tt.event, &out)
+			switch {
+			case tt.wantCode != "":
+				var apiErr *APIError
+				if !errors.As(err, &apiErr) || apiErr.Code != tt.wantCode {
+					t.Errorf("decodeEvent error = %v, want an *APIError with code %s", err, tt.wantCode)
+				}
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("decodeEvent error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantText == "":
+				if err == nil {
+					t.Error("decodeEvent succeeded on a malformed chunk")
+				}
+			default:
+				if err != nil || out.Text != tt.wantText {
+					t.Errorf("decodeEvent = %q, %v, want %q", out.Text, err, tt.wantText)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package dashscope
+
+import (
+	"context"
+	"io"
+	"iter"
+	"net/http"
+	"sync"
+)
+
+// Stream is a streaming response read one chunk at a time. It holds no
+// goroutines: chunks are decoded from the response body as Next is called.
+//
+//	stream, err := gen.Stream(ctx, req)
+//	if err != nil {
+//		return err
+//	}
+//	defer stream.Close()
+//	for stream.Next() {
+//		fmt.Print(stream.Current().Output.Text)
+//	}
+//	if err := stream.Err(); err != nil {
+//		return err
+//	}
+//
+// A Stream is not safe for concurrent use, except for Close, which may be
+// called from another goroutine to abort a stream being read.
+type Stream[T any] struct {
+	ctx     context.Context
+	body    io.ReadCloser
+	events  *SSEReader
+	op      *operation
+	observe func(*T)
+	closed  chan struct{} // Closed by Close
+
+	current *T
+
+	mu        sync.Mutex
+	err       error
+	done      bool
+	closeOnce sync.Once
+}
+
+// newStream reads chunks of type T from resp, passing each to observe before
+// it is returned. The operation ends when the stream does.
+func newStream[T any](ctx context.Context, op *operation, resp *http.Response, observe func(*T)) *Stream[T] {
+	return &Stream[T]{
+		ctx:     ctx,
+		body:    resp.Body,
+		events:  NewSSEReader(resp.Body),
+		op:      op,
+		observe: observe,
+		closed:  make(chan struct{}),
+	}
+}
+
+// Next advances to the next chunk, reporting false once the stream ends or
+// fails. The response body is released as soon as it returns false.
+func (s *Stream[T]) Next() bool {
+	if s.isDone() {
+		return false
+	}
+	if err := s.ctx.Err(); err != nil {
+		s.finish(err)
+		return false
+	}
+
+	ev, err := s.events.Next()
+	if err == nil {
+		var chunk T
+		if err = decodeEvent(ev, &chunk); err == nil {
+			if s.observe != nil {
+				s.observe(&chunk)
+			}
+			s.current = &chunk
+			return true
+		}
+	}
+
+	if err == io.EOF {
+		err = nil
+	} else if ctxErr := s.ctx.Err(); ctxErr != nil {
+		// Reads fail once the request context is canceled; report why.
+		err = ctxErr
+	}
+	s.finish(err)
+	return false
+}
+
+// Current returns the chunk read by the last call to Next.
+func (s *Stream[T]) Current() *T {
+	return s.current
+}
+
+// Err returns the error that ended the stream: an *APIError for error events,
+// the context's error on cancellation, or a read or decoding error. It is nil
+// if the stream completed or was closed before the context was canceled.
+func (s *Stream[T]) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close stops reading and releases the response body. It is safe to call
+// more than once and after the stream has ended.
+func (s *Stream[T]) Close() error {
+	s.closeOnce.Do(func() { close(s.closed) })
+	return s.finish(s.ctx.Err())
+}
+
+// All returns an iterator over the remaining chunks. A failure is yielded as
+// a final nil chunk with its error. The stream is closed when iteration ends,
+// including when the loop breaks early.
+func (s *Stream[T]) All() iter.Seq2[*T, error] {
+	return func(yield func(*T, error) bool) {
+		defer s.Close()
+		for s.Next() {
+			if !yield(s.current, nil) {
+				return
+			}
+		}
+		if err := s.Err(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// streamChannel forwards the chunks of s to a channel, sending failed(err) as
+// the last value if the stream fails. Canceling the stream's context, or
+// closing the stream, closes the channel without waiting for the consumer.
+func streamChannel[T any](s *Stream[T], failed func(error) T) <-chan T {
+	ch := make(chan T)
+	go func() {
+		defer close(ch)
+		defer s.Close()
+
+		for s.Next() {
+			select {
+			case ch <- *s.Current():
+			case <-s.ctx.Done():
+				return
+			case <-s.closed:
+				return
+			}
+		}
+		if err := s.Err(); err != nil && s.ctx.Err() == nil {
+			select {
+			case ch <- failed(err):
+			case <-s.ctx.Done():
+			case <-s.closed:
+			}
+		}
+	}()
+	return ch
+}
+
+func (s *Stream[T]) isDone() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done
+}
+
+// finish ends the stream with err unless it has already ended. Closing the
+// body also interrupts a read in progress on another goroutine.
+func (s *Stream[T]) finish(err error) error {
+	s.mu.Lock()
+	if s.done {
+		s.mu.Unlock()
+		return nil
+	}
+	s.done = true
+	s.err = err
+	s.mu.Unlock()
+
+	closeErr := s.body.Close()
+	s.op.end(err)
+	return closeErr
+}
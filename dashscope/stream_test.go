@@ -0,0 +1,191 @@
+package dashscope
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testChunk struct {
+	Text string `json:"text"`
+}
+
+// newTestStream returns a stream reading body.
+func newTestStream(ctx context.Context, body io.ReadCloser) *Stream[testChunk] {
+	ctx, op := NewClient().startOperation(ctx, "Test.Stream", CallInfo{Stream: true})
+	return newStream[testChunk](ctx, op, &http.Response{Body: body}, nil)
+}
+
+func TestStreamNext(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		want     []string
+		wantCode string // Code of the *APIError ending the stream
+		wantErr  bool
+	}{
+		{
+			name: "chunks",
+			body: "event:result\ndata:{\"text\":\"a\"}\n\nevent:result\ndata:{\"text\":\"b\"}\n\n",
+			want: []string{"a", "b"},
+		},
+		{
+			name: "done sentinel",
+			body: "data: {\"text\":\"a\"}\n\ndata: [DONE]\n\ndata: {\"text\":\"ignored\"}\n\n",
+			want: []string{"a"},
+		},
+		{
+			name:     "error event",
+			body:     "event:result\ndata:{\"text\":\"a\"}\n\nevent:error\n:HTTP_STATUS/429\ndata:{\"code\":\"Throttling\",\"message\":\"slow down\"}\n\n",
+			want:     []string{"a"},
+			wantCode: ErrCodeThrottling,
+		},
+		{
+			name:    "malformed chunk",
+			body:    "data:{\"text\":\"a\"}\n\ndata:{oops}\n\n",
+			want:    []string{"a"},
+			wantErr: true,
+		},
+		{
+			name: "empty",
+			body: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStream(context.Background(), io.NopCloser(strings.NewReader(tt.body)))
+			var got []string
+			for s.Next() {
+				got = append(got, s.Current().Text)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("chunks = %q, want %q", got, tt.want)
+			}
+
+			err := s.Err()
+			switch {
+			case tt.wantCode != "":
+				var apiErr *APIError
+				if !errors.As(err, &apiErr) || apiErr.Code != tt.wantCode {
+					t.Errorf("Err = %v, want an *APIError with code %s", err, tt.wantCode)
+				}
+			case tt.wantErr:
+				if err == nil {
+					t.Error("Err = nil, want an error")
+				}
+			default:
+				if err != nil {
+					t.Errorf("Err = %v", err)
+				}
+			}
+			if s.Next() {
+				t.Error("Next returned true after the stream ended")
+			}
+		})
+	}
+}
+
+func TestStreamCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := newTestStream(ctx, io.NopCloser(strings.NewReader("data:{\"text\":\"a\"}\n\ndata:{\"text\":\"b\"}\n\n")))
+	if !s.Next() {
+		t.Fatal("Next = false, want the first chunk")
+	}
+	cancel()
+	if s.Next() {
+		t.Error("Next = true after cancellation")
+	}
+	if !errors.Is(s.Err(), context.Canceled) {
+		t.Errorf("Err = %v, want context.Canceled", s.Err())
+	}
+}
+
+func TestStreamAllBreak(t *testing.T) {
+	body := &closeRecorder{Reader: strings.NewReader("data:{\"text\":\"a\"}\n\ndata:{\"text\":\"b\"}\n\n")}
+	s := newTestStream(context.Background(), body)
+	for chunk, err := range s.All() {
+		if err != nil || chunk.Text != "a" {
+			t.Fatalf("first chunk = %+v, %v", chunk, err)
+		}
+		break
+	}
+	if !body.closed {
+		t.Error("body not closed after breaking out of All")
+	}
+}
+
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestStreamChannel(t *testing.T) {
+	tests := []struct {
+		name string
+		// stop ends the consumption after the first chunk.
+		stop func(s *Stream[testChunk], cancel context.CancelFunc)
+	}{
+		{"context canceled", func(s *Stream[testChunk], cancel context.CancelFunc) { cancel() }},
+		{"stream closed", func(s *Stream[testChunk], cancel context.CancelFunc) { s.Close() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			// The server keeps the stream open after two chunks.
+			pr, pw := io.Pipe()
+			go func() {
+				io.WriteString(pw, "data:{\"text\":\"a\"}\n\ndata:{\"text\":\"b\"}\n\n")
+			}()
+			s := newTestStream(ctx, pr)
+			ch := streamChannel(s, func(err error) testChunk { return testChunk{Text: err.Error()} })
+
+			if first := <-ch; first.Text != "a" {
+				t.Fatalf("first chunk = %q, want a", first.Text)
+			}
+			// Stop reading while the producer is blocked on the second chunk.
+			time.Sleep(10 * time.Millisecond)
+			tt.stop(s, cancel)
+
+			select {
+			case _, ok := <-ch:
+				if ok {
+					// The second chunk may have won the race; the channel must
+					// still close.
+					if _, ok := <-ch; ok {
+						t.Error("received a chunk after stopping")
+					}
+				}
+			case <-time.After(time.Second):
+				t.Fatal("channel not closed after stopping")
+			}
+		})
+	}
+}
+
+func TestStreamChannelFailure(t *testing.T) {
+	s := newTestStream(context.Background(), io.NopCloser(strings.NewReader(
+		"data:{\"text\":\"a\"}\n\nevent:error\ndata:{\"code\":\"InternalError\",\"message\":\"oops\"}\n\n")))
+	ch := streamChannel(s, func(err error) testChunk {
+		_, code, _, _ := streamFailure(err)
+		return testChunk{Text: "failed: " + code}
+	})
+
+	var got []string
+	for chunk := range ch {
+		got = append(got, chunk.Text)
+	}
+	if want := "a,failed: InternalError"; strings.Join(got, ",") != want {
+		t.Errorf("chunks = %q, want %s", got, want)
+	}
+}
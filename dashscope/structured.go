@@ -0,0 +1,197 @@
+package dashscope
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// Response format types.
+const (
+	ResponseFormatText       = "text"
+	ResponseFormatJSONObject = "json_object"
+	ResponseFormatJSONSchema = "json_schema"
+)
+
+// ResponseFormat constrains the format of the model's reply.
+type ResponseFormat struct {
+	Type       string            `json:"type"`
+	JSONSchema *JSONSchemaFormat `json:"json_schema,omitempty"`
+}
+
+// JSONSchemaFormat is the schema the reply must follow with
+// ResponseFormatJSONSchema.
+type JSONSchemaFormat struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Schema      interface{} `json:"schema"`
+	Strict      bool        `json:"strict,omitempty"`
+}
+
+// DefaultStructuredAttempts is the number of model calls GenerateInto makes
+// before giving up on an invalid reply.
+const DefaultStructuredAttempts = 3
+
+// StructuredOption configures GenerateInto.
+type StructuredOption func(*structuredConfig)
+
+type structuredConfig struct {
+	attempts   int
+	formatType string
+	name       string
+}
+
+// WithAttempts sets the number of model calls GenerateInto makes, re-prompting
+// with the validation error after each invalid reply.
+func WithAttempts(n int) StructuredOption {
+	return func(c *structuredConfig) {
+		c.attempts = n
+	}
+}
+
+// WithJSONObjectMode requests json_object instead of json_schema output, for
+// models without schema support. The schema is then given in the prompt.
+func WithJSONObjectMode() StructuredOption {
+	return func(c *structuredConfig) {
+		c.formatType = ResponseFormatJSONObject
+	}
+}
+
+// WithSchemaName sets the schema name sent to the model, by default derived
+// from the type name.
+func WithSchemaName(name string) StructuredOption {
+	return func(c *structuredConfig) {
+		c.name = name
+	}
+}
+
+// StructuredOutputError is returned by GenerateInto when no valid reply was
+// obtained within the allowed attempts.
+type StructuredOutputError struct {
+	Content  string // The last reply
+	Attempts int
+	Err      error // Why the last reply was rejected
+}
+
+func (e *StructuredOutputError) Error() string {
+	return fmt.Sprintf("dashscope: no valid structured output after %d attempts: %v", e.Attempts, e.Err)
+}
+
+func (e *StructuredOutputError) Unwrap() error {
+	return e.Err
+}
+
+// GenerateInto asks the model for a JSON reply following the schema of T and
+// decodes it. Replies that do not parse or validate against the schema are
+// sent back with the error, up to DefaultStructuredAttempts calls in total.
+//
+//	type Sentiment struct {
+//		Label string  `json:"label" enum:"positive,negative,neutral"`
+//		Score float64 `json:"score"`
+//	}
+//	s, err := dashscope.GenerateInto[Sentiment](ctx, gen, req)
+func GenerateInto[T any](ctx context.Context, gen *Generation, req GenerationRequest, opts ...StructuredOption) (*T, error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	cfg := structuredConfig{
+		attempts:   DefaultStructuredAttempts,
+		formatType: ResponseFormatJSONSchema,
+		name:       schemaName(t),
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.attempts < 1 {
+		cfg.attempts = 1
+	}
+
+	schema := SchemaOf(t)
+	var params GenerationParameters
+	if req.Parameters != nil {
+		params = *req.Parameters
+	}
+	params.ResultFormat = "message"
+	params.IncrementalOutput = false
+	params.ResponseFormat = &ResponseFormat{Type: cfg.formatType}
+	if cfg.formatType == ResponseFormatJSONSchema {
+		params.ResponseFormat.JSONSchema = &JSONSchemaFormat{Name: cfg.name, Schema: schema}
+	}
+	req.Parameters = &params
+
+	messages := append([]Message(nil), req.Input.Messages...)
+	if req.Input.Prompt != "" {
+		messages = append(messages, Message{Role: RoleUser, Content: req.Input.Prompt})
+		req.Input.Prompt = ""
+	}
+	if cfg.formatType == ResponseFormatJSONObject {
+		data, _ := json.Marshal(schema)
+		instruction := "Reply with a JSON value matching this JSON schema:\n" + string(data)
+		if len(messages) > 0 && messages[0].Role == RoleSystem {
+			messages[0].Content += "\n\n" + instruction
+		} else {
+			messages = append([]Message{{Role: RoleSystem, Content: instruction}}, messages...)
+		}
+	}
+
+	var content string
+	var invalid error
+	for attempt := 0; attempt < cfg.attempts; attempt++ {
+		req.Input.Messages = messages
+		resp, err := gen.Call(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Output.Choices) == 0 {
+			return nil, fmt.Errorf("dashscope: response %s has no choices", resp.RequestID)
+		}
+
+		content = resp.Output.Choices[0].Message.Content
+		var out T
+		if invalid = decodeStructured(content, schema, &out); invalid == nil {
+			return &out, nil
+		}
+		messages = append(messages,
+			Message{Role: RoleAssistant, Content: content},
+			Message{Role: RoleUser, Content: fmt.Sprintf(
+				"The reply is invalid: %v. Reply again with only the corrected JSON.", invalid)},
+		)
+	}
+	return nil, &StructuredOutputError{Content: content, Attempts: cfg.attempts, Err: invalid}
+}
+
+// codeFence matches a reply wrapped in a Markdown code block.
+var codeFence = regexp.MustCompile("(?s)^```[a-zA-Z]*\\s*(.*?)\\s*```$")
+
+// decodeStructured validates content against schema and decodes it into out.
+func decodeStructured(content string, schema *Schema, out interface{}) error {
+	content = strings.TrimSpace(content)
+	if m := codeFence.FindStringSubmatch(content); m != nil {
+		content = m[1]
+	}
+
+	var v interface{}
+	if err := json.Unmarshal([]byte(content), &v); err != nil {
+		return fmt.Errorf("not valid JSON: %w", err)
+	}
+	if err := schema.Validate(v); err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(content), out)
+}
+
+// schemaName derives a schema name from a type, as the API requires names
+// made of letters, digits, underscores and dashes.
+func schemaName(t reflect.Type) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '_' || r == '-' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, t.Name())
+	if name == "" {
+		return "response"
+	}
+	return name
+}
@@ -3,9 +3,11 @@ package dashscope
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
+	"net/url"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // TaskStatus constants
@@ -33,6 +35,8 @@ type TaskOutput struct {
 	TaskID     string          `json:"task_id"`
 	TaskStatus string          `json:"task_status"`
 	Results    json.RawMessage `json:"results,omitempty"` // Keep raw JSON for specific parsing
+	Code       string          `json:"code,omitempty"`    // Set when the task failed
+	Message    string          `json:"message,omitempty"` // Set when the task failed
 }
 
 // GetTask retrieves the status of an asynchronous task.
@@ -42,73 +46,103 @@ func GetTask(ctx context.Context, apiKey string, taskID string) (*TaskResponse,
 
 // GetTaskWithClient retrieves the status of an asynchronous task using a custom HTTP client.
 func GetTaskWithClient(ctx context.Context, apiKey string, taskID string, client *http.Client) (*TaskResponse, error) {
-	url := fmt.Sprintf("%s/%s", TaskBaseURL, taskID)
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	c := NewClient(WithAPIKey(apiKey), WithHTTPClient(client))
+	return c.getTask(ctx, c.httpClient, apiKey, taskID)
+}
+
+func (c *Client) getTask(ctx context.Context, client *http.Client, apiKey string, taskID string) (*TaskResponse, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	endpoint := c.url(TaskPath + "/" + url.PathEscape(taskID))
+	req, err := c.newRequest(ctx, "GET", endpoint, nil, apiKey, "")
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	if client == nil {
-		client = &http.Client{}
-	}
-	resp, err := client.Do(req)
+	resp, err := c.do(client, req, CallInfo{Service: ServiceTask, TaskID: taskID})
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	var taskResp TaskResponse
-	if err := json.NewDecoder(resp.Body).Decode(&taskResp); err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return &taskResp, fmt.Errorf("get task failed: %s (%s)", taskResp.Message, taskResp.Code)
+	if err := decodeResponse(resp, &taskResp); err != nil {
+		return &taskResp, err
 	}
 
 	return &taskResp, nil
 }
 
-// WaitForTask waits for an asynchronous task to complete.
+// WaitForTask waits for an asynchronous task to complete. A task that
+// failed, was canceled or is unknown is returned along with an *APIError.
 func WaitForTask(ctx context.Context, apiKey string, taskID string) (*TaskResponse, error) {
 	return WaitForTaskWithClient(ctx, apiKey, taskID, nil)
 }
 
 // WaitForTaskWithClient waits for an asynchronous task to complete using a custom HTTP client.
 func WaitForTaskWithClient(ctx context.Context, apiKey string, taskID string, client *http.Client) (*TaskResponse, error) {
+	c := NewClient(WithAPIKey(apiKey), WithHTTPClient(client))
+	return c.waitForTask(ctx, c.httpClient, apiKey, taskID)
+}
+
+func (c *Client) waitForTask(ctx context.Context, client *http.Client, apiKey string, taskID string) (_ *TaskResponse, err error) {
+	ctx, op := c.startOperation(ctx, "WaitForTask", CallInfo{Service: ServiceTask, TaskID: taskID})
+	defer func() { op.end(err) }()
+
+	var resp *TaskResponse
+	err = poll(ctx, op, taskPollInterval, func(ctx context.Context) (string, bool, error) {
+		r, err := c.getTask(ctx, client, apiKey, taskID)
+		if err != nil {
+			// Network error or other immediate failure
+			return "", false, err
+		}
+		resp = r
+		status := r.Output.TaskStatus
+		switch status {
+		case TaskStatusSucceeded, TaskStatusFailed, TaskStatusCanceled, TaskStatusUnknown:
+			return status, true, nil
+		}
+		return status, false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, taskError(resp)
+}
+
+// taskPollInterval caps the delay between polls of an async task.
+const taskPollInterval = 5 * time.Second
+
+// poll calls check until it reports done, recording each poll as an event of
+// op. Polls start a second apart and the delay doubles every third poll, up
+// to maxWait, like the Python SDK.
+func poll(ctx context.Context, op *operation, maxWait time.Duration, check func(ctx context.Context) (status string, done bool, err error)) error {
 	waitSeconds := 1 * time.Second
-	maxWaitSeconds := 5 * time.Second
 	incrementSteps := 3
 	step := 0
 
 	for {
 		step++
-		resp, err := GetTaskWithClient(ctx, apiKey, taskID, client)
+		status, done, err := check(ctx)
 		if err != nil {
-			// Network error or other immediate failure
-			return nil, err
+			return err
 		}
-
-		if resp.Output.TaskStatus == TaskStatusSucceeded ||
-			resp.Output.TaskStatus == TaskStatusFailed ||
-			resp.Output.TaskStatus == TaskStatusCanceled {
-			return resp, nil
+		op.event("poll", attribute.Int("step", step), attribute.String("task_status", status))
+		if done {
+			return nil
 		}
 
-		// Wait logic similar to Python SDK
-		if waitSeconds < maxWaitSeconds && step%incrementSteps == 0 {
+		if waitSeconds < maxWait && step%incrementSteps == 0 {
 			waitSeconds *= 2
-			if waitSeconds > maxWaitSeconds {
-				waitSeconds = maxWaitSeconds
+			if waitSeconds > maxWait {
+				waitSeconds = maxWait
 			}
 		}
 
 		select {
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return ctx.Err()
 		case <-time.After(waitSeconds):
 			// continue
 		}
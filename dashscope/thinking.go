@@ -0,0 +1,77 @@
+package dashscope
+
+import (
+	"context"
+
+	"github.com/ceoifung/go-dashscope/dashscope/internal/models"
+)
+
+// thinking reports whether a request runs in thinking mode, which DashScope
+// only serves as a stream. Without enable, the model's default applies: QwQ,
+// QVQ and most Qwen3 models think.
+func thinking(model string, enable *bool) bool {
+	if enable != nil {
+		return *enable
+	}
+	return models.ThinksByDefault(model)
+}
+
+// collect performs a thinking request as a stream and assembles the reply,
+// so that Call works the same with thinking enabled.
+func (g *Generation) collect(ctx context.Context, req GenerationRequest) (*GenerationResponse, error) {
+	params := *req.Parameters
+	params.IncrementalOutput = true
+	req.Parameters = &params
+
+	ctx, cancel := g.c.withTimeout(ctx)
+	defer cancel()
+
+	stream, err := g.stream(ctx, req, "Generation.Call")
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	acc := NewGenerationAccumulator(req)
+	for stream.Next() {
+		acc.Add(stream.Current())
+	}
+	return acc.Response(), stream.Err()
+}
+
+// collect performs a thinking request as a stream and assembles the reply.
+func (m *MultiModalConversation) collect(ctx context.Context, req MultiModalConversationRequest) (*MultiModalConversationResponse, error) {
+	params := *req.Parameters
+	params.IncrementalOutput = true
+	req.Parameters = &params
+
+	ctx, cancel := m.c.withTimeout(ctx)
+	defer cancel()
+
+	stream, err := m.stream(ctx, req, "MultiModalConversation.Call")
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	acc := NewMultiModalAccumulator(req)
+	for stream.Next() {
+		acc.Add(stream.Current())
+	}
+	return acc.Response(), stream.Err()
+}
+
+// withoutReasoning returns messages without their reasoning content, which
+// is not sent back to the model in later turns.
+func withoutReasoning(messages []Message) []Message {
+	for i, msg := range messages {
+		if msg.ReasoningContent != "" {
+			messages = append([]Message(nil), messages...)
+			for j := i; j < len(messages); j++ {
+				messages[j].ReasoningContent = ""
+			}
+			break
+		}
+	}
+	return messages
+}
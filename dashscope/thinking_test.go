@@ -0,0 +1,190 @@
+package dashscope_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+	"github.com/ceoifung/go-dashscope/dashscope/dashscopetest"
+)
+
+// sentParameters decodes the parameters of a request the server received.
+func sentParameters(t *testing.T, req dashscopetest.Request) map[string]interface{} {
+	t.Helper()
+	var body struct {
+		Parameters map[string]interface{} `json:"parameters"`
+	}
+	if err := req.Decode(&body); err != nil {
+		t.Fatalf("decoding the request: %v", err)
+	}
+	return body.Parameters
+}
+
+func TestGenerationCallThinking(t *testing.T) {
+	enabled, disabled := true, false
+	tests := []struct {
+		name       string
+		model      string
+		params     dashscope.GenerationParameters
+		wantStream bool
+		wantParams map[string]interface{} // Thinking parameters sent
+	}{
+		{
+			name:       "plain model",
+			model:      dashscope.QwenPlus,
+			wantParams: map[string]interface{}{},
+		},
+		{
+			name:       "enabled with a budget",
+			model:      dashscope.QwenPlus,
+			params:     dashscope.GenerationParameters{EnableThinking: &enabled, ThinkingBudget: 500},
+			wantStream: true,
+			wantParams: map[string]interface{}{"enable_thinking": true, "thinking_budget": float64(500)},
+		},
+		{
+			name:       "reasoning model",
+			model:      dashscope.QwQPlus,
+			wantStream: true,
+			wantParams: map[string]interface{}{},
+		},
+		{
+			name:       "qwen3 by default",
+			model:      "qwen3-32b",
+			wantStream: true,
+			wantParams: map[string]interface{}{},
+		},
+		{
+			name:       "qwen3 disabled",
+			model:      "qwen3-32b",
+			params:     dashscope.GenerationParameters{EnableThinking: &disabled},
+			wantParams: map[string]interface{}{"enable_thinking": false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := dashscopetest.NewServer()
+			defer srv.Close()
+
+			params := tt.params
+			params.ResultFormat = "message"
+			resp, err := srv.Client().Generation().Call(context.Background(), dashscope.GenerationRequest{
+				Model: tt.model,
+				Input: dashscope.GenerationInput{Messages: []dashscope.Message{
+					{Role: dashscope.RoleUser, Content: "Hello"},
+				}},
+				Parameters: &params,
+			})
+			if err != nil {
+				t.Fatalf("Call: %v", err)
+			}
+
+			requests := srv.RequestsFor(dashscope.ServiceGeneration)
+			if len(requests) != 1 {
+				t.Fatalf("%d requests sent, want 1", len(requests))
+			}
+			sent := sentParameters(t, requests[0])
+			streamed := requests[0].Header.Get("X-DashScope-SSE") == "enable"
+			if streamed != tt.wantStream || (sent["stream"] == true) != tt.wantStream {
+				t.Errorf("streamed = %t, stream = %v, want %t", streamed, sent["stream"], tt.wantStream)
+			}
+			if tt.wantStream && sent["incremental_output"] != true {
+				t.Errorf("incremental_output = %v, want true", sent["incremental_output"])
+			}
+			for _, key := range []string{"enable_thinking", "thinking_budget"} {
+				if sent[key] != tt.wantParams[key] {
+					t.Errorf("%s = %v, want %v", key, sent[key], tt.wantParams[key])
+				}
+			}
+
+			msg := resp.Output.Choices[0].Message
+			if msg.Content != srv.Reply {
+				t.Errorf("content = %q, want %q", msg.Content, srv.Reply)
+			}
+			wantReasoning, wantTokens := "", 0
+			if tt.wantStream {
+				wantReasoning, wantTokens = srv.Reasoning, len(strings.Fields(srv.Reasoning))
+			}
+			if msg.ReasoningContent != wantReasoning {
+				t.Errorf("reasoning = %q, want %q", msg.ReasoningContent, wantReasoning)
+			}
+			if got := resp.Usage.OutputTokensDetails.ReasoningTokens; got != wantTokens {
+				t.Errorf("reasoning tokens = %d, want %d", got, wantTokens)
+			}
+			if params.IncrementalOutput {
+				t.Error("Call changed the caller's parameters")
+			}
+		})
+	}
+}
+
+func TestGenerationStreamReasoning(t *testing.T) {
+	srv := dashscopetest.NewServer()
+	defer srv.Close()
+
+	enabled := true
+	stream, err := srv.Client().Generation().Stream(context.Background(), dashscope.GenerationRequest{
+		Model: dashscope.QwenPlus,
+		Input: dashscope.GenerationInput{Messages: []dashscope.Message{
+			{Role: dashscope.RoleUser, Content: "Hello"},
+		}},
+		Parameters: &dashscope.GenerationParameters{
+			ResultFormat:      "message",
+			IncrementalOutput: true,
+			EnableThinking:    &enabled,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	defer stream.Close()
+
+	var reasoning, content strings.Builder
+	var last dashscope.GenerationUsage
+	for stream.Next() {
+		chunk := stream.Current()
+		msg := chunk.Output.Choices[0].Message
+		if msg.ReasoningContent != "" && content.Len() > 0 {
+			t.Errorf("reasoning %q streamed after the reply started", msg.ReasoningContent)
+		}
+		reasoning.WriteString(msg.ReasoningContent)
+		content.WriteString(msg.Content)
+		last = chunk.Usage
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	if reasoning.String() != srv.Reasoning {
+		t.Errorf("reasoning = %q, want %q", reasoning.String(), srv.Reasoning)
+	}
+	if content.String() != srv.Reply {
+		t.Errorf("content = %q, want %q", content.String(), srv.Reply)
+	}
+	thoughts, words := len(strings.Fields(srv.Reasoning)), len(strings.Fields(srv.Reply))
+	if last.OutputTokensDetails.ReasoningTokens != thoughts || last.OutputTokens != thoughts+words {
+		t.Errorf("usage = %+v, want %d reasoning tokens of %d output tokens", last, thoughts, thoughts+words)
+	}
+}
+
+func TestGenerationReasoningNotSentBack(t *testing.T) {
+	srv := dashscopetest.NewServer()
+	defer srv.Close()
+
+	history := []dashscope.Message{
+		{Role: dashscope.RoleUser, Content: "Hello"},
+		{Role: dashscope.RoleAssistant, Content: "Hi", ReasoningContent: "They greet me."},
+		{Role: dashscope.RoleUser, Content: "How are you?"},
+	}
+	if _, err := srv.Client().Generation().Call(context.Background(), dashscope.GenerationRequest{
+		Model: dashscope.QwenPlus,
+		Input: dashscope.GenerationInput{Messages: history},
+	}); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if strings.Contains(string(srv.RequestsFor(dashscope.ServiceGeneration)[0].Body), "reasoning_content") {
+		t.Error("reasoning content sent back to the model")
+	}
+	if history[1].ReasoningContent == "" {
+		t.Error("Call cleared the caller's reasoning content")
+	}
+}
@@ -0,0 +1,167 @@
+package dashscope
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+// TokenCounter counts the tokens of text for a model. Tokenizer counts
+// offline; Tokenization asks DashScope.
+type TokenCounter interface {
+	CountTokens(ctx context.Context, model, text string) (int, error)
+}
+
+// WithTokenCounter sets the counters used to size requests for rate
+// limiting and to trim conversations. They are tried in order, e.g. a local
+// Tokenizer and then the remote Tokenization as a fallback, before the
+// built-in estimate of one token per CJK character or four other
+// characters. Counts are cached per model and text, so the messages of a
+// conversation are counted once rather than on every request.
+func WithTokenCounter(counters ...TokenCounter) ClientOption {
+	return func(c *Client) {
+		c.tokenCounters = counters
+		c.tokenCache = &tokenCache{}
+	}
+}
+
+// tokenCounter returns a function counting tokens of text for model with
+// the configured counters.
+func (c *Client) tokenCounter(ctx context.Context, model string) func(string) int {
+	if len(c.tokenCounters) == 0 {
+		return estimateTokens
+	}
+	return func(text string) int {
+		if text == "" {
+			return 0
+		}
+		if n, ok := c.tokenCache.get(model, text); ok {
+			return n
+		}
+		for _, counter := range c.tokenCounters {
+			if n, err := counter.CountTokens(ctx, model, text); err == nil {
+				c.tokenCache.put(model, text, n)
+				return n
+			}
+		}
+		return estimateTokens(text)
+	}
+}
+
+// maxCachedCounts bounds the token cache, which is emptied when full.
+const maxCachedCounts = 4096
+
+// tokenCache holds the counts returned by TokenCounters. Estimates used
+// when every counter failed are not cached.
+type tokenCache struct {
+	mu     sync.Mutex
+	counts map[tokenCacheKey]int
+}
+
+type tokenCacheKey struct {
+	model, text string
+}
+
+func (tc *tokenCache) get(model, text string) (int, bool) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	n, ok := tc.counts[tokenCacheKey{model, text}]
+	return n, ok
+}
+
+func (tc *tokenCache) put(model, text string, n int) {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+	if tc.counts == nil || len(tc.counts) >= maxCachedCounts {
+		tc.counts = map[tokenCacheKey]int{}
+	}
+	tc.counts[tokenCacheKey{model, text}] = n
+}
+
+// Tokenization handles the tokenizer API, which reports how a model
+// tokenizes a prompt.
+type Tokenization struct {
+	APIKey    string
+	Workspace string
+	client    *http.Client
+	c         *Client
+}
+
+// NewTokenization creates a new Tokenization client.
+func NewTokenization(apiKey string) *Tokenization {
+	return NewClient(WithAPIKey(apiKey)).Tokenization()
+}
+
+// SetHTTPClient sets a custom HTTP client.
+func (t *Tokenization) SetHTTPClient(client *http.Client) {
+	t.client = client
+}
+
+// TokenizationRequest asks how a model tokenizes a prompt or messages.
+type TokenizationRequest struct {
+	Model string          `json:"model"`
+	Input GenerationInput `json:"input"`
+}
+
+// TokenizationResponse lists the tokens of the input.
+type TokenizationResponse struct {
+	RequestID string `json:"request_id"`
+	Output    struct {
+		TokenIDs []int    `json:"token_ids"`
+		Tokens   []string `json:"tokens"`
+		Prompt   string   `json:"prompt,omitempty"` // Messages rendered with the chat template
+	} `json:"output"`
+	Usage struct {
+		InputTokens int `json:"input_tokens"`
+	} `json:"usage"`
+	StatusCode int    `json:"status_code,omitempty"`
+	Code       string `json:"code,omitempty"`
+	Message    string `json:"message,omitempty"`
+}
+
+// Call tokenizes the input of req.
+func (t *Tokenization) Call(ctx context.Context, req TokenizationRequest) (_ *TokenizationResponse, err error) {
+	url := t.c.url(TokenizerPath)
+
+	info := CallInfo{Service: ServiceTokenization, Model: req.Model}
+	ctx, op := t.c.startOperation(ctx, "Tokenization.Call", info)
+	defer func() { op.end(err) }()
+
+	ctx, cancel := t.c.withTimeout(ctx)
+	defer cancel()
+
+	httpReq, err := t.c.newRequest(ctx, "POST", url, req, t.APIKey, t.Workspace)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.c.do(t.client, httpReq, info)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var tokResp TokenizationResponse
+	err = decodeResponse(resp, &tokResp)
+	op.setRequestID(tokResp.RequestID)
+	if err != nil {
+		return &tokResp, err
+	}
+
+	return &tokResp, nil
+}
+
+// CountTokens implements TokenCounter with one request per call.
+func (t *Tokenization) CountTokens(ctx context.Context, model, text string) (int, error) {
+	resp, err := t.Call(ctx, TokenizationRequest{
+		Model: model,
+		Input: GenerationInput{Prompt: text},
+	})
+	if err != nil {
+		return 0, err
+	}
+	if n := resp.Usage.InputTokens; n > 0 {
+		return n, nil
+	}
+	return len(resp.Output.TokenIDs), nil
+}
@@ -0,0 +1,78 @@
+package dashscope
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// countingCounter counts one token per byte and records its calls.
+type countingCounter struct {
+	calls int
+	err   error
+}
+
+func (c *countingCounter) CountTokens(ctx context.Context, model, text string) (int, error) {
+	c.calls++
+	return len(text), c.err
+}
+
+func TestTokenCounterCache(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		texts     [][2]string // Model and text
+		want      []int
+		wantCalls int
+	}{
+		{
+			name:      "repeated text",
+			texts:     [][2]string{{QwenTurbo, "hello"}, {QwenTurbo, "hello"}, {QwenTurbo, "hello!"}},
+			want:      []int{5, 5, 6},
+			wantCalls: 2,
+		},
+		{
+			name:      "per model",
+			texts:     [][2]string{{QwenTurbo, "hello"}, {QwenPlus, "hello"}},
+			want:      []int{5, 5},
+			wantCalls: 2,
+		},
+		{
+			name:      "empty text",
+			texts:     [][2]string{{QwenTurbo, ""}},
+			want:      []int{0},
+			wantCalls: 0,
+		},
+		{
+			name:      "estimates not cached",
+			err:       errors.New("unavailable"),
+			texts:     [][2]string{{QwenTurbo, "hello"}, {QwenTurbo, "hello"}},
+			want:      []int{2, 2},
+			wantCalls: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := &countingCounter{err: tt.err}
+			c := NewClient(WithTokenCounter(counter))
+			for i, mt := range tt.texts {
+				if got := c.tokenCounter(context.Background(), mt[0])(mt[1]); got != tt.want[i] {
+					t.Errorf("count %q = %d, want %d", mt[1], got, tt.want[i])
+				}
+			}
+			if counter.calls != tt.wantCalls {
+				t.Errorf("%d counter calls, want %d", counter.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestTokenCacheBound(t *testing.T) {
+	tc := &tokenCache{}
+	for i := 0; i < maxCachedCounts+1; i++ {
+		tc.put(QwenTurbo, string(rune(i)), i)
+	}
+	if n := len(tc.counts); n != 1 {
+		t.Errorf("%d cached counts after overflowing, want 1", n)
+	}
+}
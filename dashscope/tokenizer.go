@@ -0,0 +1,437 @@
+package dashscope
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// QwenSpecialTokens are the control tokens shared by the Qwen vocabularies.
+var QwenSpecialTokens = map[string]int{
+	"<|endoftext|>": 151643,
+	"<|im_start|>":  151644,
+	"<|im_end|>":    151645,
+}
+
+// Tokenizer is a byte-level BPE tokenizer, such as Qwen's, that counts and
+// encodes tokens offline. It is safe for concurrent use.
+//
+// Load the vocab.json and merges.txt published with the Qwen2 and later
+// models with LoadTokenizerFiles, or the qwen.tiktoken file of the first
+// Qwen models with LoadTiktokenFile.
+type Tokenizer struct {
+	encoder map[string]int // Token bytes to ID
+	decoder map[int]string
+	// rank returns the merge priority of a pair, lowest first.
+	rank func(a, b string) (int, bool)
+	// wholeWords looks words up before merging, as tiktoken does.
+	wholeWords bool
+
+	special      map[string]int
+	specialNames []string // Longest first
+
+	mu    sync.Mutex // Guards cache
+	cache map[string][]int
+}
+
+// maxTokenizerCache bounds the number of cached words.
+const maxTokenizerCache = 1 << 16
+
+// LoadTokenizerFiles loads a tokenizer from Hugging Face vocab.json and
+// merges.txt files.
+func LoadTokenizerFiles(vocabPath, mergesPath string) (*Tokenizer, error) {
+	vocab, err := os.Open(vocabPath)
+	if err != nil {
+		return nil, err
+	}
+	defer vocab.Close()
+	merges, err := os.Open(mergesPath)
+	if err != nil {
+		return nil, err
+	}
+	defer merges.Close()
+	return LoadTokenizer(vocab, merges)
+}
+
+// LoadTokenizer loads a tokenizer from a Hugging Face vocab.json, mapping
+// tokens to IDs, and a merges.txt listing merges by priority. The Qwen
+// special tokens are added unless the vocabulary defines them.
+func LoadTokenizer(vocab, merges io.Reader) (*Tokenizer, error) {
+	var tokens map[string]int
+	if err := json.NewDecoder(vocab).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("failed to read vocab: %w", err)
+	}
+
+	t := newTokenizer()
+	for token, id := range tokens {
+		raw, ok := unmapBytes(token)
+		if !ok {
+			// Added tokens are not byte-mapped.
+			raw = token
+		}
+		t.encoder[raw] = id
+		t.decoder[id] = raw
+	}
+
+	ranks := map[[2]string]int{}
+	scanner := bufio.NewScanner(merges)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#version") || strings.TrimSpace(line) == "" {
+			continue
+		}
+		a, b, ok := strings.Cut(line, " ")
+		rawA, okA := unmapBytes(a)
+		rawB, okB := unmapBytes(b)
+		if !ok || !okA || !okB {
+			return nil, fmt.Errorf("invalid merge %q", line)
+		}
+		pair := [2]string{rawA, rawB}
+		if _, dup := ranks[pair]; !dup {
+			ranks[pair] = len(ranks)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read merges: %w", err)
+	}
+	t.rank = func(a, b string) (int, bool) {
+		r, ok := ranks[[2]string{a, b}]
+		return r, ok
+	}
+
+	t.addDefaultSpecialTokens()
+	return t, nil
+}
+
+// LoadTiktokenFile loads a tokenizer from a tiktoken file such as
+// qwen.tiktoken.
+func LoadTiktokenFile(path string) (*Tokenizer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadTiktoken(f)
+}
+
+// LoadTiktoken loads a tokenizer from tiktoken ranks, one base64-encoded token
+// and its rank per line. The Qwen special tokens are added.
+func LoadTiktoken(r io.Reader) (*Tokenizer, error) {
+	t := newTokenizer()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("invalid tiktoken line %q", scanner.Text())
+		}
+		token, err := base64.StdEncoding.DecodeString(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid tiktoken token %q: %w", fields[0], err)
+		}
+		rank, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid tiktoken rank %q: %w", fields[1], err)
+		}
+		t.encoder[string(token)] = rank
+		t.decoder[rank] = string(token)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	// tiktoken merges the pair whose result has the lowest rank.
+	t.rank = func(a, b string) (int, bool) {
+		r, ok := t.encoder[a+b]
+		return r, ok
+	}
+	t.wholeWords = true
+
+	t.addDefaultSpecialTokens()
+	return t, nil
+}
+
+func newTokenizer() *Tokenizer {
+	return &Tokenizer{
+		encoder: map[string]int{},
+		decoder: map[int]string{},
+		special: map[string]int{},
+		cache:   map[string][]int{},
+	}
+}
+
+func (t *Tokenizer) addDefaultSpecialTokens() {
+	tokens := map[string]int{}
+	for name, id := range QwenSpecialTokens {
+		if existing, ok := t.encoder[name]; ok {
+			id = existing
+		}
+		tokens[name] = id
+	}
+	t.AddSpecialTokens(tokens)
+}
+
+// AddSpecialTokens registers control tokens, which are matched verbatim in
+// the text and never split. It must not be called concurrently with other
+// methods.
+func (t *Tokenizer) AddSpecialTokens(tokens map[string]int) {
+	for name, id := range tokens {
+		t.special[name] = id
+		t.decoder[id] = name
+	}
+	t.specialNames = make([]string, 0, len(t.special))
+	for name := range t.special {
+		t.specialNames = append(t.specialNames, name)
+	}
+	sort.Slice(t.specialNames, func(i, j int) bool {
+		return len(t.specialNames[i]) > len(t.specialNames[j])
+	})
+}
+
+// Encode returns the token IDs of text.
+func (t *Tokenizer) Encode(text string) []int {
+	var ids []int
+	for text != "" {
+		i, name := t.nextSpecial(text)
+		for _, word := range preTokenize(text[:i]) {
+			ids = append(ids, t.encodeWord(word)...)
+		}
+		if name == "" {
+			break
+		}
+		ids = append(ids, t.special[name])
+		text = text[i+len(name):]
+	}
+	return ids
+}
+
+// Count returns the number of tokens of text.
+func (t *Tokenizer) Count(text string) int {
+	return len(t.Encode(text))
+}
+
+// CountMessages returns the number of prompt tokens of messages in the
+// ChatML template Qwen models use, including the assistant reply header.
+func (t *Tokenizer) CountMessages(messages []Message) int {
+	n := 0
+	for _, msg := range messages {
+		// <|im_start|>role\ncontent<|im_end|>\n
+		n += 2 + t.Count(msg.Role+"\n") + t.Count(msg.Content) + t.Count("\n")
+		for _, call := range msg.ToolCalls {
+			n += t.Count(call.Function.Name) + t.Count(call.Function.Arguments)
+		}
+	}
+	return n + 1 + t.Count(RoleAssistant+"\n")
+}
+
+// CountTokens implements TokenCounter.
+func (t *Tokenizer) CountTokens(ctx context.Context, model, text string) (int, error) {
+	return t.Count(text), nil
+}
+
+// Decode returns the text of token IDs. Unknown IDs are skipped.
+func (t *Tokenizer) Decode(ids []int) string {
+	var b strings.Builder
+	for _, id := range ids {
+		b.WriteString(t.decoder[id])
+	}
+	return b.String()
+}
+
+// nextSpecial returns the position and name of the first special token in
+// text, or len(text) and "".
+func (t *Tokenizer) nextSpecial(text string) (int, string) {
+	pos, found := len(text), ""
+	for _, name := range t.specialNames {
+		if i := strings.Index(text, name); i >= 0 && i < pos {
+			pos, found = i, name
+		}
+	}
+	return pos, found
+}
+
+// encodeWord applies the BPE merges to a pre-tokenized word.
+func (t *Tokenizer) encodeWord(word string) []int {
+	if id, ok := t.encoder[word]; ok && t.wholeWords {
+		return []int{id}
+	}
+	t.mu.Lock()
+	ids, ok := t.cache[word]
+	t.mu.Unlock()
+	if ok {
+		return ids
+	}
+
+	parts := make([]string, len(word))
+	for i := 0; i < len(word); i++ {
+		parts[i] = word[i : i+1]
+	}
+	for len(parts) > 1 {
+		best, bestRank := -1, 0
+		for i := 0; i < len(parts)-1; i++ {
+			if r, ok := t.rank(parts[i], parts[i+1]); ok && (best < 0 || r < bestRank) {
+				best, bestRank = i, r
+			}
+		}
+		if best < 0 {
+			break
+		}
+		a, b := parts[best], parts[best+1]
+		merged := parts[:0:0]
+		for i := 0; i < len(parts); i++ {
+			if i < len(parts)-1 && parts[i] == a && parts[i+1] == b {
+				merged = append(merged, a+b)
+				i++
+			} else {
+				merged = append(merged, parts[i])
+			}
+		}
+		parts = merged
+	}
+
+	ids = make([]int, 0, len(parts))
+	for _, part := range parts {
+		if id, ok := t.encoder[part]; ok {
+			ids = append(ids, id)
+			continue
+		}
+		// Not in the vocabulary: fall back to single bytes.
+		for i := 0; i < len(part); i++ {
+			if id, ok := t.encoder[part[i:i+1]]; ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	t.mu.Lock()
+	if len(t.cache) >= maxTokenizerCache {
+		clear(t.cache)
+	}
+	t.cache[word] = ids
+	t.mu.Unlock()
+	return ids
+}
+
+// preTokenize splits text into words like the Qwen pre-tokenizer regex:
+//
+//	(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+func preTokenize(text string) []string {
+	var words []string
+	for len(text) > 0 {
+		n := matchWord(text)
+		words = append(words, text[:n])
+		text = text[n:]
+	}
+	return words
+}
+
+// matchWord returns the length of the word at the start of text.
+func matchWord(text string) int {
+	r, size := utf8.DecodeRuneInString(text)
+
+	// Contractions.
+	if r == '\'' {
+		rest := strings.ToLower(text[1:min(len(text), 3)])
+		for _, suffix := range []string{"re", "ve", "ll", "s", "t", "m", "d"} {
+			if strings.HasPrefix(rest, suffix) {
+				return 1 + len(suffix)
+			}
+		}
+	}
+
+	// An optional non-letter, non-digit, non-newline followed by letters.
+	start := 0
+	if !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '\r' && r != '\n' {
+		if next, _ := utf8.DecodeRuneInString(text[size:]); size < len(text) && unicode.IsLetter(next) {
+			start = size
+		}
+	}
+	if first, _ := utf8.DecodeRuneInString(text[start:]); unicode.IsLetter(first) {
+		return start + spanOf(text[start:], unicode.IsLetter)
+	}
+
+	if unicode.IsNumber(r) {
+		return size
+	}
+
+	// An optional space, punctuation and trailing newlines.
+	start = 0
+	if r == ' ' && size < len(text) {
+		if next, _ := utf8.DecodeRuneInString(text[1:]); isPunct(next) {
+			start = 1
+		}
+	}
+	if first, _ := utf8.DecodeRuneInString(text[start:]); isPunct(first) {
+		n := start + spanOf(text[start:], isPunct)
+		return n + spanOf(text[n:], func(r rune) bool { return r == '\r' || r == '\n' })
+	}
+
+	// Whitespace.
+	space := spanOf(text, unicode.IsSpace)
+	if newline := strings.LastIndexAny(text[:space], "\r\n"); newline >= 0 {
+		return newline + 1
+	}
+	if space == len(text) {
+		return space
+	}
+	// Leave the last space to prefix the following word.
+	if _, last := utf8.DecodeLastRuneInString(text[:space]); space > last {
+		return space - last
+	}
+	return space
+}
+
+func isPunct(r rune) bool {
+	return !unicode.IsSpace(r) && !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+// spanOf returns the length of the prefix of s whose runes satisfy f.
+func spanOf(s string, f func(rune) bool) int {
+	for i, r := range s {
+		if !f(r) {
+			return i
+		}
+	}
+	return len(s)
+}
+
+// byteDecoder maps the printable runes byte-level BPE vocabularies use to
+// the bytes they stand for.
+var byteDecoder = func() map[rune]byte {
+	dec := map[rune]byte{}
+	n := 0
+	for b := 0; b < 256; b++ {
+		if ('!' <= b && b <= '~') || (0xA1 <= b && b <= 0xAC) || (0xAE <= b && b <= 0xFF) {
+			dec[rune(b)] = byte(b)
+		} else {
+			dec[rune(256+n)] = byte(b)
+			n++
+		}
+	}
+	return dec
+}()
+
+// unmapBytes converts a vocabulary token to the bytes it stands for.
+func unmapBytes(token string) (string, bool) {
+	b := make([]byte, 0, len(token))
+	for _, r := range token {
+		c, ok := byteDecoder[r]
+		if !ok {
+			return "", false
+		}
+		b = append(b, c)
+	}
+	return string(b), true
+}
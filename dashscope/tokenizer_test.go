@@ -0,0 +1,143 @@
+package dashscope
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPreTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Hello world", []string{"Hello", " world"}},
+		{"I'm fine", []string{"I", "'m", " fine"}},
+		{"don't", []string{"don", "'t"}},
+		{"WE'LL", []string{"WE", "'LL"}},
+		{"123", []string{"1", "2", "3"}},
+		{"a  b", []string{"a", " ", " b"}},
+		{"hi!!\n\nyo", []string{"hi", "!!\n\n", "yo"}},
+		{"a\n\n b", []string{"a", "\n\n", " b"}},
+		{"x.y", []string{"x", ".y"}},
+		{"a ?!", []string{"a", " ?!"}},
+		{"end  ", []string{"end", "  "}},
+		{"你好世界", []string{"你好世界"}},
+		{"价格100元", []string{"价格", "1", "0", "0", "元"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := preTokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("preTokenize(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+// testTokenizer is a tiny byte-level BPE vocabulary, in which Ġ stands for a
+// space.
+func testTokenizer(t *testing.T) *Tokenizer {
+	t.Helper()
+	vocab := `{"h":0,"e":1,"l":2,"o":3,"Ġ":4,"w":5,"r":6,"d":7,"he":8,"ll":9,"hell":10,"hello":11,"Ġw":12}`
+	merges := "#version: 0.2\nh e\nl l\nhe ll\nhell o\nĠ w\n"
+	tok, err := LoadTokenizer(strings.NewReader(vocab), strings.NewReader(merges))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tok
+}
+
+func TestTokenizerEncode(t *testing.T) {
+	tok := testTokenizer(t)
+	tests := []struct {
+		text string
+		want []int
+	}{
+		{"hello", []int{11}},
+		{"hello world", []int{11, 12, 3, 6, 2, 7}},
+		{"hell", []int{10}},
+		{"he", []int{8}},
+		{"hello<|im_end|>hello", []int{11, 151645, 11}},
+		{"<|im_start|><|im_end|>", []int{151644, 151645}},
+		{"hez", []int{8}}, // Bytes missing from the vocabulary are dropped
+		{"", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got := tok.Encode(tt.text)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Encode(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+			if n := tok.Count(tt.text); n != len(tt.want) {
+				t.Errorf("Count(%q) = %d, want %d", tt.text, n, len(tt.want))
+			}
+			// Repeat to exercise the word cache.
+			if again := tok.Encode(tt.text); !reflect.DeepEqual(again, got) {
+				t.Errorf("second Encode(%q) = %v, want %v", tt.text, again, got)
+			}
+		})
+	}
+
+	if got := tok.Decode([]int{11, 12, 3, 6, 2, 7, 151645, 999}); got != "hello world<|im_end|>" {
+		t.Errorf("Decode = %q", got)
+	}
+}
+
+func TestLoadTokenizerInvalid(t *testing.T) {
+	tests := []struct {
+		name          string
+		vocab, merges string
+	}{
+		{"vocab", `{"h":`, ""},
+		{"merge without pair", `{}`, "h\n"},
+		{"merge with unmapped rune", `{}`, "h \x01\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadTokenizer(strings.NewReader(tt.vocab), strings.NewReader(tt.merges)); err == nil {
+				t.Error("LoadTokenizer succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestLoadTiktoken(t *testing.T) {
+	// h, e and he.
+	tok, err := LoadTiktoken(strings.NewReader("aA== 0\nZQ== 1\naGU= 2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		text string
+		want []int
+	}{
+		{"he", []int{2}},
+		{"hehe", []int{2, 2}},
+		{"eh", []int{1, 0}},
+		{"he<|endoftext|>", []int{2, 151643}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			if got := tok.Encode(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Encode(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"aA==\n", "!!! 0\n", "aA== x\n"} {
+		if _, err := LoadTiktoken(strings.NewReader(invalid)); err == nil {
+			t.Errorf("LoadTiktoken(%q) succeeded, want an error", invalid)
+		}
+	}
+}
+
+func TestTokenizerCountMessages(t *testing.T) {
+	tok := testTokenizer(t)
+	messages := []Message{{Role: RoleUser, Content: "hello"}}
+	// <|im_start|> user\n hello <|im_end|> \n, then <|im_start|> assistant\n.
+	want := 2 + tok.Count("user\n") + 1 + tok.Count("\n") + 1 + tok.Count("assistant\n")
+	if got := tok.CountMessages(messages); got != want {
+		t.Errorf("CountMessages = %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,67 @@
+package dashscope
+
+import "encoding/json"
+
+// ToolTypeFunction is the type of function tools and tool calls.
+const ToolTypeFunction = "function"
+
+// Tool choices.
+const (
+	ToolChoiceAuto = "auto" // The model decides whether to call tools
+	ToolChoiceNone = "none" // The model answers without calling tools
+)
+
+// Tool describes a function the model may call.
+type Tool struct {
+	Type     string             `json:"type"`
+	Function FunctionDefinition `json:"function"`
+}
+
+// FunctionDefinition describes a callable function. Parameters is the JSON
+// schema of its arguments, e.g. a map or a json.RawMessage.
+type FunctionDefinition struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Parameters  interface{} `json:"parameters,omitempty"`
+}
+
+// NewFunctionTool returns a function tool taking arguments described by the
+// JSON schema parameters.
+func NewFunctionTool(name, description string, parameters interface{}) Tool {
+	return Tool{
+		Type: ToolTypeFunction,
+		Function: FunctionDefinition{
+			Name:        name,
+			Description: description,
+			Parameters:  parameters,
+		},
+	}
+}
+
+// ToolChoiceFunction returns a tool choice forcing the model to call the
+// named function.
+func ToolChoiceFunction(name string) interface{} {
+	return Tool{
+		Type:     ToolTypeFunction,
+		Function: FunctionDefinition{Name: name},
+	}
+}
+
+// NewToolMessage returns the message reporting the result of a tool call.
+func NewToolMessage(call ToolCall, content string) Message {
+	return Message{
+		Role:       RoleTool,
+		Content:    content,
+		Name:       call.Function.Name,
+		ToolCallID: call.ID,
+	}
+}
+
+// estimateToolTokens estimates the prompt tokens taken by tool definitions.
+func estimateToolTokens(tools []Tool, count func(string) int) int {
+	if len(tools) == 0 {
+		return 0
+	}
+	data, _ := json.Marshal(tools)
+	return count(string(data))
+}
@@ -0,0 +1,130 @@
+package dashscope_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+	"github.com/ceoifung/go-dashscope/dashscope/dashscopetest"
+)
+
+// toolCallChunk is a streamed message delta carrying tool call fragments.
+func toolCallChunk(finish string, calls ...map[string]interface{}) map[string]interface{} {
+	message := map[string]interface{}{"role": dashscope.RoleAssistant, "content": ""}
+	if calls != nil {
+		message["tool_calls"] = calls
+	}
+	return map[string]interface{}{
+		"output": map[string]interface{}{
+			"choices": []map[string]interface{}{{"finish_reason": finish, "message": message}},
+		},
+		"usage": map[string]interface{}{"input_tokens": 20, "output_tokens": 8, "total_tokens": 28},
+	}
+}
+
+func TestCallStreamToolCalls(t *testing.T) {
+	srv := dashscopetest.NewServer()
+	defer srv.Close()
+	srv.Enqueue(dashscope.ServiceGeneration, dashscopetest.Chunks(
+		toolCallChunk("null", map[string]interface{}{
+			"index": 0, "id": "call_1", "type": "function",
+			"function": map[string]interface{}{"name": "get_weather", "arguments": `{"ci`},
+		}),
+		toolCallChunk("null", map[string]interface{}{
+			"index": 0, "function": map[string]interface{}{"arguments": `ty":"Hang`},
+		}),
+		toolCallChunk("null",
+			map[string]interface{}{"index": 0, "function": map[string]interface{}{"arguments": `zhou"}`}},
+			map[string]interface{}{
+				"index": 1, "id": "call_2", "type": "function",
+				"function": map[string]interface{}{"name": "get_time", "arguments": `{}`},
+			}),
+		toolCallChunk("tool_calls"),
+	))
+
+	weather := dashscope.NewFunctionTool("get_weather", "Get the weather of a city", map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"city": map[string]string{"type": "string"}},
+	})
+	req := dashscope.GenerationRequest{
+		Model: dashscope.QwenPlus,
+		Input: dashscope.GenerationInput{Messages: []dashscope.Message{
+			{Role: dashscope.RoleUser, Content: "Weather and time in Hangzhou?"},
+		}},
+		Parameters: &dashscope.GenerationParameters{
+			IncrementalOutput: true,
+			Tools:             []dashscope.Tool{weather},
+			ToolChoice:        dashscope.ToolChoiceAuto,
+			ParallelToolCalls: true,
+		},
+	}
+	ch, err := srv.Client().Generation().CallStream(context.Background(), req)
+	if err != nil {
+		t.Fatalf("CallStream: %v", err)
+	}
+	acc := dashscope.NewGenerationAccumulator(req)
+	chunks := 0
+	for chunk := range ch {
+		if chunk.Code != "" {
+			t.Fatalf("stream failed: %s %s", chunk.Code, chunk.Message)
+		}
+		acc.Add(&chunk)
+		chunks++
+	}
+	if chunks != 4 {
+		t.Errorf("received %d chunks, want 4", chunks)
+	}
+
+	choice := acc.Response().Output.Choices[0]
+	want := []dashscope.ToolCall{
+		{Index: 0, ID: "call_1", Type: "function", Function: dashscope.FunctionCall{Name: "get_weather", Arguments: `{"city":"Hangzhou"}`}},
+		{Index: 1, ID: "call_2", Type: "function", Function: dashscope.FunctionCall{Name: "get_time", Arguments: `{}`}},
+	}
+	if !reflect.DeepEqual(choice.Message.ToolCalls, want) {
+		t.Errorf("tool calls = %+v, want %+v", choice.Message.ToolCalls, want)
+	}
+	if choice.FinishReason != "tool_calls" {
+		t.Errorf("finish reason = %q, want tool_calls", choice.FinishReason)
+	}
+
+	var sent struct {
+		Parameters struct {
+			ResultFormat      string           `json:"result_format"`
+			Tools             []dashscope.Tool `json:"tools"`
+			ToolChoice        string           `json:"tool_choice"`
+			ParallelToolCalls bool             `json:"parallel_tool_calls"`
+		} `json:"parameters"`
+	}
+	requests := srv.RequestsFor(dashscope.ServiceGeneration)
+	if err := requests[0].Decode(&sent); err != nil {
+		t.Fatalf("decoding the request: %v", err)
+	}
+	p := sent.Parameters
+	if p.ResultFormat != "message" || len(p.Tools) != 1 || p.Tools[0].Function.Name != "get_weather" ||
+		p.ToolChoice != dashscope.ToolChoiceAuto || !p.ParallelToolCalls {
+		t.Errorf("sent parameters = %+v, want the tools in the message format", p)
+	}
+
+	// The calls are answered in the next turn.
+	req.Input.Messages = append(req.Input.Messages, choice.Message,
+		dashscope.NewToolMessage(want[0], "sunny"), dashscope.NewToolMessage(want[1], "noon"))
+	req.Parameters.IncrementalOutput = false
+	if _, err := srv.Client().Generation().Call(context.Background(), req); err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	var answer struct {
+		Input struct {
+			Messages []dashscope.Message `json:"messages"`
+		} `json:"input"`
+	}
+	requests = srv.RequestsFor(dashscope.ServiceGeneration)
+	if err := requests[1].Decode(&answer); err != nil {
+		t.Fatalf("decoding the request: %v", err)
+	}
+	messages := answer.Input.Messages
+	if len(messages) != 4 || len(messages[1].ToolCalls) != 2 || messages[2].ToolCallID != "call_1" ||
+		messages[3].Role != dashscope.RoleTool || messages[3].Name != "get_time" {
+		t.Errorf("sent messages = %+v, want the tool calls and their results", messages)
+	}
+}
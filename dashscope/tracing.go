@@ -0,0 +1,35 @@
+package dashscope
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/ceoifung/go-dashscope/dashscope"
+
+// Span attribute keys.
+const (
+	AttrSystem           = attribute.Key("gen_ai.system")
+	AttrModel            = attribute.Key("gen_ai.request.model")
+	AttrInputTokens      = attribute.Key("gen_ai.usage.input_tokens")
+	AttrOutputTokens     = attribute.Key("gen_ai.usage.output_tokens")
+	AttrService          = attribute.Key("dashscope.service")
+	AttrRequestID        = attribute.Key("dashscope.request_id")
+	AttrTaskID           = attribute.Key("dashscope.task_id")
+	AttrDialogID         = attribute.Key("dashscope.dialog_id")
+	AttrAppID            = attribute.Key("dashscope.app_id")
+	AttrSessionID        = attribute.Key("dashscope.session_id")
+	AttrCharacters       = attribute.Key("dashscope.usage.characters")
+	AttrImageCount       = attribute.Key("dashscope.usage.image_count")
+	AttrTimeToFirstToken = attribute.Key("dashscope.time_to_first_token")
+	AttrErrorCode        = attribute.Key("dashscope.error_code")
+	AttrStatusCode       = attribute.Key("http.response.status_code")
+)
+
+// WithTracerProvider enables OpenTelemetry tracing. Every operation, including
+// streams, async task polling and websocket sessions, is recorded as a span.
+func WithTracerProvider(provider trace.TracerProvider) ClientOption {
+	return func(c *Client) {
+		c.tracer = provider.Tracer(tracerName)
+	}
+}
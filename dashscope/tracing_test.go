@@ -0,0 +1,203 @@
+package dashscope_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/ceoifung/go-dashscope/dashscope"
+	"github.com/ceoifung/go-dashscope/dashscope/dashscopetest"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedClient returns a client of srv recording its spans in the returned
+// exporter.
+func tracedClient(srv *dashscopetest.Server) (*dashscope.Client, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	return srv.Client(dashscope.WithTracerProvider(provider), dashscope.WithRetryPolicy(fastRetry())), exporter
+}
+
+// onlySpan returns the single span recorded by exporter.
+func onlySpan(t *testing.T, exporter *tracetest.InMemoryExporter) tracetest.SpanStub {
+	t.Helper()
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("%d spans recorded, want 1", len(spans))
+	}
+	return spans[0]
+}
+
+func checkAttributes(t *testing.T, span tracetest.SpanStub, want []attribute.KeyValue) {
+	t.Helper()
+	got := attribute.NewSet(span.Attributes...)
+	for _, kv := range want {
+		v, ok := got.Value(kv.Key)
+		if !ok {
+			t.Errorf("span has no %s attribute, want %v", kv.Key, kv.Value.Emit())
+			continue
+		}
+		if v != kv.Value {
+			t.Errorf("%s = %v, want %v", kv.Key, v.Emit(), kv.Value.Emit())
+		}
+	}
+}
+
+func TestTracingHTTP(t *testing.T) {
+	completion := dashscopetest.Response{Body: map[string]interface{}{
+		"request_id": "req-ok",
+		"output":     map[string]interface{}{"text": "Hi", "finish_reason": "stop"},
+		"usage":      map[string]interface{}{"input_tokens": 3, "output_tokens": 2, "total_tokens": 5},
+	}}
+	failure := dashscopetest.Fail(http.StatusBadRequest, dashscope.ErrCodeInvalidParameter, "bad input")
+	failure.Body = dashscopetest.Error{Code: dashscope.ErrCodeInvalidParameter, Message: "bad input", RequestID: "req-bad"}
+
+	tests := []struct {
+		name       string
+		response   dashscopetest.Response
+		wantAttrs  []attribute.KeyValue
+		wantStatus codes.Code
+	}{
+		{
+			name:     "completion",
+			response: completion,
+			wantAttrs: []attribute.KeyValue{
+				dashscope.AttrRequestID.String("req-ok"),
+				dashscope.AttrInputTokens.Int(3),
+				dashscope.AttrOutputTokens.Int(2),
+			},
+			wantStatus: codes.Unset,
+		},
+		{
+			name:     "API error",
+			response: failure,
+			wantAttrs: []attribute.KeyValue{
+				dashscope.AttrRequestID.String("req-bad"),
+				dashscope.AttrStatusCode.Int(http.StatusBadRequest),
+				dashscope.AttrErrorCode.String(dashscope.ErrCodeInvalidParameter),
+			},
+			wantStatus: codes.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := dashscopetest.NewServer()
+			defer srv.Close()
+			srv.Enqueue(dashscope.ServiceGeneration, tt.response)
+
+			c, exporter := tracedClient(srv)
+			_, err := c.Generation().Call(context.Background(), dashscope.GenerationRequest{
+				Model: dashscope.QwenTurbo,
+				Input: dashscope.GenerationInput{Prompt: "Hi"},
+			})
+			if (err != nil) != (tt.wantStatus == codes.Error) {
+				t.Fatalf("Call error = %v", err)
+			}
+
+			span := onlySpan(t, exporter)
+			if span.Name != "dashscope.Generation.Call" {
+				t.Errorf("span name = %q, want %q", span.Name, "dashscope.Generation.Call")
+			}
+			if span.SpanKind != trace.SpanKindClient {
+				t.Errorf("span kind = %v, want %v", span.SpanKind, trace.SpanKindClient)
+			}
+			checkAttributes(t, span, append([]attribute.KeyValue{
+				dashscope.AttrSystem.String("dashscope"),
+				dashscope.AttrService.String(dashscope.ServiceGeneration),
+				dashscope.AttrModel.String(dashscope.QwenTurbo),
+			}, tt.wantAttrs...))
+			if span.Status.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", span.Status.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == codes.Error && len(span.Events) == 0 {
+				t.Error("span has no exception event")
+			}
+		})
+	}
+}
+
+func TestTracingStream(t *testing.T) {
+	srv := dashscopetest.NewServer()
+	defer srv.Close()
+
+	c, exporter := tracedClient(srv)
+	stream, err := c.Generation().Stream(context.Background(), dashscope.GenerationRequest{
+		Model:      dashscope.QwenTurbo,
+		Input:      dashscope.GenerationInput{Prompt: "Hi"},
+		Parameters: &dashscope.GenerationParameters{IncrementalOutput: true},
+	})
+	if err != nil {
+		t.Fatalf("Stream: %v", err)
+	}
+	for stream.Next() {
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+
+	span := onlySpan(t, exporter)
+	if span.Name != "dashscope.Generation.Stream" {
+		t.Errorf("span name = %q, want %q", span.Name, "dashscope.Generation.Stream")
+	}
+	attrs := attribute.NewSet(span.Attributes...)
+	for _, key := range []attribute.Key{dashscope.AttrRequestID, dashscope.AttrOutputTokens, dashscope.AttrTimeToFirstToken} {
+		if !attrs.HasValue(key) {
+			t.Errorf("span has no %s attribute", key)
+		}
+	}
+}
+
+func TestTracingWebsocket(t *testing.T) {
+	tests := []struct {
+		name       string
+		session    dashscopetest.Session
+		wantAttrs  []attribute.KeyValue
+		wantStatus codes.Code
+	}{
+		{
+			name:       "synthesis",
+			wantAttrs:  []attribute.KeyValue{dashscope.AttrCharacters.Int(5)},
+			wantStatus: codes.Unset,
+		},
+		{
+			name:    "task failed",
+			session: dashscopetest.Session{Fail: &dashscopetest.Error{Code: dashscope.ErrCodeInvalidParameter, Message: "bad voice"}},
+			wantAttrs: []attribute.KeyValue{
+				dashscope.AttrErrorCode.String(dashscope.ErrCodeInvalidParameter),
+			},
+			wantStatus: codes.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := dashscopetest.NewServer()
+			defer srv.Close()
+			srv.EnqueueSession(dashscope.ServiceSpeechSynthesis, tt.session)
+
+			c, exporter := tracedClient(srv)
+			_, err := c.SpeechSynthesizer("cosyvoice-v1").Call(context.Background(), "Hello", nil, nil)
+			if (err != nil) != (tt.wantStatus == codes.Error) {
+				t.Fatalf("Call error = %v", err)
+			}
+
+			span := onlySpan(t, exporter)
+			if span.Name != "dashscope.SpeechSynthesizer.Call" {
+				t.Errorf("span name = %q, want %q", span.Name, "dashscope.SpeechSynthesizer.Call")
+			}
+			checkAttributes(t, span, append([]attribute.KeyValue{
+				dashscope.AttrService.String(dashscope.ServiceSpeechSynthesis),
+				dashscope.AttrModel.String("cosyvoice-v1"),
+			}, tt.wantAttrs...))
+			if attrs := attribute.NewSet(span.Attributes...); !attrs.HasValue(dashscope.AttrTaskID) {
+				t.Error("span has no task ID")
+			}
+			if span.Status.Code != tt.wantStatus {
+				t.Errorf("status = %v, want %v", span.Status.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -1,19 +1,16 @@
 package dashscope
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
-	"os"
 )
 
 // Transcription Models
 const (
-	ParaformerV1      = "paraformer-v1"
-	Paraformer8kV1    = "paraformer-8k-v1"
-	ParaformerMtlV1   = "paraformer-mtl-v1"
+	ParaformerV1         = "paraformer-v1"
+	Paraformer8kV1       = "paraformer-8k-v1"
+	ParaformerMtlV1      = "paraformer-mtl-v1"
 	ParaformerRealtimeV1 = "paraformer-realtime-v1" // For recognition, but good to have constants
 )
 
@@ -21,17 +18,12 @@ const (
 type Transcription struct {
 	APIKey string
 	client *http.Client
+	c      *Client
 }
 
 // NewTranscription creates a new Transcription client.
 func NewTranscription(apiKey string) *Transcription {
-	if apiKey == "" {
-		apiKey = os.Getenv("DASHSCOPE_API_KEY")
-	}
-	return &Transcription{
-		APIKey: apiKey,
-		client: &http.Client{},
-	}
+	return NewClient(WithAPIKey(apiKey)).Transcription()
 }
 
 // SetHTTPClient sets a custom HTTP client.
@@ -40,10 +32,10 @@ func (t *Transcription) SetHTTPClient(client *http.Client) {
 }
 
 type TranscriptionRequest struct {
-	Model      string                  `json:"model"`
-	Input      TranscriptionInput      `json:"input"`
+	Model      string                   `json:"model"`
+	Input      TranscriptionInput       `json:"input"`
 	Parameters *TranscriptionParameters `json:"parameters,omitempty"`
-	Resources  []Resource              `json:"resources,omitempty"`
+	Resources  []Resource               `json:"resources,omitempty"`
 }
 
 type TranscriptionInput struct {
@@ -78,16 +70,20 @@ type TranscriptionResponse struct {
 }
 
 // Call performs the transcription request (submit and wait).
-func (t *Transcription) Call(ctx context.Context, req TranscriptionRequest) (*TranscriptionResponse, error) {
+func (t *Transcription) Call(ctx context.Context, req TranscriptionRequest) (_ *TranscriptionResponse, err error) {
+	ctx, op := t.c.startOperation(ctx, "Transcription.Call", CallInfo{Service: ServiceTranscription, Model: req.Model})
+	defer func() { op.end(err) }()
+
 	// 1. Submit async task
 	taskID, err := t.AsyncCall(ctx, req)
 	if err != nil {
 		return nil, err
 	}
+	op.setTaskID(taskID)
 
 	// 2. Wait for task completion
-	taskResp, err := WaitForTask(ctx, t.APIKey, taskID)
-	if err != nil {
+	taskResp, err := t.c.waitForTask(ctx, t.client, t.APIKey, taskID)
+	if taskResp == nil {
 		return nil, err
 	}
 
@@ -101,46 +97,49 @@ func (t *Transcription) Call(ctx context.Context, req TranscriptionRequest) (*Tr
 	resp.Output.TaskID = taskResp.Output.TaskID
 	resp.Output.TaskStatus = taskResp.Output.TaskStatus
 	resp.Output.Results = taskResp.Output.Results
-	
+
 	if taskResp.Usage != nil {
 		usageBytes, _ := json.Marshal(taskResp.Usage)
 		resp.Usage = usageBytes
 	}
 
-	return resp, nil
+	return resp, err
 }
 
 // AsyncCall submits the transcription task and returns the task ID.
-func (t *Transcription) AsyncCall(ctx context.Context, req TranscriptionRequest) (string, error) {
-	url := ASRTranscriptionURL
+func (t *Transcription) AsyncCall(ctx context.Context, req TranscriptionRequest) (_ string, err error) {
+	url := t.c.url(ASRTranscriptionPath)
 
-	jsonData, err := json.Marshal(req)
-	if err != nil {
+	info := CallInfo{Service: ServiceTranscription, Model: req.Model}
+	ctx, op := t.c.startOperation(ctx, "Transcription.AsyncCall", info)
+	defer func() { op.end(err) }()
+
+	ctx, cancel := t.c.withTimeout(ctx)
+	defer cancel()
+
+	// Async submissions count against the request quota only.
+	if err := op.reserve(ctx, 0); err != nil {
 		return "", err
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	httpReq, err := t.c.newRequest(ctx, "POST", url, req, t.APIKey, "")
 	if err != nil {
 		return "", err
 	}
 
-	httpReq.Header.Set("Authorization", "Bearer "+t.APIKey)
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	resp, err := t.client.Do(httpReq)
+	resp, err := t.c.do(t.client, httpReq, info)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 
 	var taskResp TaskResponse
-	if err := json.NewDecoder(resp.Body).Decode(&taskResp); err != nil {
+	err = decodeResponse(resp, &taskResp)
+	op.setRequestID(taskResp.RequestID)
+	if err != nil {
 		return "", err
 	}
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("async call failed: %s (%s)", taskResp.Message, taskResp.Code)
-	}
+	op.setTaskID(taskResp.Output.TaskID)
 
 	return taskResp.Output.TaskID, nil
 }
@@ -5,10 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
 	"os"
 	"strings"
-	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
@@ -61,14 +59,12 @@ type SpeechSynthesizer struct {
 	Model     string
 	APIKey    string
 	Workspace string
+	c         *Client
 }
 
 // NewSpeechSynthesizer creates a new synthesizer.
 func NewSpeechSynthesizer(model, apiKey string) *SpeechSynthesizer {
-	return &SpeechSynthesizer{
-		Model:  model,
-		APIKey: apiKey,
-	}
+	return NewClient(WithAPIKey(apiKey)).SpeechSynthesizer(model)
 }
 
 // SetWorkspace sets the workspace ID.
@@ -76,6 +72,15 @@ func (s *SpeechSynthesizer) SetWorkspace(workspace string) {
 	s.Workspace = workspace
 }
 
+// client returns the Client of s, or the default client if s was built as a
+// struct literal.
+func (s *SpeechSynthesizer) client() *Client {
+	if s.c == nil {
+		return defaultClient()
+	}
+	return s.c
+}
+
 type wsRequestHeader struct {
 	Action    string `json:"action"`
 	TaskID    string `json:"task_id"`
@@ -111,28 +116,27 @@ type wsResponse struct {
 // Call performs the text-to-speech synthesis.
 // parameters can include: format, sample_rate, volume, rate, pitch, etc.
 // Returns the final result containing all audio data and sentences.
-func (s *SpeechSynthesizer) Call(ctx context.Context, text string, callback ResultCallback, parameters map[string]interface{}) (*SpeechSynthesisResult, error) {
+func (s *SpeechSynthesizer) Call(ctx context.Context, text string, callback ResultCallback, parameters map[string]interface{}) (_ *SpeechSynthesisResult, err error) {
 	if s.APIKey == "" {
 		return nil, errors.New("API key is required")
 	}
 
 	// 1. Prepare WebSocket connection
-	header := http.Header{}
-	header.Set("Authorization", "bearer "+s.APIKey)
-	header.Set("User-Agent", "dashscope-go-sdk/0.1.0")
-	if s.Workspace != "" {
-		header.Set("X-DashScope-WorkSpace", s.Workspace)
-	}
-
-	dialer := websocket.Dialer{
-		HandshakeTimeout: 10 * time.Second,
+	taskID := strings.ReplaceAll(uuid.New().String(), "-", "")
+	info := CallInfo{
+		Service: ServiceSpeechSynthesis,
+		Model:   s.Model,
+		TaskID:  taskID,
 	}
+	c := s.client()
+	ctx, op := c.startOperation(ctx, "SpeechSynthesizer.Call", info)
+	defer func() { op.end(err) }()
 
-	conn, _, err := dialer.DialContext(ctx, BaseWebsocketURL, header)
+	conn, err := c.dialSession(ctx, info, s.APIKey, s.Workspace)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to websocket: %w", err)
 	}
-	defer conn.Close()
+	defer conn.close()
 
 	if callback != nil {
 		callback.OnOpen()
@@ -140,7 +144,6 @@ func (s *SpeechSynthesizer) Call(ctx context.Context, text string, callback Resu
 	}
 
 	// 2. Send Start Task Request
-	taskID := strings.ReplaceAll(uuid.New().String(), "-", "")
 	req := wsRequest{
 		Header: wsRequestHeader{
 			Action:    string(ActionRunTask),
@@ -159,7 +162,7 @@ func (s *SpeechSynthesizer) Call(ctx context.Context, text string, callback Resu
 		},
 	}
 
-	if err := conn.WriteJSON(req); err != nil {
+	if err := conn.writeJSON(string(ActionRunTask), req); err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 
@@ -170,7 +173,7 @@ func (s *SpeechSynthesizer) Call(ctx context.Context, text string, callback Resu
 
 	// 3. Receive Loop
 	for {
-		messageType, messageData, err := conn.ReadMessage()
+		messageType, messageData, err := conn.read()
 		if err != nil {
 			if callback != nil {
 				callback.OnError(err)
@@ -180,6 +183,7 @@ func (s *SpeechSynthesizer) Call(ctx context.Context, text string, callback Resu
 
 		if messageType == websocket.BinaryMessage {
 			// Audio data
+			op.markFirstToken()
 			finalResult.AudioData = append(finalResult.AudioData, messageData...)
 
 			if callback != nil {
@@ -207,6 +211,7 @@ func (s *SpeechSynthesizer) Call(ctx context.Context, text string, callback Resu
 						finalResult.Usage = &SpeechSynthesisUsage{
 							Characters: int(chars),
 						}
+						op.setCharacters(int(chars))
 					}
 				}
 
@@ -237,7 +242,11 @@ func (s *SpeechSynthesizer) Call(ctx context.Context, text string, callback Resu
 					}
 				}
 			case EventTaskFailed:
-				err := fmt.Errorf("task failed: %s - %s", resp.Header.Code, resp.Header.Message)
+				err := &APIError{
+					Code:    resp.Header.Code,
+					Message: resp.Header.Message,
+					TaskID:  resp.Header.TaskID,
+				}
 				if callback != nil {
 					callback.OnError(err)
 				}
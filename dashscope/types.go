@@ -25,7 +25,8 @@ const (
 type ActionType string
 
 const (
-	ActionRunTask ActionType = "run-task"
+	ActionRunTask    ActionType = "run-task"
+	ActionFinishTask ActionType = "finish-task"
 )
 
 // AudioFormat constants
@@ -41,10 +42,32 @@ const (
 	RoleSystem    = "system"
 	RoleAssistant = "assistant"
 	RoleBot       = "bot"
+	RoleTool      = "tool"
 )
 
 // Message represents a message in the conversation.
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role             string     `json:"role"`
+	Content          string     `json:"content"`
+	ReasoningContent string     `json:"reasoning_content,omitempty"`
+	ToolCalls        []ToolCall `json:"tool_calls,omitempty"`
+	// Name and ToolCallID identify the call answered by a tool message.
+	Name       string `json:"name,omitempty"`
+	ToolCallID string `json:"tool_call_id,omitempty"`
+}
+
+// ToolCall is a tool invocation requested by the model.
+type ToolCall struct {
+	// Index identifies the call among those of a message. Streamed argument
+	// fragments of the same call share it.
+	Index    int          `json:"index,omitempty"`
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"` // "function"
+	Function FunctionCall `json:"function"`
+}
+
+// FunctionCall is the function and JSON-encoded arguments of a tool call.
+type FunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
 }
@@ -0,0 +1,122 @@
+package dashscope
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// wsConn is a websocket connection to DashScope that runs every message
+// through the client's middleware and serializes writes.
+type wsConn struct {
+	conn   *websocket.Conn
+	c      *Client
+	ctx    context.Context
+	info   CallInfo
+	apiKey string // Redacted from logs
+	mu     sync.Mutex
+}
+
+// dialSession opens a websocket connection for the operation described by info.
+func (c *Client) dialSession(ctx context.Context, info CallInfo, apiKey, workspace string) (*wsConn, error) {
+	conn, err := c.dial(ctx, apiKey, workspace)
+	if err != nil {
+		return nil, err
+	}
+	c.log().InfoContext(ctx, "dashscope: websocket connected", callAttrs(info)...)
+	return &wsConn{
+		conn:   conn,
+		c:      c,
+		ctx:    ctx,
+		info:   info,
+		apiKey: apiKey,
+	}, nil
+}
+
+// writeJSON sends v as an outbound action.
+func (w *wsConn) writeJSON(action string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return w.write(&WebsocketMessage{
+		Direction: Outbound,
+		Type:      websocket.TextMessage,
+		Data:      data,
+		Action:    action,
+	})
+}
+
+// writeBinary sends an audio frame.
+func (w *wsConn) writeBinary(data []byte) error {
+	return w.write(&WebsocketMessage{
+		Direction: Outbound,
+		Type:      websocket.BinaryMessage,
+		Data:      data,
+	})
+}
+
+func (w *wsConn) write(msg *WebsocketMessage) error {
+	h := w.c.websocketHandler(w.info, func(ctx context.Context, msg *WebsocketMessage) error {
+		w.logMessage(msg)
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return w.conn.WriteMessage(msg.Type, msg.Data)
+	})
+	return h(w.ctx, msg)
+}
+
+// read receives the next inbound message after it has passed the middleware.
+func (w *wsConn) read() (int, []byte, error) {
+	messageType, data, err := w.conn.ReadMessage()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	msg := &WebsocketMessage{
+		Direction: Inbound,
+		Type:      messageType,
+		Data:      data,
+	}
+	if messageType == websocket.TextMessage {
+		msg.Event = inboundEvent(data)
+	}
+	w.logMessage(msg)
+
+	h := w.c.websocketHandler(w.info, func(ctx context.Context, msg *WebsocketMessage) error {
+		return nil
+	})
+	if err := h(w.ctx, msg); err != nil {
+		return 0, nil, err
+	}
+	return msg.Type, msg.Data, nil
+}
+
+func (w *wsConn) close() error {
+	w.c.log().DebugContext(w.ctx, "dashscope: websocket closed", callAttrs(w.info)...)
+	return w.conn.Close()
+}
+
+// inboundEvent extracts the event name of a task message, or the directive
+// of a dialog message.
+func inboundEvent(data []byte) string {
+	var msg struct {
+		Header struct {
+			Event string `json:"event"`
+		} `json:"header"`
+		Payload struct {
+			Output struct {
+				Directive string `json:"directive"`
+			} `json:"output"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return ""
+	}
+	if msg.Header.Event != "" {
+		return msg.Header.Event
+	}
+	return msg.Payload.Output.Directive
+}
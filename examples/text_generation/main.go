@@ -47,18 +47,19 @@ func main() {
 		},
 	}
 
-	ch, err := gen.CallStream(context.Background(), reqStream)
+	stream, err := gen.Stream(context.Background(), reqStream)
 	if err != nil {
 		fmt.Printf("Stream call failed: %v\n", err)
 		return
 	}
+	defer stream.Close()
 
-	for resp := range ch {
-		if resp.StatusCode != 0 && resp.StatusCode != 200 {
-			fmt.Printf("Error: %s\n", resp.Message)
-			break
-		}
-		fmt.Printf("%s", resp.Output.Text)
+	for stream.Next() {
+		fmt.Printf("%s", stream.Current().Output.Text)
+	}
+	if err := stream.Err(); err != nil {
+		fmt.Printf("\nError: %v\n", err)
+		return
 	}
 	fmt.Println("\nStream finished")
 }